@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// newArtifactStore returns the store for --artifact-store, a local directory
+// or an s3://bucket/prefix URL
+func newArtifactStore(dest string) (apkfile.ArtifactStore, error) {
+	if !strings.HasPrefix(dest, "s3://") {
+		return apkfile.DirStore(dest), nil
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%s has no bucket", dest)
+	}
+	return newS3Store(u.Host, strings.Trim(u.Path, "/")), nil
+}
+
+// s3Store is an ArtifactStore uploading to an S3 bucket, or any storage with
+// S3's API, with the credentials of the standard AWS environment variables
+type s3Store struct {
+	bucket   string
+	prefix   string
+	endpoint string
+	region   string
+	key      string
+	secret   string
+	token    string
+	client   *http.Client
+	now      func() time.Time
+}
+
+// newS3Store stores artifacts in bucket under prefix, AWS_ENDPOINT_URL points
+// it at S3 compatible storage such as MinIO
+func newS3Store(bucket, prefix string) *s3Store {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	return &s3Store{
+		bucket:   bucket,
+		prefix:   prefix,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		region:   region,
+		key:      os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret:   os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:    os.Getenv("AWS_SESSION_TOKEN"),
+		client:   http.DefaultClient,
+		now:      time.Now,
+	}
+}
+
+func (s *s3Store) Put(ctx context.Context, sha256sum, name string, r io.Reader) (string, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	key := path.Join(s.prefix, sha256sum, name)
+
+	req, err := http.NewRequest("PUT", s.endpoint+"/"+s.bucket+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	s.sign(req, body)
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("uploading %s to s3 failed: %s %s", key, resp.Status, msg)
+	}
+	return "s3://" + s.bucket + "/" + key, nil
+}
+
+// sign adds an AWS Signature Version 4 to req
+func (s *s3Store) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payload := sha256.Sum256(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+
+	// the signed headers, in the sorted order the canonical request lists them
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if s.token != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	canonicalSum := sha256.Sum256([]byte(canonical))
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalSum[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secret), date)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.key+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
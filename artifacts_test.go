@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestS3StoreSign tests the Signature Version 4 of an upload.
+func TestS3StoreSign(t *testing.T) {
+	s := &s3Store{region: "us-east-1", key: "AKID", secret: "secret", now: func() time.Time {
+		return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	}}
+	req, _ := http.NewRequest("PUT", "https://s3.us-east-1.amazonaws.com/bucket/samples/abc/decompiled.tar.gz", nil)
+	s.sign(req, []byte("hello"))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKID/20240102/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, " +
+		"Signature=abcdbe17b4f3967114643bf9fcd77b6badc4ca4cdd71c9accff597e4500f5b6f"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+// TestS3StorePut tests uploading an artifact.
+func TestS3StorePut(t *testing.T) {
+	var path string
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	s := newS3Store("bucket", "samples")
+	s.endpoint = ts.URL
+	location, err := s.Put(context.Background(), "abc", "decompiled.tar.gz", bytes.NewReader([]byte("sources")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location != "s3://bucket/samples/abc/decompiled.tar.gz" || path != "/bucket/samples/abc/decompiled.tar.gz" || string(body) != "sources" {
+		t.Errorf("unexpected upload of %q to %s, stored at %s", body, path, location)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// jobState is where a job is in its life cycle in the bolt queue
+type jobState string
+
+const (
+	jobQueued  jobState = "queued"
+	jobRunning jobState = "running"
+	jobDone    jobState = "done"
+	// jobDead jobs failed maxAttempts times and won't be retried
+	jobDead jobState = "dead"
+)
+
+var (
+	jobsBucket = []byte("jobs")
+	// readyBucket indexes the queued jobs by priority, highest first, then
+	// by the time they are due and by sequence, so claiming one is a cursor
+	// seek per priority
+	readyBucket = []byte("ready")
+	// finishedBucket indexes the done and dead jobs by when they finished,
+	// then by sequence, so pruning them is a cursor seek
+	finishedBucket = []byte("finished")
+)
+
+// pruneInterval is how often the finished jobs older than the retention are
+// removed
+const pruneInterval = time.Minute
+
+// jobRecord is a scan job as persisted in the bolt queue
+type jobRecord struct {
+	Key       string          `json:"key"`
+	Job       scanJob         `json:"job"`
+	State     jobState        `json:"state"`
+	Attempts  int             `json:"attempts"`
+	NotBefore time.Time       `json:"not_before,omitempty"`
+	LastError string          `json:"last_error,omitempty"`
+	Created   time.Time       `json:"created"`
+	Updated   time.Time       `json:"updated"`
+	Result    json.RawMessage `json:"result,omitempty"`
+}
+
+// boltQueue is a persistent local job queue, queued and in-flight jobs
+// survive restarts and failed jobs are retried with exponential backoff
+type boltQueue struct {
+	db          *bolt.DB
+	maxAttempts int
+	backoff     time.Duration
+	poll        time.Duration
+	// retention is how long done and dead jobs, and their results, are
+	// kept, zero keeps them forever
+	retention time.Duration
+	pruneMu   sync.Mutex
+	lastPrune time.Time
+	// wake is signalled when a job is enqueued
+	wake chan struct{}
+}
+
+// openBoltQueue opens (or creates) the queue database at path and puts any
+// job that was running when the process last stopped back in the queue.
+// Finished jobs are removed once they are older than retention
+func openBoltQueue(path string, maxAttempts int, backoff, retention time.Duration) (*boltQueue, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	q := &boltQueue{
+		db:          db,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		poll:        time.Second,
+		retention:   retention,
+		wake:        make(chan struct{}, 1),
+	}
+
+	// the indexes are rebuilt, databases of earlier releases have none
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(jobsBucket)
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{readyBucket, finishedBucket} {
+			if tx.Bucket(name) != nil {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var rec jobRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			switch rec.State {
+			case jobRunning:
+				rec.State = jobQueued
+				if err := putRecord(b, k, rec); err != nil {
+					return err
+				}
+				return putReady(tx, k, rec)
+			case jobQueued:
+				return putReady(tx, k, rec)
+			default:
+				return tx.Bucket(finishedBucket).Put(indexKey(uint64(rec.Updated.UnixNano()), k), nil)
+			}
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// indexKey is the key of a job in an index, the order it is sorted in and
+// the job's own key
+func indexKey(order uint64, key []byte) []byte {
+	return append(itob(order), key...)
+}
+
+// readyOrder sorts higher priorities first
+func readyOrder(priority int) uint64 {
+	// flipping the sign bit sorts signed priorities as unsigned ones
+	return ^(uint64(int64(priority)) ^ 1<<63)
+}
+
+// putReady indexes the queued job rec as ready once it is due, new jobs are
+// due right away
+func putReady(tx *bolt.Tx, key []byte, rec jobRecord) error {
+	var due int64
+	if !rec.NotBefore.IsZero() {
+		due = rec.NotBefore.UnixNano()
+	}
+	return tx.Bucket(readyBucket).Put(indexKey(readyOrder(rec.Job.Priority), indexKey(uint64(due), key)), nil)
+}
+
+func putRecord(b *bolt.Bucket, key []byte, rec jobRecord) error {
+	rec.Updated = time.Now().UTC()
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// Enqueue persists a new job and returns its queue key
+func (q *boltQueue) Enqueue(job scanJob) (string, error) {
+	var key string
+
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key = strconv.FormatUint(seq, 10)
+		now := time.Now().UTC()
+		rec := jobRecord{
+			Key:     key,
+			Job:     job,
+			State:   jobQueued,
+			Created: now,
+		}
+		if err := putRecord(b, itob(seq), rec); err != nil {
+			return err
+		}
+		return putReady(tx, itob(seq), rec)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return key, nil
+}
+
+// Get returns the job stored under key
+func (q *boltQueue) Get(key string) (jobRecord, error) {
+	var rec jobRecord
+
+	seq, err := strconv.ParseUint(key, 10, 64)
+	if err != nil {
+		return rec, fmt.Errorf("invalid job key %q", key)
+	}
+
+	err = q.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(jobsBucket).Get(itob(seq))
+		if v == nil {
+			return os.ErrNotExist
+		}
+		return json.Unmarshal(v, &rec)
+	})
+
+	return rec, err
+}
+
+// claim marks the job that is due with the highest priority, the oldest of
+// them, as running and returns it
+func (q *boltQueue) claim() (*jobRecord, error) {
+	var claimed *jobRecord
+
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		ready := tx.Bucket(readyBucket)
+		now := uint64(time.Now().UnixNano())
+		var key []byte
+		c := ready.Cursor()
+		// the first key of a priority is its job due first, ties going to the
+		// oldest job. When even that one is backing off after a failure the
+		// next priority is sought
+		for k, _ := c.First(); k != nil; {
+			if binary.BigEndian.Uint64(k[8:16]) <= now {
+				key = k
+				break
+			}
+			order := binary.BigEndian.Uint64(k[:8])
+			if order == math.MaxUint64 {
+				break
+			}
+			k, _ = c.Seek(itob(order + 1))
+		}
+		if key == nil {
+			return nil
+		}
+		if err := ready.Delete(key); err != nil {
+			return err
+		}
+
+		b := tx.Bucket(jobsBucket)
+		v := b.Get(key[16:])
+		if v == nil {
+			return nil
+		}
+		var rec jobRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return err
+		}
+		rec.State = jobRunning
+		rec.Attempts++
+		claimed = &rec
+		return putRecord(b, key[16:], rec)
+	})
+
+	return claimed, err
+}
+
+// prune removes the jobs that finished before the retention
+func (q *boltQueue) prune(now time.Time) error {
+	if q.retention <= 0 {
+		return nil
+	}
+	cutoff := uint64(now.Add(-q.retention).UnixNano())
+	return q.db.Update(func(tx *bolt.Tx) error {
+		finished := tx.Bucket(finishedBucket)
+		b := tx.Bucket(jobsBucket)
+		c := finished.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) < cutoff; k, _ = c.First() {
+			if err := b.Delete(k[8:]); err != nil {
+				return err
+			}
+			if err := finished.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// prunePeriodically prunes the finished jobs every pruneInterval, the workers
+// polling the queue take turns
+func (q *boltQueue) prunePeriodically() error {
+	q.pruneMu.Lock()
+	defer q.pruneMu.Unlock()
+	now := time.Now()
+	if now.Sub(q.lastPrune) < pruneInterval {
+		return nil
+	}
+	q.lastPrune = now
+	return q.prune(now)
+}
+
+func (q *boltQueue) Next(ctx context.Context) (scanJob, error) {
+	for {
+		if err := q.prunePeriodically(); err != nil {
+			return scanJob{}, err
+		}
+		rec, err := q.claim()
+		if err != nil {
+			return scanJob{}, err
+		}
+		if rec != nil {
+			job := rec.Job
+			job.handle = rec.Key
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return scanJob{}, ctx.Err()
+		case <-q.wake:
+		case <-time.After(q.poll):
+		}
+	}
+}
+
+// update applies fn to the record behind job
+func (q *boltQueue) update(job scanJob, fn func(rec *jobRecord)) error {
+	seq, err := strconv.ParseUint(job.handle.(string), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	return q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		v := b.Get(itob(seq))
+		if v == nil {
+			return os.ErrNotExist
+		}
+		var rec jobRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return err
+		}
+		fn(&rec)
+		switch rec.State {
+		case jobQueued:
+			if err := putReady(tx, itob(seq), rec); err != nil {
+				return err
+			}
+		case jobDone, jobDead:
+			if err := tx.Bucket(finishedBucket).Put(indexKey(uint64(time.Now().UnixNano()), itob(seq)), nil); err != nil {
+				return err
+			}
+		}
+		if rec.Job.Cleanup && (rec.State == jobDone || rec.State == jobDead) {
+			// the queue owns uploaded samples once they are enqueued, jobs
+			// queued by earlier releases have no scan directory
+			if rec.Job.Dir != "" {
+				os.RemoveAll(rec.Job.Dir)
+			} else {
+				os.Remove(rec.Job.Path)
+				if rec.Job.Expansion != "" {
+					os.Remove(rec.Job.Expansion)
+				}
+			}
+		}
+		return putRecord(b, itob(seq), rec)
+	})
+}
+
+func (q *boltQueue) Ack(job scanJob) error {
+	return q.update(job, func(rec *jobRecord) {
+		rec.State = jobDone
+		rec.LastError = ""
+	})
+}
+
+// Complete marks job as done and stores its results
+func (q *boltQueue) Complete(job scanJob, result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return q.update(job, func(rec *jobRecord) {
+		rec.State = jobDone
+		rec.LastError = ""
+		rec.Result = data
+	})
+}
+
+// Fail puts job back in the queue after an exponential backoff, or marks it
+// dead once it has been attempted maxAttempts times
+func (q *boltQueue) Fail(job scanJob, jobErr error) error {
+	return q.update(job, func(rec *jobRecord) {
+		rec.LastError = jobErr.Error()
+		if rec.Attempts >= q.maxAttempts {
+			rec.State = jobDead
+			return
+		}
+		delay := q.backoff << uint(rec.Attempts-1)
+		if delay > time.Hour || delay <= 0 {
+			delay = time.Hour
+		}
+		rec.State = jobQueued
+		rec.NotBefore = time.Now().Add(delay)
+	})
+}
+
+func (q *boltQueue) Close() error { return q.db.Close() }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBoltQueueRecovery tests that running jobs are re-queued when the queue is re-opened.
+func TestBoltQueueRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.db")
+
+	q, err := openBoltQueue(path, 3, time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := q.Enqueue(scanJob{Path: "sample"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.Next(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// simulate a crash with the job in-flight
+	q.Close()
+
+	q, err = openBoltQueue(path, 3, time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	rec, err := q.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.State != jobQueued {
+		t.Errorf("job should be queued after a restart, got %s", rec.State)
+	}
+}
+
+// TestBoltQueueDeadLetter tests that a job is marked dead after max attempts.
+func TestBoltQueueDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := openBoltQueue(filepath.Join(dir, "queue.db"), 2, time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.poll = time.Millisecond
+
+	key, err := q.Enqueue(scanJob{Path: "sample"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		job, err := q.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = q.Fail(job, errors.New("text file busy")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec, err := q.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.State != jobDead || rec.Attempts != 2 {
+		t.Errorf("job should be dead after 2 attempts, got %s after %d", rec.State, rec.Attempts)
+	}
+}
+
+// TestBoltQueuePriority tests that higher priority jobs are claimed first, the oldest of them on ties.
+func TestBoltQueuePriority(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := openBoltQueue(filepath.Join(dir, "queue.db"), 2, time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	for _, job := range []scanJob{
+		{Path: "corpus-1", Priority: -10},
+		{Path: "default"},
+		{Path: "analyst-1", Priority: 10},
+		{Path: "corpus-2", Priority: -10},
+		{Path: "analyst-2", Priority: 10},
+	} {
+		if _, err := q.Enqueue(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{"analyst-1", "analyst-2", "default", "corpus-1", "corpus-2"} {
+		job, err := q.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Path != want {
+			t.Errorf("expected %s, got %s", want, job.Path)
+		}
+	}
+}
+
+// TestBoltQueueBackoff tests that jobs backing off don't hold up the ready jobs of lower priorities.
+func TestBoltQueueBackoff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := openBoltQueue(filepath.Join(dir, "queue.db"), 3, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if _, err := q.Enqueue(scanJob{Path: "analyst", Priority: 10}); err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = q.Fail(job, errors.New("text file busy")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(scanJob{Path: "corpus", Priority: -10}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := q.claim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || rec.Job.Path != "corpus" {
+		t.Fatalf("expected the corpus job, got %+v", rec)
+	}
+	if rec, err = q.claim(); err != nil || rec != nil {
+		t.Errorf("expected the analyst job to back off, got %+v, %v", rec, err)
+	}
+}
+
+// TestBoltQueuePrune tests that finished jobs are removed once older than the retention, and queued ones kept.
+func TestBoltQueuePrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.db")
+
+	q, err := openBoltQueue(path, 2, time.Millisecond, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := q.Enqueue(scanJob{Path: "done", Priority: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, err := q.Enqueue(scanJob{Path: "queued"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Complete(job, map[string]string{"verdict": "malicious"}); err != nil {
+		t.Fatal(err)
+	}
+	// the indexes are rebuilt when the queue is re-opened
+	q.Close()
+	if q, err = openBoltQueue(path, 2, time.Millisecond, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if err := q.prune(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(done); err != nil {
+		t.Errorf("expected a recent job to be kept, got %v", err)
+	}
+	if err := q.prune(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(done); !os.IsNotExist(err) {
+		t.Errorf("expected the finished job to be pruned, got %v", err)
+	}
+	if rec, err := q.Get(queued); err != nil || rec.State != jobQueued {
+		t.Errorf("expected the queued job to be kept, got %+v, %v", rec, err)
+	}
+	if job, err = q.Next(context.Background()); err != nil || job.Path != "queued" {
+		t.Errorf("expected the queued job to be claimed, got %+v, %v", job, err)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/go-redis/redis"
+	"github.com/urfave/cli"
+)
+
+// resultCache stores completed scans keyed by the file's SHA256 and the
+// plugin version that produced them
+type resultCache interface {
+	Get(key string) (apkfile.FileInfo, bool)
+	Set(key string, fileInfo apkfile.FileInfo)
+}
+
+// cache is consulted before every scan, nil when caching is disabled
+var cache resultCache
+
+// newCache builds the result cache from the global cache flags
+func newCache(c *cli.Context) (resultCache, error) {
+	if c.GlobalBool("no-cache") {
+		return nil, nil
+	}
+
+	local := newLRUCache(c.GlobalInt("cache-size"), c.GlobalDuration("cache-ttl"))
+	if c.GlobalString("cache-redis") == "" {
+		return local, nil
+	}
+
+	remote, err := newRedisCache(c.GlobalString("cache-redis"), c.GlobalDuration("cache-ttl"))
+	if err != nil {
+		return nil, err
+	}
+
+	return tieredCache{local: local, remote: remote}, nil
+}
+
+// cacheKey is the key a scan of a file with sha256 by the scanner with digest
+// is cached under, so reloading tools, rules or feeds misses the scans of
+// the scanner before
+func cacheKey(digest, sha256 string) string {
+	return name + ":" + Version + ":" + digest + ":" + sha256
+}
+
+// lruCache is a size bounded in-memory cache whose entries expire after ttl
+type lruCache struct {
+	sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	fileInfo apkfile.FileInfo
+	expires  time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) Get(key string) (apkfile.FileInfo, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return apkfile.FileInfo{}, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return apkfile.FileInfo{}, false
+	}
+	c.order.MoveToFront(el)
+
+	return entry.fileInfo, true
+}
+
+func (c *lruCache) Set(key string, fileInfo apkfile.FileInfo) {
+	c.Lock()
+	defer c.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = &lruEntry{key, fileInfo, time.Now().Add(c.ttl)}
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key, fileInfo, time.Now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// redisCache shares cached scans between instances through Redis
+type redisCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func newRedisCache(rawurl string, ttl time.Duration) (*redisCache, error) {
+	opts, err := redis.ParseURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return &redisCache{client: redis.NewClient(opts), ttl: ttl}, nil
+}
+
+func (c *redisCache) Get(key string) (apkfile.FileInfo, bool) {
+	var fileInfo apkfile.FileInfo
+
+	data, err := c.client.Get(key).Bytes()
+	if err != nil {
+		return fileInfo, false
+	}
+	if err = json.Unmarshal(data, &fileInfo); err != nil {
+		return fileInfo, false
+	}
+
+	return fileInfo, true
+}
+
+func (c *redisCache) Set(key string, fileInfo apkfile.FileInfo) {
+	data, err := json.Marshal(fileInfo)
+	if err != nil {
+		return
+	}
+	c.client.Set(key, data, c.ttl)
+}
+
+// tieredCache checks the in-memory cache before Redis
+type tieredCache struct {
+	local  resultCache
+	remote resultCache
+}
+
+func (c tieredCache) Get(key string) (apkfile.FileInfo, bool) {
+	if fileInfo, ok := c.local.Get(key); ok {
+		return fileInfo, true
+	}
+	fileInfo, ok := c.remote.Get(key)
+	if ok {
+		c.local.Set(key, fileInfo)
+	}
+	return fileInfo, ok
+}
+
+func (c tieredCache) Set(key string, fileInfo apkfile.FileInfo) {
+	c.local.Set(key, fileInfo)
+	c.remote.Set(key, fileInfo)
+}
+
+// cachedScan returns the cached results for a file with hashes, or scans it with
+// rc's scanner and caches the results. Scans with an expansion file aren't cached,
+// the same APK is scanned alone too
+func cachedScan(ctx context.Context, rc *runtimeConfig, path string, hashes apkfile.FileHashes, obb *apkfile.ExpansionFile) (apkfile.FileInfo, error) {
+	scanner := rc.scanner
+	if obb != nil {
+		fileInfo, err := scanner.ScanWithExpansion(ctx, path, hashes, *obb)
+		if err == nil {
+			observeTimings(fileInfo.Timings)
+		}
+		return fileInfo, err
+	}
+
+	key := cacheKey(rc.scannerDigest(), hashes.SHA256)
+	if cache != nil {
+		if fileInfo, ok := cache.Get(key); ok {
+			log.Debug("using cached results for ", hashes.SHA256)
+			return fileInfo, nil
+		}
+	}
+
+	fileInfo, err := scanner.ScanHashed(ctx, path, hashes)
+	if err != nil {
+		return fileInfo, err
+	}
+	observeTimings(fileInfo.Timings)
+
+	// partial results are rescanned next time
+	if cache != nil && !fileInfo.Partial() {
+		cache.Set(key, fileInfo)
+	}
+
+	return fileInfo, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// TestLRUCache tests eviction and expiry of the in-memory result cache.
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2, time.Hour)
+
+	c.Set("a", apkfile.FileInfo{SSDeep: "a"})
+	c.Set("b", apkfile.FileInfo{SSDeep: "b"})
+	c.Get("a")
+	c.Set("c", apkfile.FileInfo{SSDeep: "c"})
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry should have been evicted")
+	}
+	if fileInfo, ok := c.Get("a"); !ok || fileInfo.SSDeep != "a" {
+		t.Error("recently used entry should still be cached")
+	}
+
+	c.ttl = -time.Second
+	c.Set("d", apkfile.FileInfo{SSDeep: "d"})
+	if _, ok := c.Get("d"); ok {
+		t.Error("expired entry should not be returned")
+	}
+}
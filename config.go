@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/urfave/cli"
+)
+
+// fileConfig is the --config file, it is re-read on every reload
+type fileConfig struct {
+	// Elasticsearch overrides --elasitcsearch
+	Elasticsearch string `json:"elasticsearch"`
+	// Tools maps external tools (trid, exiftool, java, ...) to the binaries to run
+	Tools map[string]string `json:"tools"`
+	// APIKeys are the web service's API keys and the defaults of their submissions
+	APIKeys map[string]apiKey `json:"api_keys"`
+}
+
+// runtimeConfig is everything a scan uses that can be swapped by a reload
+type runtimeConfig struct {
+	scanner *apkfile.Scanner
+	elastic string
+	apiKeys map[string]apiKey
+	// inFlight counts the scans still using this config
+	inFlight sync.WaitGroup
+
+	digestOnce sync.Once
+	digest     string
+}
+
+// scannerDigest returns the digest of the scanner's plugin info, the tools'
+// versions are detected on first use
+func (rc *runtimeConfig) scannerDigest() string {
+	rc.digestOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		rc.digest = newPluginInfo(ctx, rc.scanner).digest()
+	})
+	return rc.digest
+}
+
+var (
+	configMu sync.Mutex
+	current  *runtimeConfig
+	// rebuild loads a fresh runtime config the same way the current one was
+	rebuild func() (*runtimeConfig, error)
+)
+
+// readConfigFile parses the --config file, an empty path is an empty config
+func readConfigFile(path string) (fileConfig, error) {
+	var cfg fileConfig
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	err = json.Unmarshal(data, &cfg)
+	return cfg, err
+}
+
+// setupConfig loads the runtime config from the flags and config files and
+// makes reloadConfig rebuild it the same way
+func setupConfig(c *cli.Context, opts ...apkfile.Option) error {
+	var err error
+	if cache, err = newCache(c); err != nil {
+		return err
+	}
+
+	rebuild = func() (*runtimeConfig, error) {
+		file, err := readConfigFile(c.GlobalString("config"))
+		if err != nil {
+			return nil, err
+		}
+
+		rc := &runtimeConfig{elastic: c.GlobalString("elasitcsearch"), apiKeys: file.APIKeys}
+		if file.Elasticsearch != "" {
+			rc.elastic = file.Elasticsearch
+		}
+
+		scannerOpts := opts
+		for name, path := range file.Tools {
+			scannerOpts = append(scannerOpts, apkfile.WithToolPath(name, path))
+		}
+		if c.GlobalBool("signer-reputation") {
+			scannerOpts = append(scannerOpts, apkfile.WithReputationStore(newElasticReputation(rc.elastic)))
+		}
+		if c.GlobalBool("update-analysis") {
+			scannerOpts = append(scannerOpts, apkfile.WithScanHistory(newElasticReputation(rc.elastic)))
+		}
+		if rc.scanner, err = newScanner(c, scannerOpts...); err != nil {
+			return nil, err
+		}
+		return rc, nil
+	}
+
+	return reloadConfig()
+}
+
+// reloadConfig swaps in a freshly loaded runtime config, scans in flight
+// finish with the old one which is closed once they are done
+func reloadConfig() error {
+	rc, err := rebuild()
+	if err != nil {
+		return err
+	}
+
+	configMu.Lock()
+	old := current
+	current = rc
+	configMu.Unlock()
+
+	if old != nil {
+		go func() {
+			old.inFlight.Wait()
+			old.scanner.Close()
+		}()
+	}
+	return nil
+}
+
+// acquireConfig returns the current runtime config, release must be called
+// once the scan using it is done
+func acquireConfig() (rc *runtimeConfig, release func()) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	current.inFlight.Add(1)
+	return current, current.inFlight.Done
+}
+
+// closeConfig waits for the scans using the current config and releases it
+func closeConfig() {
+	configMu.Lock()
+	rc := current
+	current = nil
+	configMu.Unlock()
+
+	if rc != nil {
+		rc.inFlight.Wait()
+		rc.scanner.Close()
+	}
+}
+
+// reloadOnSIGHUP reloads the runtime config on every SIGHUP
+func reloadOnSIGHUP() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		for range sigs {
+			if err := reloadConfig(); err != nil {
+				log.WithError(err).Error("reload failed, keeping the current configuration")
+				continue
+			}
+			log.Info("configuration reloaded")
+		}
+	}()
+}
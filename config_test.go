@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// TestReadConfigFile tests the readConfigFile function.
+func TestReadConfigFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"elasticsearch": "elastic:9200", "tools": {"trid": "/opt/trid/trid"}}`)
+	f.Close()
+
+	cfg, err := readConfigFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Elasticsearch != "elastic:9200" || cfg.Tools["trid"] != "/opt/trid/trid" {
+		t.Errorf("unexpected config: %#v", cfg)
+	}
+
+	if cfg, err = readConfigFile(""); err != nil || cfg.Tools != nil {
+		t.Errorf("an empty path should be an empty config, got %#v, %v", cfg, err)
+	}
+}
+
+// TestReloadConfig tests that scans in flight keep the config they started with.
+func TestReloadConfig(t *testing.T) {
+	generation := 0
+	rebuild = func() (*runtimeConfig, error) {
+		generation++
+		s, err := apkfile.NewScanner()
+		if err != nil {
+			return nil, err
+		}
+		return &runtimeConfig{scanner: s, elastic: string(rune('0' + generation))}, nil
+	}
+	if err := reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	defer closeConfig()
+
+	first, release := acquireConfig()
+	if err := reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	second, releaseSecond := acquireConfig()
+	defer releaseSecond()
+
+	if first.elastic != "1" || second.elastic != "2" {
+		t.Errorf("expected configs 1 and 2, got %s and %s", first.elastic, second.elastic)
+	}
+	release()
+}
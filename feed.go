@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/urfave/cli"
+)
+
+// feed is a list the scanner is configured with, a local file or a URL whose
+// latest download is cached on disk, e.g. the --malware-feed
+type feed struct {
+	// name is what the feed is called in logs and errors
+	name    string
+	url     string
+	path    string
+	refresh time.Duration
+	client  *http.Client
+	// validate checks a download before it replaces the cached copy
+	validate func(path string) error
+}
+
+// newFeed returns the feed set with flag, nil when it isn't set. Downloads
+// are cached at cache
+func newFeed(c *cli.Context, flag, cache string, refresh time.Duration, validate func(string) error) *feed {
+	location := c.GlobalString(flag)
+	if location == "" {
+		return nil
+	}
+	f := &feed{name: strings.Replace(flag, "-", " ", -1), path: location, validate: validate}
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return f
+	}
+
+	f.url, f.path, f.refresh = location, cache, refresh
+	f.client = &http.Client{Timeout: time.Minute}
+	return f
+}
+
+// newMalwareFeed returns the --malware-feed, nil when it isn't set
+func newMalwareFeed(c *cli.Context) *feed {
+	cache := c.GlobalString("malware-feed-cache")
+	if cache == "" {
+		cache = filepath.Join(os.TempDir(), name+"-malware-feed.json")
+	}
+	return newFeed(c, "malware-feed", cache, c.GlobalDuration("malware-feed-refresh"), func(path string) error {
+		_, err := apkfile.LoadMalwareFeed(path)
+		return err
+	})
+}
+
+// newHashListFeed returns the --hash-allowlist or --hash-denylist, nil when it isn't set
+func newHashListFeed(c *cli.Context, flag string) *feed {
+	cache := filepath.Join(os.TempDir(), name+"-"+flag+".txt")
+	return newFeed(c, flag, cache, c.GlobalDuration("hash-list-refresh"), func(path string) error {
+		_, err := apkfile.LoadHashList(path)
+		return err
+	})
+}
+
+// feeds returns every feed that is set
+func feeds(c *cli.Context) []*feed {
+	var all []*feed
+	for _, f := range []*feed{newMalwareFeed(c), newHashListFeed(c, "hash-allowlist"), newHashListFeed(c, "hash-denylist")} {
+		if f != nil {
+			all = append(all, f)
+		}
+	}
+	return all
+}
+
+// load returns the path to read the feed from, downloading it first when
+// there is no cached copy or it is older than the refresh interval. A stale
+// copy is used when the download fails
+func (f *feed) load() (string, error) {
+	if f.url == "" {
+		return f.path, nil
+	}
+	info, err := os.Stat(f.path)
+	switch {
+	case os.IsNotExist(err):
+		if _, err := f.update(); err != nil {
+			return "", err
+		}
+	case err != nil:
+		return "", err
+	case time.Since(info.ModTime()) > f.refresh:
+		if _, err := f.update(); err != nil {
+			log.WithError(err).Warn(f.name+" update failed, using the copy from ", info.ModTime().Format(time.RFC3339))
+		}
+	}
+	return f.path, nil
+}
+
+// update downloads the feed unless it is unchanged since the cached copy,
+// reporting whether it changed
+func (f *feed) update() (bool, error) {
+	req, err := http.NewRequest("GET", f.url, nil)
+	if err != nil {
+		return false, err
+	}
+	if info, err := os.Stat(f.path); err == nil {
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		now := time.Now()
+		return false, os.Chtimes(f.path, now, now)
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("downloading the %s failed: %s", f.name, resp.Status)
+	}
+
+	// only a feed that parses replaces the cached one
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), "."+filepath.Base(f.path))
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, resp.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := f.validate(tmp.Name()); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), f.path)
+}
+
+// refreshPeriodically updates a downloaded feed every refresh interval and
+// reloads the configuration when it changed
+func (f *feed) refreshPeriodically() {
+	if f.url == "" || f.refresh <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(f.refresh) {
+			changed, err := f.update()
+			if err != nil {
+				log.WithError(err).Warn(f.name + " update failed")
+				continue
+			}
+			if !changed {
+				continue
+			}
+			if err := reloadConfig(); err != nil {
+				log.WithError(err).Error("reload failed, keeping the current configuration")
+				continue
+			}
+			log.Info(f.name + " updated")
+		}
+	}()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// TestMalwareFeedUpdate tests downloading and caching the malware feed.
+func TestMalwareFeedUpdate(t *testing.T) {
+	body := `{"packages": [{"package": "com.flash.update", "family": "FluBot"}]}`
+	modified := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	validate := func(path string) error {
+		_, err := apkfile.LoadMalwareFeed(path)
+		return err
+	}
+	f := &feed{name: "malware feed", url: ts.URL, path: filepath.Join(dir, "feed.json"), refresh: time.Hour, client: http.DefaultClient, validate: validate}
+
+	path, err := f.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	packages, err := apkfile.LoadMalwareFeed(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 1 || packages[0].Family != "FluBot" {
+		t.Errorf("unexpected feed %v", packages)
+	}
+
+	if changed, err := f.update(); err != nil || changed {
+		t.Errorf("expected the feed unchanged, got %v, %v", changed, err)
+	}
+
+	modified = time.Now().Add(time.Hour)
+	body = `not json`
+	if _, err := f.update(); err == nil {
+		t.Error("expected an error for a malformed feed")
+	}
+	if path, err := f.load(); err != nil {
+		t.Fatal(err)
+	} else if packages, err := apkfile.LoadMalwareFeed(path); err != nil || len(packages) != 1 {
+		t.Errorf("expected the cached feed to be kept, got %v, %v", packages, err)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+// graphqlSchema is what /graphql serves, reports as they are stored in
+// elasticsearch with the fields analysts filter on
+const graphqlSchema = `
+schema {
+	query: Query
+}
+
+type Query {
+	# reports are the stored reports matching every filter that is given,
+	# the permission filter needs reports with update_analysis. tag matches
+	# the policy's and the submitters' tags, meta the key=value metadata of
+	# the submissions
+	reports(hash: String, package: String, signer: String, permission: String, verdict: String, tag: String, meta: [String!], limit: Int = 10): [Report!]!
+}
+
+type Report {
+	sha256: String!
+	sha1: String!
+	md5: String!
+	targetType: String
+	package: String
+	verdict: String
+	reasons: [String!]!
+	tags: [String!]!
+	mime: String!
+	ssdeep: String!
+	trid: [TRiDMatch!]!
+	signers: [Signer!]!
+	permissions: [String!]!
+	submission: Submission
+	# json is the whole report
+	json: String!
+}
+
+type Submission {
+	# submitter is the name of the API key the sample was submitted with
+	submitter: String
+	tags: [String!]!
+	metadata: [Metadata!]!
+}
+
+type Metadata {
+	key: String!
+	value: String!
+}
+
+type TRiDMatch {
+	extension: String!
+	description: String!
+	# probability is in percent
+	probability: Float!
+}
+
+type Signer {
+	subject: String!
+	issuer: String!
+	sha256: String!
+	sha1: String!
+	schemes: [String!]!
+}
+`
+
+// maxGraphQLReports caps the reports a query returns
+const maxGraphQLReports = 100
+
+// graphqlHandler serves /graphql, nil when it is disabled
+var graphqlHandler http.Handler
+
+// newGraphQLHandler parses the schema and serves queries over the stored
+// reports of the current configuration's elasticsearch
+func newGraphQLHandler() (http.Handler, error) {
+	schema, err := graphql.ParseSchema(graphqlSchema, &queryResolver{})
+	if err != nil {
+		return nil, err
+	}
+	return &relay.Handler{Schema: schema}, nil
+}
+
+type queryResolver struct{}
+
+func (*queryResolver) Reports(ctx context.Context, args struct {
+	Hash, Package, Signer, Permission, Verdict, Tag *string
+	Meta                                            *[]string
+	Limit                                           int32
+}) ([]*reportResolver, error) {
+	if args.Limit < 1 || args.Limit > maxGraphQLReports {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxGraphQLReports)
+	}
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	f := reportFilter{
+		Hash:       deref(args.Hash),
+		Package:    deref(args.Package),
+		Signer:     deref(args.Signer),
+		Permission: deref(args.Permission),
+		Verdict:    deref(args.Verdict),
+		Tag:        deref(args.Tag),
+		Limit:      int(args.Limit),
+	}
+	if args.Meta != nil {
+		meta, err := parseSubmission(nil, *args.Meta)
+		if err != nil {
+			return nil, err
+		}
+		if meta != nil {
+			f.Metadata = meta.Metadata
+		}
+	}
+
+	rc, release := acquireConfig()
+	elastic := rc.elastic
+	release()
+	reports, err := newElasticReputation(elastic).FindReports(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := []*reportResolver{}
+	for _, r := range reports {
+		resolvers = append(resolvers, &reportResolver{r})
+	}
+	return resolvers, nil
+}
+
+type reportResolver struct{ fi apkfile.FileInfo }
+
+func (r *reportResolver) SHA256() string { return r.fi.Hashes.SHA256 }
+func (r *reportResolver) SHA1() string   { return r.fi.Hashes.SHA1 }
+func (r *reportResolver) MD5() string    { return r.fi.Hashes.MD5 }
+func (r *reportResolver) Mime() string   { return r.fi.Magic.Mime }
+func (r *reportResolver) SSDeep() string { return r.fi.SSDeep }
+func (r *reportResolver) Tags() []string { return nonNil(r.fi.Tags) }
+
+func (r *reportResolver) TargetType() *string {
+	return optional(r.fi.TargetType)
+}
+
+func (r *reportResolver) Package() *string {
+	if r.fi.Impersonation != nil {
+		return optional(r.fi.Impersonation.Package)
+	}
+	if r.fi.UpdateAnalysis != nil {
+		return optional(r.fi.UpdateAnalysis.Current.Package)
+	}
+	return nil
+}
+
+func (r *reportResolver) Verdict() *string {
+	if r.fi.Verdict == nil {
+		return nil
+	}
+	return &r.fi.Verdict.Verdict
+}
+
+func (r *reportResolver) Reasons() []string {
+	if r.fi.Verdict == nil {
+		return []string{}
+	}
+	return nonNil(r.fi.Verdict.Reasons)
+}
+
+func (r *reportResolver) Permissions() []string {
+	if r.fi.UpdateAnalysis == nil {
+		return []string{}
+	}
+	return nonNil(r.fi.UpdateAnalysis.Current.Permissions)
+}
+
+func (r *reportResolver) TRiD() []*tridResolver {
+	matches := []*tridResolver{}
+	for _, m := range r.fi.TRiD {
+		matches = append(matches, &tridResolver{m})
+	}
+	return matches
+}
+
+func (r *reportResolver) Signers() []*signerResolver {
+	signers := []*signerResolver{}
+	for _, s := range r.fi.Signers {
+		signers = append(signers, &signerResolver{s})
+	}
+	return signers
+}
+
+func (r *reportResolver) Submission() *submissionResolver {
+	if r.fi.Submission == nil {
+		return nil
+	}
+	return &submissionResolver{r.fi.Submission}
+}
+
+func (r *reportResolver) JSON() (string, error) {
+	fi := r.fi
+	fi.MarkDown = ""
+	data, err := json.Marshal(fi)
+	return string(data), err
+}
+
+type tridResolver struct{ m apkfile.TRiDMatch }
+
+func (t *tridResolver) Extension() string    { return t.m.Extension }
+func (t *tridResolver) Description() string  { return t.m.Description }
+func (t *tridResolver) Probability() float64 { return t.m.Probability }
+
+type submissionResolver struct{ s *apkfile.Submission }
+
+func (s *submissionResolver) Submitter() *string { return optional(s.s.Submitter) }
+func (s *submissionResolver) Tags() []string     { return nonNil(s.s.Tags) }
+
+func (s *submissionResolver) Metadata() []*metadataResolver {
+	keys := make([]string, 0, len(s.s.Metadata))
+	for k := range s.s.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	metadata := []*metadataResolver{}
+	for _, k := range keys {
+		metadata = append(metadata, &metadataResolver{k, s.s.Metadata[k]})
+	}
+	return metadata
+}
+
+type metadataResolver struct{ key, value string }
+
+func (m *metadataResolver) Key() string   { return m.key }
+func (m *metadataResolver) Value() string { return m.value }
+
+type signerResolver struct{ s apkfile.Signer }
+
+func (s *signerResolver) Subject() string   { return s.s.Subject }
+func (s *signerResolver) Issuer() string    { return s.s.Issuer }
+func (s *signerResolver) SHA256() string    { return s.s.SHA256 }
+func (s *signerResolver) SHA1() string      { return s.s.SHA1 }
+func (s *signerResolver) Schemes() []string { return nonNil(s.s.Schemes) }
+
+// optional is nil for an empty string, GraphQL's null
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// nonNil is s, or an empty list instead of null
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestGraphQL tests querying stored reports with filters.
+func TestGraphQL(t *testing.T) {
+	es, query := fakeElastic(`{"hits": {"total": 1, "hits": [{"_source": {"plugins": {"metadata": {"apkfile": {
+			"hashes": {"sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+			"impersonation": {"package": "com.flash.update"},
+			"signers": [{"subject": "CN=Flash", "sha256": "c0ffee", "schemes": ["v1"]}],
+			"verdict": {"verdict": "malicious", "reasons": ["package com.flash.update is known FluBot"]}}}}}}]}}`)
+	defer es.Close()
+	current = &runtimeConfig{elastic: es.URL}
+	defer func() { current = nil }()
+
+	handler, err := newGraphQLHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"query": "{ reports(package: \"com.flash.update\", verdict: \"malicious\", limit: 5) { sha256 package verdict reasons signers { subject sha256 } permissions } }"}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/v1/graphql", strings.NewReader(body)))
+
+	var resp struct {
+		Data struct {
+			Reports []struct {
+				SHA256      string
+				Package     *string
+				Verdict     *string
+				Reasons     []string
+				Signers     []struct{ Subject, SHA256 string }
+				Permissions []string
+			}
+		}
+		Errors []interface{}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Errors) > 0 || len(resp.Data.Reports) != 1 {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+	r := resp.Data.Reports[0]
+	if *r.Package != "com.flash.update" || *r.Verdict != "malicious" || r.Signers[0].SHA256 != "c0ffee" || r.Permissions == nil {
+		t.Errorf("unexpected report %s", w.Body.String())
+	}
+	for _, want := range []string{`"size":5`, `"plugins.metadata.apkfile.impersonation.package.keyword":"com.flash.update"`,
+		`"plugins.metadata.apkfile.verdict.verdict.keyword":"malicious"`} {
+		if !strings.Contains(*query, want) {
+			t.Errorf("expected %s in %s", want, *query)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/v1/graphql", strings.NewReader(`{"query": "{ reports(limit: 1000) { sha256 } }"}`)))
+	if !strings.Contains(w.Body.String(), "limit must be between 1 and 100") {
+		t.Errorf("expected the limit to be capped, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,68 @@
+#!/usr/bin/env python3
+"""Print androguard's view of an APK as JSON on stdout.
+
+usage: androguard_report.py APK
+
+The report has the manifest details apkfile.jar reports under "apk", the size
+of the call graph under "call_graph", and every Android or Java API the app
+calls along with the methods calling it under "api_calls".
+"""
+
+import json
+import sys
+
+from androguard.misc import AnalyzeAPK
+
+# FRAMEWORK are the packages whose methods are reported as APIs
+FRAMEWORK = ("Landroid/", "Landroidx/", "Ldalvik/", "Ljava/", "Ljavax/", "Lorg/apache/http/")
+
+
+def method_ref(m):
+    return "%s->%s" % (m.class_name, m.name)
+
+
+def main():
+    if len(sys.argv) != 2:
+        sys.stderr.write(__doc__)
+        return 2
+    a, _, dx = AnalyzeAPK(sys.argv[1])
+
+    methods = calls = external = 0
+    apis = {}
+    for m in dx.get_methods():
+        methods += 1
+        calls += len(m.get_xref_to())
+        if not m.is_external():
+            continue
+        external += 1
+        if m.class_name.startswith(FRAMEWORK):
+            callers = apis.setdefault(method_ref(m), set())
+            callers.update(method_ref(caller) for _, caller, _ in m.get_xref_from())
+
+    report = {
+        "apk": {
+            "package": a.get_package(),
+            "version_name": a.get_androidversion_name(),
+            "version_code": a.get_androidversion_code(),
+            "min_sdk": a.get_min_sdk_version(),
+            "target_sdk": a.get_target_sdk_version(),
+            "main_activity": a.get_main_activity(),
+            "permissions": a.get_permissions(),
+            "activities": a.get_activities(),
+            "services": a.get_services(),
+            "receivers": a.get_receivers(),
+            "providers": a.get_providers(),
+        },
+        "call_graph": {"methods": methods, "calls": calls, "external": external},
+        "api_calls": [
+            {"api": api, "callers": sorted(callers)}
+            for api, callers in sorted(apis.items())
+            if callers
+        ],
+    }
+    json.dump(report, sys.stdout)
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -0,0 +1,14 @@
+#!/bin/sh
+# Decompile an APK with jadx and write the Java sources as a tar archive on
+# stdout, jadx's own output goes to stderr.
+#
+# usage: jadx_archive.sh APK
+set -e
+
+out=$(mktemp -d)
+trap 'rm -rf "$out"' EXIT
+
+# jadx exits non-zero when it fails to decompile some methods, which is common
+# for obfuscated apps, the sources it did produce are still worth having
+${JADX:-jadx} --no-res --show-bad-code --output-dir "$out" "$1" >&2 || test -d "$out/sources"
+tar -C "$out" -cf - sources
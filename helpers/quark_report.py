@@ -0,0 +1,29 @@
+#!/usr/bin/env python3
+"""Print Quark-Engine's JSON report for an APK on stdout.
+
+usage: quark_report.py RULES APK
+
+RULES is a Quark rule file or a directory of them. Quark's CLI mixes its
+summary table into stdout, so this goes through its Python API instead.
+"""
+
+import json
+import sys
+
+from quark.report import Report
+
+
+def main():
+    if len(sys.argv) != 3:
+        sys.stderr.write(__doc__)
+        return 2
+    rules, apk = sys.argv[1:]
+
+    report = Report()
+    report.analysis(apk, rules)
+    json.dump(report.get_report("json"), sys.stdout)
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
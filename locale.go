@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// catalog translates the titles, headers and labels of the Markdown report,
+// keyed by their English text. Messages it lacks stay in English
+type catalog map[string]string
+
+// reportCatalog is the catalog of --locale, nil renders the report in English
+var reportCatalog catalog
+
+// T translates text of the template itself, which like the template and the
+// catalogs is trusted and isn't escaped
+func (c catalog) T(msg string) template.HTML {
+	return template.HTML(c.message(msg))
+}
+
+// label translates a value of the report, e.g. the verdict
+func (c catalog) label(value string) string {
+	return c.message(value)
+}
+
+func (c catalog) message(msg string) string {
+	if s := c[msg]; s != "" {
+		return s
+	}
+	return msg
+}
+
+// normalizeLocale turns e.g. de_DE.UTF-8 into de-de
+func normalizeLocale(locale string) string {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	return strings.ToLower(strings.Replace(locale, "_", "-", -1))
+}
+
+// loadCatalog returns the catalog of locale, the built-in one with the
+// messages of dir/<locale>.json on top. A region falls back to its language,
+// de-at to de. English and C need no catalog
+func loadCatalog(locale, dir string) (catalog, error) {
+	locale = normalizeLocale(locale)
+	if locale == "" || locale == "c" || locale == "posix" {
+		return nil, nil
+	}
+	candidates := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+
+	for _, name := range candidates {
+		if name == "en" {
+			return nil, nil
+		}
+		c := catalog{}
+		builtin, found := builtinCatalogs[name]
+		for msg, s := range builtin {
+			c[msg] = s
+		}
+		if dir != "" {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name+".json"))
+			switch {
+			case err == nil:
+				var messages map[string]string
+				if err := json.Unmarshal(data, &messages); err != nil {
+					return nil, fmt.Errorf("message catalog %s.json: %v", name, err)
+				}
+				for msg, s := range messages {
+					c[msg] = s
+				}
+				found = true
+			case !os.IsNotExist(err):
+				return nil, err
+			}
+		}
+		if found {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no message catalog for locale %s", locale)
+}
+
+// builtinCatalogs are the catalogs shipped with File Info, by language
+var builtinCatalogs = map[string]catalog{
+	"de": {
+		"Verdict":                           "Urteil",
+		"known_good":                        "bekannt gutartig",
+		"suspicious":                        "verdächtig",
+		"malicious":                         "bösartig",
+		"Tags":                              "Tags",
+		"Submission":                        "Einreichung",
+		"Submitter":                         "Einreicher",
+		"Magic":                             "Dateityp",
+		"Field":                             "Feld",
+		"Value":                             "Wert",
+		"Mime":                              "MIME-Typ",
+		"Description":                       "Beschreibung",
+		"Hashes":                            "Prüfsummen",
+		"Timestamp Anomalies":               "Zeitstempel-Anomalien",
+		"Suspicious Entries":                "Verdächtige Einträge",
+		"Entry":                             "Eintrag",
+		"Rule":                              "Regel",
+		"Expansion File":                    "Erweiterungsdatei",
+		"Name":                              "Name",
+		"Size":                              "Größe",
+		"Package":                           "Paket",
+		"Linked":                            "Verknüpft",
+		"Code":                              "Code",
+		"Vulnerabilities":                   "Schwachstellen",
+		"Locations":                         "Fundstellen",
+		"Steganography":                     "Steganografie",
+		"Image":                             "Bild",
+		"Finding":                           "Befund",
+		"Offset":                            "Offset",
+		"Length":                            "Länge",
+		"Strings":                           "Zeichenketten",
+		"Email":                             "E-Mail",
+		"Bitcoin":                           "Bitcoin",
+		"Monero":                            "Monero",
+		"Phone":                             "Telefon",
+		"Decrypted":                         "Entschlüsselt",
+		"Secrets":                           "Geheimnisse",
+		"Secret":                            "Geheimnis",
+		"Location":                          "Fundstelle",
+		"Cloud Backends":                    "Cloud-Backends",
+		"Kind":                              "Art",
+		"Exposed":                           "Offen",
+		"not probed":                        "nicht geprüft",
+		"Projects":                          "Projekte",
+		"Crypto Findings":                   "Kryptografie-Befunde",
+		"Evidence":                          "Nachweis",
+		"Signers":                           "Signierer",
+		"Subject":                           "Inhaber",
+		"Schemes":                           "Schemata",
+		"Issues":                            "Probleme",
+		"Blocklisted":                       "Gesperrt",
+		"Parser Discrepancies":              "Parser-Abweichungen",
+		"Tool":                              "Werkzeug",
+		"Ours":                              "Unsere",
+		"Theirs":                            "Deren",
+		"Signature Errors":                  "Signaturfehler",
+		"Artifacts":                         "Artefakte",
+		"Signer Reputation":                 "Signierer-Reputation",
+		"Samples":                           "Proben",
+		"Verdicts":                          "Urteile",
+		"Packages":                          "Pakete",
+		"Update Analysis":                   "Update-Analyse",
+		"Previous":                          "Vorher",
+		"Current":                           "Aktuell",
+		"Version Code":                      "Versionscode",
+		"downgrade":                         "Downgrade",
+		"changed":                           "geändert",
+		"Added Permissions":                 "Neue Berechtigungen",
+		"Removed Permissions":               "Entfernte Berechtigungen",
+		"Malware Packages":                  "Malware-Pakete",
+		"Match":                             "Treffer",
+		"Family":                            "Familie",
+		"Enrichment":                        "Externe Dienste",
+		"Provider":                          "Anbieter",
+		"Found":                             "Bekannt",
+		"Detections":                        "Erkennungen",
+		"detected":                          "erkannt",
+		"Unavailable":                       "Nicht verfügbar",
+		"Low Risk":                          "Geringes Risiko",
+		"Moderate Risk":                     "Mittleres Risiko",
+		"High Risk":                         "Hohes Risiko",
+		"score":                             "Punktzahl",
+		"Crime":                             "Verhalten",
+		"Confidence":                        "Konfidenz",
+		"Weight":                            "Gewicht",
+		"Labels":                            "Labels",
+		"methods":                           "Methoden",
+		"calls":                             "Aufrufe",
+		"external methods":                  "externe Methoden",
+		"Callers":                           "Aufrufer",
+		"Decompiled Sources":                "Dekompilierte Quellen",
+		"Files":                             "Dateien",
+		"Artifact":                          "Artefakt",
+		"URLs":                              "URLs",
+		"IPs":                               "IPs",
+		"Emails":                            "E-Mails",
+		"Toolchain":                         "Toolchain",
+		"Language":                          "Sprache",
+		"Compiler":                          "Compiler",
+		"Frameworks":                        "Frameworks",
+		"Rebuilt":                           "Neu gepackt",
+		"yes":                               "ja",
+		"no":                                "nein",
+		"Opcodes":                           "Opcodes",
+		"Dex":                               "Dex",
+		"Methods":                           "Methoden",
+		"Instructions":                      "Instruktionen",
+		"Invoke Density":                    "Aufrufdichte",
+		"Const-String Ratio":                "Const-String-Anteil",
+		"classes":                           "Klassen",
+		"Classes":                           "Klassen",
+		"API Usage":                         "API-Nutzung",
+		"Calls":                             "Aufrufe",
+		"Reflection":                        "Reflection",
+		"heavy":                             "intensiv",
+		"Native Libraries":                  "Native Bibliotheken",
+		"Library":                           "Bibliothek",
+		"JNI Exports":                       "JNI-Exporte",
+		"Packer":                            "Packer",
+		"unknown":                           "unbekannt",
+		"Anti-Debug":                        "Anti-Debug",
+		"Canary":                            "Canary",
+		"Stripped":                          "Gestrippt",
+		"Impersonation":                     "Imitation",
+		"Locales":                           "Gebietsschemas",
+		"Label":                             "Bezeichnung",
+		"Script":                            "Schrift",
+		"Intent Filters":                    "Intent-Filter",
+		"Indicator":                         "Indikator",
+		"Components":                        "Komponenten",
+		"Task Hijacking":                    "Task-Hijacking",
+		"Activities":                        "Aktivitäten",
+		"Attestation":                       "Attestierung",
+		"Setting":                           "Einstellung",
+		"JavaScript interfaces":             "JavaScript-Schnittstellen",
+		"at":                                "in",
+		"File URLs":                         "Datei-URLs",
+		"Bundled pages and scripts":         "Mitgelieferte Seiten und Skripte",
+		"Anti-Analysis":                     "Anti-Analyse",
+		"Check":                             "Prüfung",
+		"emulator":                          "Emulator",
+		"root":                              "Root",
+		"instrumentation":                   "Instrumentierung",
+		"Behaviors":                         "Verhaltensweisen",
+		"Behavior":                          "Verhalten",
+		"Billing":                           "Zahlungen",
+		"store":                             "Store",
+		"payment":                           "Zahlung",
+		"carrier":                           "Mobilfunkanbieter",
+		"Toll fraud risk":                   "Risiko von Gebührenbetrug",
+		"embeds payment flows and requests": "enthält Zahlungsabläufe und fordert",
+		"Custom Permissions":                "Eigene Berechtigungen",
+		"Permission":                        "Berechtigung",
+		"Protection Level":                  "Schutzstufe",
+		"Weakly Guarded":                    "Schwach geschützt",
+		"Runtime Permissions":               "Laufzeitberechtigungen",
+		"Declared":                          "Deklariert",
+		"Requested In":                      "Angefordert in",
+		"Declared but not requested":        "Deklariert, aber nicht angefordert",
+		"Requests that aren't constants":    "Anforderungen ohne Konstanten",
+		"Deep Links":                        "Deep Links",
+		"Component":                         "Komponente",
+		"Suspicious":                        "Verdächtig",
+		"Errors":                            "Fehler",
+		"Analyzer":                          "Analyse",
+		"Error":                             "Fehler",
+		"Warnings":                          "Warnungen",
+		"Warning":                           "Warnung",
+	},
+	"es": {
+		"Verdict":                           "Veredicto",
+		"known_good":                        "benigno conocido",
+		"suspicious":                        "sospechoso",
+		"malicious":                         "malicioso",
+		"Tags":                              "Etiquetas",
+		"Submission":                        "Envío",
+		"Submitter":                         "Remitente",
+		"Magic":                             "Tipo de archivo",
+		"Field":                             "Campo",
+		"Value":                             "Valor",
+		"Mime":                              "Tipo MIME",
+		"Description":                       "Descripción",
+		"Hashes":                            "Hashes",
+		"Timestamp Anomalies":               "Anomalías de marcas de tiempo",
+		"Suspicious Entries":                "Entradas sospechosas",
+		"Entry":                             "Entrada",
+		"Rule":                              "Regla",
+		"Expansion File":                    "Archivo de expansión",
+		"Name":                              "Nombre",
+		"Size":                              "Tamaño",
+		"Package":                           "Paquete",
+		"Linked":                            "Vinculado",
+		"Code":                              "Código",
+		"Vulnerabilities":                   "Vulnerabilidades",
+		"Locations":                         "Ubicaciones",
+		"Steganography":                     "Esteganografía",
+		"Image":                             "Imagen",
+		"Finding":                           "Hallazgo",
+		"Offset":                            "Desplazamiento",
+		"Length":                            "Longitud",
+		"Strings":                           "Cadenas",
+		"Email":                             "Correo",
+		"Bitcoin":                           "Bitcoin",
+		"Monero":                            "Monero",
+		"Phone":                             "Teléfono",
+		"Decrypted":                         "Descifrado",
+		"Secrets":                           "Secretos",
+		"Secret":                            "Secreto",
+		"Location":                          "Ubicación",
+		"Cloud Backends":                    "Backends en la nube",
+		"Kind":                              "Tipo",
+		"Exposed":                           "Expuesto",
+		"not probed":                        "no comprobado",
+		"Projects":                          "Proyectos",
+		"Crypto Findings":                   "Hallazgos criptográficos",
+		"Evidence":                          "Evidencia",
+		"Signers":                           "Firmantes",
+		"Subject":                           "Sujeto",
+		"Schemes":                           "Esquemas",
+		"Issues":                            "Problemas",
+		"Blocklisted":                       "En lista de bloqueo",
+		"Parser Discrepancies":              "Discrepancias del analizador",
+		"Tool":                              "Herramienta",
+		"Ours":                              "Nuestro",
+		"Theirs":                            "Suyo",
+		"Signature Errors":                  "Errores de firma",
+		"Artifacts":                         "Artefactos",
+		"Signer Reputation":                 "Reputación del firmante",
+		"Samples":                           "Muestras",
+		"Verdicts":                          "Veredictos",
+		"Packages":                          "Paquetes",
+		"Update Analysis":                   "Análisis de actualización",
+		"Previous":                          "Anterior",
+		"Current":                           "Actual",
+		"Version Code":                      "Código de versión",
+		"downgrade":                         "versión anterior",
+		"changed":                           "cambiado",
+		"Added Permissions":                 "Permisos añadidos",
+		"Removed Permissions":               "Permisos eliminados",
+		"Malware Packages":                  "Paquetes de malware",
+		"Match":                             "Coincidencia",
+		"Family":                            "Familia",
+		"Enrichment":                        "Servicios externos",
+		"Provider":                          "Proveedor",
+		"Found":                             "Conocido",
+		"Detections":                        "Detecciones",
+		"detected":                          "detectado",
+		"Unavailable":                       "No disponible",
+		"Low Risk":                          "Riesgo bajo",
+		"Moderate Risk":                     "Riesgo moderado",
+		"High Risk":                         "Riesgo alto",
+		"score":                             "puntuación",
+		"Crime":                             "Comportamiento",
+		"Confidence":                        "Confianza",
+		"Weight":                            "Peso",
+		"Labels":                            "Etiquetas",
+		"methods":                           "métodos",
+		"calls":                             "llamadas",
+		"external methods":                  "métodos externos",
+		"Callers":                           "Llamantes",
+		"Decompiled Sources":                "Fuentes descompiladas",
+		"Files":                             "Archivos",
+		"Artifact":                          "Artefacto",
+		"URLs":                              "URLs",
+		"IPs":                               "IPs",
+		"Emails":                            "Correos",
+		"Toolchain":                         "Cadena de herramientas",
+		"Language":                          "Lenguaje",
+		"Compiler":                          "Compilador",
+		"Frameworks":                        "Frameworks",
+		"Rebuilt":                           "Reempaquetado",
+		"yes":                               "sí",
+		"no":                                "no",
+		"Opcodes":                           "Opcodes",
+		"Dex":                               "Dex",
+		"Methods":                           "Métodos",
+		"Instructions":                      "Instrucciones",
+		"Invoke Density":                    "Densidad de invocaciones",
+		"Const-String Ratio":                "Proporción de const-string",
+		"classes":                           "clases",
+		"Classes":                           "Clases",
+		"API Usage":                         "Uso de API",
+		"Calls":                             "Llamadas",
+		"Reflection":                        "Reflexión",
+		"heavy":                             "intensivo",
+		"Native Libraries":                  "Bibliotecas nativas",
+		"Library":                           "Biblioteca",
+		"JNI Exports":                       "Exportaciones JNI",
+		"Packer":                            "Empaquetador",
+		"unknown":                           "desconocido",
+		"Anti-Debug":                        "Antidepuración",
+		"Canary":                            "Canario",
+		"Stripped":                          "Sin símbolos",
+		"Impersonation":                     "Suplantación",
+		"Locales":                           "Configuraciones regionales",
+		"Label":                             "Etiqueta",
+		"Script":                            "Escritura",
+		"Intent Filters":                    "Filtros de intents",
+		"Indicator":                         "Indicador",
+		"Components":                        "Componentes",
+		"Task Hijacking":                    "Secuestro de tareas",
+		"Activities":                        "Actividades",
+		"Attestation":                       "Atestación",
+		"Setting":                           "Ajuste",
+		"JavaScript interfaces":             "Interfaces JavaScript",
+		"at":                                "en",
+		"File URLs":                         "URLs de archivo",
+		"Bundled pages and scripts":         "Páginas y scripts incluidos",
+		"Anti-Analysis":                     "Antianálisis",
+		"Check":                             "Comprobación",
+		"emulator":                          "emulador",
+		"root":                              "root",
+		"instrumentation":                   "instrumentación",
+		"Behaviors":                         "Comportamientos",
+		"Behavior":                          "Comportamiento",
+		"Billing":                           "Pagos",
+		"store":                             "tienda",
+		"payment":                           "pago",
+		"carrier":                           "operador",
+		"Toll fraud risk":                   "Riesgo de fraude de tarificación",
+		"embeds payment flows and requests": "incluye flujos de pago y solicita",
+		"Custom Permissions":                "Permisos personalizados",
+		"Permission":                        "Permiso",
+		"Protection Level":                  "Nivel de protección",
+		"Weakly Guarded":                    "Protegido débilmente",
+		"Runtime Permissions":               "Permisos en tiempo de ejecución",
+		"Declared":                          "Declarado",
+		"Requested In":                      "Solicitado en",
+		"Declared but not requested":        "Declarados pero no solicitados",
+		"Requests that aren't constants":    "Solicitudes que no son constantes",
+		"Deep Links":                        "Enlaces profundos",
+		"Component":                         "Componente",
+		"Suspicious":                        "Sospechoso",
+		"Errors":                            "Errores",
+		"Analyzer":                          "Analizador",
+		"Error":                             "Error",
+		"Warnings":                          "Advertencias",
+		"Warning":                           "Advertencia",
+	},
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// TestLocalizedMarkDown tests rendering the Markdown report with a message catalog.
+func TestLocalizedMarkDown(t *testing.T) {
+	defer func(c catalog) { reportCatalog = c }(reportCatalog)
+
+	dir, err := ioutil.TempDir("", "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"Tags": "Schlagwörter"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if reportCatalog, err = loadCatalog("de_AT.UTF-8", dir); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo := apkfile.FileInfo{
+		Verdict: &apkfile.Verdict{Verdict: apkfile.VerdictMalicious, Reasons: []string{"blocklisted signer"}},
+		Tags:    []string{"banker"},
+		Magic:   apkfile.FileMagic{Mime: "application/vnd.android.package-archive"},
+		Toolchain: &apkfile.Toolchain{
+			Language: "Kotlin",
+			Rebuilt:  true,
+		},
+		Errors: apkfile.Diagnostics{{Analyzer: "trid", Code: apkfile.DiagnosticToolMissing, Message: "trid: not found"}},
+	}
+	markDown := generateMarkDownTable(fileInfo)
+	for _, want := range []string{
+		"#### Urteil: **bösartig**",
+		"#### Schlagwörter: banker",
+		"| MIME-Typ        | application/vnd.android.package-archive",
+		"| Neu gepackt     | **ja** |",
+		"#### Fehler",
+		"blocklisted signer",
+	} {
+		if !strings.Contains(markDown, want) {
+			t.Errorf("expected %q in\n%s", want, markDown)
+		}
+	}
+
+	reportCatalog = nil
+	if markDown := generateMarkDownTable(fileInfo); !strings.Contains(markDown, "#### Verdict: **malicious**") {
+		t.Errorf("expected an English report, got\n%s", markDown)
+	}
+
+	if _, err := loadCatalog("xx", dir); err == nil {
+		t.Error("expected an error for a locale without a catalog")
+	}
+	if c, err := loadCatalog("en_US", ""); err != nil || c != nil {
+		t.Errorf("expected no catalog for English, got %v %v", c, err)
+	}
+}
+
+// TestBuiltinCatalogs tests that the built-in catalogs translate every message of the template.
+func TestBuiltinCatalogs(t *testing.T) {
+	var messages []string
+	for _, m := range regexp.MustCompile(`\{\{ T "([^"]+)" \}\}`).FindAllStringSubmatch(tpl, -1) {
+		messages = append(messages, m[1])
+	}
+	if len(messages) == 0 {
+		t.Fatal("expected the template to have messages")
+	}
+	for locale, c := range builtinCatalogs {
+		for _, msg := range messages {
+			if c[msg] == "" {
+				t.Errorf("%s: no translation for %q", locale, msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/urfave/cli"
+)
+
+// reportFilter selects stored reports, each field that is set must match
+type reportFilter struct {
+	// Hash is an MD5, SHA1 or SHA256
+	Hash    string
+	Package string
+	// Signer is the SHA256 fingerprint of a signing certificate
+	Signer string
+	// Permission is matched against the permissions update_analysis recorded
+	Permission string
+	Verdict    string
+	// Tag is matched against the policy's tags and the submitters' ones
+	Tag string
+	// Metadata are the submission metadata values the reports must have
+	Metadata map[string]string
+	Limit    int
+}
+
+// query is the elasticsearch query of the filter
+func (f reportFilter) query() map[string]interface{} {
+	anyOf := func(clauses ...interface{}) interface{} {
+		return map[string]interface{}{"bool": map[string]interface{}{"should": clauses, "minimum_should_match": 1}}
+	}
+	filters := []interface{}{}
+	if f.Hash != "" {
+		hash := strings.ToLower(f.Hash)
+		filters = append(filters, anyOf(
+			term(resultsField+".hashes.sha256.keyword", hash),
+			term(resultsField+".hashes.sha1.keyword", hash),
+			term(resultsField+".hashes.md5.keyword", hash),
+		))
+	}
+	if f.Package != "" {
+		filters = append(filters, anyOf(
+			term(resultsField+".impersonation.package.keyword", f.Package),
+			term(resultsField+".update_analysis.current.package.keyword", f.Package),
+		))
+	}
+	if f.Signer != "" {
+		filters = append(filters, term(resultsField+".signers.sha256.keyword", strings.ToLower(f.Signer)))
+	}
+	if f.Permission != "" {
+		filters = append(filters, term(resultsField+".update_analysis.current.permissions.keyword", f.Permission))
+	}
+	if f.Verdict != "" {
+		filters = append(filters, term(resultsField+".verdict.verdict.keyword", f.Verdict))
+	}
+	if f.Tag != "" {
+		filters = append(filters, anyOf(
+			term(resultsField+".tags.keyword", f.Tag),
+			term(resultsField+".submission.tags.keyword", f.Tag),
+		))
+	}
+	for key, value := range f.Metadata {
+		filters = append(filters, term(resultsField+".submission.metadata."+key+".keyword", value))
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": filters}}
+}
+
+// FindReports returns the stored reports matching f, merged with their
+// refreshed sections
+func (e *elasticReputation) FindReports(ctx context.Context, f reportFilter) ([]apkfile.FileInfo, error) {
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source struct {
+					Plugins map[string]map[string]apkfile.FileInfo `json:"plugins"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	search := map[string]interface{}{
+		"size":    f.Limit,
+		"_source": []string{resultsField},
+		"query":   f.query(),
+	}
+	if found, err := e.search(ctx, search, &result); err != nil || !found {
+		return nil, err
+	}
+
+	var reports []apkfile.FileInfo
+	for _, hit := range result.Hits.Hits {
+		reports = append(reports, hit.Source.Plugins[category][name])
+	}
+	return e.mergeRefreshed(ctx, reports)
+}
+
+// Reports returns the stored reports of the sample with the SHA256 query, or
+// of the APKs whose package name is query
+func (e *elasticReputation) Reports(ctx context.Context, query string, limit int) ([]apkfile.FileInfo, error) {
+	return e.FindReports(ctx, queryFilter(query, limit))
+}
+
+// queryFilter matches the sample with the SHA256 query, or the APKs whose
+// package name is query
+func queryFilter(query string, limit int) reportFilter {
+	if _, err := hex.DecodeString(query); err == nil && len(query) == 64 {
+		return reportFilter{Hash: query, Limit: limit}
+	}
+	return reportFilter{Package: query, Limit: limit}
+}
+
+// lookup prints the stored reports of the sample or package in the first
+// argument, and of the submissions with --tag and --meta, as JSON lines or
+// Markdown with --table
+func lookup(c *cli.Context) error {
+	f := reportFilter{Limit: c.Int("limit")}
+	if c.Args().Present() {
+		f = queryFilter(c.Args().First(), c.Int("limit"))
+	}
+	f.Tag = c.String("tag")
+	if meta, err := parseSubmission(nil, c.StringSlice("meta")); err != nil {
+		return err
+	} else if meta != nil {
+		f.Metadata = meta.Metadata
+	}
+	if !c.Args().Present() && f.Tag == "" && f.Metadata == nil {
+		return fmt.Errorf("Please supply a SHA256, a package name, a --tag or --meta to look up")
+	}
+
+	file, err := readConfigFile(c.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+	elastic := c.GlobalString("elasitcsearch")
+	if file.Elasticsearch != "" {
+		elastic = file.Elasticsearch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.GlobalInt("timeout"))*time.Second)
+	defer cancel()
+	reports, err := newElasticReputation(elastic).FindReports(ctx, f)
+	if err != nil {
+		return err
+	}
+	if len(reports) == 0 && c.Args().Present() {
+		return fmt.Errorf("no reports of %s", c.Args().First())
+	}
+	if len(reports) == 0 {
+		return fmt.Errorf("no reports found")
+	}
+
+	for _, fileInfo := range reports {
+		if c.GlobalBool("table") {
+			fmt.Println(generateMarkDownTable(fileInfo))
+			continue
+		}
+		fileInfo.MarkDown = ""
+		fileInfoJSON, err := json.Marshal(fileInfo)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(fileInfoJSON))
+	}
+	return nil
+}
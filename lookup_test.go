@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeElastic serves hits to every search of the malice index, query is the
+// last search's body
+func fakeElastic(hits string) (*httptest.Server, *string) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/malice/_search" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		query = string(body)
+		w.Write([]byte(hits))
+	}))
+	return ts, &query
+}
+
+// TestElasticReports tests looking up stored reports by SHA256 and by package.
+func TestElasticReports(t *testing.T) {
+	ts, query := fakeElastic(`{"hits": {"total": 1, "hits": [{"_source": {"plugins": {"metadata": {"apkfile": {
+			"hashes": {"sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+			"verdict": {"verdict": "malicious", "reasons": ["package com.flash.update is known FluBot"]}}}}}}]}}`)
+	defer ts.Close()
+	e := newElasticReputation(ts.URL)
+
+	reports, err := e.Reports(context.Background(), "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Verdict == nil || reports[0].Verdict.Verdict != "malicious" {
+		t.Fatalf("unexpected reports %#v", reports)
+	}
+	if !strings.Contains(*query, `"plugins.metadata.apkfile.hashes.sha256.keyword":"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`) ||
+		!strings.Contains(*query, `"size":10`) {
+		t.Errorf("unexpected SHA256 query %s", *query)
+	}
+
+	if _, err := e.Reports(context.Background(), "com.flash.update", 3); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(*query, `"plugins.metadata.apkfile.impersonation.package.keyword":"com.flash.update"`) ||
+		!strings.Contains(*query, `"plugins.metadata.apkfile.update_analysis.current.package.keyword":"com.flash.update"`) {
+		t.Errorf("unexpected package query %s", *query)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// defaultHeartbeat is how often heartbeats are sent when --heartbeat isn't a
+// positive duration
+const defaultHeartbeat = 30 * time.Second
+
+// errNotRegistered is returned by heartbeats the master doesn't know the
+// instance of, e.g. after it restarted
+var errNotRegistered = errors.New("not registered with the Malice master")
+
+// registration is what an instance tells the Malice master about itself
+type registration struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Version  string `json:"version"`
+	// Mode is web or worker
+	Mode string `json:"mode"`
+	// Capabilities are the analyzers the instance runs and the APIs it serves
+	Capabilities []string `json:"capabilities"`
+	// Endpoint is where the master reaches the web service, workers have none
+	Endpoint string `json:"endpoint,omitempty"`
+	Hostname string `json:"hostname"`
+}
+
+// heartbeat tells the master an instance is still up
+type heartbeat struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+// masterClient registers an instance with the Malice master API and keeps it
+// registered with heartbeats
+type masterClient struct {
+	url    string
+	client *http.Client
+	reg    registration
+	// interval is how often heartbeats are sent
+	interval time.Duration
+	// id is what the master registered the instance as
+	id string
+}
+
+func newMasterClient(addr string, reg registration) *masterClient {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &masterClient{url: strings.TrimSuffix(addr, "/") + "/api/v1/plugins", client: http.DefaultClient, reg: reg}
+}
+
+// register announces the instance, the master replies with its ID
+func (m *masterClient) register(ctx context.Context) error {
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := m.do(ctx, "POST", m.url, m.reg, &result); err != nil {
+		return err
+	}
+	if result.ID == "" {
+		return fmt.Errorf("the Malice master registered the plugin without an ID")
+	}
+	m.id = result.ID
+	return nil
+}
+
+func (m *masterClient) heartbeat(ctx context.Context) error {
+	return m.do(ctx, "PUT", m.url+"/"+m.id+"/heartbeat", heartbeat{Status: "ok", Time: time.Now().UTC()}, nil)
+}
+
+// deregister tells the master the instance is shutting down
+func (m *masterClient) deregister(ctx context.Context) error {
+	return m.do(ctx, "DELETE", m.url+"/"+m.id, nil, nil)
+}
+
+func (m *masterClient) do(ctx context.Context, method, url string, body, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && method != "POST" {
+		return errNotRegistered
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Malice master %s %s failed: %s", method, url, resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// run registers the instance, retrying every interval until the master is
+// reachable, then sends a heartbeat every interval until ctx is done. Each
+// request gets an interval to be answered in. The
+// instance registers again when the master forgot it, and deregisters when
+// ctx is done
+func (m *masterClient) run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		// a master that doesn't answer mustn't stop the heartbeats for good
+		callCtx, cancel := context.WithTimeout(ctx, m.interval)
+		var err error
+		if m.id == "" {
+			if err = m.register(callCtx); err == nil {
+				log.Infof("registered with the Malice master as %s", m.id)
+			}
+		} else if err = m.heartbeat(callCtx); err == errNotRegistered {
+			m.id = ""
+		}
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.WithError(err).Warn("reaching the Malice master failed")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if m.id != "" {
+				dctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := m.deregister(dctx); err != nil {
+					log.WithError(err).Warn("deregistering from the Malice master failed")
+				}
+				cancel()
+			}
+			return
+		}
+	}
+}
+
+// newMaster returns the client keeping a web service or worker registered
+// with the Malice master in --master, nil when none is set
+func newMaster(c *cli.Context, mode, endpoint string, capabilities ...string) *masterClient {
+	addr := c.GlobalString("master")
+	if addr == "" {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+
+	rc, release := acquireConfig()
+	capabilities = append(rc.scanner.Analyzers(), capabilities...)
+	release()
+
+	m := newMasterClient(addr, registration{
+		Name:         name,
+		Category:     category,
+		Version:      Version,
+		Mode:         mode,
+		Capabilities: capabilities,
+		Endpoint:     endpoint,
+		Hostname:     hostname,
+	})
+	m.interval = c.GlobalDuration("heartbeat")
+	if m.interval <= 0 {
+		log.Warnf("--heartbeat must be positive, sending heartbeats every %v", defaultHeartbeat)
+		m.interval = defaultHeartbeat
+	}
+	return m
+}
+
+// webEndpoint is where the master reaches the web service, --advertise or
+// port 3993 of this host
+func webEndpoint(c *cli.Context) string {
+	if endpoint := c.GlobalString("advertise"); endpoint != "" {
+		return endpoint
+	}
+	hostname, _ := os.Hostname()
+	return "http://" + hostname + ":3993"
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMasterClient tests registering, heartbeats and registering again after the master forgot the instance.
+func TestMasterClient(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	registered := map[string]bool{}
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v1/plugins":
+			var reg registration
+			if err := json.NewDecoder(r.Body).Decode(&reg); err != nil || reg.Name != "apkfile" || reg.Capabilities[0] != "hashes" {
+				t.Errorf("unexpected registration %+v, %v", reg, err)
+			}
+			id := map[bool]string{false: "1", true: "2"}[len(registered) > 0]
+			registered[id] = true
+			json.NewEncoder(w).Encode(map[string]string{"id": id})
+		case r.Method == "PUT" && r.URL.Path == "/api/v1/plugins/1/heartbeat":
+			// the master restarted and forgot the first registration
+			http.NotFound(w, r)
+		case r.Method == "PUT" && r.URL.Path == "/api/v1/plugins/2/heartbeat":
+			if len(requests) == 4 {
+				close(done)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	m := newMasterClient(srv.URL, registration{Name: "apkfile", Mode: "web", Capabilities: []string{"hashes", "scan"}})
+	m.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		m.run(ctx)
+		close(stopped)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for heartbeats")
+	}
+	cancel()
+	<-stopped
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"POST /api/v1/plugins", "PUT /api/v1/plugins/1/heartbeat", "POST /api/v1/plugins", "PUT /api/v1/plugins/2/heartbeat"}
+	for i, r := range want {
+		if requests[i] != r {
+			t.Errorf("request %d: expected %s, got %s", i, r, requests[i])
+		}
+	}
+	if last := requests[len(requests)-1]; last != "DELETE /api/v1/plugins/2" {
+		t.Errorf("expected to deregister on shutdown, got %s", last)
+	}
+}
+
+// TestMasterClientHang tests that a master not answering doesn't stop the registration attempts.
+func TestMasterClientHang(t *testing.T) {
+	attempts := make(chan struct{}, 10)
+	hang := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case attempts <- struct{}{}:
+		default:
+		}
+		select {
+		case <-hang:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(hang)
+
+	m := newMasterClient(srv.URL, registration{Name: "apkfile", Mode: "worker"})
+	m.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.run(ctx)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-attempts:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected registering to be attempted again")
+		}
+	}
+}
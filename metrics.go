@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scansTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "fileinfo",
+		Name:      "scans_total",
+		Help:      "Number of scans processed, by result.",
+	}, []string{"result"})
+
+	scansInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "fileinfo",
+		Name:      "scans_in_flight",
+		Help:      "Number of scans currently running.",
+	})
+
+	scanDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "fileinfo",
+		Name:      "scan_duration_seconds",
+		Help:      "Time taken to scan a file.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	})
+
+	analyzerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "fileinfo",
+		Name:      "analyzer_duration_seconds",
+		Help:      "Time taken by each analyzer.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"analyzer"})
+
+	analyzerPeakMemory = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "fileinfo",
+		Name:      "analyzer_peak_memory_bytes",
+		Help:      "Peak resident memory of each analyzer's external tools.",
+		Buckets:   prometheus.ExponentialBuckets(1<<20, 2, 12),
+	}, []string{"analyzer"})
+)
+
+func init() {
+	prometheus.MustRegister(scansTotal, scansInFlight, scanDuration, analyzerDuration, analyzerPeakMemory)
+}
+
+// observeTimings exports the analyzer timings of a fresh scan
+func observeTimings(timings map[string]apkfile.Timing) {
+	for name, t := range timings {
+		analyzerDuration.WithLabelValues(name).Observe(t.Duration)
+		if t.PeakMemory > 0 {
+			analyzerPeakMemory.WithLabelValues(name).Observe(float64(t.PeakMemory))
+		}
+	}
+}
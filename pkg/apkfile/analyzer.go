@@ -0,0 +1,250 @@
+package apkfile
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Target is the file an analyzer runs against
+type Target struct {
+	Path string
+	// Hashes is set when the digests were computed before the scan started
+	Hashes *FileHashes
+
+	maxEntrySize int64
+	// expansion is the OBB the target was scanned with, nil for none
+	expansion     *ExpansionFile
+	archive       archive
+	dex           dexFiles
+	strings       foundStrings
+	manifestDoc   manifestDoc
+	resourceDoc   resourceDoc
+	signing       signingCerts
+	androguardRun androguardRun
+}
+
+// Target types, what the scanned file turned out to be
+const (
+	TargetAPK = "apk"
+	// TargetArchive is a zip without an AndroidManifest.xml, e.g. a JAR
+	TargetArchive = "archive"
+	TargetFile    = "file"
+)
+
+// Type returns what the target is, APK-specific analyzers are skipped for
+// anything but TargetAPK
+func (t *Target) Type() string {
+	switch _, err := t.manifest(); err {
+	case ErrNotAPK:
+		if _, err := t.Archive(); err == nil {
+			return TargetArchive
+		}
+		return TargetFile
+	default:
+		// an AndroidManifest.xml that doesn't parse is still an APK
+		return TargetAPK
+	}
+}
+
+// sha256 returns the target's SHA256, hashing it unless the scan was given
+// its digests
+func (t *Target) sha256() (string, error) {
+	if t.Hashes != nil {
+		return t.Hashes.SHA256, nil
+	}
+	h, err := HashFile(t.Path)
+	return h.SHA256, err
+}
+
+// apkSpecific is implemented by analyzers that run APK tools, which fail on
+// anything else
+type apkSpecific interface {
+	apkOnly()
+}
+
+// Section is the part of the report an analyzer produced
+type Section interface{}
+
+// Analyzer produces one section of the report
+type Analyzer interface {
+	// Name is the key the analyzer's section is reported under
+	Name() string
+	// Available reports whether the tools the analyzer needs are installed
+	Available() bool
+	// Run analyzes target
+	Run(ctx context.Context, target *Target) (Section, error)
+}
+
+// toolAvailable reports whether an external tool can be run through the
+// scanner's backend
+func (s *Scanner) toolAvailable(name string) bool {
+	if _, ok := s.backend.(dockerBackend); ok {
+		// the tools live in the sandbox image, not on this host
+		return true
+	}
+	_, err := exec.LookPath(s.toolPath(name))
+	return err == nil
+}
+
+// toolPath returns the binary configured for an external tool, by default
+// name itself or wherever findTool finds it on this OS
+func (s *Scanner) toolPath(name string) string {
+	if path, ok := s.tools[name]; ok {
+		return path
+	}
+	if _, ok := s.backend.(dockerBackend); ok {
+		return name
+	}
+	return findTool(name)
+}
+
+// builtinAnalyzers are the analyzers every Scanner runs
+func builtinAnalyzers(s *Scanner) []Analyzer {
+	return []Analyzer{
+		hashesAnalyzer{},
+		magicAnalyzer{s},
+		ssdeepAnalyzer{},
+		tridAnalyzer{s},
+		exiftoolAnalyzer{s},
+		apkAnalyzer{s},
+		entriesAnalyzer{},
+		timestampsAnalyzer{},
+		suspiciousEntriesAnalyzer{},
+		expansionAnalyzer{},
+		vulnerabilitiesAnalyzer{},
+		stegoAnalyzer{},
+		stringsAnalyzer{s},
+		secretsAnalyzer{s},
+		cloudBackendsAnalyzer{s},
+		cryptoAnalyzer{},
+		deepLinksAnalyzer{},
+		intentsAnalyzer{},
+		taskHijackingAnalyzer{},
+		attestationAnalyzer{},
+		webViewAnalyzer{},
+		antiAnalysisAnalyzer{},
+		behaviorsAnalyzer{},
+		billingAnalyzer{},
+		permissionsAnalyzer{},
+		runtimePermissionsAnalyzer{},
+		impersonationAnalyzer{},
+		localesAnalyzer{},
+		nativeAnalyzer{},
+		toolchainAnalyzer{},
+		opcodesAnalyzer{},
+		apiUsageAnalyzer{},
+		packagesAnalyzer{s},
+		signersAnalyzer{s},
+		crossCheckAnalyzer{s},
+		reputationAnalyzer{s},
+		updateAnalyzer{s},
+		feedAnalyzer{s},
+		enrichmentAnalyzer{s},
+		quarkAnalyzer{s},
+		androguardAnalyzer{s},
+		decompileAnalyzer{s},
+		artifactsAnalyzer{s},
+	}
+}
+
+type hashesAnalyzer struct{}
+
+func (hashesAnalyzer) Name() string    { return "hashes" }
+func (hashesAnalyzer) Available() bool { return true }
+
+func (hashesAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	if target.Hashes != nil {
+		return *target.Hashes, nil
+	}
+	return HashFile(target.Path)
+}
+
+type magicAnalyzer struct{ s *Scanner }
+
+func (magicAnalyzer) Name() string    { return "magic" }
+func (magicAnalyzer) Available() bool { return true }
+
+func (a magicAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	var magic FileMagic
+	var err error
+
+	if magic.Mime, err = a.s.getFileMimeType(ctx, target.Path); err != nil && ctx.Err() == nil {
+		// try again
+		magic.Mime, err = a.s.getFileMimeType(ctx, target.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if magic.Description, err = a.s.getFileDescription(ctx, target.Path); err != nil && ctx.Err() == nil {
+		// try again
+		magic.Description, err = a.s.getFileDescription(ctx, target.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.s.magic.builtin() {
+		warn(ctx, DiagnosticBuiltinMagic, "libmagic is not available, the file type was told by the built-in detection")
+	}
+	return magic, nil
+}
+
+type ssdeepAnalyzer struct{}
+
+func (ssdeepAnalyzer) Name() string    { return "ssdeep" }
+func (ssdeepAnalyzer) Available() bool { return true }
+
+func (ssdeepAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	return SSDeepFile(target.Path)
+}
+
+type tridAnalyzer struct{ s *Scanner }
+
+func (tridAnalyzer) Name() string      { return "trid" }
+func (a tridAnalyzer) Available() bool { return a.s.toolAvailable("trid") }
+
+func (a tridAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	out, err := a.s.runTool(ctx, target.Path, "trid", target.Path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTRiDOutput(out), nil
+}
+
+type exiftoolAnalyzer struct{ s *Scanner }
+
+func (exiftoolAnalyzer) Name() string      { return "exiftool" }
+func (a exiftoolAnalyzer) Available() bool { return a.s.toolAvailable("exiftool") }
+
+func (a exiftoolAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	out, err := a.s.runTool(ctx, target.Path, "exiftool", "-j", "-G", target.Path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseExiftoolOutput(out), nil
+}
+
+type apkAnalyzer struct{ s *Scanner }
+
+func (apkAnalyzer) Name() string { return "apk_file" }
+func (a apkAnalyzer) Available() bool {
+	if a.s.apkBackend == APKBackendAndroguard {
+		return a.s.toolAvailable("python3")
+	}
+	return a.s.toolAvailable("java")
+}
+
+func (apkAnalyzer) apkOnly() {}
+
+func (a apkAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	if _, err := target.manifest(); err == ErrNotAPK {
+		return nil, nil
+	}
+	if a.s.apkBackend != APKBackendAndroguard {
+		return a.s.runAPKFile(ctx, target.Path)
+	}
+	out, err := target.androguard(ctx, a.s)
+	if err != nil {
+		return nil, err
+	}
+	return string(out.APK), nil
+}
@@ -0,0 +1,128 @@
+package apkfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// APK backends, what produces the apk_file section
+const (
+	APKBackendApkfile    = "apkfile"
+	APKBackendAndroguard = "androguard"
+)
+
+// maxAPICallers is how many of the methods calling an API are listed
+const maxAPICallers = 10
+
+// AndroguardReport is what androguard adds to the apk_file section it
+// produces with the androguard backend
+type AndroguardReport struct {
+	CallGraph CallGraph `json:"call_graph" structs:"call_graph"`
+	// APICalls are the Android and Java APIs the app calls
+	APICalls []APICall `json:"api_calls" structs:"api_calls"`
+}
+
+// CallGraph is the size of the app's call graph
+type CallGraph struct {
+	Methods int `json:"methods" structs:"methods"`
+	Calls   int `json:"calls" structs:"calls"`
+	// External is the number of methods called but not defined in the app
+	External int `json:"external" structs:"external"`
+}
+
+// APICall is an API and the methods calling it
+type APICall struct {
+	// API is the smali style reference, e.g. Landroid/telephony/SmsManager;->sendTextMessage
+	API string `json:"api" structs:"api"`
+	// Callers are the first maxAPICallers methods calling it, in order
+	Callers []string `json:"callers" structs:"callers"`
+	// CallerCount is the number of methods calling it
+	CallerCount int `json:"caller_count" structs:"caller_count"`
+}
+
+// androguardOutput is what helpers/androguard_report.py prints
+type androguardOutput struct {
+	APK       json.RawMessage `json:"apk"`
+	CallGraph CallGraph       `json:"call_graph"`
+	APICalls  []struct {
+		API     string   `json:"api"`
+		Callers []string `json:"callers"`
+	} `json:"api_calls"`
+}
+
+// androguardRun is androguard's report on the target, shared by the apk_file
+// and androguard sections
+type androguardRun struct {
+	once sync.Once
+	out  *androguardOutput
+	err  error
+}
+
+// WithAPKBackend selects what produces the apk_file section, apkfile.jar by
+// default. The androguard backend runs helper, helpers/androguard_report.py,
+// and also adds an androguard section with the call graph and API calls
+func WithAPKBackend(backend, helper string) Option {
+	return func(s *Scanner) {
+		s.apkBackend = backend
+		s.androguardHelper = helper
+	}
+}
+
+// androguard runs the androguard helper against the target once per scan
+func (t *Target) androguard(ctx context.Context, s *Scanner) (*androguardOutput, error) {
+	t.androguardRun.once.Do(func() {
+		// sandboxes mount the sample at its absolute path
+		path, err := filepath.Abs(t.Path)
+		if err != nil {
+			t.androguardRun.err = err
+			return
+		}
+		out, err := s.runTool(ctx, t.Path, "python3", s.androguardHelper, path)
+		if err != nil {
+			t.androguardRun.err = err
+			return
+		}
+		t.androguardRun.out, t.androguardRun.err = parseAndroguardOutput(out)
+	})
+	return t.androguardRun.out, t.androguardRun.err
+}
+
+func parseAndroguardOutput(out string) (*androguardOutput, error) {
+	var o androguardOutput
+	if err := json.Unmarshal([]byte(out), &o); err != nil {
+		return nil, fmt.Errorf("invalid androguard report: %v", err)
+	}
+	return &o, nil
+}
+
+type androguardAnalyzer struct{ s *Scanner }
+
+func (androguardAnalyzer) Name() string { return "androguard" }
+func (a androguardAnalyzer) Available() bool {
+	return a.s.apkBackend == APKBackendAndroguard && a.s.toolAvailable("python3")
+}
+
+func (androguardAnalyzer) apkOnly() {}
+
+func (a androguardAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	if _, err := target.manifest(); err == ErrNotAPK {
+		return nil, nil
+	}
+	out, err := target.androguard(ctx, a.s)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AndroguardReport{CallGraph: out.CallGraph, APICalls: []APICall{}}
+	for _, c := range out.APICalls {
+		call := APICall{API: c.API, Callers: c.Callers, CallerCount: len(c.Callers)}
+		if len(call.Callers) > maxAPICallers {
+			call.Callers = call.Callers[:maxAPICallers]
+		}
+		report.APICalls = append(report.APICalls, call)
+	}
+	return report, nil
+}
@@ -0,0 +1,71 @@
+package apkfile
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestAndroguardBackend tests the apk_file and androguard sections produced
+// from one run of the androguard helper.
+func TestAndroguardBackend(t *testing.T) {
+	var callers []string
+	for i := 0; i < 12; i++ {
+		callers = append(callers, fmt.Sprintf(`"Lcom/example/Main;->run%d"`, i))
+	}
+	report := `{"apk": {"package": "com.example"}, "call_graph": {"methods": 40, "calls": 75, "external": 22},
+		"api_calls": [{"api": "Landroid/telephony/SmsManager;->sendTextMessage", "callers": [` + strings.Join(callers, ",") + `]}]}`
+
+	// the helper is run with python3, which is sh here
+	helper, err := ioutil.TempFile("", "helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(helper.Name())
+	fmt.Fprintf(helper, "echo '%s'\n", report)
+	helper.Close()
+
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example"><application/></manifest>`
+	path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+	defer os.Remove(path)
+
+	s := &Scanner{backend: localBackend{}, tools: map[string]string{"python3": "sh"}}
+	WithAPKBackend(APKBackendAndroguard, helper.Name())(s)
+	target := &Target{Path: path}
+	defer target.close()
+
+	apk, err := apkAnalyzer{s}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apk != `{"package": "com.example"}` {
+		t.Errorf("unexpected apk_file section %q", apk)
+	}
+
+	// the helper ran once, the second section reuses its report
+	os.Remove(helper.Name())
+	section, err := androguardAnalyzer{s}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := section.(*AndroguardReport)
+	want := &AndroguardReport{
+		CallGraph: CallGraph{Methods: 40, Calls: 75, External: 22},
+		APICalls: []APICall{{
+			API:         "Landroid/telephony/SmsManager;->sendTextMessage",
+			Callers:     []string{"Lcom/example/Main;->run0", "Lcom/example/Main;->run1", "Lcom/example/Main;->run2", "Lcom/example/Main;->run3", "Lcom/example/Main;->run4", "Lcom/example/Main;->run5", "Lcom/example/Main;->run6", "Lcom/example/Main;->run7", "Lcom/example/Main;->run8", "Lcom/example/Main;->run9"},
+			CallerCount: 12,
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	if (androguardAnalyzer{&Scanner{apkBackend: APKBackendApkfile}}).Available() {
+		t.Error("expected the androguard section only with the androguard backend")
+	}
+}
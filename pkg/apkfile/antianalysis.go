@@ -0,0 +1,93 @@
+package apkfile
+
+import (
+	"context"
+	"regexp"
+)
+
+// AntiAnalysis lists the signs the app checks where it's running before it
+// shows what it does
+type AntiAnalysis struct {
+	// Emulator are the fingerprints of emulators and sandboxes it looks for
+	Emulator []AntiAnalysisFinding `json:"emulator,omitempty" structs:"emulator,omitempty"`
+	// Root are the su binaries, root managers and build tags it looks for
+	Root []AntiAnalysisFinding `json:"root,omitempty" structs:"root,omitempty"`
+	// Instrumentation are the Frida and Xposed artifacts it looks for
+	Instrumentation []AntiAnalysisFinding `json:"instrumentation,omitempty" structs:"instrumentation,omitempty"`
+}
+
+// AntiAnalysisFinding is a string or field reference and where it was found
+type AntiAnalysisFinding struct {
+	Indicator string `json:"indicator" structs:"indicator"`
+	Location  string `json:"location" structs:"location"`
+}
+
+var (
+	emulatorRegexp = regexp.MustCompile(`(?i)goldfish|ranchu|qemu|genymotion|genyd|vbox86|bluestacks|\bnox\b|nox_|sdk_gphone|google_sdk|andy_vm|ttvm_|^0{15}$`)
+	rootRegexp     = regexp.MustCompile(`(?i)(?:^|/)su$|superuser|supersu|magisk|busybox|test-keys|rootbeer|rootcloak`)
+	// instrumentationRegexp matches the Frida server, port and thread names
+	// and the Xposed and Substrate frameworks
+	instrumentationRegexp = regexp.MustCompile(`(?i)frida|gum-js-loop|linjector|^27042$|xposed|de/robv/android|de\.robv\.android|lsposed|substrate|saurik`)
+	// buildFields are the android.os.Build fields emulator checks compare,
+	// they are only reported along with the emulator strings since most apps
+	// read them for analytics
+	buildFields = map[string]bool{
+		"FINGERPRINT":  true,
+		"MODEL":        true,
+		"MANUFACTURER": true,
+		"BRAND":        true,
+		"DEVICE":       true,
+		"PRODUCT":      true,
+		"HARDWARE":     true,
+		"BOARD":        true,
+	}
+)
+
+type antiAnalysisAnalyzer struct{}
+
+func (antiAnalysisAnalyzer) Name() string    { return "anti_analysis" }
+func (antiAnalysisAnalyzer) Available() bool { return true }
+
+func (antiAnalysisAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	if _, err := target.Archive(); err == ErrNotArchive {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	found, err := target.extractStrings()
+	if err != nil {
+		return nil, err
+	}
+
+	section := &AntiAnalysis{}
+	for _, str := range found {
+		finding := AntiAnalysisFinding{Indicator: str.Value, Location: str.Location}
+		switch {
+		case instrumentationRegexp.MatchString(str.Value):
+			section.Instrumentation = append(section.Instrumentation, finding)
+		case rootRegexp.MatchString(str.Value):
+			section.Root = append(section.Root, finding)
+		case emulatorRegexp.MatchString(str.Value):
+			section.Emulator = append(section.Emulator, finding)
+		}
+	}
+
+	if len(section.Emulator) > 0 {
+		dexes, err := target.dexFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range dexes {
+			for _, f := range d.fields {
+				if f.class == "Landroid/os/Build;" && buildFields[f.name] {
+					section.Emulator = append(section.Emulator, AntiAnalysisFinding{Indicator: f.String(), Location: d.name})
+				}
+			}
+		}
+	}
+
+	if section.Emulator == nil && section.Root == nil && section.Instrumentation == nil {
+		return nil, nil
+	}
+	return section, nil
+}
@@ -0,0 +1,72 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestAntiAnalysisAnalyzer tests finding emulator, root and instrumentation checks.
+func TestAntiAnalysisAnalyzer(t *testing.T) {
+	b := newDexBuilder()
+	b.str("ro.kernel.qemu")
+	b.str("/system/xbin/su")
+	b.str("com.topjohnwu.magisk")
+	b.str("re.frida.server")
+	b.str("Lde/robv/android/xposed/XposedBridge;")
+	b.str("Hello")
+	b.field("Landroid/os/Build;", "FINGERPRINT", stringClass)
+	b.field("Landroid/os/Build;", "SERIAL", stringClass)
+	b.field("Lcom/example/Main;", "MODEL", stringClass)
+	path := writeZip(t, map[string]string{"classes.dex": string(b.build())})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := antiAnalysisAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anti := section.(*AntiAnalysis)
+
+	wantEmulator := []AntiAnalysisFinding{
+		{"ro.kernel.qemu", "classes.dex"},
+		{"Landroid/os/Build;->FINGERPRINT", "classes.dex"},
+	}
+	if !reflect.DeepEqual(anti.Emulator, wantEmulator) {
+		t.Errorf("expected emulator %+v, got %+v", wantEmulator, anti.Emulator)
+	}
+	wantRoot := []AntiAnalysisFinding{
+		{"/system/xbin/su", "classes.dex"},
+		{"com.topjohnwu.magisk", "classes.dex"},
+	}
+	if !reflect.DeepEqual(anti.Root, wantRoot) {
+		t.Errorf("expected root %+v, got %+v", wantRoot, anti.Root)
+	}
+	wantInstrumentation := []AntiAnalysisFinding{
+		{"re.frida.server", "classes.dex"},
+		{"Lde/robv/android/xposed/XposedBridge;", "classes.dex"},
+	}
+	if !reflect.DeepEqual(anti.Instrumentation, wantInstrumentation) {
+		t.Errorf("expected instrumentation %+v, got %+v", wantInstrumentation, anti.Instrumentation)
+	}
+}
+
+// TestAntiAnalysisBuildFields tests that reading Build fields alone isn't reported.
+func TestAntiAnalysisBuildFields(t *testing.T) {
+	b := newDexBuilder()
+	b.field("Landroid/os/Build;", "MODEL", stringClass)
+	path := writeZip(t, map[string]string{"classes.dex": string(b.build())})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := antiAnalysisAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if section != nil {
+		t.Errorf("expected no section, got %+v", section)
+	}
+}
@@ -0,0 +1,81 @@
+package apkfile
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+)
+
+// debuggerNames are the debug servers anti-debugging code looks for in the
+// process list or /proc/self/maps
+var debuggerNames = []string{"gdbserver", "gdb", "lldb-server", "android_server", "android_server64"}
+
+// armBreakpoints are the breakpoint gdb sets on 32-bit ARM and the BKPT
+// instruction, held in literal pools by code that scans itself for them
+var armBreakpoints = []uint32{0xe7f001f0, 0xe1200070}
+
+// checkAntiDebug lists the ways the library resists debugging in lib.AntiDebug
+func checkAntiDebug(lib *NativeLib, f *elf.File) {
+	syms, _ := f.ImportedSymbols()
+	for _, s := range syms {
+		if s.Name == "ptrace" {
+			lib.AntiDebug = append(lib.AntiDebug, "imports ptrace, attaching to itself keeps debuggers out")
+			break
+		}
+	}
+
+	var rodata []byte
+	if s := f.Section(".rodata"); s != nil && s.Type != elf.SHT_NOBITS {
+		rodata, _ = s.Data()
+	}
+	strs := make(map[string]bool)
+	for _, s := range bytes.Split(rodata, []byte{0}) {
+		strs[string(s)] = true
+	}
+	if bytes.Contains(rodata, []byte("TracerPid")) {
+		lib.AntiDebug = append(lib.AntiDebug, "reads TracerPid from /proc/self/status")
+	}
+	if bytes.Contains(rodata, []byte("ptrace_stop")) {
+		lib.AntiDebug = append(lib.AntiDebug, "reads ptrace_stop from /proc/self/wchan")
+	}
+	for _, name := range debuggerNames {
+		if strs[name] {
+			lib.AntiDebug = append(lib.AntiDebug, "looks for "+name)
+		}
+	}
+
+	if breakpointChecks(f) {
+		lib.AntiDebug = append(lib.AntiDebug, "compares its code to breakpoint instructions")
+	}
+}
+
+// breakpointChecks reports whether the code builds breakpoint instructions
+// as constants, which code that checks itself for breakpoints has to do
+func breakpointChecks(f *elf.File) bool {
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_EXECINSTR == 0 || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		code, err := s.Data()
+		if err != nil {
+			continue
+		}
+		for i := 0; i+4 <= len(code); i += 4 {
+			insn := binary.LittleEndian.Uint32(code[i:])
+			switch f.Machine {
+			case elf.EM_AARCH64:
+				// movz w/x, #0xd420, lsl #16 builds BRK #0, 0xd4200000
+				if insn&0x7fffffe0 == 0x52ba8400 {
+					return true
+				}
+			case elf.EM_ARM:
+				for _, bp := range armBreakpoints {
+					if insn == bp {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
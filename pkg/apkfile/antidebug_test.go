@@ -0,0 +1,47 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestCheckAntiDebug tests the native anti-debugging heuristics.
+func TestCheckAntiDebug(t *testing.T) {
+	// movz w8, #0xd420, lsl #16 and ret
+	check := []byte{0x08, 0x84, 0xba, 0x52, 0xc0, 0x03, 0x5f, 0xd6}
+	path := writeZip(t, map[string]string{
+		"lib/arm64-v8a/libguard.so": string(elfBuilder{
+			imports: []string{"ptrace", "fopen"},
+			rodata:  []string{"/proc/self/status", "TracerPid:", "gdbserver"},
+			text:    check,
+		}.build()),
+		"lib/arm64-v8a/libplain.so": string(elfBuilder{imports: []string{"fopen"}, rodata: []string{"gdbserver is great"}, text: check[4:]}.build()),
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := nativeAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	libs := make(map[string]NativeLib)
+	for _, l := range section.(*NativeLibs).Libraries {
+		libs[l.Path] = l
+	}
+
+	want := []string{
+		"imports ptrace, attaching to itself keeps debuggers out",
+		"reads TracerPid from /proc/self/status",
+		"looks for gdbserver",
+		"compares its code to breakpoint instructions",
+	}
+	if got := libs["lib/arm64-v8a/libguard.so"].AntiDebug; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := libs["lib/arm64-v8a/libplain.so"].AntiDebug; got != nil {
+		t.Errorf("unexpected anti-debugging %q", got)
+	}
+}
@@ -0,0 +1,121 @@
+package apkfile
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	// heavyReflection is the share of calls going through reflection from
+	// which an app is flagged, ordinary apps stay well below a percent
+	heavyReflection = 0.05
+	// heavyReflectionCalls keeps tiny apps from being flagged
+	heavyReflectionCalls = 20
+)
+
+// APIUsage counts the calls to APIs that obfuscated and malicious code leans
+// on, as behavior features
+type APIUsage struct {
+	// Invokes is the number of call sites in all the dex files
+	Invokes        int      `json:"invokes" structs:"invokes"`
+	Reflection     APICount `json:"reflection" structs:"reflection"`
+	Cipher         APICount `json:"cipher" structs:"cipher"`
+	Base64         APICount `json:"base64" structs:"base64"`
+	RuntimeExec    APICount `json:"runtime_exec" structs:"runtime_exec"`
+	ProcessBuilder APICount `json:"process_builder" structs:"process_builder"`
+	// HeavyReflection is set when an unusual share of the calls go through
+	// reflection, a classic obfuscation tell
+	HeavyReflection bool `json:"heavy_reflection" structs:"heavy_reflection"`
+}
+
+// APICount is how often an API is called
+type APICount struct {
+	Calls int `json:"calls" structs:"calls"`
+	// Methods is the number of methods calling it
+	Methods int `json:"methods" structs:"methods"`
+	// Ratio is Calls over all the call sites
+	Ratio float64 `json:"ratio" structs:"ratio"`
+}
+
+// reflectionMethods are the java.lang.Class methods that look up members by
+// name, java.lang.reflect is counted as a whole
+var reflectionMethods = map[string]bool{
+	"forName":                 true,
+	"getMethod":               true,
+	"getMethods":              true,
+	"getDeclaredMethod":       true,
+	"getDeclaredMethods":      true,
+	"getField":                true,
+	"getDeclaredField":        true,
+	"getConstructor":          true,
+	"getDeclaredConstructor":  true,
+	"getDeclaredConstructors": true,
+	"newInstance":             true,
+}
+
+// apiCount returns the counter a call to m falls into, nil if none
+func (u *APIUsage) apiCount(m dexMethodRef) *APICount {
+	switch {
+	case strings.HasPrefix(m.class, "Ljava/lang/reflect/"), m.class == "Ljava/lang/Class;" && reflectionMethods[m.name]:
+		return &u.Reflection
+	case m.class == cipherClass:
+		return &u.Cipher
+	case m.class == "Landroid/util/Base64;", strings.HasPrefix(m.class, "Ljava/util/Base64"):
+		return &u.Base64
+	case m.class == "Ljava/lang/Runtime;" && m.name == "exec":
+		return &u.RuntimeExec
+	case m.class == "Ljava/lang/ProcessBuilder;":
+		return &u.ProcessBuilder
+	}
+	return nil
+}
+
+type apiUsageAnalyzer struct{}
+
+func (apiUsageAnalyzer) Name() string    { return "api_usage" }
+func (apiUsageAnalyzer) Available() bool { return true }
+
+func (apiUsageAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	dexes, err := target.dexFiles()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(dexes) == 0 {
+		return nil, nil
+	}
+
+	usage := &APIUsage{}
+	for _, d := range dexes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		err := d.eachMethod(func(m dexMethod) {
+			if m.insns == nil {
+				return
+			}
+			calling := map[*APICount]bool{}
+			for _, call := range gatherFacts(d, m).calls {
+				usage.Invokes++
+				if c := usage.apiCount(call); c != nil {
+					c.Calls++
+					calling[c] = true
+				}
+			}
+			for c := range calling {
+				c.Methods++
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range []*APICount{&usage.Reflection, &usage.Cipher, &usage.Base64, &usage.RuntimeExec, &usage.ProcessBuilder} {
+		c.Ratio = ratio(c.Calls, usage.Invokes)
+	}
+	usage.HeavyReflection = usage.Reflection.Calls >= heavyReflectionCalls && usage.Reflection.Ratio >= heavyReflection
+	return usage, nil
+}
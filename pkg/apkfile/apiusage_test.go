@@ -0,0 +1,60 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestAPIUsageAnalyzer tests counting calls to reflection, crypto and exec.
+func TestAPIUsageAnalyzer(t *testing.T) {
+	b := newDexBuilder()
+	run := b.method("Lcom/example/Main;", "run", "V")
+	load := b.method("Lcom/example/Main;", "load", "V")
+	forName := b.method("Ljava/lang/Class;", "forName", "Ljava/lang/Class;", stringClass)
+	getName := b.method("Ljava/lang/Class;", "getName", stringClass)
+	invoke := b.method("Ljava/lang/reflect/Method;", "invoke", "Ljava/lang/Object;", "Ljava/lang/Object;", "[Ljava/lang/Object;")
+	decode := b.method("Landroid/util/Base64;", "decode", "[B", stringClass, "I")
+	exec := b.method("Ljava/lang/Runtime;", "exec", "Ljava/lang/Process;", stringClass)
+	b.class("Lcom/example/Main;", "Ljava/lang/Object;",
+		builderMethod{run, []uint16{
+			0x1071, uint16(forName), 0x0000, // invoke-static {v0}
+			0x106e, uint16(getName), 0x0000, // invoke-virtual {v0}
+			0x306e, uint16(invoke), 0x0210, // invoke-virtual {v0, v1, v2}
+			0x000e,
+		}},
+		builderMethod{load, []uint16{
+			0x1071, uint16(forName), 0x0000,
+			0x2071, uint16(decode), 0x0010,
+			0x206e, uint16(exec), 0x0010,
+			0x000e,
+		}},
+	)
+
+	path := writeZip(t, map[string]string{"classes.dex": string(b.build())})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := apiUsageAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage := section.(*APIUsage)
+
+	if usage.Invokes != 6 {
+		t.Errorf("expected 6 invokes, got %d", usage.Invokes)
+	}
+	if want := (APICount{Calls: 3, Methods: 2, Ratio: 0.5}); usage.Reflection != want {
+		t.Errorf("expected reflection %+v, got %+v", want, usage.Reflection)
+	}
+	if want := (APICount{Calls: 1, Methods: 1, Ratio: 0.1667}); usage.Base64 != want || usage.RuntimeExec != want {
+		t.Errorf("expected base64 and exec %+v, got %+v and %+v", want, usage.Base64, usage.RuntimeExec)
+	}
+	if usage.Cipher.Calls != 0 || usage.ProcessBuilder.Calls != 0 {
+		t.Errorf("unexpected calls %+v", usage)
+	}
+	if usage.HeavyReflection {
+		t.Error("expected too few calls to count as heavy reflection")
+	}
+}
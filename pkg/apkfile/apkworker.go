@@ -0,0 +1,239 @@
+package apkfile
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// workerStartBackoff is how long after a failed start the worker is tried
+	// again, doubling with every failure
+	workerStartBackoff = time.Second
+	// workerStartFailures failed starts within workerStartWindow disable the worker
+	workerStartFailures = 5
+	workerStartWindow   = 10 * time.Minute
+)
+
+// workerStartTimeout is how long the worker has to print READY
+var workerStartTimeout = 30 * time.Second
+
+// apkWorker is a resident JVM running worker/ApkfileWorker.java so that
+// apkfile.jar is not started from scratch for every scan, scans are fed to it
+// one at a time
+type apkWorker struct {
+	sync.Mutex
+	// classpath is the directory holding ApkfileWorker.class, empty disables the worker
+	classpath string
+	// disabled is set when the worker keeps failing to start
+	disabled bool
+	// failures are the failed starts since firstFailure, until retryAt scans
+	// fall back to java -jar
+	failures     int
+	firstFailure time.Time
+	retryAt      time.Time
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// apkfileError is an error reported by apkfile.jar itself rather than by the worker
+type apkfileError string
+
+func (e apkfileError) Error() string { return "apkfile: " + string(e) }
+
+// start launches the JVM worker and waits for its READY handshake
+func (w *apkWorker) start(ctx context.Context, s *Scanner) error {
+	// the worker lives across scans, so CPU time is the one limit it can't share
+	l := s.limits
+	l.CPU = 0
+	sep := string(os.PathListSeparator)
+	if _, ok := s.backend.(dockerBackend); ok {
+		// java runs in the Linux sandbox image whatever the host is
+		sep = ":"
+	}
+	name, args, err := s.backend.Wrap(l, s.toolPath("java"), []string{"-cp", s.apkfileJar + sep + w.classpath, "ApkfileWorker"}, "")
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(name, args...)
+	setProcessGroup(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	w.cmd = cmd
+	w.stdin = stdin
+	w.stdout = bufio.NewReader(stdout)
+
+	ready := make(chan error, 1)
+	go func() {
+		line, err := w.stdout.ReadString('\n')
+		if err == nil && strings.TrimSpace(line) != "READY" {
+			err = fmt.Errorf("unexpected handshake %q", line)
+		}
+		ready <- err
+	}()
+
+	timer := time.NewTimer(workerStartTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-ready:
+	case <-timer.C:
+		err = fmt.Errorf("no handshake within %v", workerStartTimeout)
+	case <-ctx.Done():
+		w.stop()
+		<-ready
+		return ctx.Err()
+	}
+	if err != nil {
+		w.stop()
+		return fmt.Errorf("apkfile worker failed to start: %v", err)
+	}
+
+	log.Debug("apkfile worker started, pid: ", cmd.Process.Pid)
+
+	return nil
+}
+
+// stop kills the JVM worker, it is restarted by the next scan
+func (w *apkWorker) stop() {
+	if w.cmd == nil {
+		return
+	}
+	w.stdin.Close()
+	signalProcessGroup(w.cmd, syscall.SIGKILL)
+	w.cmd.Wait()
+	w.cmd = nil
+}
+
+// usable tells whether scans should go to the worker at now
+func (w *apkWorker) usable(now time.Time) bool {
+	return w.classpath != "" && !w.disabled && !now.Before(w.retryAt)
+}
+
+// startFailed backs off from starting the worker again, disabling it after
+// workerStartFailures failed starts within workerStartWindow
+func (w *apkWorker) startFailed(now time.Time) {
+	if w.failures == 0 || now.Sub(w.firstFailure) > workerStartWindow {
+		w.failures = 0
+		w.firstFailure = now
+	}
+	w.failures++
+	if w.failures >= workerStartFailures {
+		log.Warnf("apkfile worker failed to start %d times, disabling it", w.failures)
+		w.disabled = true
+		return
+	}
+	w.retryAt = now.Add(workerStartBackoff << uint(w.failures-1))
+}
+
+// Close shuts the worker down for good
+func (w *apkWorker) Close() {
+	w.Lock()
+	defer w.Unlock()
+	w.stop()
+}
+
+// scan sends one path to the running worker and reads back its answer
+func (w *apkWorker) scan(ctx context.Context, s *Scanner, path string) (string, error) {
+	if w.cmd == nil {
+		if err := w.start(ctx, s); err != nil {
+			if ctx.Err() == nil {
+				w.startFailed(time.Now())
+			}
+			return "", err
+		}
+		w.failures = 0
+	}
+
+	type answer struct {
+		out string
+		err error
+	}
+	c := make(chan answer, 1)
+
+	go func() {
+		if _, err := io.WriteString(w.stdin, path+"\n"); err != nil {
+			c <- answer{"", err}
+			return
+		}
+		header, err := w.stdout.ReadString('\n')
+		if err != nil {
+			c <- answer{"", err}
+			return
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 2 {
+			c <- answer{"", fmt.Errorf("malformed apkfile worker header: %q", header)}
+			return
+		}
+		length, err := strconv.Atoi(fields[1])
+		if err != nil {
+			c <- answer{"", err}
+			return
+		}
+		body := make([]byte, length)
+		if _, err = io.ReadFull(w.stdout, body); err != nil {
+			c <- answer{"", err}
+			return
+		}
+		if fields[0] != "OK" {
+			c <- answer{"", apkfileError(body)}
+			return
+		}
+		c <- answer{string(body), nil}
+	}()
+
+	select {
+	case <-ctx.Done():
+		// the worker is in an unknown state, kill it and let the next scan restart it
+		w.stop()
+		<-c
+		return "", ctx.Err()
+	case a := <-c:
+		if _, ok := a.err.(apkfileError); a.err != nil && !ok {
+			// the JVM crashed or the pipe broke, restart on the next scan
+			w.stop()
+		}
+		return a.out, a.err
+	}
+}
+
+// runAPKFile returns the apkfile.jar JSON for path, using the resident JVM
+// worker when it is enabled and falling back to a one-shot java exec
+func (s *Scanner) runAPKFile(ctx context.Context, path string) (string, error) {
+	jvm := s.jvm
+	jvm.Lock()
+	if jvm.usable(time.Now()) && !strings.Contains(path, "\n") {
+		out, err := jvm.scan(ctx, s, path)
+		jvm.Unlock()
+		if _, ok := err.(apkfileError); err == nil || ok || ctx.Err() != nil {
+			return out, err
+		}
+		log.WithError(err).Warn("apkfile worker failed, falling back to java -jar")
+	} else {
+		jvm.Unlock()
+	}
+
+	return s.runTool(ctx, path, "java", "-jar", s.apkfileJar, path)
+}
@@ -0,0 +1,61 @@
+package apkfile
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAPKWorkerStartBackoff tests backing off from failed worker starts and disabling the worker only when they keep failing.
+func TestAPKWorkerStartBackoff(t *testing.T) {
+	w := &apkWorker{classpath: "worker"}
+	now := time.Unix(0, 0)
+
+	w.startFailed(now)
+	if w.usable(now) || !w.usable(now.Add(workerStartBackoff)) {
+		t.Errorf("expected the worker to be retried after %v", workerStartBackoff)
+	}
+
+	// failures spread wider than the window don't add up
+	for i := 0; i < workerStartFailures; i++ {
+		now = now.Add(workerStartWindow + time.Second)
+		w.startFailed(now)
+	}
+	if w.disabled {
+		t.Fatal("expected failures outside the window not to disable the worker")
+	}
+
+	for i := 1; i < workerStartFailures; i++ {
+		now = w.retryAt
+		w.startFailed(now)
+	}
+	if !w.disabled || w.usable(now.Add(workerStartWindow)) {
+		t.Errorf("expected %d failures within the window to disable the worker", workerStartFailures)
+	}
+}
+
+// TestAPKWorkerStartTimeout tests falling back to java -jar when the worker never finishes its handshake.
+func TestAPKWorkerStartTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { workerStartTimeout = timeout }(workerStartTimeout)
+	workerStartTimeout = 100 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "jvm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	java := fakeTool(t, dir, "java", `[ "$1" = -jar ] && echo '{}' && exit
+exec sleep 60`)
+
+	s := &Scanner{backend: localBackend{}, tools: map[string]string{"java": java}, jvm: &apkWorker{classpath: dir}}
+	out, err := s.runAPKFile(context.Background(), "testdata/trid.out")
+	if err != nil || strings.TrimSpace(out) != "{}" {
+		t.Errorf("expected the java -jar output, got %q, %v", out, err)
+	}
+	if s.jvm.cmd != nil || s.jvm.failures != 1 {
+		t.Errorf("expected the start to be stopped and counted, got %d failures", s.jvm.failures)
+	}
+}
@@ -0,0 +1,154 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// DefaultMaxEntrySize is the largest archive entry analyzers read into memory
+const DefaultMaxEntrySize = 100 << 20
+
+var (
+	// ErrNotArchive is returned by Target.Archive for files that aren't zips
+	ErrNotArchive = errors.New("not a zip archive")
+	// ErrEntryTooLarge is returned by Archive.ReadEntry for entries above the
+	// scanner's max analyzed entry size
+	ErrEntryTooLarge = errors.New("archive entry is larger than the max analyzed entry size")
+)
+
+// Archive gives analyzers access to the entries of an APK through its zip
+// central directory, entries are only decompressed when they are read
+type Archive struct {
+	*zip.ReadCloser
+	maxEntrySize int64
+}
+
+// archive is opened on first use and shared by every analyzer of a scan
+type archive struct {
+	once sync.Once
+	zip  *Archive
+	err  error
+}
+
+// Archive returns the zip archive the target is, or ErrNotArchive
+func (t *Target) Archive() (*Archive, error) {
+	t.archive.once.Do(func() {
+		r, err := zip.OpenReader(t.Path)
+		if err != nil {
+			t.archive.err = ErrNotArchive
+			return
+		}
+		t.archive.zip = &Archive{ReadCloser: r, maxEntrySize: t.maxEntrySize}
+	})
+	return t.archive.zip, t.archive.err
+}
+
+// close releases the archive if an analyzer opened it
+func (t *Target) close() {
+	t.archive.once.Do(func() { t.archive.err = ErrNotArchive })
+	if t.archive.zip != nil {
+		t.archive.zip.Close()
+	}
+}
+
+// Analyzable reports whether f is small enough to be read by ReadEntry
+func (a *Archive) Analyzable(f *zip.File) bool {
+	return a.maxEntrySize <= 0 || f.UncompressedSize64 <= uint64(a.maxEntrySize)
+}
+
+// ReadEntry decompresses f into memory, entries above the max analyzed entry
+// size fail with ErrEntryTooLarge
+func (a *Archive) ReadEntry(f *zip.File) ([]byte, error) {
+	if !a.Analyzable(f) {
+		return nil, ErrEntryTooLarge
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	if a.maxEntrySize <= 0 {
+		return ioutil.ReadAll(rc)
+	}
+	// the header size can lie, e.g. in zip bombs
+	data, err := ioutil.ReadAll(io.LimitReader(rc, a.maxEntrySize+1))
+	if err == nil && int64(len(data)) > a.maxEntrySize {
+		return nil, ErrEntryTooLarge
+	}
+	return data, err
+}
+
+// ArchiveEntry describes one entry of an APK
+type ArchiveEntry struct {
+	Name           string `json:"name" structs:"name"`
+	Size           uint64 `json:"size" structs:"size"`
+	CompressedSize uint64 `json:"compressed_size" structs:"compressed_size"`
+	Method         uint16 `json:"method" structs:"method"`
+	CRC32          string `json:"crc32" structs:"crc32"`
+	SHA256         string `json:"sha256,omitempty" structs:"sha256,omitempty"`
+	// Skipped is set for entries too large to be parsed by other analyzers
+	Skipped bool `json:"skipped,omitempty" structs:"skipped,omitempty"`
+}
+
+type entriesAnalyzer struct{}
+
+func (entriesAnalyzer) Name() string    { return "entries" }
+func (entriesAnalyzer) Available() bool { return true }
+
+// Run hashes every entry by streaming it, huge assets included, without
+// holding any of them in memory
+func (entriesAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	a, err := target.Archive()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ArchiveEntry, 0, len(a.File))
+	for _, f := range a.File {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entry := ArchiveEntry{
+			Name:           f.Name,
+			Size:           f.UncompressedSize64,
+			CompressedSize: f.CompressedSize64,
+			Method:         f.Method,
+			CRC32:          fmt.Sprintf("%08x", f.CRC32),
+			Skipped:        !a.Analyzable(f),
+		}
+		if !f.FileInfo().IsDir() {
+			entry.SHA256, err = hashEntry(f)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func hashEntry(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,79 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// writeZip creates a zip archive with the given entries for a test
+func writeZip(t *testing.T, entries map[string]string) string {
+	f, err := ioutil.TempFile("", "apk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, body := range entries {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(body))
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+// TestEntriesAnalyzer tests that large entries are hashed but can't be read.
+func TestEntriesAnalyzer(t *testing.T) {
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml": "manifest",
+		"assets/main.obb":     strings.Repeat("A", 4096),
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path, maxEntrySize: 1024}
+	defer target.close()
+
+	section, err := entriesAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := section.([]ArchiveEntry)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	a, _ := target.Archive()
+	for i, entry := range entries {
+		if entry.SHA256 == "" {
+			t.Errorf("%s should be hashed", entry.Name)
+		}
+		_, err := a.ReadEntry(a.File[i])
+		if entry.Name == "assets/main.obb" {
+			if !entry.Skipped || err != ErrEntryTooLarge {
+				t.Errorf("%s should be skipped, got %v", entry.Name, err)
+			}
+		} else if entry.Skipped || err != nil {
+			t.Errorf("%s should be readable, got %v", entry.Name, err)
+		}
+	}
+}
+
+// TestEntriesAnalyzerNotArchive tests that files that aren't zips get no section.
+func TestEntriesAnalyzerNotArchive(t *testing.T) {
+	target := &Target{Path: "testdata/trid.out"}
+	defer target.close()
+
+	section, err := entriesAnalyzer{}.Run(context.Background(), target)
+	if section != nil || err != nil {
+		t.Errorf("expected no section, got %v, %v", section, err)
+	}
+}
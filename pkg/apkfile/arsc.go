@@ -0,0 +1,242 @@
+package apkfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var errBadARSC = errors.New("malformed resource table")
+
+const (
+	arscTable   = 0x0002
+	arscPackage = 0x0200
+	arscType    = 0x0201
+)
+
+// resourceTable is what the analyzers read of resources.arsc
+type resourceTable struct {
+	// locales are the locales of the resource configurations, e.g. ru or
+	// zh-CN, the default configuration has none
+	locales []string
+	// strings are the string resources by ID, with their value in every
+	// locale, "" for the default configuration
+	strings map[uint32]map[string]string
+}
+
+// label resolves a manifest attribute, "@0x7f0e001b" for references, to
+// its default string, or its value when it isn't a reference
+func (r *resourceTable) label(attr string) string {
+	var id uint32
+	if _, err := fmt.Sscanf(attr, "@0x%08x", &id); err != nil {
+		return attr
+	}
+	return r.strings[id][""]
+}
+
+type resourceDoc struct {
+	once  sync.Once
+	table *resourceTable
+	err   error
+}
+
+// resources returns the APK's parsed resources.arsc, an empty table when it
+// has none
+func (t *Target) resources() (*resourceTable, error) {
+	t.resourceDoc.once.Do(func() {
+		if _, err := t.manifest(); err == ErrNotAPK {
+			t.resourceDoc.err = err
+			return
+		}
+		a, err := t.Archive()
+		if err != nil {
+			t.resourceDoc.err = err
+			return
+		}
+		t.resourceDoc.table = &resourceTable{strings: make(map[uint32]map[string]string)}
+		for _, f := range a.File {
+			if f.Name != "resources.arsc" {
+				continue
+			}
+			data, err := a.ReadEntry(f)
+			if err != nil {
+				t.resourceDoc.err = err
+				return
+			}
+			if t.resourceDoc.table, err = parseResourceTable(data); err != nil {
+				t.resourceDoc.err = fmt.Errorf("resources.arsc: %v", err)
+			}
+			return
+		}
+	})
+	return t.resourceDoc.table, t.resourceDoc.err
+}
+
+// parseResourceTable decodes the locales and string resources of a
+// ResTable
+func parseResourceTable(data []byte) (*resourceTable, error) {
+	if len(data) < 12 || binary.LittleEndian.Uint16(data) != arscTable {
+		return nil, errBadARSC
+	}
+	table := &resourceTable{strings: make(map[uint32]map[string]string)}
+	var values []string
+
+	err := eachChunk(data, uint32(binary.LittleEndian.Uint16(data[2:])), func(typ uint16, chunk []byte) error {
+		switch typ {
+		case axmlStringPool:
+			var err error
+			values, err = parseStringPool(chunk)
+			return err
+		case arscPackage:
+			return table.parsePackage(chunk, values)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// eachChunk calls fn with the chunks following a header of headerSize bytes
+func eachChunk(data []byte, headerSize uint32, fn func(typ uint16, chunk []byte) error) error {
+	for off := uint64(headerSize); off+8 <= uint64(len(data)); {
+		size := uint64(binary.LittleEndian.Uint32(data[off+4:]))
+		if size < 8 || off+size > uint64(len(data)) {
+			return errBadARSC
+		}
+		if err := fn(binary.LittleEndian.Uint16(data[off:]), data[off:off+size]); err != nil {
+			return err
+		}
+		off += size
+	}
+	return nil
+}
+
+// parsePackage decodes a ResTable_package and the types in it
+func (r *resourceTable) parsePackage(chunk []byte, values []string) error {
+	if len(chunk) < 288 {
+		return errBadARSC
+	}
+	id := binary.LittleEndian.Uint32(chunk[8:])
+	var typeNames []string
+	first := true
+
+	return eachChunk(chunk, uint32(binary.LittleEndian.Uint16(chunk[2:])), func(typ uint16, c []byte) error {
+		switch typ {
+		case axmlStringPool:
+			// the type names come first, then the key names
+			if first {
+				var err error
+				typeNames, err = parseStringPool(c)
+				first = false
+				return err
+			}
+		case arscType:
+			return r.parseType(c, id, typeNames, values)
+		}
+		return nil
+	})
+}
+
+// parseType decodes a ResTable_type, the entries of one type in one
+// configuration
+func (r *resourceTable) parseType(chunk []byte, pkg uint32, typeNames, values []string) error {
+	if len(chunk) < 32 {
+		return errBadARSC
+	}
+	headerSize := uint32(binary.LittleEndian.Uint16(chunk[2:]))
+	typeID := uint32(chunk[8])
+	flags := chunk[9]
+	count := binary.LittleEndian.Uint32(chunk[12:])
+	entriesStart := uint64(binary.LittleEndian.Uint32(chunk[16:]))
+	if uint64(headerSize) > uint64(len(chunk)) || headerSize < 32 {
+		return errBadARSC
+	}
+
+	// ResTable_config, language and country follow the size and imsi
+	locale := unpackLocale(chunk[28:30], 'a')
+	if locale != "" {
+		if country := unpackLocale(chunk[30:32], '0'); country != "" {
+			locale += "-" + country
+		}
+		r.locales = appendUnique(r.locales, locale)
+	}
+	if typeID == 0 || int(typeID) > len(typeNames) || typeNames[typeID-1] != "string" {
+		return nil
+	}
+
+	entry := func(index, off uint32) {
+		at := entriesStart + uint64(off)
+		if at+8 > uint64(len(chunk)) {
+			return
+		}
+		size := uint64(binary.LittleEndian.Uint16(chunk[at:]))
+		entryFlags := binary.LittleEndian.Uint16(chunk[at+2:])
+		var dataType byte
+		var data uint32
+		switch {
+		case entryFlags&0x0008 != 0: // compact, the value is inline
+			dataType, data = byte(entryFlags>>8), binary.LittleEndian.Uint32(chunk[at+4:])
+		case entryFlags&0x0001 != 0: // complex, e.g. a style
+			return
+		default:
+			if at+size+8 > uint64(len(chunk)) {
+				return
+			}
+			dataType, data = chunk[at+size+3], binary.LittleEndian.Uint32(chunk[at+size+4:])
+		}
+		if dataType != 0x03 || uint64(data) >= uint64(len(values)) {
+			return
+		}
+		id := pkg<<24 | typeID<<16 | index
+		if r.strings[id] == nil {
+			r.strings[id] = make(map[string]string)
+		}
+		r.strings[id][locale] = values[data]
+	}
+
+	for i := uint32(0); i < count; i++ {
+		switch {
+		case flags&0x01 != 0: // sparse, index and offset/4 pairs
+			at := uint64(headerSize) + uint64(i)*4
+			if at+4 > uint64(len(chunk)) {
+				return errBadARSC
+			}
+			entry(uint32(binary.LittleEndian.Uint16(chunk[at:])), uint32(binary.LittleEndian.Uint16(chunk[at+2:]))*4)
+		case flags&0x02 != 0: // offset16, offset/4 or 0xffff for none
+			at := uint64(headerSize) + uint64(i)*2
+			if at+2 > uint64(len(chunk)) {
+				return errBadARSC
+			}
+			if off := binary.LittleEndian.Uint16(chunk[at:]); off != 0xffff {
+				entry(i, uint32(off)*4)
+			}
+		default:
+			at := uint64(headerSize) + uint64(i)*4
+			if at+4 > uint64(len(chunk)) {
+				return errBadARSC
+			}
+			if off := binary.LittleEndian.Uint32(chunk[at:]); off != noIndex {
+				entry(i, off)
+			}
+		}
+	}
+	return nil
+}
+
+// unpackLocale decodes a ResTable_config language or country, two letters
+// or three packed into two bytes when the high bit is set
+func unpackLocale(b []byte, base byte) string {
+	switch {
+	case b[0] == 0:
+		return ""
+	case b[0]&0x80 != 0:
+		first := b[1] & 0x1f
+		second := (b[1]&0xe0)>>5 | (b[0]&0x03)<<3
+		third := (b[0] & 0x7c) >> 2
+		return string([]byte{base + first, base + second, base + third})
+	}
+	return string(b)
+}
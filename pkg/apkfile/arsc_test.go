@@ -0,0 +1,112 @@
+package apkfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// encodeARSC compiles string resources to a resources.arsc the way aapt
+// does, values holds the strings of every locale, "" being the default
+// configuration, and string i is resource 0x7f010000+i
+func encodeARSC(values map[string][]string) []byte {
+	chunk := func(out *bytes.Buffer, typ, headerSize uint16, payload []byte) {
+		binary.Write(out, binary.LittleEndian, typ)
+		binary.Write(out, binary.LittleEndian, headerSize)
+		binary.Write(out, binary.LittleEndian, uint32(8+len(payload)))
+		out.Write(payload)
+	}
+	locales := make([]string, 0, len(values))
+	for l := range values {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+
+	var pool, keys []string
+	var types bytes.Buffer
+	for _, locale := range locales {
+		strs := values[locale]
+		var p bytes.Buffer
+		w := func(v interface{}) { binary.Write(&p, binary.LittleEndian, v) }
+		w(byte(1)) // type ID
+		w(byte(0))
+		w(uint16(0))
+		w(uint32(len(strs)))
+		w(uint32(84 + 4*len(strs)))
+		// ResTable_config
+		config := make([]byte, 64)
+		config[0] = 64
+		if locale != "" {
+			copy(config[8:10], locale[:2])
+			if len(locale) == 5 {
+				copy(config[10:12], locale[3:])
+			}
+		}
+		p.Write(config)
+		for i := range strs {
+			w(uint32(16 * i))
+		}
+		for i, s := range strs {
+			if len(keys) <= i {
+				keys = append(keys, "string"+string(rune('a'+i)))
+			}
+			w(uint16(8))
+			w(uint16(0))
+			w(uint32(i))
+			w(uint16(8))
+			w(byte(0))
+			w(byte(0x03))
+			w(uint32(len(pool)))
+			pool = append(pool, s)
+		}
+		chunk(&types, arscType, 84, p.Bytes())
+	}
+
+	var pkg bytes.Buffer
+	binary.Write(&pkg, binary.LittleEndian, uint32(0x7f))
+	pkg.Write(make([]byte, 256)) // name
+	binary.Write(&pkg, binary.LittleEndian, uint32(288))
+	binary.Write(&pkg, binary.LittleEndian, uint32(1))
+	binary.Write(&pkg, binary.LittleEndian, uint32(0))
+	binary.Write(&pkg, binary.LittleEndian, uint32(len(keys)))
+	binary.Write(&pkg, binary.LittleEndian, uint32(0))
+	chunk(&pkg, axmlStringPool, 28, encodeStringPool([]string{"string"}))
+	chunk(&pkg, axmlStringPool, 28, encodeStringPool(keys))
+	pkg.Write(types.Bytes())
+
+	var table bytes.Buffer
+	binary.Write(&table, binary.LittleEndian, uint32(1)) // packageCount
+	chunk(&table, axmlStringPool, 28, encodeStringPool(pool))
+	chunk(&table, arscPackage, 288, pkg.Bytes())
+
+	var out bytes.Buffer
+	chunk(&out, arscTable, 12, table.Bytes())
+	return out.Bytes()
+}
+
+// TestParseResourceTable tests reading locales and strings from resources.arsc.
+func TestParseResourceTable(t *testing.T) {
+	data := encodeARSC(map[string][]string{
+		"":      {"Flashlight", "Turn on"},
+		"ru":    {"Фонарик", "Включить"},
+		"zh-CN": {"手电筒", "打开"},
+	})
+	table, err := parseResourceTable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ru", "zh-CN"}; !reflect.DeepEqual(table.locales, want) {
+		t.Errorf("expected locales %q, got %q", want, table.locales)
+	}
+	if want := map[string]string{"": "Turn on", "ru": "Включить", "zh-CN": "打开"}; !reflect.DeepEqual(table.strings[0x7f010001], want) {
+		t.Errorf("expected strings %q, got %q", want, table.strings[0x7f010001])
+	}
+	if label := table.label("@0x7f010000"); label != "Flashlight" {
+		t.Errorf("expected label Flashlight, got %q", label)
+	}
+	if _, err := parseResourceTable(data[:40]); err == nil {
+		t.Error("expected a truncated table to fail")
+	}
+}
@@ -0,0 +1,222 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ArtifactStore keeps files produced by scans, e.g. decompiled sources, so
+// analysts can get them without reprocessing the APK
+type ArtifactStore interface {
+	// Put stores the artifact name of the sample with the SHA256 sha256 and
+	// returns where it can be found
+	Put(ctx context.Context, sha256, name string, r io.Reader) (string, error)
+}
+
+// DirStore is an ArtifactStore keeping artifacts in a local directory, in a
+// subdirectory per sample only the scanner's user can read
+type DirStore string
+
+func (d DirStore) Put(ctx context.Context, sha256, name string, r io.Reader) (string, error) {
+	dir := filepath.Join(string(d), sha256)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	// readers never see a partly written artifact
+	tmp, err := ioutil.TempFile(dir, "."+name)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, name)
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// Artifact is a file extracted from the sample and kept in the scanner's
+// artifact store
+type Artifact struct {
+	Name string `json:"name" structs:"name"`
+	// Description says what the artifact is, e.g. which entry it was extracted from
+	Description string `json:"description" structs:"description"`
+	Size        int    `json:"size" structs:"size"`
+	// Location is where the store put it
+	Location string `json:"location" structs:"location"`
+}
+
+// WithArtifacts keeps the decoded AndroidManifest.xml, the signing
+// certificates, the launcher icon and suspicious entries of every APK in store
+func WithArtifacts(store ArtifactStore) Option {
+	return func(s *Scanner) {
+		s.artifacts = store
+	}
+}
+
+// launcherIconRegexp matches the densities of the default launcher icon
+var launcherIconRegexp = regexp.MustCompile(`^res/mipmap-[a-z0-9-]+/ic_launcher\.(png|webp)$`)
+
+type artifactsAnalyzer struct{ s *Scanner }
+
+func (artifactsAnalyzer) Name() string      { return "artifacts" }
+func (a artifactsAnalyzer) Available() bool { return a.s.artifacts != nil }
+
+func (a artifactsAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sha256sum, err := target.sha256()
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := []Artifact{}
+	put := func(name, description string, data []byte) error {
+		location, err := a.s.artifacts.Put(ctx, sha256sum, name, bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("storing %s: %v", name, err)
+		}
+		artifacts = append(artifacts, Artifact{Name: name, Description: description, Size: len(data), Location: location})
+		return nil
+	}
+
+	var manifest bytes.Buffer
+	manifest.WriteString(xml.Header)
+	root.writeXML(&manifest, 0)
+	if err := put("AndroidManifest.xml", "AndroidManifest.xml decoded to text XML", manifest.Bytes()); err != nil {
+		return nil, err
+	}
+
+	certs, err := target.signingCerts()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, c := range certs {
+		fingerprint := newSigner(c.cert).SHA256
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+		if err := put("cert-"+fingerprint+".pem", c.scheme+" signing certificate", data); err != nil {
+			return nil, err
+		}
+	}
+
+	arc, err := target.Archive()
+	if err != nil {
+		return nil, err
+	}
+	var icon *zip.File
+	names := make(map[string]bool)
+	for _, f := range arc.File {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if f.FileInfo().IsDir() || !arc.Analyzable(f) {
+			continue
+		}
+		if launcherIconRegexp.MatchString(f.Name) && (icon == nil || f.UncompressedSize64 > icon.UncompressedSize64) {
+			icon = f
+		}
+
+		var rules []string
+		for _, e := range checkEntryName(f.Name) {
+			rules = append(rules, e.Rule)
+		}
+		if e := checkEntryType(f); e != nil {
+			rules = append(rules, e.Rule)
+		}
+		if e, err := checkEntrySize(f); err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		} else if e != nil {
+			rules = append(rules, e.Rule)
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		data, err := arc.ReadEntry(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		name := "entry-" + artifactName(f.Name)
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("entry-%d-%s", i, artifactName(f.Name))
+		}
+		names[name] = true
+		if err := put(name, fmt.Sprintf("suspicious entry %q, %s", f.Name, strings.Join(rules, ", ")), data); err != nil {
+			return nil, err
+		}
+	}
+
+	if icon != nil {
+		data, err := arc.ReadEntry(icon)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", icon.Name, err)
+		}
+		if err := put("icon"+path.Ext(icon.Name), "launcher icon "+icon.Name, data); err != nil {
+			return nil, err
+		}
+	}
+	return artifacts, nil
+}
+
+// artifactName turns an entry name into a file name safe for any store
+func artifactName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.TrimLeft(name, "./"))
+}
+
+// writeXML writes e as indented text XML, attributes are written by their
+// local names since namespaces aren't kept when parsing
+func (e *xmlElement) writeXML(w *bytes.Buffer, depth int) {
+	indent := strings.Repeat("    ", depth)
+	w.WriteString(indent + "<" + e.Name)
+	names := make([]string, 0, len(e.Attrs))
+	for name := range e.Attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.WriteString(" " + name + `="`)
+		xml.EscapeText(w, []byte(e.Attrs[name]))
+		w.WriteString(`"`)
+	}
+	if len(e.Children) == 0 {
+		w.WriteString("/>\n")
+		return
+	}
+	w.WriteString(">\n")
+	for _, c := range e.Children {
+		c.writeXML(w, depth+1)
+	}
+	w.WriteString(indent + "</" + e.Name + ">\n")
+}
@@ -0,0 +1,89 @@
+package apkfile
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestArtifactsAnalyzer tests saving the manifest, certificates, icon and suspicious entries of an APK.
+func TestArtifactsAnalyzer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const pngMagic = "\x89PNG\r\n\x1a\n"
+	cert := selfSignedCert(t, pkix.Name{CommonName: "Flash Player Update"})
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.flash.update">
+		<uses-permission android:name="android.permission.SEND_SMS"/>
+		<application android:label="Flash &amp; Update"/></manifest>`
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml":              string(encodeAXML(t, manifest)),
+		"META-INF/CERT.RSA":                string(pkcs7SignedData(t, cert)),
+		"res/mipmap-hdpi/ic_launcher.png":  pngMagic + "small",
+		"res/mipmap-xhdpi/ic_launcher.png": pngMagic + "the biggest icon",
+		"assets/.payload":                  "dex\n035\x00",
+		"assets/fonts/regular.ttf":         "font",
+	})
+	defer os.Remove(path)
+	hashes, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Scanner{}
+	WithArtifacts(DirStore(dir))(s)
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := artifactsAnalyzer{s}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint := newSigner(mustParseCert(t, cert)).SHA256
+	artifacts := section.([]Artifact)
+	want := map[string]string{
+		"AndroidManifest.xml":          `<application label="Flash &amp; Update"/>`,
+		"cert-" + fingerprint + ".pem": "-----BEGIN CERTIFICATE-----",
+		"entry-assets_.payload":        "dex\n035",
+		"icon.png":                     "the biggest icon",
+	}
+	if len(artifacts) != len(want) {
+		t.Fatalf("expected %d artifacts, got %#v", len(want), artifacts)
+	}
+	for _, a := range artifacts {
+		content, ok := want[a.Name]
+		if !ok {
+			t.Errorf("unexpected artifact %#v", a)
+			continue
+		}
+		if a.Location != filepath.Join(dir, hashes.SHA256, a.Name) {
+			t.Errorf("unexpected location %s", a.Location)
+		}
+		data, err := ioutil.ReadFile(a.Location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), content) || a.Size != len(data) {
+			t.Errorf("%s: expected %q in %d bytes, got %q", a.Name, content, a.Size, data)
+		}
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, hashes.SHA256, "cert-"+fingerprint+".pem"))
+	if block, _ := pem.Decode(data); block == nil || string(block.Bytes) != string(mustParseCert(t, cert).Raw) {
+		t.Error("expected the certificate as PEM")
+	}
+
+	target = &Target{Path: "testdata/trid.out"}
+	defer target.close()
+	if section, err := (artifactsAnalyzer{s}).Run(context.Background(), target); section != nil || err != nil {
+		t.Errorf("expected nothing for a file that isn't an APK, got %v, %v", section, err)
+	}
+}
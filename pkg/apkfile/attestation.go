@@ -0,0 +1,85 @@
+package apkfile
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// AttestationAPI is a family of device integrity or root of trust APIs the
+// app calls, and the calls that show it
+type AttestationAPI struct {
+	Name        string   `json:"name" structs:"name"`
+	Description string   `json:"description" structs:"description"`
+	Calls       []string `json:"calls" structs:"calls"`
+}
+
+// attestationAPIs are matched against the methods the dex files reference,
+// a reference ending in -> matches every method of the class
+var attestationAPIs = []struct {
+	name, description string
+	refs              []string
+}{
+	{"safetynet", "SafetyNet Attestation, deprecated for Play Integrity", []string{
+		"Lcom/google/android/gms/safetynet/SafetyNetClient;->attest",
+		"Lcom/google/android/gms/safetynet/SafetyNetApi;->attest",
+	}},
+	{"play_integrity", "Play Integrity verdicts on the app, device and account", []string{
+		"Lcom/google/android/play/core/integrity/IntegrityManager;->requestIntegrityToken",
+		"Lcom/google/android/play/core/integrity/StandardIntegrityManager;->prepareIntegrityToken",
+		"Lcom/google/android/play/core/integrity/IntegrityManagerFactory;->create",
+	}},
+	{"key_attestation", "hardware-backed keys whose certificate chain proves the device's state", []string{
+		"Landroid/security/keystore/KeyGenParameterSpec$Builder;->setAttestationChallenge",
+		"Landroid/security/keystore/KeyGenParameterSpec$Builder;->setIsStrongBoxBacked",
+		"Landroid/security/keystore/KeyInfo;->isInsideSecureHardware",
+		"Landroid/security/keystore/KeyInfo;->getSecurityLevel",
+	}},
+	{"drm", "DRM, which checks the device's security level before decrypting media", []string{
+		"Landroid/media/MediaDrm;->",
+		"Landroid/drm/DrmManagerClient;->",
+	}},
+}
+
+type attestationAnalyzer struct{}
+
+func (attestationAnalyzer) Name() string    { return "attestation" }
+func (attestationAnalyzer) Available() bool { return true }
+
+func (attestationAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	if _, err := target.Archive(); err == ErrNotArchive {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	dexes, err := target.dexFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	calls := make(map[string][]string)
+	for _, d := range dexes {
+		for _, m := range d.methods {
+			ref := m.String()
+			for _, api := range attestationAPIs {
+				for _, prefix := range api.refs {
+					if strings.HasPrefix(ref, prefix) {
+						calls[api.name] = appendUnique(calls[api.name], ref)
+					}
+				}
+			}
+		}
+	}
+
+	var found []AttestationAPI
+	for _, api := range attestationAPIs {
+		if c := calls[api.name]; len(c) > 0 {
+			sort.Strings(c)
+			found = append(found, AttestationAPI{Name: api.name, Description: api.description, Calls: c})
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return found, nil
+}
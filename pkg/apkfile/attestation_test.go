@@ -0,0 +1,33 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestAttestationAnalyzer tests finding integrity and DRM API calls.
+func TestAttestationAnalyzer(t *testing.T) {
+	b := newDexBuilder()
+	b.method("Lcom/google/android/play/core/integrity/IntegrityManager;", "requestIntegrityToken", "Lcom/google/android/gms/tasks/Task;", "Lcom/google/android/play/core/integrity/IntegrityTokenRequest;")
+	b.method("Landroid/media/MediaDrm;", "<init>", "V", "Ljava/util/UUID;")
+	b.method("Landroid/media/MediaDrm;", "getPropertyString", stringClass, stringClass)
+	b.method("Landroid/media/MediaPlayer;", "start", "V")
+	path := writeZip(t, map[string]string{"classes.dex": string(b.build())})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := attestationAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apis := section.([]AttestationAPI)
+	if len(apis) != 2 || apis[0].Name != "play_integrity" || apis[1].Name != "drm" {
+		t.Fatalf("unexpected APIs %+v", apis)
+	}
+	if want := []string{"Landroid/media/MediaDrm;-><init>", "Landroid/media/MediaDrm;->getPropertyString"}; !reflect.DeepEqual(apis[1].Calls, want) {
+		t.Errorf("expected calls %q, got %q", want, apis[1].Calls)
+	}
+}
@@ -0,0 +1,364 @@
+package apkfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"unicode/utf16"
+)
+
+// xmlElement is an element of a parsed binary or text XML document
+type xmlElement struct {
+	Name string
+	// Attrs are keyed by local name, e.g. "name" for android:name
+	Attrs    map[string]string
+	Children []*xmlElement
+}
+
+// Attr returns the value of an attribute, "" when it is not set
+func (e *xmlElement) Attr(name string) string {
+	return e.Attrs[name]
+}
+
+// All returns the children of e named name
+func (e *xmlElement) All(name string) []*xmlElement {
+	var found []*xmlElement
+	for _, c := range e.Children {
+		if c.Name == name {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// Walk calls fn for e and every element below it
+func (e *xmlElement) Walk(fn func(*xmlElement)) {
+	fn(e)
+	for _, c := range e.Children {
+		c.Walk(fn)
+	}
+}
+
+var errBadAXML = errors.New("malformed binary XML")
+
+// ErrNotAPK is returned for archives without an AndroidManifest.xml
+var ErrNotAPK = errors.New("not an APK")
+
+const (
+	axmlStringPool   = 0x0001
+	axmlDocument     = 0x0003
+	axmlStartElement = 0x0102
+	axmlEndElement   = 0x0103
+	axmlResourceMap  = 0x0180
+)
+
+// androidAttrs names the android: attributes the analyzers read by resource
+// ID, manifests that strip attribute names from the string pool still have them
+var androidAttrs = map[uint32]string{
+	0x01010001: "label",
+	0x01010003: "name",
+	0x01010006: "permission",
+	0x01010007: "readPermission",
+	0x01010008: "writePermission",
+	0x01010009: "protectionLevel",
+	0x0101000a: "permissionGroup",
+	0x0101000b: "sharedUserId",
+	0x0101000e: "enabled",
+	0x0101000f: "debuggable",
+	0x01010010: "exported",
+	0x01010011: "process",
+	0x01010012: "taskAffinity",
+	0x01010017: "excludeFromRecents",
+	0x0101001c: "priority",
+	0x0101001d: "launchMode",
+	0x01010026: "mimeType",
+	0x01010027: "scheme",
+	0x01010028: "host",
+	0x01010029: "port",
+	0x0101002a: "path",
+	0x0101002b: "pathPrefix",
+	0x0101002c: "pathPattern",
+	0x01010204: "allowTaskReparenting",
+	0x0101020c: "minSdkVersion",
+	0x0101021b: "versionCode",
+	0x0101021c: "versionName",
+	0x01010261: "sharedUserLabel",
+	0x01010270: "targetSdkVersion",
+	0x01010280: "allowBackup",
+	0x010104ec: "usesCleartextTraffic",
+	0x010104ee: "autoVerify",
+	0x01010527: "networkSecurityConfig",
+}
+
+// parseXML parses an Android binary XML document, or a text one as produced
+// by apktool, into its root element
+func parseXML(data []byte) (*xmlElement, error) {
+	if len(data) > 0 && (data[0] == '<' || bytes.HasPrefix(data, []byte("\xef\xbb\xbf<"))) {
+		return parseTextXML(data)
+	}
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != axmlDocument {
+		return nil, errBadAXML
+	}
+
+	var (
+		pool   []string
+		resIDs []uint32
+		stack  []*xmlElement
+		root   *xmlElement
+	)
+
+	// the header size is ignored on purpose, packers tamper with it
+	for off := uint32(8); uint64(off)+8 <= uint64(len(data)); {
+		typ := binary.LittleEndian.Uint16(data[off:])
+		headerSize := uint32(binary.LittleEndian.Uint16(data[off+2:]))
+		size := binary.LittleEndian.Uint32(data[off+4:])
+		if size < 8 || uint64(off)+uint64(size) > uint64(len(data)) {
+			return nil, errBadAXML
+		}
+		chunk := data[off : off+size]
+
+		switch typ {
+		case axmlStringPool:
+			var err error
+			if pool, err = parseStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case axmlResourceMap:
+			for i := headerSize; i+4 <= size; i += 4 {
+				resIDs = append(resIDs, binary.LittleEndian.Uint32(chunk[i:]))
+			}
+		case axmlStartElement:
+			e, err := parseStartElement(chunk, pool, resIDs)
+			if err != nil {
+				return nil, err
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, e)
+			} else if root == nil {
+				root = e
+			}
+			stack = append(stack, e)
+		case axmlEndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+		off += size
+	}
+
+	if root == nil {
+		return nil, errBadAXML
+	}
+	return root, nil
+}
+
+// parseStringPool decodes a ResStringPool chunk
+func parseStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, errBadAXML
+	}
+	count := binary.LittleEndian.Uint32(chunk[8:])
+	flags := binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := binary.LittleEndian.Uint32(chunk[20:])
+	utf8 := flags&0x100 != 0
+
+	if uint64(28)+uint64(count)*4 > uint64(len(chunk)) {
+		return nil, errBadAXML
+	}
+	pool := make([]string, count)
+	for i := range pool {
+		off := uint64(stringsStart) + uint64(binary.LittleEndian.Uint32(chunk[28+i*4:]))
+		if off >= uint64(len(chunk)) {
+			continue
+		}
+		if utf8 {
+			pool[i] = poolStringUTF8(chunk[off:])
+		} else {
+			pool[i] = poolStringUTF16(chunk[off:])
+		}
+	}
+	return pool, nil
+}
+
+func poolStringUTF8(b []byte) string {
+	// UTF-16 length then UTF-8 length, each one or two bytes
+	skip := func(b []byte) (int, []byte) {
+		if len(b) == 0 {
+			return 0, b
+		}
+		if b[0]&0x80 != 0 && len(b) > 1 {
+			return int(b[0]&0x7f)<<8 | int(b[1]), b[2:]
+		}
+		return int(b[0]), b[1:]
+	}
+	_, b = skip(b)
+	n, b := skip(b)
+	if n > len(b) {
+		n = len(b)
+	}
+	return string(b[:n])
+}
+
+func poolStringUTF16(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint16(b))
+	b = b[2:]
+	if n&0x8000 != 0 && len(b) >= 2 {
+		n = (n&0x7fff)<<16 | int(binary.LittleEndian.Uint16(b))
+		b = b[2:]
+	}
+	if n*2 > len(b) {
+		n = len(b) / 2
+	}
+	units := make([]uint16, n)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// parseStartElement decodes a ResXMLTree_attrExt chunk
+func parseStartElement(chunk []byte, pool []string, resIDs []uint32) (*xmlElement, error) {
+	if len(chunk) < 36 {
+		return nil, errBadAXML
+	}
+	str := func(i uint32) string {
+		if uint64(i) < uint64(len(pool)) {
+			return pool[i]
+		}
+		return ""
+	}
+
+	ext := chunk[16:]
+	e := &xmlElement{
+		Name:  str(binary.LittleEndian.Uint32(ext[4:])),
+		Attrs: make(map[string]string),
+	}
+	attrStart := uint32(binary.LittleEndian.Uint16(ext[8:]))
+	attrSize := uint32(binary.LittleEndian.Uint16(ext[10:]))
+	attrCount := uint32(binary.LittleEndian.Uint16(ext[12:]))
+	if attrSize < 20 {
+		attrSize = 20
+	}
+
+	for i := uint32(0); i < attrCount; i++ {
+		a := uint64(16) + uint64(attrStart) + uint64(i*attrSize)
+		if a+20 > uint64(len(chunk)) {
+			return nil, errBadAXML
+		}
+		attr := chunk[a:]
+		nameIdx := binary.LittleEndian.Uint32(attr[4:])
+		name := str(nameIdx)
+		if uint64(nameIdx) < uint64(len(resIDs)) {
+			if known, ok := androidAttrs[resIDs[nameIdx]]; ok {
+				name = known
+			}
+		}
+		e.Attrs[name] = attrValue(attr, str)
+	}
+
+	return e, nil
+}
+
+// attrValue formats a Res_value the way aapt dump xmltree does
+func attrValue(attr []byte, str func(uint32) string) string {
+	raw := binary.LittleEndian.Uint32(attr[8:])
+	dataType := attr[15]
+	data := binary.LittleEndian.Uint32(attr[16:])
+
+	switch dataType {
+	case 0x03: // string
+		return str(data)
+	case 0x01: // reference
+		return fmt.Sprintf("@0x%08x", data)
+	case 0x10: // int decimal
+		return strconv.FormatInt(int64(int32(data)), 10)
+	case 0x11: // int hex
+		return fmt.Sprintf("0x%x", data)
+	case 0x12: // boolean
+		return strconv.FormatBool(data != 0)
+	}
+	if raw != noIndex {
+		return str(raw)
+	}
+	return fmt.Sprintf("0x%x", data)
+}
+
+// parseTextXML parses a text XML document into the same tree as parseXML
+func parseTextXML(data []byte) (*xmlElement, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlElement
+	var root *xmlElement
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if root != nil {
+				return root, nil
+			}
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &xmlElement{Name: t.Name.Local, Attrs: make(map[string]string)}
+			for _, a := range t.Attr {
+				e.Attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, e)
+			} else if root == nil {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+// manifestDoc is parsed on first use and shared by every analyzer of a scan
+type manifestDoc struct {
+	once sync.Once
+	root *xmlElement
+	err  error
+}
+
+// manifest returns the root <manifest> element of the APK's AndroidManifest.xml
+func (t *Target) manifest() (*xmlElement, error) {
+	t.manifestDoc.once.Do(func() {
+		a, err := t.Archive()
+		if err == ErrNotArchive {
+			t.manifestDoc.err = ErrNotAPK
+			return
+		}
+		if err != nil {
+			t.manifestDoc.err = err
+			return
+		}
+		for _, f := range a.File {
+			if f.Name != "AndroidManifest.xml" {
+				continue
+			}
+			data, err := a.ReadEntry(f)
+			if err != nil {
+				t.manifestDoc.err = err
+				return
+			}
+			if t.manifestDoc.root, err = parseXML(data); err != nil {
+				t.manifestDoc.err = fmt.Errorf("AndroidManifest.xml: %v", err)
+			}
+			return
+		}
+		t.manifestDoc.err = ErrNotAPK
+	})
+	return t.manifestDoc.root, t.manifestDoc.err
+}
@@ -0,0 +1,198 @@
+package apkfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"strconv"
+	"testing"
+	"unicode/utf16"
+)
+
+const androidNS = "http://schemas.android.com/apk/res/android"
+
+// encodeAXML compiles a text XML document to Android binary XML the way aapt
+// does, android: attributes are written with their resource IDs
+func encodeAXML(t *testing.T, text string) []byte {
+	resIDs := make(map[string]uint32)
+	for id, name := range androidAttrs {
+		resIDs[name] = id
+	}
+
+	var pool []string
+	var poolIDs []uint32
+	index := make(map[string]uint32)
+	intern := func(s string) uint32 {
+		if i, ok := index[s]; ok {
+			return i
+		}
+		pool = append(pool, s)
+		index[s] = uint32(len(pool) - 1)
+		return index[s]
+	}
+
+	var tokens []xml.Token
+	d := xml.NewDecoder(bytes.NewReader([]byte(text)))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		tokens = append(tokens, xml.CopyToken(tok))
+	}
+	// attribute names with resource IDs have to come first in the pool
+	for _, tok := range tokens {
+		if se, ok := tok.(xml.StartElement); ok {
+			for _, a := range se.Attr {
+				if id, ok := resIDs[a.Name.Local]; ok && a.Name.Space == androidNS {
+					if _, seen := index[a.Name.Local]; !seen {
+						intern(a.Name.Local)
+						poolIDs = append(poolIDs, id)
+					}
+				}
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	chunk := func(typ uint16, headerSize uint16, payload []byte) {
+		binary.Write(&body, binary.LittleEndian, typ)
+		binary.Write(&body, binary.LittleEndian, headerSize)
+		binary.Write(&body, binary.LittleEndian, uint32(8+len(payload)))
+		body.Write(payload)
+	}
+	for _, tok := range tokens {
+		var p bytes.Buffer
+		w := func(v interface{}) { binary.Write(&p, binary.LittleEndian, v) }
+		switch tt := tok.(type) {
+		case xml.StartElement:
+			w(uint32(1))       // line number
+			w(uint32(noIndex)) // comment
+			w(uint32(noIndex)) // namespace
+			w(intern(tt.Name.Local))
+			w(uint16(20)) // attributeStart
+			w(uint16(20)) // attributeSize
+			var attrs []xml.Attr
+			for _, a := range tt.Attr {
+				if a.Name.Space != "xmlns" && a.Name.Local != "xmlns" {
+					attrs = append(attrs, a)
+				}
+			}
+			w(uint16(len(attrs)))
+			w(uint16(0))
+			w(uint16(0))
+			w(uint16(0))
+			for _, a := range attrs {
+				w(uint32(noIndex))
+				w(intern(a.Name.Local))
+				raw, dataType, data := uint32(noIndex), byte(0x03), uint32(0)
+				if a.Value == "true" || a.Value == "false" {
+					dataType = 0x12
+					if a.Value == "true" {
+						data = noIndex
+					}
+				} else if n, err := strconv.Atoi(a.Value); err == nil {
+					dataType, data = 0x10, uint32(n)
+				} else {
+					raw = intern(a.Value)
+					data = raw
+				}
+				w(raw)
+				w(uint16(8))
+				w(byte(0))
+				w(dataType)
+				w(data)
+			}
+			chunk(axmlStartElement, 16, p.Bytes())
+		case xml.EndElement:
+			w(uint32(1))
+			w(uint32(noIndex))
+			w(uint32(noIndex))
+			w(intern(tt.Name.Local))
+			chunk(axmlEndElement, 16, p.Bytes())
+		}
+	}
+
+	var rm bytes.Buffer
+	binary.Write(&rm, binary.LittleEndian, poolIDs)
+
+	var out bytes.Buffer
+	elements := append([]byte(nil), body.Bytes()...)
+	body.Reset()
+	chunk(axmlStringPool, 28, encodeStringPool(pool))
+	chunk(axmlResourceMap, 8, rm.Bytes())
+	body.Write(elements)
+
+	binary.Write(&out, binary.LittleEndian, uint16(axmlDocument))
+	binary.Write(&out, binary.LittleEndian, uint16(8))
+	binary.Write(&out, binary.LittleEndian, uint32(8+body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+// encodeStringPool returns the body of a UTF-16 ResStringPool chunk
+func encodeStringPool(pool []string) []byte {
+	var strs bytes.Buffer
+	var offsets []uint32
+	for _, s := range pool {
+		offsets = append(offsets, uint32(strs.Len()))
+		units := utf16.Encode([]rune(s))
+		binary.Write(&strs, binary.LittleEndian, uint16(len(units)))
+		binary.Write(&strs, binary.LittleEndian, units)
+		binary.Write(&strs, binary.LittleEndian, uint16(0))
+	}
+	for strs.Len()%4 != 0 {
+		strs.WriteByte(0)
+	}
+	var sp bytes.Buffer
+	binary.Write(&sp, binary.LittleEndian, uint32(len(pool)))
+	binary.Write(&sp, binary.LittleEndian, uint32(0))
+	binary.Write(&sp, binary.LittleEndian, uint32(0)) // UTF-16
+	binary.Write(&sp, binary.LittleEndian, uint32(28+4*len(pool)))
+	binary.Write(&sp, binary.LittleEndian, uint32(0))
+	binary.Write(&sp, binary.LittleEndian, offsets)
+	sp.Write(strs.Bytes())
+	return sp.Bytes()
+}
+
+const testManifest = `<?xml version="1.0" encoding="utf-8"?>
+<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app" android:sharedUserId="android.uid.system">
+  <uses-permission android:name="android.permission.RECEIVE_SMS"/>
+  <application android:label="Example">
+    <activity android:name=".MainActivity" android:exported="true">
+      <intent-filter android:autoVerify="true">
+        <action android:name="android.intent.action.VIEW"/>
+        <category android:name="android.intent.category.BROWSABLE"/>
+        <data android:scheme="https" android:host="example.com" android:pathPrefix="/open"/>
+      </intent-filter>
+    </activity>
+  </application>
+</manifest>`
+
+// TestParseXML tests that binary and text manifests parse to the same tree.
+func TestParseXML(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"binary": encodeAXML(t, testManifest),
+		"text":   []byte(testManifest),
+	} {
+		root, err := parseXML(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if root.Name != "manifest" || root.Attr("package") != "com.example.app" || root.Attr("sharedUserId") != "android.uid.system" {
+			t.Errorf("%s: unexpected root %#v", name, root)
+		}
+		var data *xmlElement
+		root.Walk(func(e *xmlElement) {
+			if e.Name == "data" {
+				data = e
+			}
+		})
+		if data == nil || data.Attr("host") != "example.com" || data.Attr("pathPrefix") != "/open" {
+			t.Errorf("%s: unexpected data element %#v", name, data)
+		}
+		if app := root.All("application"); len(app) != 1 || app[0].Children[0].Attr("exported") != "true" {
+			t.Errorf("%s: exported attribute lost", name)
+		}
+	}
+}
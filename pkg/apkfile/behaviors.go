@@ -0,0 +1,329 @@
+package apkfile
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Behavior is a combination of findings that adds up to a known malware
+// technique
+type Behavior struct {
+	Name        string     `json:"name" structs:"name"`
+	Description string     `json:"description" structs:"description"`
+	Evidence    []Evidence `json:"evidence" structs:"evidence"`
+}
+
+// behaviorFacts is what the behavior rules look at, gathered once per scan
+type behaviorFacts struct {
+	pkg         string
+	permissions []string
+	components  []manifestComponent
+	archive     *Archive
+	// calls are the methods the dex files reference, as Lclass;->name, and
+	// the dex file referencing them
+	calls   map[string]string
+	dexes   []*dexFile
+	strings []foundString
+	billing []BillingSDK
+}
+
+// behaviorRule returns the behavior when the facts add up to it, nil otherwise
+type behaviorRule func(f *behaviorFacts) (*Behavior, error)
+
+var behaviorRules = []behaviorRule{
+	overlayAttack,
+	tollFraud,
+}
+
+var (
+	// passwordInputRegexp matches the password fields of HTML login forms
+	passwordInputRegexp = regexp.MustCompile(`(?i)<input[^>]+type\s*=\s*["']?password`)
+	// foregroundAPIs tell an app which app is in the foreground
+	foregroundAPIs = []string{
+		"Landroid/app/usage/UsageStatsManager;->queryUsageStats",
+		"Landroid/app/usage/UsageStatsManager;->queryEvents",
+		"Landroid/app/ActivityManager;->getRunningTasks",
+		"Landroid/app/ActivityManager;->getRunningAppProcesses",
+	}
+	// shortCodeRegexp matches the 4 to 6 digit numbers premium SMS are sent to
+	shortCodeRegexp = regexp.MustCompile(`^[1-9][0-9]{3,5}$`)
+	// billingURLRegexp matches the WAP and direct carrier billing endpoints
+	// that charge a subscription to the phone bill
+	billingURLRegexp = regexp.MustCompile(`(?i)^https?://[^/]*\bwap\.|/wap/|billing|subscri|\bdcb\b|msisdn|premium|carrier|charging`)
+)
+
+// maxShortCodes is how many short codes a toll fraud behavior lists
+const maxShortCodes = 10
+
+type behaviorsAnalyzer struct{}
+
+func (behaviorsAnalyzer) Name() string    { return "behaviors" }
+func (behaviorsAnalyzer) Available() bool { return true }
+
+func (behaviorsAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	a, err := target.Archive()
+	if err != nil {
+		return nil, err
+	}
+	dexes, err := target.dexFiles()
+	if err != nil {
+		return nil, err
+	}
+	found, err := target.extractStrings()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &behaviorFacts{
+		pkg:         root.Attr("package"),
+		permissions: usesPermissions(root),
+		components:  components(root),
+		archive:     a,
+		calls:       make(map[string]string),
+		dexes:       dexes,
+		strings:     found,
+		billing:     bundledBillingSDKs(dexes),
+	}
+	for _, d := range dexes {
+		for _, m := range d.methods {
+			if _, ok := f.calls[m.String()]; !ok {
+				f.calls[m.String()] = d.name
+			}
+		}
+	}
+
+	behaviors := []Behavior{}
+	for _, rule := range behaviorRules {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		b, err := rule(f)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			behaviors = append(behaviors, *b)
+		}
+	}
+	return behaviors, nil
+}
+
+// requests reports whether the app asks for permission
+func (f *behaviorFacts) requests(permission string) bool {
+	return containsString(f.permissions, "android.permission."+permission)
+}
+
+// calling returns the APIs the app references
+func (f *behaviorFacts) calling(apis []string) []string {
+	var found []string
+	for _, api := range apis {
+		if _, ok := f.calls[api]; ok {
+			found = append(found, api)
+		}
+	}
+	return found
+}
+
+// stringEvidence is value, found in str, located in the entry str was found in
+func (f *behaviorFacts) stringEvidence(str foundString, value, detail string) Evidence {
+	var data []byte
+	if str.Decrypted == nil {
+		// decrypted strings are only in the dex files encrypted
+		data = f.entryData(str.Location)
+	}
+	return stringEvidence(str.Location, data, value, detail)
+}
+
+// entryData returns the content of an archive entry, nil when it can't be read
+func (f *behaviorFacts) entryData(name string) []byte {
+	for _, d := range f.dexes {
+		if d.name == name {
+			return d.data
+		}
+	}
+	for _, file := range f.archive.File {
+		if file.Name == name {
+			data, _ := f.archive.ReadEntry(file)
+			return data
+		}
+	}
+	return nil
+}
+
+// accessibilityServices returns the services bound as accessibility services
+func (f *behaviorFacts) accessibilityServices() []string {
+	var found []string
+	for _, c := range f.components {
+		if c.Kind != "service" {
+			continue
+		}
+		bound := c.Element.Attr("permission") == "android.permission.BIND_ACCESSIBILITY_SERVICE"
+		for _, filter := range c.Element.All("intent-filter") {
+			for _, a := range filter.All("action") {
+				bound = bound || a.Attr("name") == "android.accessibilityservice.AccessibilityService"
+			}
+		}
+		if bound {
+			found = append(found, c.Name)
+		}
+	}
+	return found
+}
+
+// assetsMatching returns the first match of re in the assets with one of
+// extensions, e.g. the HTML login templates bankers overlay, by asset
+func (f *behaviorFacts) assetsMatching(re *regexp.Regexp, extensions ...string) (map[string]Evidence, error) {
+	found := make(map[string]Evidence)
+	for _, file := range f.archive.File {
+		ext := strings.ToLower(path.Ext(file.Name))
+		if !strings.HasPrefix(file.Name, "assets/") || !containsString(extensions, ext) || !f.archive.Analyzable(file) {
+			continue
+		}
+		data, err := f.archive.ReadEntry(file)
+		if err != nil {
+			return nil, err
+		}
+		if m := re.Find(data); m != nil {
+			found[file.Name] = stringEvidence(file.Name, data, string(m), "")
+		}
+	}
+	return found, nil
+}
+
+// overlayAttack is the banker kill chain: find out which app is in the
+// foreground, and draw a fake login screen over it when it's a target
+func overlayAttack(f *behaviorFacts) (*Behavior, error) {
+	templates, err := f.assetsMatching(passwordInputRegexp, ".html", ".htm")
+	if err != nil {
+		return nil, err
+	}
+	accessibility := f.accessibilityServices()
+	foreground := f.calling(foregroundAPIs)
+
+	var evidence []Evidence
+	overlay := f.requests("SYSTEM_ALERT_WINDOW")
+	if overlay {
+		evidence = append(evidence, permissionEvidence("android.permission.SYSTEM_ALERT_WINDOW", "requests SYSTEM_ALERT_WINDOW to draw over other apps"))
+	}
+	for _, s := range accessibility {
+		evidence = append(evidence, Evidence{
+			Kind:      EvidenceManifest,
+			Path:      "AndroidManifest.xml",
+			Attribute: "service@android:name",
+			Value:     s,
+			Detail:    "accessibility service " + s,
+		})
+	}
+	usageStats := false
+	for _, p := range []string{"PACKAGE_USAGE_STATS", "GET_TASKS"} {
+		if f.requests(p) {
+			if !usageStats {
+				evidence = append(evidence, permissionEvidence("android.permission."+p, "requests access to the apps being used"))
+			}
+			usageStats = true
+		}
+	}
+	for _, api := range foreground {
+		evidence = append(evidence, Evidence{Kind: EvidenceCode, Path: f.calls[api], Value: api, Detail: "calls " + api})
+	}
+	var names []string
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e := templates[name]
+		e.Detail = "login template " + name
+		evidence = append(evidence, e)
+	}
+
+	// overlays need a way to draw them, a way to time them and, unless they
+	// are drawn by the accessibility service, something to show
+	canDraw := overlay || len(accessibility) > 0
+	canTime := len(accessibility) > 0 || usageStats || len(foreground) > 0
+	hasContent := overlay || len(templates) > 0
+	if !canDraw || !canTime || !hasContent || len(evidence) < 3 {
+		return nil, nil
+	}
+	return &Behavior{
+		Name:        "overlay_attack",
+		Description: "watches the foreground app and draws over it, the banker overlay kill chain",
+		Evidence:    evidence,
+	}, nil
+}
+
+// tollFraud is sending premium SMS, or subscribing through WAP billing pages,
+// so the charges land on the phone bill
+func tollFraud(f *behaviorFacts) (*Behavior, error) {
+	var shortCodes, billing []string
+	// foundIn is the string each short code and URL was first found in
+	foundIn := make(map[string]foundString)
+	for _, str := range f.strings {
+		// short codes are only taken from the dex string tables, the digit
+		// runs of binaries and assets are mostly noise
+		if path.Ext(str.Location) == ".dex" && shortCodeRegexp.MatchString(str.Value) {
+			shortCodes = append(shortCodes, str.Value)
+			foundIn[str.Value] = str
+		}
+		for _, u := range urlRegexp.FindAllString(str.Value, -1) {
+			if billingURLRegexp.MatchString(u) {
+				billing = appendUnique(billing, u)
+				if _, ok := foundIn[u]; !ok {
+					foundIn[u] = str
+				}
+			}
+		}
+	}
+	sort.Strings(shortCodes)
+	sort.Strings(billing)
+
+	var evidence []Evidence
+	signals := 0
+	if f.requests("SEND_SMS") {
+		signals++
+		evidence = append(evidence, permissionEvidence("android.permission.SEND_SMS", "requests SEND_SMS"))
+	}
+	if len(shortCodes) > 0 {
+		signals++
+		if len(shortCodes) > maxShortCodes {
+			shortCodes = shortCodes[:maxShortCodes]
+		}
+		for _, c := range shortCodes {
+			evidence = append(evidence, f.stringEvidence(foundIn[c], c, "short code "+c))
+		}
+	}
+	if len(billing) > 0 {
+		signals++
+		for _, u := range billing {
+			evidence = append(evidence, f.stringEvidence(foundIn[u], u, "billing URL "+u))
+		}
+	}
+	carrier := false
+	for _, sdk := range f.billing {
+		if sdk.Kind == "carrier" {
+			carrier = true
+			evidence = append(evidence, Evidence{Kind: EvidenceCode, Value: sdk.Package, Detail: "carrier billing SDK " + sdk.Name})
+		}
+	}
+	if carrier {
+		signals++
+	}
+	if signals < 2 {
+		return nil, nil
+	}
+	return &Behavior{
+		Name:        "toll_fraud",
+		Description: "sends premium SMS or subscribes through carrier billing, charging the phone bill",
+		Evidence:    evidence,
+	}, nil
+}
@@ -0,0 +1,161 @@
+package apkfile
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// evidenceDetails lists the details of the evidence
+func evidenceDetails(evidence []Evidence) []string {
+	var details []string
+	for _, e := range evidence {
+		details = append(details, e.Detail)
+	}
+	return details
+}
+
+// TestOverlayAttack tests flagging the banker overlay kill chain.
+func TestOverlayAttack(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <uses-permission android:name="android.permission.SYSTEM_ALERT_WINDOW"/>
+  <uses-permission android:name="android.permission.PACKAGE_USAGE_STATS"/>
+  <application>
+    <service android:name=".Helper" android:permission="android.permission.BIND_ACCESSIBILITY_SERVICE"/>
+    <service android:name=".Sync"/>
+  </application>
+</manifest>`
+	b := newDexBuilder()
+	b.method("Landroid/app/ActivityManager;", "getRunningTasks", "Ljava/util/List;", "I")
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml":     string(encodeAXML(t, manifest)),
+		"classes.dex":             string(b.build()),
+		"assets/bank/login.html":  `<form><input name="user"><input type="password" name="pin"></form>`,
+		"assets/help.html":        `<p>Nothing to see</p>`,
+		"res/raw/login.html":      `<input type='password'>`,
+		"assets/inject/index.htm": `<INPUT TYPE=PASSWORD>`,
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := behaviorsAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	behaviors := section.([]Behavior)
+	if len(behaviors) != 1 || behaviors[0].Name != "overlay_attack" {
+		t.Fatalf("expected an overlay_attack, got %+v", behaviors)
+	}
+	want := []string{
+		"requests SYSTEM_ALERT_WINDOW to draw over other apps",
+		"accessibility service com.example.app.Helper",
+		"requests access to the apps being used",
+		"calls Landroid/app/ActivityManager;->getRunningTasks",
+		"login template assets/bank/login.html",
+		"login template assets/inject/index.htm",
+	}
+	if got := evidenceDetails(behaviors[0].Evidence); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected evidence %q, got %q", want, got)
+	}
+	if e := behaviors[0].Evidence[0]; e != permissionEvidence("android.permission.SYSTEM_ALERT_WINDOW", want[0]) {
+		t.Errorf("expected the permission in the manifest, got %#v", e)
+	}
+	if e := behaviors[0].Evidence[1]; e.Kind != EvidenceManifest || e.Attribute != "service@android:name" || e.Value != "com.example.app.Helper" {
+		t.Errorf("expected the accessibility service in the manifest, got %#v", e)
+	}
+	if e := behaviors[0].Evidence[3]; e.Kind != EvidenceCode || e.Path != "classes.dex" {
+		t.Errorf("expected the call in classes.dex, got %#v", e)
+	}
+	if e := behaviors[0].Evidence[4]; e.Kind != EvidenceString || e.Path != "assets/bank/login.html" || e.Offset == nil || *e.Offset != 25 {
+		t.Errorf("expected the password input of the login template, got %#v", e)
+	}
+}
+
+// TestOverlayAttackAlone tests that drawing over other apps isn't flagged on its own.
+func TestOverlayAttackAlone(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <uses-permission android:name="android.permission.SYSTEM_ALERT_WINDOW"/>
+  <uses-permission android:name="android.permission.GET_TASKS"/>
+  <application/>
+</manifest>`
+	path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := behaviorsAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if behaviors := section.([]Behavior); len(behaviors) != 0 {
+		t.Errorf("expected no behaviors, got %+v", behaviors)
+	}
+}
+
+// TestTollFraud tests flagging premium SMS and carrier billing.
+func TestTollFraud(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <uses-permission android:name="android.permission.SEND_SMS"/>
+</manifest>`
+	b := newDexBuilder()
+	b.str("7132")
+	b.str("35011")
+	b.str("0800")
+	b.str("http://pay.example.com/wap/subscribe?msisdn=")
+	b.str("https://www.example.com/about")
+	dex := b.build()
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml": string(encodeAXML(t, manifest)),
+		"classes.dex":         string(dex),
+		"assets/sizes.txt":    "1024 2048 4096",
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := behaviorsAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	behaviors := section.([]Behavior)
+	if len(behaviors) != 1 || behaviors[0].Name != "toll_fraud" {
+		t.Fatalf("expected a toll_fraud, got %+v", behaviors)
+	}
+	want := []string{
+		"requests SEND_SMS",
+		"short code 35011",
+		"short code 7132",
+		"billing URL http://pay.example.com/wap/subscribe?msisdn=",
+	}
+	if got := evidenceDetails(behaviors[0].Evidence); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected evidence %q, got %q", want, got)
+	}
+	e := behaviors[0].Evidence[1]
+	if e.Kind != EvidenceString || e.Path != "classes.dex" || e.Value != "35011" || e.Offset == nil || *e.Offset != int64(bytes.Index(dex, []byte("35011"))) {
+		t.Errorf("expected the short code's offset in classes.dex, got %#v", e)
+	}
+}
+
+// TestTollFraudShortCodes tests that short codes aren't flagged without a way to use them.
+func TestTollFraudShortCodes(t *testing.T) {
+	b := newDexBuilder()
+	b.str("7132")
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml": string(encodeAXML(t, `<manifest package="com.example.app"/>`)),
+		"classes.dex":         string(b.build()),
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := behaviorsAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if behaviors := section.([]Behavior); len(behaviors) != 0 {
+		t.Errorf("expected no behaviors, got %+v", behaviors)
+	}
+}
@@ -0,0 +1,109 @@
+package apkfile
+
+import (
+	"context"
+	"sort"
+)
+
+// Billing is how the app takes payments
+type Billing struct {
+	SDKs []BillingSDK `json:"sdks" structs:"sdks"`
+	// SMSPermissions are the SMS permissions the app requests
+	SMSPermissions []string `json:"sms_permissions,omitempty" structs:"sms_permissions,omitempty"`
+	// TollFraudRisk is set when the app embeds payment flows and can send or
+	// read SMS, what toll fraud needs to subscribe users and confirm it
+	TollFraudRisk bool `json:"toll_fraud_risk" structs:"toll_fraud_risk"`
+}
+
+// BillingSDK is a billing or payment library the app bundles
+type BillingSDK struct {
+	Name string `json:"name" structs:"name"`
+	// Kind is store for app store in-app billing, payment for payment
+	// processors and carrier for carrier and SMS billing
+	Kind    string `json:"kind" structs:"kind"`
+	Package string `json:"package" structs:"package"`
+}
+
+// billingSDKs are matched by the package of the classes they bundle
+var billingSDKs = []BillingSDK{
+	{"Google Play Billing", "store", "com.android.billingclient"},
+	{"Google Play In-app Billing v3", "store", "com.android.vending.billing"},
+	{"Huawei IAP", "store", "com.huawei.hms.iap"},
+	{"Samsung IAP", "store", "com.samsung.android.sdk.iap"},
+	{"Amazon IAP", "store", "com.amazon.device.iap"},
+	{"RevenueCat", "store", "com.revenuecat.purchases"},
+	{"Stripe", "payment", "com.stripe.android"},
+	{"Braintree", "payment", "com.braintreepayments"},
+	{"PayPal", "payment", "com.paypal.android"},
+	{"Adyen", "payment", "com.adyen.checkout"},
+	{"Checkout.com", "payment", "com.checkout"},
+	{"Razorpay", "payment", "com.razorpay"},
+	{"Paytm", "payment", "com.paytm"},
+	{"Alipay", "payment", "com.alipay"},
+	{"UnionPay", "payment", "com.unionpay"},
+	{"Mercado Pago", "payment", "com.mercadopago"},
+	{"YooMoney", "payment", "ru.yoomoney"},
+	{"Fortumo", "carrier", "com.fortumo"},
+	{"Boku", "carrier", "com.boku"},
+	{"Centili", "carrier", "com.centili"},
+	{"DIMOCO", "carrier", "com.dimoco"},
+	{"Bango", "carrier", "com.bango"},
+	{"Mobiamo", "carrier", "com.mobiamo"},
+}
+
+// smsPermissions are the permissions toll fraud sends premium SMS and reads
+// the confirmation codes with
+var smsPermissions = []string{
+	"android.permission.SEND_SMS",
+	"android.permission.RECEIVE_SMS",
+	"android.permission.READ_SMS",
+}
+
+// bundledBillingSDKs returns the billing SDKs in the dex files
+func bundledBillingSDKs(dexes []*dexFile) []BillingSDK {
+	var prefixes []string
+	for _, sdk := range billingSDKs {
+		prefixes = append(prefixes, sdk.Package)
+	}
+	found := embeddedPackages(dexes, prefixes)
+	var sdks []BillingSDK
+	for _, sdk := range billingSDKs {
+		if found[sdk.Package] {
+			sdks = append(sdks, sdk)
+		}
+	}
+	return sdks
+}
+
+type billingAnalyzer struct{}
+
+func (billingAnalyzer) Name() string    { return "billing" }
+func (billingAnalyzer) Available() bool { return true }
+
+func (billingAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dexes, err := target.dexFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	sdks := bundledBillingSDKs(dexes)
+	if len(sdks) == 0 {
+		return nil, nil
+	}
+	b := &Billing{SDKs: sdks}
+	for _, p := range usesPermissions(root) {
+		if containsString(smsPermissions, p) {
+			b.SMSPermissions = append(b.SMSPermissions, p)
+		}
+	}
+	sort.Strings(b.SMSPermissions)
+	b.TollFraudRisk = len(b.SMSPermissions) > 0
+	return b, nil
+}
@@ -0,0 +1,61 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestBillingAnalyzer tests detecting billing SDKs and flagging them next to
+// SMS permissions.
+func TestBillingAnalyzer(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <uses-permission android:name="android.permission.SEND_SMS"/>
+  <uses-permission android:name="android.permission.RECEIVE_SMS"/>
+  <uses-permission android:name="android.permission.INTERNET"/>
+</manifest>`
+	b := newDexBuilder()
+	b.class("Lcom/android/billingclient/api/BillingClient;", "Ljava/lang/Object;")
+	b.class("Lcom/fortumo/android/Fortumo;", "Ljava/lang/Object;")
+	b.class("Lcom/example/app/Main;", "Landroid/app/Activity;")
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml": string(encodeAXML(t, manifest)),
+		"classes.dex":         string(b.build()),
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := billingAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Billing{
+		SDKs: []BillingSDK{
+			{"Google Play Billing", "store", "com.android.billingclient"},
+			{"Fortumo", "carrier", "com.fortumo"},
+		},
+		SMSPermissions: []string{"android.permission.RECEIVE_SMS", "android.permission.SEND_SMS"},
+		TollFraudRisk:  true,
+	}
+	if !reflect.DeepEqual(section, want) {
+		t.Errorf("expected %+v, got %+v", want, section)
+	}
+
+	// the carrier billing SDK and SEND_SMS add up to toll fraud
+	section, err = behaviorsAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	behaviors := section.([]Behavior)
+	if len(behaviors) != 1 || behaviors[0].Name != "toll_fraud" {
+		t.Fatalf("expected a toll_fraud, got %+v", behaviors)
+	}
+	if want := []string{"requests SEND_SMS", "carrier billing SDK Fortumo"}; !reflect.DeepEqual(evidenceDetails(behaviors[0].Evidence), want) {
+		t.Errorf("expected evidence %q, got %+v", want, behaviors[0].Evidence)
+	}
+	if e := behaviors[0].Evidence[1]; e.Kind != EvidenceCode || e.Value != "com.fortumo" {
+		t.Errorf("expected the SDK's package, got %#v", e)
+	}
+}
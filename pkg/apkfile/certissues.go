@@ -0,0 +1,92 @@
+package apkfile
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+const (
+	// maxValidityYears is longer than anyone means a certificate to last,
+	// keytool's own examples use 10000 days, about 27 years
+	maxValidityYears = 100
+	// minRSAKeySize is the smallest RSA or DSA key that isn't weak
+	minRSAKeySize = 2048
+	// minECKeySize is the smallest EC key that isn't weak
+	minECKeySize = 224
+)
+
+// weakSignatureAlgorithms can be forged with collisions
+var weakSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA: true,
+	x509.MD5WithRSA: true,
+}
+
+// keySize returns the size in bits of the certificate's public key
+func keySize(cert *x509.Certificate) int {
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *dsa.PublicKey:
+		return k.P.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
+
+// certIssues lists what is wrong with a signing certificate as of now.
+// Android doesn't check validity periods, but they tell how carefully, and
+// when, the key was made
+func certIssues(cert *x509.Certificate, now time.Time) []string {
+	var issues []string
+	if cert.Subject.CommonName == "Android Debug" {
+		issues = append(issues, "debug certificate, the app was never signed for release")
+	}
+
+	selfSigned := bytes.Equal(cert.RawSubject, cert.RawIssuer)
+	if selfSigned {
+		if years := yearsBetween(cert.NotBefore, cert.NotAfter); years >= maxValidityYears {
+			issues = append(issues, fmt.Sprintf("self-signed and valid for %d years", years))
+		}
+	}
+	if cert.NotAfter.Before(now) {
+		issues = append(issues, "expired on "+cert.NotAfter.UTC().Format("2006-01-02"))
+	}
+	if cert.NotBefore.After(now) {
+		issues = append(issues, "created in the future, on "+cert.NotBefore.UTC().Format("2006-01-02"))
+	}
+
+	if weakSignatureAlgorithms[cert.SignatureAlgorithm] {
+		issues = append(issues, "weak signature algorithm "+cert.SignatureAlgorithm.String())
+	}
+	size := keySize(cert)
+	switch cert.PublicKeyAlgorithm {
+	case x509.RSA, x509.DSA:
+		if size < minRSAKeySize {
+			issues = append(issues, fmt.Sprintf("weak %d-bit %s key", size, cert.PublicKeyAlgorithm))
+		}
+	case x509.ECDSA:
+		if size < minECKeySize {
+			issues = append(issues, fmt.Sprintf("weak %d-bit %s key", size, cert.PublicKeyAlgorithm))
+		}
+	}
+	return issues
+}
+
+// yearsBetween returns the number of whole years from a to b, which unlike a
+// time.Duration doesn't overflow after 292 years
+func yearsBetween(a, b time.Time) int {
+	years := b.Year() - a.Year()
+	if b.AddDate(-years, 0, 0).Before(a) {
+		years--
+	}
+	return years
+}
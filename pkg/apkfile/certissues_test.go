@@ -0,0 +1,72 @@
+package apkfile
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestCertIssues tests the signing certificate quality checks.
+func TestCertIssues(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a 512-bit modulus, the key is only ever written into the certificate
+	weak := &rsa.PublicKey{N: new(big.Int).SetBit(big.NewInt(1), 511, 1), E: 65537}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		tmpl   x509.Certificate
+		pub    interface{}
+		weakMD bool
+		want   []string
+	}{
+		{
+			name: "release",
+			tmpl: x509.Certificate{Subject: pkix.Name{CommonName: "Example"}, NotBefore: now.AddDate(-1, 0, 0), NotAfter: now.AddDate(25, 0, 0)},
+			pub:  &key.PublicKey,
+		},
+		{
+			name: "debug",
+			tmpl: x509.Certificate{Subject: pkix.Name{CommonName: "Android Debug", Organization: []string{"Android"}}, NotBefore: now.AddDate(-2, 0, 0), NotAfter: now.AddDate(-1, 0, 0)},
+			pub:  &key.PublicKey,
+			want: []string{"debug certificate, the app was never signed for release", "expired on 2023-06-01"},
+		},
+		{
+			name:   "careless",
+			tmpl:   x509.Certificate{Subject: pkix.Name{CommonName: "a"}, NotBefore: now.AddDate(0, 0, 3), NotAfter: now.AddDate(1000, 0, 0)},
+			pub:    weak,
+			weakMD: true,
+			want: []string{
+				"self-signed and valid for 999 years",
+				"created in the future, on 2024-06-04",
+				"weak signature algorithm MD5-RSA",
+				"weak 512-bit RSA key",
+			},
+		},
+	}
+	for _, test := range tests {
+		test.tmpl.SerialNumber = big.NewInt(1)
+		der, err := x509.CreateCertificate(rand.Reader, &test.tmpl, &test.tmpl, test.pub, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := mustParseCert(t, der)
+		if test.weakMD {
+			// Go refuses to sign with MD5, so only the algorithm is swapped
+			cert.SignatureAlgorithm = x509.MD5WithRSA
+		}
+		if got := certIssues(cert, now); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package apkfile
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCloudProbeInterval is the least time between two probes
+	DefaultCloudProbeInterval = time.Second
+	// DefaultCloudProbes is how many backends of a scan are probed
+	DefaultCloudProbes = 10
+)
+
+// CloudProbeConfig lets the cloud_backends analyzer check whether the
+// backends it finds are open, by reading them without credentials. Nothing
+// is ever written
+type CloudProbeConfig struct {
+	// Client sends the probes, http.DefaultClient when nil
+	Client *http.Client
+	// Interval is the least time between two probes of the scanner, across
+	// scans
+	Interval time.Duration
+	// MaxProbes caps the probes of a scan
+	MaxProbes int
+}
+
+// CloudBackends are the cloud services the app talks to, Firebase projects
+// and storage buckets left open leak the data of every user of the app
+type CloudBackends struct {
+	Endpoints []CloudEndpoint `json:"endpoints,omitempty" structs:"endpoints,omitempty"`
+	// Projects are the Google Cloud project IDs of the endpoints
+	Projects []string `json:"projects,omitempty" structs:"projects,omitempty"`
+	// AppIDs are the Firebase app IDs, 1:<project number>:android:<hash>
+	AppIDs  []string `json:"app_ids,omitempty" structs:"app_ids,omitempty"`
+	APIKeys []string `json:"api_keys,omitempty" structs:"api_keys,omitempty"`
+}
+
+// CloudEndpoint is a cloud backend found in the app's strings
+type CloudEndpoint struct {
+	// Kind is firebase_database, firebase_storage, gcs_bucket, s3_bucket,
+	// cloud_functions or app_engine
+	Kind    string `json:"kind" structs:"kind"`
+	URL     string `json:"url" structs:"url"`
+	Project string `json:"project,omitempty" structs:"project,omitempty"`
+	// Location is the entry it was found in
+	Location string `json:"location" structs:"location"`
+	// Probe is the status an unauthenticated read got, or why it failed,
+	// empty when the endpoint wasn't probed
+	Probe string `json:"probe,omitempty" structs:"probe,omitempty"`
+	// Exposed is set when the read succeeded, a database anyone can read or a
+	// bucket anyone can list
+	Exposed bool `json:"exposed,omitempty" structs:"exposed,omitempty"`
+}
+
+// cloudPatterns find the endpoints, the first group is the URL, or the
+// bucket name for buckets, and the second one the project if the URL has it
+var cloudPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"firebase_database", regexp.MustCompile(`\b(https://([a-z0-9-]+?)(?:-default-rtdb)?(?:\.[a-z0-9-]+)?\.(?:firebaseio\.com|firebasedatabase\.app))\b`)},
+	// google_storage_bucket is the bare bucket name, not a URL
+	{"firebase_storage", regexp.MustCompile(`(?:^|[^/.a-z0-9-])(([a-z0-9-]+)\.(?:appspot\.com|firebasestorage\.app))\b`)},
+	{"gcs_bucket", regexp.MustCompile(`(?:\bgs://|\bhttps?://storage\.googleapis\.com/)([a-z0-9][a-z0-9._-]{1,61}[a-z0-9])\b`)},
+	{"s3_bucket", regexp.MustCompile(`\b([a-z0-9][a-z0-9.-]{1,61}[a-z0-9])\.s3(?:[.-][a-z0-9-]+)?\.amazonaws\.com\b`)},
+	{"cloud_functions", regexp.MustCompile(`\b(https://[a-z]+-[a-z]+[0-9]-([a-z0-9-]+)\.cloudfunctions\.net)\b`)},
+	{"app_engine", regexp.MustCompile(`\b(https://([a-z0-9-]+)\.appspot\.com)\b`)},
+}
+
+var (
+	firebaseAppID = regexp.MustCompile(`\b1:\d+:android:[0-9a-f]+\b`)
+	googleAPIKey  = regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)
+)
+
+// probeURL returns the URL an unauthenticated read of an endpoint is sent
+// to, empty for the kinds that aren't probed
+func probeURL(e CloudEndpoint) string {
+	switch e.Kind {
+	case "firebase_database":
+		return e.URL + "/.json?shallow=true"
+	case "firebase_storage":
+		return "https://firebasestorage.googleapis.com/v0/b/" + e.URL + "/o?maxResults=1"
+	case "gcs_bucket":
+		return "https://storage.googleapis.com/storage/v1/b/" + e.URL + "/o?maxResults=1"
+	case "s3_bucket":
+		return "https://" + e.URL + ".s3.amazonaws.com/?max-keys=1"
+	}
+	return ""
+}
+
+// WithCloudProbe probes the Firebase databases and storage buckets the
+// cloud_backends section lists
+func WithCloudProbe(cfg CloudProbeConfig) Option {
+	return func(s *Scanner) {
+		if cfg.Client == nil {
+			cfg.Client = http.DefaultClient
+		}
+		if cfg.Interval == 0 {
+			cfg.Interval = DefaultCloudProbeInterval
+		}
+		if cfg.MaxProbes == 0 {
+			cfg.MaxProbes = DefaultCloudProbes
+		}
+		s.cloudProbe = &cloudProber{cfg: cfg}
+	}
+}
+
+// cloudProber spaces out the probes of every scan
+type cloudProber struct {
+	cfg  CloudProbeConfig
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the next probe may be sent
+func (p *cloudProber) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.cfg.Interval)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// probe reads the endpoint without credentials
+func (p *cloudProber) probe(ctx context.Context, e *CloudEndpoint) error {
+	if err := p.wait(ctx); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", probeURL(*e), nil)
+	if err != nil {
+		e.Probe = err.Error()
+		return nil
+	}
+	resp, err := p.cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e.Probe = err.Error()
+		return nil
+	}
+	resp.Body.Close()
+	e.Probe = resp.Status
+	e.Exposed = resp.StatusCode == http.StatusOK
+	return nil
+}
+
+type cloudBackendsAnalyzer struct{ s *Scanner }
+
+func (cloudBackendsAnalyzer) Name() string    { return "cloud_backends" }
+func (cloudBackendsAnalyzer) Available() bool { return true }
+
+func (a cloudBackendsAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	found, err := target.extractStrings()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &CloudBackends{}
+	seen := make(map[string]bool)
+	for _, str := range found {
+		for _, p := range cloudPatterns {
+			for _, m := range p.re.FindAllStringSubmatch(str.Value, -1) {
+				if seen[p.kind+m[1]] {
+					continue
+				}
+				seen[p.kind+m[1]] = true
+				e := CloudEndpoint{Kind: p.kind, URL: m[1], Location: str.Location}
+				if len(m) > 2 {
+					e.Project = m[2]
+					b.Projects = appendUnique(b.Projects, m[2])
+				}
+				b.Endpoints = append(b.Endpoints, e)
+			}
+		}
+		for _, id := range firebaseAppID.FindAllString(str.Value, -1) {
+			b.AppIDs = appendUnique(b.AppIDs, id)
+		}
+		for _, key := range googleAPIKey.FindAllString(str.Value, -1) {
+			b.APIKeys = appendUnique(b.APIKeys, key)
+		}
+	}
+	if len(b.Endpoints) == 0 && len(b.AppIDs) == 0 && len(b.APIKeys) == 0 {
+		return nil, nil
+	}
+	sort.Slice(b.Endpoints, func(i, j int) bool {
+		if b.Endpoints[i].Kind != b.Endpoints[j].Kind {
+			return b.Endpoints[i].Kind < b.Endpoints[j].Kind
+		}
+		return b.Endpoints[i].URL < b.Endpoints[j].URL
+	})
+	sort.Strings(b.Projects)
+
+	if p := a.s.cloudProbe; p != nil {
+		probes := 0
+		for i := range b.Endpoints {
+			if probeURL(b.Endpoints[i]) == "" || probes == p.cfg.MaxProbes {
+				continue
+			}
+			probes++
+			if err := p.probe(ctx, &b.Endpoints[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,242 @@
+package apkfile
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// badgingRegexp matches aapt2 dump badging lines, e.g.
+	// package: name='com.foo' versionCode='3' or sdkVersion:'21'
+	badgingRegexp = regexp.MustCompile(`^([\w-]+):\s*(.*)$`)
+	// badgingValueRegexp matches the key='value' pairs and bare 'value' of a badging line
+	badgingValueRegexp = regexp.MustCompile(`(?:([\w-]+)=)?'([^']*)'`)
+	// certDigestRegexp matches the certificates apksigner --print-certs prints
+	certDigestRegexp = regexp.MustCompile(`^Signer #\d+ certificate SHA-256 digest: ([0-9a-fA-F:]+)$`)
+)
+
+// CrossCheck is where the Android SDK tools disagree with the plugin's own
+// parsing, which manifests and signatures crafted to confuse parsers cause
+type CrossCheck struct {
+	// Tools are the SDK tools that were run
+	Tools []string `json:"tools" structs:"tools"`
+	// SignatureVerified is whether apksigner verified the APK's signatures
+	SignatureVerified *bool `json:"signature_verified,omitempty" structs:"signature_verified,omitempty"`
+	// SignatureErrors are the errors apksigner reported
+	SignatureErrors []string      `json:"signature_errors,omitempty" structs:"signature_errors,omitempty"`
+	Discrepancies   []Discrepancy `json:"discrepancies" structs:"discrepancies"`
+}
+
+// Discrepancy is a value the plugin and an SDK tool read differently, empty
+// when one of them didn't find it at all
+type Discrepancy struct {
+	Tool   string `json:"tool" structs:"tool"`
+	Field  string `json:"field" structs:"field"`
+	Ours   string `json:"ours" structs:"ours"`
+	Theirs string `json:"theirs" structs:"theirs"`
+}
+
+type crossCheckAnalyzer struct{ s *Scanner }
+
+func (crossCheckAnalyzer) Name() string { return "cross_check" }
+func (a crossCheckAnalyzer) Available() bool {
+	return a.s.toolAvailable("aapt2") || a.s.toolAvailable("apksigner")
+}
+
+func (crossCheckAnalyzer) apkOnly() {}
+
+func (a crossCheckAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, manifestErr := target.manifest()
+	if manifestErr == ErrNotAPK {
+		return nil, nil
+	}
+	// sandboxes mount the sample at its absolute path
+	path, err := filepath.Abs(target.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &CrossCheck{Tools: []string{}, Discrepancies: []Discrepancy{}}
+	if a.s.toolAvailable("aapt2") {
+		check.Tools = append(check.Tools, "aapt2")
+		out, err := a.s.runTool(ctx, target.Path, "aapt2", "dump", "badging", path)
+		failure, err := toolFailure(ctx, err)
+		if err != nil {
+			return nil, err
+		}
+		check.Discrepancies = append(check.Discrepancies, compareBadging(root, manifestErr, out, failure)...)
+	}
+
+	if a.s.toolAvailable("apksigner") {
+		check.Tools = append(check.Tools, "apksigner")
+		out, err := a.s.runTool(ctx, target.Path, "apksigner", "verify", "--print-certs", path)
+		failure, err := toolFailure(ctx, err)
+		if err != nil {
+			return nil, err
+		}
+		verified := failure == ""
+		check.SignatureVerified = &verified
+		if !verified {
+			check.SignatureErrors = signatureErrors(out + "\n" + failure)
+		}
+
+		certs, err := target.signingCerts()
+		check.Discrepancies = append(check.Discrepancies, compareCerts(certs, err, out, verified)...)
+	}
+
+	return check, nil
+}
+
+// toolFailure returns the stderr of a tool that ran and failed, the error
+// itself when it couldn't be run or the scan is over
+func toolFailure(ctx context.Context, err error) (string, error) {
+	if err == nil {
+		return "", nil
+	}
+	if exit, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+		if stderr := strings.TrimSpace(string(exit.Stderr)); stderr != "" {
+			return stderr, nil
+		}
+		return exit.Error(), nil
+	}
+	return "", err
+}
+
+// compareBadging compares the manifest with aapt2 dump badging's output, or
+// whether either of them failed to parse it
+func compareBadging(root *xmlElement, manifestErr error, out, failure string) []Discrepancy {
+	var found []Discrepancy
+	add := func(field, ours, theirs string) {
+		found = append(found, Discrepancy{"aapt2", field, ours, theirs})
+	}
+	switch {
+	case manifestErr != nil && failure != "":
+		return nil
+	case manifestErr != nil:
+		add("manifest", manifestErr.Error(), "parsed")
+		return found
+	case failure != "":
+		add("manifest", "parsed", firstLine(failure))
+		return found
+	}
+
+	ours := map[string]string{
+		"package":     root.Attr("package"),
+		"versionCode": root.Attr("versionCode"),
+		"versionName": root.Attr("versionName"),
+	}
+	if sdk := root.All("uses-sdk"); len(sdk) > 0 {
+		ours["sdkVersion"] = sdk[0].Attr("minSdkVersion")
+		ours["targetSdkVersion"] = sdk[0].Attr("targetSdkVersion")
+	}
+	ourPermissions := map[string]bool{}
+	for _, p := range usesPermissions(root) {
+		ourPermissions[p] = true
+	}
+
+	theirs := map[string]string{}
+	theirPermissions := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		m := badgingRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		for _, v := range badgingValueRegexp.FindAllStringSubmatch(m[2], -1) {
+			switch {
+			case m[1] == "package" && v[1] != "":
+				theirs[v[1]] = v[2]
+			case (m[1] == "uses-permission" || m[1] == "uses-permission-sdk-23") && v[1] == "name":
+				theirPermissions[v[2]] = true
+			case (m[1] == "sdkVersion" || m[1] == "targetSdkVersion") && v[1] == "":
+				theirs[m[1]] = v[2]
+			}
+		}
+	}
+
+	for _, field := range []string{"package", "versionCode", "versionName", "sdkVersion", "targetSdkVersion"} {
+		o, t := ours[field], theirs[field]
+		// references to resources are resolved by aapt2 only
+		if o == "" || t == "" || strings.HasPrefix(o, "@") {
+			continue
+		}
+		if o != t {
+			add(field, o, t)
+		}
+	}
+	for _, p := range sortedKeys(theirPermissions) {
+		if !ourPermissions[p] {
+			add("uses-permission", "", p)
+		}
+	}
+	for _, p := range sortedKeys(ourPermissions) {
+		if !theirPermissions[p] {
+			add("uses-permission", p, "")
+		}
+	}
+	return found
+}
+
+// compareCerts reports the certificates apksigner verified that weren't
+// found in the signatures. The v1 certificates it skips when a newer scheme
+// verifies aren't discrepancies
+func compareCerts(certs []signingCert, certsErr error, out string, verified bool) []Discrepancy {
+	var found []Discrepancy
+	if certsErr != nil {
+		if verified {
+			found = append(found, Discrepancy{"apksigner", "signature", certsErr.Error(), "verified"})
+		}
+		return found
+	}
+
+	ours := map[string]bool{}
+	for _, c := range certs {
+		sum := sha256.Sum256(c.cert.Raw)
+		ours[hex.EncodeToString(sum[:])] = true
+	}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		m := certDigestRegexp.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		if fp := normalizeFingerprint(m[1]); !ours[fp] {
+			found = append(found, Discrepancy{"apksigner", "signer", "", fp})
+		}
+	}
+	return found
+}
+
+// signatureErrors returns the ERROR lines apksigner printed
+func signatureErrors(out string) []string {
+	var errs []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "ERROR: ") {
+			errs = append(errs, strings.TrimPrefix(line, "ERROR: "))
+		}
+	}
+	return errs
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
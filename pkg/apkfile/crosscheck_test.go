@@ -0,0 +1,97 @@
+package apkfile
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeTool writes a shell script standing in for an SDK tool
+func fakeTool(t *testing.T, dir, name, script string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestCrossCheckAnalyzer tests comparing the manifest and signers with aapt2 and apksigner.
+func TestCrossCheckAnalyzer(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example" android:versionCode="3" android:versionName="@0x7f0a0001">` +
+		`<uses-sdk android:minSdkVersion="21" android:targetSdkVersion="30"/>` +
+		`<uses-permission android:name="android.permission.INTERNET"/>` +
+		`<uses-permission android:name="android.permission.READ_SMS"/>` +
+		`<application/></manifest>`
+	path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+	defer os.Remove(path)
+	cert := selfSignedCert(t, pkix.Name{CommonName: "Example"})
+	addSigningBlock(t, path, apkSignatureV2, cert)
+	sum := sha256.Sum256(cert)
+	ours := hex.EncodeToString(sum[:])
+
+	dir, err := ioutil.TempDir("", "sdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// aapt2 sees the app targeting another SDK and a permission hidden from us
+	aapt2 := fakeTool(t, dir, "aapt2", `cat <<'EOF'
+package: name='com.example' versionCode='3' versionName='1.0' platformBuildVersionName='11'
+sdkVersion:'21'
+targetSdkVersion:'19'
+uses-permission: name='android.permission.INTERNET'
+uses-permission: name='android.permission.SEND_SMS'
+application-label:'Example'
+EOF`)
+	apksigner := fakeTool(t, dir, "apksigner", `echo "Signer #1 certificate DN: CN=Example"
+echo "Signer #1 certificate SHA-256 digest: `+ours+`"
+echo "Signer #2 certificate SHA-256 digest: 00:11:22"`)
+
+	s := &Scanner{backend: localBackend{}, tools: map[string]string{"aapt2": aapt2, "apksigner": apksigner}}
+	target := &Target{Path: path}
+	section, err := crossCheckAnalyzer{s}.Run(context.Background(), target)
+	target.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := section.(*CrossCheck)
+
+	verified := true
+	want := &CrossCheck{
+		Tools:             []string{"aapt2", "apksigner"},
+		SignatureVerified: &verified,
+		Discrepancies: []Discrepancy{
+			{"aapt2", "targetSdkVersion", "30", "19"},
+			{"aapt2", "uses-permission", "", "android.permission.SEND_SMS"},
+			{"aapt2", "uses-permission", "android.permission.READ_SMS", ""},
+			{"apksigner", "signer", "", "001122"},
+		},
+	}
+	if !reflect.DeepEqual(check, want) {
+		t.Errorf("expected %+v, got %+v", want, check)
+	}
+
+	// tools that reject the APK are discrepancies too
+	fakeTool(t, dir, "aapt2", `echo "W/ResourceType: Bad XML block" >&2; exit 1`)
+	fakeTool(t, dir, "apksigner", `echo "DOES NOT VERIFY"; echo "ERROR: Missing META-INF/MANIFEST.MF" >&2; exit 1`)
+	target = &Target{Path: path}
+	section, err = crossCheckAnalyzer{s}.Run(context.Background(), target)
+	target.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check = section.(*CrossCheck)
+	if *check.SignatureVerified || !reflect.DeepEqual(check.SignatureErrors, []string{"Missing META-INF/MANIFEST.MF"}) {
+		t.Errorf("expected the signature not to verify, got %+v", check)
+	}
+	if want := []Discrepancy{{"aapt2", "manifest", "parsed", "W/ResourceType: Bad XML block"}}; !reflect.DeepEqual(check.Discrepancies, want) {
+		t.Errorf("expected %+v, got %+v", want, check.Discrepancies)
+	}
+}
@@ -0,0 +1,185 @@
+package apkfile
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// CryptoFinding is a likely misuse of the Java crypto APIs
+type CryptoFinding struct {
+	Rule        string `json:"rule" structs:"rule"`
+	Description string `json:"description" structs:"description"`
+	// Location is the dex file and method, e.g. classes.dex:Lcom/foo/Bar;->encrypt
+	Location string `json:"location" structs:"location"`
+	Evidence string `json:"evidence,omitempty" structs:"evidence,omitempty"`
+}
+
+var (
+	// transformationRegexp matches full algorithm/mode/padding transformations
+	transformationRegexp = regexp.MustCompile(`(?i)^[a-z0-9]+/([a-z0-9]+)/[a-z0-9]+$`)
+	// defaultECBRegexp matches bare algorithms that Cipher defaults to ECB for
+	defaultECBRegexp = regexp.MustCompile(`(?i)^(?:AES|DESede|Blowfish)$`)
+	// weakCipherRegexp matches broken ciphers
+	weakCipherRegexp = regexp.MustCompile(`(?i)^(?:DES|RC2|RC4|ARCFOUR)(?:/.*)?$`)
+	// algorithmRegexp matches the algorithm and charset names methods pass
+	// around besides their keys
+	algorithmRegexp = regexp.MustCompile(`(?i)^(?:AES|DES|DESede|RC2|RC4|ARCFOUR|Blowfish|Hmac\w+|PBKDF2\w*|ChaCha20\S*|RSA|EC|SHA-?\d+|MD5|UTF-?8|UTF-16\w*|ISO-8859-1|US-ASCII)(?:/.*)?$`)
+)
+
+const (
+	cipherClass       = "Ljavax/crypto/Cipher;"
+	keyGeneratorClass = "Ljavax/crypto/KeyGenerator;"
+	secretKeySpec     = "Ljavax/crypto/spec/SecretKeySpec;"
+	ivParameterSpec   = "Ljavax/crypto/spec/IvParameterSpec;"
+	secureRandomClass = "Ljava/security/SecureRandom;"
+	stringClass       = "Ljava/lang/String;"
+)
+
+// methodFacts is what a method's bytecode references
+type methodFacts struct {
+	calls     []dexMethodRef
+	strings   []string
+	byteArray bool
+}
+
+// invokes reports whether the method calls class->name
+func (f methodFacts) invokes(class, name string) bool {
+	for _, c := range f.calls {
+		if c.class == class && c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// gatherFacts collects the calls and constants of a method
+func gatherFacts(d *dexFile, m dexMethod) methodFacts {
+	var f methodFacts
+	eachInsn(m.insns, func(op byte, insn []uint16) {
+		switch {
+		case isInvoke(op):
+			f.calls = append(f.calls, d.method(uint32(insn[1])))
+		case op == opConstString || op == opConstStringJumbo:
+			f.strings = append(f.strings, d.str(stringIndex(op, insn)))
+		case op == opFillArrayData:
+			f.byteArray = true
+		}
+	})
+	return f
+}
+
+type cryptoAnalyzer struct{}
+
+func (cryptoAnalyzer) Name() string    { return "crypto_findings" }
+func (cryptoAnalyzer) Available() bool { return true }
+
+func (cryptoAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	dexes, err := target.dexFiles()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []CryptoFinding{}
+	for _, d := range dexes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		err := d.eachMethod(func(m dexMethod) {
+			if m.insns != nil {
+				findings = append(findings, cryptoMisuse(d, m)...)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return findings, nil
+}
+
+// cryptoMisuse applies the crypto heuristics to one method
+func cryptoMisuse(d *dexFile, m dexMethod) []CryptoFinding {
+	f := gatherFacts(d, m)
+	location := d.name + ":" + m.ref.String()
+
+	var findings []CryptoFinding
+	add := func(rule, description, evidence string) {
+		findings = append(findings, CryptoFinding{rule, description, location, evidence})
+	}
+
+	if f.invokes(cipherClass, "getInstance") {
+		if ecb := ecbTransformation(f.strings); ecb != "" {
+			add("ecb_mode", "cipher used in ECB mode, which leaks patterns in the plaintext", ecb)
+		}
+	}
+
+	if f.invokes(cipherClass, "getInstance") || f.invokes(keyGeneratorClass, "getInstance") || f.invokes(secretKeySpec, "<init>") {
+		for _, s := range f.strings {
+			if weakCipherRegexp.MatchString(s) {
+				add("weak_cipher", "broken cipher (DES, RC2 or RC4)", s)
+				break
+			}
+		}
+	}
+
+	hardcoded := func(class, rule, description string) {
+		if !f.invokes(class, "<init>") {
+			return
+		}
+		if f.invokes(stringClass, "getBytes") {
+			for _, s := range f.strings {
+				if s != "" && !algorithmRegexp.MatchString(s) {
+					add(rule, description, s)
+					return
+				}
+			}
+		}
+		if f.byteArray {
+			add(rule, description, "byte array literal")
+		}
+	}
+	hardcoded(secretKeySpec, "hardcoded_key", "encryption key built from a constant")
+	hardcoded(ivParameterSpec, "hardcoded_iv", "initialization vector built from a constant")
+
+	for _, c := range f.calls {
+		if c.class != secureRandomClass {
+			continue
+		}
+		var params []string
+		if c.proto < len(d.protos) {
+			params = d.protos[c.proto].params
+		}
+		if c.name == "setSeed" || c.name == "<init>" && len(params) == 1 && params[0] == "[B" {
+			add("securerandom_seed", "SecureRandom seeded with a fixed value becomes predictable", c.String())
+			break
+		}
+	}
+
+	return findings
+}
+
+// ecbTransformation returns the ECB transformation among a method's strings, a
+// bare algorithm name only counts when the method has no full transformation
+// since it is also what SecretKeySpec gets
+func ecbTransformation(strs []string) string {
+	var bare string
+	explicit := false
+	for _, s := range strs {
+		if m := transformationRegexp.FindStringSubmatch(s); m != nil {
+			if strings.EqualFold(m[1], "ECB") {
+				return s
+			}
+			explicit = true
+		} else if bare == "" && defaultECBRegexp.MatchString(s) {
+			bare = s
+		}
+	}
+	if explicit {
+		return ""
+	}
+	return bare
+}
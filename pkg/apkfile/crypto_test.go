@@ -0,0 +1,65 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestCryptoAnalyzer tests the crypto misuse heuristics.
+func TestCryptoAnalyzer(t *testing.T) {
+	b := newDexBuilder()
+	getInstance := b.method(cipherClass, "getInstance", cipherClass, stringClass)
+	getBytes := b.method(stringClass, "getBytes", "[B")
+	keySpec := b.method(secretKeySpec, "<init>", "V", "[B", stringClass)
+	setSeed := b.method(secureRandomClass, "setSeed", "V", "J")
+	encrypt := b.method("Lcom/example/Crypto;", "encrypt", "V")
+	seed := b.method("Lcom/example/Crypto;", "seed", "V")
+	transformation := b.str("AES/ECB/PKCS5Padding")
+	key := b.str("0123456789abcdef")
+	algorithm := b.str("AES")
+
+	b.class("Lcom/example/Crypto;", "Ljava/lang/Object;",
+		builderMethod{encrypt, []uint16{
+			0x001a, uint16(transformation), // const-string v0
+			0x1071, uint16(getInstance), 0x0000, // invoke-static {v0}
+			0x011a, uint16(key), // const-string v1
+			0x106e, uint16(getBytes), 0x0001, // invoke-virtual {v1}
+			0x021a, uint16(algorithm), // const-string v2
+			0x3070, uint16(keySpec), 0x0213, // invoke-direct {v3, v1, v2}
+			0x000e,
+		}},
+		builderMethod{seed, []uint16{
+			0x206e, uint16(setSeed), 0x0010, // invoke-virtual {v0, v1}
+			0x000e,
+		}},
+	)
+
+	path := writeZip(t, map[string]string{"classes.dex": string(b.build())})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+
+	section, err := cryptoAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[string]CryptoFinding)
+	for _, f := range section.([]CryptoFinding) {
+		found[f.Rule] = f
+	}
+	if f := found["ecb_mode"]; f.Evidence != "AES/ECB/PKCS5Padding" || f.Location != "classes.dex:Lcom/example/Crypto;->encrypt" {
+		t.Errorf("unexpected ecb_mode finding: %#v", f)
+	}
+	if f := found["hardcoded_key"]; f.Evidence != "0123456789abcdef" {
+		t.Errorf("unexpected hardcoded_key finding: %#v", f)
+	}
+	if f := found["securerandom_seed"]; f.Location != "classes.dex:Lcom/example/Crypto;->seed" {
+		t.Errorf("unexpected securerandom_seed finding: %#v", f)
+	}
+	if _, ok := found["weak_cipher"]; ok {
+		t.Errorf("AES should not be reported as a weak cipher: %#v", found)
+	}
+}
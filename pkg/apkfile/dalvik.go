@@ -0,0 +1,104 @@
+package apkfile
+
+// dalvikWidths is the size in 16-bit code units of every Dalvik opcode,
+// see https://source.android.com/devices/tech/dalvik/dalvik-bytecode
+var dalvikWidths = func() [256]int {
+	var w [256]int
+	set := func(from, to, width int) {
+		for op := from; op <= to; op++ {
+			w[op] = width
+		}
+	}
+	set(0x00, 0xff, 1)
+	set(0x02, 0x02, 2) // move/from16
+	set(0x03, 0x03, 3) // move/16
+	set(0x05, 0x05, 2)
+	set(0x06, 0x06, 3)
+	set(0x08, 0x08, 2)
+	set(0x09, 0x09, 3)
+	set(0x13, 0x13, 2) // const/16
+	set(0x14, 0x14, 3) // const
+	set(0x15, 0x16, 2) // const/high16, const-wide/16
+	set(0x17, 0x17, 3) // const-wide/32
+	set(0x18, 0x18, 5) // const-wide
+	set(0x19, 0x1a, 2) // const-wide/high16, const-string
+	set(0x1b, 0x1b, 3) // const-string/jumbo
+	set(0x1c, 0x1c, 2) // const-class
+	set(0x1f, 0x20, 2) // check-cast, instance-of
+	set(0x22, 0x23, 2) // new-instance, new-array
+	set(0x24, 0x26, 3) // filled-new-array(/range), fill-array-data
+	set(0x29, 0x29, 2) // goto/16
+	set(0x2a, 0x2c, 3) // goto/32, packed-switch, sparse-switch
+	set(0x2d, 0x3d, 2) // cmp*, if-*
+	set(0x44, 0x6d, 2) // aget*, aput*, iget*, iput*, sget*, sput*
+	set(0x6e, 0x72, 3) // invoke-*
+	set(0x74, 0x78, 3) // invoke-*/range
+	set(0x90, 0xaf, 2) // binop
+	set(0xd0, 0xe2, 2) // binop/lit16, binop/lit8
+	set(0xfa, 0xfb, 4) // invoke-polymorphic(/range)
+	set(0xfc, 0xfd, 3) // invoke-custom(/range)
+	set(0xfe, 0xff, 2) // const-method-handle, const-method-type
+	return w
+}()
+
+const (
+	opConstString      = 0x1a
+	opConstStringJumbo = 0x1b
+	opNewInstance      = 0x22
+	opFillArrayData    = 0x26
+	opInvokeVirtual    = 0x6e
+	opInvokeInterface  = 0x72
+	opInvokeVirtualR   = 0x74
+	opInvokeInterfaceR = 0x78
+)
+
+// isInvoke reports whether op is one of the invoke-kind instructions whose
+// second code unit is a method index
+func isInvoke(op byte) bool {
+	return op >= opInvokeVirtual && op <= opInvokeInterface || op >= opInvokeVirtualR && op <= opInvokeInterfaceR
+}
+
+// eachInsn calls fn with the opcode and code units of every instruction in
+// insns, switch and array payloads are skipped
+func eachInsn(insns []uint16, fn func(op byte, insn []uint16)) {
+	for pc := 0; pc < len(insns); {
+		op := byte(insns[pc])
+		width := dalvikWidths[op]
+
+		if op == 0x00 {
+			switch insns[pc] {
+			case 0x0100: // packed-switch-payload
+				if pc+1 < len(insns) {
+					width = int(insns[pc+1])*2 + 4
+				}
+			case 0x0200: // sparse-switch-payload
+				if pc+1 < len(insns) {
+					width = int(insns[pc+1])*4 + 2
+				}
+			case 0x0300: // fill-array-data-payload
+				if pc+3 < len(insns) {
+					size := int(insns[pc+2]) | int(insns[pc+3])<<16
+					width = (size*int(insns[pc+1])+1)/2 + 4
+				}
+			}
+			if width != 1 {
+				pc += width
+				continue
+			}
+		}
+
+		if pc+width > len(insns) {
+			return
+		}
+		fn(op, insns[pc:pc+width])
+		pc += width
+	}
+}
+
+// stringIndex returns the string index of a const-string(/jumbo) instruction
+func stringIndex(op byte, insn []uint16) uint32 {
+	if op == opConstStringJumbo {
+		return uint32(insn[1]) | uint32(insn[2])<<16
+	}
+	return uint32(insn[1])
+}
@@ -0,0 +1,141 @@
+package apkfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// decompiledArtifact is the name the decompiled sources are stored under
+const decompiledArtifact = "decompiled.tar.gz"
+
+// javaStringRegexp matches Java string literals
+var javaStringRegexp = regexp.MustCompile(`"((?:[^"\\\n]|\\.)*)"`)
+
+// DecompileConfig decompiles APKs with jadx
+type DecompileConfig struct {
+	// Helper is the path to helpers/jadx_archive.sh, which runs jadx and
+	// prints the sources as a tar archive
+	Helper string
+	// Store keeps the decompiled sources, they are only scanned for strings
+	// when nil
+	Store ArtifactStore
+}
+
+// Decompiled is what jadx's decompiled sources show
+type Decompiled struct {
+	// Files is the number of Java source files
+	Files int `json:"files" structs:"files"`
+	// Artifact is where the sources were stored
+	Artifact string `json:"artifact,omitempty" structs:"artifact,omitempty"`
+	// Strings are the IOCs in the sources' string literals, which include the
+	// constants jadx folds and the ones built at compile time
+	Strings *Strings `json:"strings" structs:"strings"`
+}
+
+// WithDecompiler adds a decompiled section from the sources jadx decompiles
+// the APK to
+func WithDecompiler(cfg DecompileConfig) Option {
+	return func(s *Scanner) {
+		s.decompile = cfg
+	}
+}
+
+type decompileAnalyzer struct{ s *Scanner }
+
+func (decompileAnalyzer) Name() string { return "decompiled" }
+func (a decompileAnalyzer) Available() bool {
+	return a.s.decompile.Helper != "" && a.s.toolAvailable("jadx")
+}
+
+func (decompileAnalyzer) apkOnly() {}
+
+func (a decompileAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	if _, err := target.manifest(); err == ErrNotAPK {
+		return nil, nil
+	}
+	// sandboxes mount the sample at its absolute path
+	path, err := filepath.Abs(target.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sandboxes only let tools write to a private /tmp, so the helper
+	// hands the sources over on stdout
+	out, err := a.s.runTool(ctx, target.Path, "sh", a.s.decompile.Helper, path)
+	if err != nil {
+		return nil, err
+	}
+
+	section := &Decompiled{}
+	var found []foundString
+	seen := make(map[string]bool)
+	tr := tar.NewReader(strings.NewReader(out))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, ".java") {
+			continue
+		}
+		section.Files++
+		src, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range javaStrings(src) {
+			if !seen[v] {
+				seen[v] = true
+				found = append(found, foundString{Value: v, Location: hdr.Name})
+			}
+		}
+	}
+
+	if store := a.s.decompile.Store; store != nil {
+		sha256sum, err := target.sha256()
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(out))
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		if section.Artifact, err = store.Put(ctx, sha256sum, decompiledArtifact, &buf); err != nil {
+			return nil, err
+		}
+	}
+
+	if section.Strings, err = a.s.classifyStrings(ctx, found); err != nil {
+		return nil, err
+	}
+	return section, nil
+}
+
+// javaStrings returns the string literals in Java source
+func javaStrings(src []byte) []string {
+	var found []string
+	for _, m := range javaStringRegexp.FindAllSubmatch(src, -1) {
+		v := string(m[1])
+		// most of Java's escapes are Go's too, the rest are kept as written
+		if unquoted, err := strconv.Unquote(`"` + v + `"`); err == nil {
+			v = unquoted
+		}
+		if len(v) >= minStringLength {
+			found = append(found, v)
+		}
+	}
+	return found
+}
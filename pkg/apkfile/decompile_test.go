@@ -0,0 +1,70 @@
+package apkfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDecompileAnalyzer tests extracting strings from jadx's sources and storing them.
+func TestDecompileAnalyzer(t *testing.T) {
+	var sources bytes.Buffer
+	tw := tar.NewWriter(&sources)
+	for name, src := range map[string]string{
+		"sources/com/example/Main.java": `package com.example;
+public class Main {
+    private static final String C2 = "https://c2.example.com/gate.php";
+    void run() { send("mail to \"ops@example.com\"", "+14155550123"); }
+}`,
+		"sources/com/example/R.txt": `"https://ignored.example.com"`,
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(src)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(src))
+	}
+	tw.Close()
+
+	dir, err := ioutil.TempDir("", "decompile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "sources.tar")
+	ioutil.WriteFile(archive, sources.Bytes(), 0644)
+	helper := filepath.Join(dir, "helper.sh")
+	ioutil.WriteFile(helper, []byte("cat "+archive+"\n"), 0644)
+
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example"><application/></manifest>`
+	path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+	defer os.Remove(path)
+
+	s := &Scanner{backend: localBackend{}}
+	WithDecompiler(DecompileConfig{Helper: helper, Store: DirStore(filepath.Join(dir, "artifacts"))})(s)
+	target := &Target{Path: path, Hashes: &FileHashes{SHA256: "abc"}}
+	defer target.close()
+	section, err := decompileAnalyzer{s}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := section.(*Decompiled)
+
+	if d.Files != 1 || d.Artifact != filepath.Join(dir, "artifacts", "abc", decompiledArtifact) {
+		t.Errorf("unexpected section %+v", d)
+	}
+	if _, err := os.Stat(d.Artifact); err != nil {
+		t.Error(err)
+	}
+	want := &Strings{
+		Total:  3,
+		URLs:   []string{"https://c2.example.com/gate.php"},
+		Emails: []string{"ops@example.com"},
+		Phones: []string{"+14155550123"},
+	}
+	if !reflect.DeepEqual(d.Strings, want) {
+		t.Errorf("expected %+v, got %+v", want, d.Strings)
+	}
+}
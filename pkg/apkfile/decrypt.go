@@ -0,0 +1,278 @@
+package apkfile
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// DecryptedString is a dex string constant recovered by decrypting it the way
+// the app's string decryptor does at runtime
+type DecryptedString struct {
+	Value string `json:"value" structs:"value"`
+	// Scheme is how it was encrypted: xor for characters XORed with a key,
+	// base64_xor for Base64 of bytes XORed with a key, as StringFog does, or
+	// aes for Base64 or hex of AES/ECB or AES/CBC with PKCS#5 padding
+	Scheme string `json:"scheme" structs:"scheme"`
+	// Decryptor is the method the constant is passed to, e.g. Lcom/a/b;->a
+	Decryptor string `json:"decryptor" structs:"decryptor"`
+	// Location is the dex file and method passing the constant
+	Location string `json:"location" structs:"location"`
+}
+
+const (
+	opInvokeStatic  = 0x71
+	opInvokeStaticR = 0x77
+	opXorInt        = 0x97
+	opXorInt2Addr   = 0xb7
+	opXorIntLit16   = 0xd7
+	opXorIntLit8    = 0xdf
+)
+
+// stringDecryptor is a method of the dex that looks like an obfuscator's
+// string decryptor: it returns a String from one or two Strings, the data and
+// the key, and XORs or calls Cipher
+type stringDecryptor struct {
+	// keys are the method's string constants, the key and the IV of one
+	// taking only the data
+	keys []string
+	// xorKeys are the literals the method XORs with
+	xorKeys []int
+	xor     bool
+	aes     bool
+}
+
+// stringDecryptors returns the string decryptors defined in the dex
+func stringDecryptors(d *dexFile) (map[dexMethodRef]*stringDecryptor, error) {
+	decryptors := make(map[dexMethodRef]*stringDecryptor)
+	err := d.eachMethod(func(m dexMethod) {
+		if m.insns == nil || m.ref.proto >= len(d.protos) {
+			return
+		}
+		proto := d.protos[m.ref.proto]
+		if proto.ret != stringClass || len(proto.params) == 0 || len(proto.params) > 2 {
+			return
+		}
+		for _, p := range proto.params {
+			if p != stringClass {
+				return
+			}
+		}
+
+		f := gatherFacts(d, m)
+		dec := &stringDecryptor{aes: f.invokes(cipherClass, "getInstance")}
+		for _, s := range f.strings {
+			if s != "" && !algorithmRegexp.MatchString(s) {
+				dec.keys = append(dec.keys, s)
+			}
+		}
+		eachInsn(m.insns, func(op byte, insn []uint16) {
+			switch op {
+			case opXorInt, opXorInt2Addr:
+				dec.xor = true
+			case opXorIntLit8: // xor-int/lit8 vAA, vBB, #+CC
+				dec.xor = true
+				dec.xorKeys = append(dec.xorKeys, int(int8(insn[1]>>8)))
+			case opXorIntLit16: // xor-int/lit16 vA, vB, #+CCCC
+				dec.xor = true
+				dec.xorKeys = append(dec.xorKeys, int(int16(insn[1])))
+			}
+		})
+		if dec.xor || dec.aes {
+			decryptors[m.ref] = dec
+		}
+	})
+	return decryptors, err
+}
+
+// decryptStrings recovers the string constants the dex passes straight to
+// its string decryptors
+func decryptStrings(d *dexFile) ([]DecryptedString, error) {
+	decryptors, err := stringDecryptors(d)
+	if err != nil || len(decryptors) == 0 {
+		return nil, err
+	}
+
+	var found []DecryptedString
+	err = d.eachMethod(func(m dexMethod) {
+		if m.insns == nil {
+			return
+		}
+		strs := make(map[uint16]string)
+		eachInsn(m.insns, func(op byte, insn []uint16) {
+			switch op {
+			case opConstString, opConstStringJumbo:
+				strs[insn[0]>>8] = d.str(stringIndex(op, insn))
+			case opInvokeStatic, opInvokeStaticR:
+				ref := d.method(uint32(insn[1]))
+				dec := decryptors[ref]
+				if dec == nil {
+					return
+				}
+				var args []string
+				for _, r := range invokeRegisters(op, insn) {
+					s, ok := strs[r]
+					if !ok {
+						return
+					}
+					args = append(args, s)
+				}
+				if value, scheme := dec.decrypt(args); scheme != "" {
+					found = append(found, DecryptedString{
+						Value:     value,
+						Scheme:    scheme,
+						Decryptor: ref.String(),
+						Location:  d.name + ":" + m.ref.String(),
+					})
+				}
+			}
+		})
+	})
+	return found, err
+}
+
+// decrypt tries the schemes the decryptor may implement on the constants it
+// is called with, the first plaintext that is printable text wins
+func (dec *stringDecryptor) decrypt(args []string) (string, string) {
+	data, keys := args[0], dec.keys
+	if len(args) == 2 {
+		keys = []string{args[1]}
+	}
+
+	if dec.aes {
+		for _, key := range keys {
+			for _, v := range decryptAES(data, key, dec.keys) {
+				if plausiblePlaintext(v, data) {
+					return v, "aes"
+				}
+			}
+		}
+	}
+	if !dec.xor {
+		return "", ""
+	}
+	if raw, ok := decodeBase64(data); ok {
+		for _, key := range keys {
+			if v := string(xorBytes(raw, []byte(key))); plausiblePlaintext(v, data) {
+				return v, "base64_xor"
+			}
+		}
+	}
+	for _, key := range keys {
+		if v := xorChars(data, utf16.Encode([]rune(key))); plausiblePlaintext(v, data) {
+			return v, "xor"
+		}
+	}
+	for _, key := range dec.xorKeys {
+		if v := xorChars(data, []uint16{uint16(key)}); plausiblePlaintext(v, data) {
+			return v, "xor"
+		}
+	}
+	return "", ""
+}
+
+// plausiblePlaintext reports whether v is text that can be what encrypted
+// became, rather than the garbage of the wrong scheme or key
+func plausiblePlaintext(v, encrypted string) bool {
+	if len(v) < minStringLength || v == encrypted || !utf8.ValidString(v) {
+		return false
+	}
+	for _, r := range v {
+		if r == utf8.RuneError || !unicode.IsPrint(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// xorBytes XORs data with the repeated key
+func xorBytes(data, key []byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ key[i%len(key)]
+	}
+	return out
+}
+
+// xorChars XORs the UTF-16 characters of s with the repeated key, as Java
+// code looping over a char[] does
+func xorChars(s string, key []uint16) string {
+	if len(key) == 0 {
+		return ""
+	}
+	chars := utf16.Encode([]rune(s))
+	for i := range chars {
+		chars[i] ^= key[i%len(key)]
+	}
+	return string(utf16.Decode(chars))
+}
+
+// decodeBase64 decodes standard or URL safe Base64, padded or not
+func decodeBase64(s string) ([]byte, bool) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if raw, err := enc.DecodeString(s); err == nil && len(raw) > 0 {
+			return raw, true
+		}
+	}
+	return nil, false
+}
+
+// decryptAES decrypts the Base64 or hex ciphertext s with key in ECB mode,
+// and in CBC mode with each 16 character candidate for the IV. It returns the
+// plaintexts whose padding is right
+func decryptAES(s, key string, ivs []string) []string {
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return nil
+	}
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		var ok bool
+		if raw, ok = decodeBase64(s); !ok {
+			return nil
+		}
+	}
+	if len(raw) == 0 || len(raw)%aes.BlockSize != 0 {
+		return nil
+	}
+
+	var plaintexts []string
+	plain := make([]byte, len(raw))
+	for i := 0; i < len(raw); i += aes.BlockSize {
+		block.Decrypt(plain[i:], raw[i:i+aes.BlockSize])
+	}
+	if v, ok := unpadPKCS7(plain); ok {
+		plaintexts = append(plaintexts, v)
+	}
+	for _, iv := range ivs {
+		if len(iv) != aes.BlockSize || iv == key {
+			continue
+		}
+		cipher.NewCBCDecrypter(block, []byte(iv)).CryptBlocks(plain, raw)
+		if v, ok := unpadPKCS7(plain); ok {
+			plaintexts = append(plaintexts, v)
+		}
+	}
+	return plaintexts
+}
+
+// unpadPKCS7 strips PKCS#7 padding, false when it is malformed
+func unpadPKCS7(b []byte) (string, bool) {
+	n := int(b[len(b)-1])
+	if n == 0 || n > aes.BlockSize || n > len(b) {
+		return "", false
+	}
+	for _, p := range b[len(b)-n:] {
+		if int(p) != n {
+			return "", false
+		}
+	}
+	return string(b[:len(b)-n]), true
+}
@@ -0,0 +1,111 @@
+package apkfile
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"encoding/base64"
+	"os"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// TestDecryptStrings tests recovering the constants passed to string decryptors.
+func TestDecryptStrings(t *testing.T) {
+	aesKey := "0123456789abcdef"
+	plain := []byte("https://aes.example.com/config")
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	block, err := aes.NewCipher([]byte(aesKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := make([]byte, len(plain))
+	for i := 0; i < len(plain); i += aes.BlockSize {
+		block.Encrypt(encrypted[i:], plain[i:i+aes.BlockSize])
+	}
+
+	b := newDexBuilder()
+	fog := b.method("Lcom/a/Fog;", "decrypt", stringClass, stringClass, stringClass)
+	xor := b.method("Lcom/a/Fog;", "x", stringClass, stringClass)
+	unaes := b.method("Lcom/a/Fog;", "y", stringClass, stringClass)
+	upper := b.method("Lcom/a/Fog;", "upper", stringClass, stringClass)
+	getInstance := b.method(cipherClass, "getInstance", cipherClass, stringClass)
+	run := b.method("Lcom/a/Main;", "run", "V")
+
+	fogData := b.str(base64.StdEncoding.EncodeToString(xorBytes([]byte("https://fog.example.com/gate"), []byte("k3y"))))
+	fogKey := b.str("k3y")
+	xorData := b.str(xorChars("185.12.45.9:4444", []uint16{0x05}))
+	aesData := b.str(base64.StdEncoding.EncodeToString(encrypted))
+	key := b.str(aesKey)
+	transformation := b.str("AES/ECB/PKCS5Padding")
+	plainText := b.str("not encrypted at all")
+
+	b.class("Lcom/a/Fog;", "Ljava/lang/Object;",
+		builderMethod{fog, []uint16{
+			0x10b7, // xor-int/2addr v0, v1
+			0x0011, // return-object v0
+		}},
+		builderMethod{xor, []uint16{
+			0x00df, 0x0500, // xor-int/lit8 v0, v0, #5
+			0x0011, // return-object v0
+		}},
+		builderMethod{unaes, []uint16{
+			0x001a, uint16(transformation), // const-string v0
+			0x1071, uint16(getInstance), 0x0000, // invoke-static {v0}
+			0x011a, uint16(key), // const-string v1
+			0x0011, // return-object v0
+		}},
+		builderMethod{upper, []uint16{
+			0x0011, // return-object v0
+		}},
+	)
+	b.class("Lcom/a/Main;", "Ljava/lang/Object;",
+		builderMethod{run, []uint16{
+			0x001a, uint16(fogData), // const-string v0
+			0x011a, uint16(fogKey), // const-string v1
+			0x2071, uint16(fog), 0x0010, // invoke-static {v0, v1}
+			0x001a, uint16(xorData), // const-string v0
+			0x1071, uint16(xor), 0x0000, // invoke-static {v0}
+			0x001a, uint16(aesData), // const-string v0
+			0x1071, uint16(unaes), 0x0000, // invoke-static {v0}
+			0x001a, uint16(plainText), // const-string v0
+			0x1071, uint16(upper), 0x0000, // invoke-static {v0}
+			0x000e,
+		}},
+	)
+
+	path := writeZip(t, map[string]string{"classes.dex": string(b.build())})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+
+	s := &Scanner{stringsLimit: DefaultStringsLimit}
+	section, err := stringsAnalyzer{s}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs := section.(*Strings)
+
+	want := []DecryptedString{
+		{"https://fog.example.com/gate", "base64_xor", "Lcom/a/Fog;->decrypt", "classes.dex:Lcom/a/Main;->run"},
+		{"185.12.45.9:4444", "xor", "Lcom/a/Fog;->x", "classes.dex:Lcom/a/Main;->run"},
+		{"https://aes.example.com/config", "aes", "Lcom/a/Fog;->y", "classes.dex:Lcom/a/Main;->run"},
+	}
+	if !reflect.DeepEqual(strs.Decrypted, want) {
+		t.Errorf("unexpected decrypted strings %#v", strs.Decrypted)
+	}
+	if !containsString(strs.URLs, "https://fog.example.com/gate") || !containsString(strs.URLs, "https://aes.example.com/config") || !containsString(strs.IPs, "185.12.45.9") {
+		t.Errorf("expected the IOCs of the decrypted strings, got %q and %q", strs.URLs, strs.IPs)
+	}
+}
+
+// TestXorChars tests XORing UTF-16 characters with a repeated key.
+func TestXorChars(t *testing.T) {
+	key := utf16.Encode([]rune("ab"))
+	if got := xorChars(xorChars("Grüße, world", key), key); got != "Grüße, world" {
+		t.Errorf("expected XORing twice to restore the string, got %q", got)
+	}
+}
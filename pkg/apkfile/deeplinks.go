@@ -0,0 +1,140 @@
+package apkfile
+
+import (
+	"context"
+	"strings"
+)
+
+// DeepLink is a URI an app component is registered to open
+type DeepLink struct {
+	Component string `json:"component" structs:"component"`
+	URI       string `json:"uri" structs:"uri"`
+	Scheme    string `json:"scheme" structs:"scheme"`
+	Host      string `json:"host,omitempty" structs:"host,omitempty"`
+	// Path is the filter's path, pathPrefix followed by * or pathPattern
+	Path string `json:"path,omitempty" structs:"path,omitempty"`
+	// Browsable is set when web pages can open the link
+	Browsable bool `json:"browsable" structs:"browsable"`
+	// AutoVerify is set for app links whose hosts Android verifies against
+	// the site's assetlinks.json
+	AutoVerify bool `json:"auto_verify,omitempty" structs:"auto_verify,omitempty"`
+	// Suspicious says why the link looks like an attempt at interception
+	Suspicious string `json:"suspicious,omitempty" structs:"suspicious,omitempty"`
+}
+
+// interceptedSchemes belong to the system or other apps, registering them
+// lets an app intercept what was meant for those
+var interceptedSchemes = map[string]bool{
+	"sms": true, "smsto": true, "mms": true, "mmsto": true, "tel": true, "mailto": true,
+	"market": true, "intent": true, "file": true, "content": true,
+	"otpauth": true, "otpauth-migration": true,
+	"bitcoin": true, "ethereum": true, "wc": true, "metamask": true, "trust": true,
+	"paypal": true, "fb": true, "whatsapp": true, "tg": true, "twitter": true, "instagram": true,
+}
+
+// wellKnownHosts are hosts whose web links other apps have no business opening
+var wellKnownHosts = []string{
+	"google.com", "facebook.com", "paypal.com", "twitter.com", "instagram.com",
+	"whatsapp.com", "microsoft.com", "live.com", "apple.com", "amazon.com",
+}
+
+type deepLinksAnalyzer struct{}
+
+func (deepLinksAnalyzer) Name() string    { return "deep_links" }
+func (deepLinksAnalyzer) Available() bool { return true }
+
+func (deepLinksAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	links := []DeepLink{}
+	for _, c := range components(root) {
+		for _, filter := range c.Element.All("intent-filter") {
+			links = append(links, filterLinks(c.Name, filter)...)
+		}
+	}
+	return links, nil
+}
+
+// filterLinks returns the links an intent filter matches, the schemes, hosts
+// and paths of all its <data> elements combine with each other
+func filterLinks(component string, filter *xmlElement) []DeepLink {
+	var schemes, hosts, paths []string
+	browsable := false
+	for _, c := range filter.All("category") {
+		if c.Attr("name") == "android.intent.category.BROWSABLE" {
+			browsable = true
+		}
+	}
+	for _, d := range filter.All("data") {
+		if s := d.Attr("scheme"); s != "" {
+			schemes = append(schemes, s)
+		}
+		if h := d.Attr("host"); h != "" {
+			if p := d.Attr("port"); p != "" {
+				h += ":" + p
+			}
+			hosts = append(hosts, h)
+		}
+		if p := d.Attr("path"); p != "" {
+			paths = append(paths, p)
+		}
+		if p := d.Attr("pathPrefix"); p != "" {
+			paths = append(paths, p+"*")
+		}
+		if p := d.Attr("pathPattern"); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+
+	var links []DeepLink
+	for _, scheme := range schemes {
+		for _, host := range hosts {
+			for _, path := range paths {
+				uri := scheme + ":"
+				if host != "" {
+					uri += "//" + host + path
+				}
+				link := DeepLink{
+					Component:  component,
+					URI:        uri,
+					Scheme:     scheme,
+					Host:       host,
+					Path:       path,
+					Browsable:  browsable,
+					AutoVerify: filter.Attr("autoVerify") == "true",
+				}
+				link.Suspicious = suspiciousLink(link)
+				links = append(links, link)
+			}
+		}
+	}
+	return links
+}
+
+func suspiciousLink(l DeepLink) string {
+	scheme := strings.ToLower(l.Scheme)
+	if interceptedSchemes[scheme] {
+		return "registers the " + scheme + ": scheme owned by the system or another app"
+	}
+	if (scheme == "http" || scheme == "https") && !l.AutoVerify {
+		host := strings.ToLower(l.Host)
+		for _, known := range wellKnownHosts {
+			if host == known || strings.HasSuffix(host, "."+known) {
+				return "claims " + known + " links without app link verification"
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestDeepLinksAnalyzer tests that intent filter data is expanded into deep links.
+func TestDeepLinksAnalyzer(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <application>
+    <activity android:name=".MainActivity">
+      <intent-filter android:autoVerify="true">
+        <action android:name="android.intent.action.VIEW"/>
+        <category android:name="android.intent.category.BROWSABLE"/>
+        <data android:scheme="https"/>
+        <data android:host="example.com" android:pathPrefix="/open"/>
+      </intent-filter>
+    </activity>
+    <activity-alias android:name="Login">
+      <intent-filter>
+        <data android:scheme="https" android:host="www.paypal.com"/>
+        <data android:scheme="otpauth"/>
+      </intent-filter>
+    </activity-alias>
+  </application>
+</manifest>`
+	path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := deepLinksAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := section.([]DeepLink)
+
+	want := map[string]DeepLink{
+		"https://example.com/open*": {Component: "com.example.app.MainActivity", Browsable: true, AutoVerify: true},
+		"https://www.paypal.com":    {Component: "com.example.app.Login", Suspicious: "claims paypal.com links without app link verification"},
+		"otpauth://www.paypal.com":  {Component: "com.example.app.Login", Suspicious: "registers the otpauth: scheme owned by the system or another app"},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("expected %d links, got %#v", len(want), links)
+	}
+	for _, l := range links {
+		w, ok := want[l.URI]
+		if !ok {
+			t.Errorf("unexpected link %#v", l)
+			continue
+		}
+		if l.Component != w.Component || l.Browsable != w.Browsable || l.AutoVerify != w.AutoVerify || l.Suspicious != w.Suspicious {
+			t.Errorf("%s: got %#v", l.URI, l)
+		}
+	}
+
+	// non-APKs have no deep links section
+	if section, err = (deepLinksAnalyzer{}).Run(context.Background(), &Target{Path: "deeplinks_test.go"}); section != nil || err != nil {
+		t.Errorf("expected no section for a non-APK, got %v, %v", section, err)
+	}
+}
@@ -0,0 +1,412 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// dexFile is the parts of a classes*.dex file the analyzers use
+type dexFile struct {
+	// name is the archive entry the dex was read from
+	name    string
+	data    []byte
+	strings []string
+	types   []string
+	protos  []dexProto
+	fields  []dexFieldRef
+	methods []dexMethodRef
+	classes []dexClass
+}
+
+// dexProto is a method prototype
+type dexProto struct {
+	shorty string
+	ret    string
+	params []string
+}
+
+// dexFieldRef is a field_id_item, a field defined or accessed by the dex
+type dexFieldRef struct {
+	class string
+	typ   string
+	name  string
+}
+
+// dexMethodRef is a method_id_item, a method defined or called by the dex
+type dexMethodRef struct {
+	class string
+	name  string
+	proto int
+}
+
+// dexClass is a class_def_item
+type dexClass struct {
+	name       string
+	super      string
+	source     string
+	access     uint32
+	interfaces []string
+	// annotationsOff is the offset of the annotations_directory_item, 0 for
+	// classes without annotations
+	annotationsOff uint32
+	// dataOff is the offset of the class_data_item, 0 for classes without fields or methods
+	dataOff uint32
+}
+
+// dexMethod is a method defined in the dex along with its bytecode
+type dexMethod struct {
+	class  string
+	ref    dexMethodRef
+	access uint32
+	// insns is the method's bytecode in 16-bit code units, nil for abstract and native methods
+	insns []uint16
+}
+
+// String returns the smali style reference of a method, e.g. Lcom/foo/Bar;->run
+func (m dexMethodRef) String() string {
+	return m.class + "->" + m.name
+}
+
+// String returns the smali style reference of a field, e.g. Landroid/os/Build;->MODEL
+func (f dexFieldRef) String() string {
+	return f.class + "->" + f.name
+}
+
+var errBadDex = errors.New("malformed dex file")
+
+// parseDex reads the header and string table of a dex file
+func parseDex(name string, data []byte) (*dexFile, error) {
+	if len(data) < 0x70 || string(data[:4]) != "dex\n" {
+		return nil, errBadDex
+	}
+	d := &dexFile{name: name, data: data}
+
+	size, off := d.u32(0x38), d.u32(0x3C)
+	if uint64(off)+uint64(size)*4 > uint64(len(data)) {
+		return nil, errBadDex
+	}
+	d.strings = make([]string, size)
+	for i := range d.strings {
+		s, err := d.readString(d.u32(off + uint32(i)*4))
+		if err != nil {
+			return nil, err
+		}
+		d.strings[i] = s
+	}
+
+	size, off = d.u32(0x40), d.u32(0x44)
+	if uint64(off)+uint64(size)*4 > uint64(len(data)) {
+		return nil, errBadDex
+	}
+	d.types = make([]string, size)
+	for i := range d.types {
+		d.types[i] = d.str(d.u32(off + uint32(i)*4))
+	}
+
+	size, off = d.u32(0x48), d.u32(0x4C)
+	if uint64(off)+uint64(size)*12 > uint64(len(data)) {
+		return nil, errBadDex
+	}
+	d.protos = make([]dexProto, size)
+	for i := range d.protos {
+		item := off + uint32(i)*12
+		d.protos[i] = dexProto{
+			shorty: d.str(d.u32(item)),
+			ret:    d.typ(d.u32(item + 4)),
+			params: d.typeList(d.u32(item + 8)),
+		}
+	}
+
+	size, off = d.u32(0x50), d.u32(0x54)
+	if uint64(off)+uint64(size)*8 > uint64(len(data)) {
+		return nil, errBadDex
+	}
+	d.fields = make([]dexFieldRef, size)
+	for i := range d.fields {
+		item := off + uint32(i)*8
+		d.fields[i] = dexFieldRef{
+			class: d.typ(uint32(d.u16(item))),
+			typ:   d.typ(uint32(d.u16(item + 2))),
+			name:  d.str(d.u32(item + 4)),
+		}
+	}
+
+	size, off = d.u32(0x58), d.u32(0x5C)
+	if uint64(off)+uint64(size)*8 > uint64(len(data)) {
+		return nil, errBadDex
+	}
+	d.methods = make([]dexMethodRef, size)
+	for i := range d.methods {
+		item := off + uint32(i)*8
+		d.methods[i] = dexMethodRef{
+			class: d.typ(uint32(d.u16(item))),
+			proto: int(d.u16(item + 2)),
+			name:  d.str(d.u32(item + 4)),
+		}
+	}
+
+	size, off = d.u32(0x60), d.u32(0x64)
+	if uint64(off)+uint64(size)*32 > uint64(len(data)) {
+		return nil, errBadDex
+	}
+	d.classes = make([]dexClass, size)
+	for i := range d.classes {
+		item := off + uint32(i)*32
+		d.classes[i] = dexClass{
+			name:           d.typ(d.u32(item)),
+			access:         d.u32(item + 4),
+			super:          d.typ(d.u32(item + 8)),
+			interfaces:     d.typeList(d.u32(item + 12)),
+			source:         d.str(d.u32(item + 16)),
+			annotationsOff: d.u32(item + 20),
+			dataOff:        d.u32(item + 24),
+		}
+	}
+
+	return d, nil
+}
+
+// noIndex is the dex NO_INDEX value
+const noIndex = 0xffffffff
+
+// str returns the string at index i of the string table, "" when out of range
+func (d *dexFile) str(i uint32) string {
+	if i == noIndex || uint64(i) >= uint64(len(d.strings)) {
+		return ""
+	}
+	return d.strings[i]
+}
+
+// typ returns the descriptor of type i, e.g. Ljava/lang/String;
+func (d *dexFile) typ(i uint32) string {
+	if i == noIndex || uint64(i) >= uint64(len(d.types)) {
+		return ""
+	}
+	return d.types[i]
+}
+
+// method returns method_id i, the zero dexMethodRef when out of range
+func (d *dexFile) method(i uint32) dexMethodRef {
+	if uint64(i) >= uint64(len(d.methods)) {
+		return dexMethodRef{}
+	}
+	return d.methods[i]
+}
+
+// typeList returns the descriptors of the type_list at off
+func (d *dexFile) typeList(off uint32) []string {
+	if off == 0 {
+		return nil
+	}
+	size := d.u32(off)
+	if uint64(off)+4+uint64(size)*2 > uint64(len(d.data)) {
+		return nil
+	}
+	list := make([]string, size)
+	for i := range list {
+		list[i] = d.typ(uint32(d.u16(off + 4 + uint32(i)*2)))
+	}
+	return list
+}
+
+// eachMethod calls fn for every method defined in the dex
+func (d *dexFile) eachMethod(fn func(m dexMethod)) error {
+	for _, c := range d.classes {
+		if c.dataOff == 0 {
+			continue
+		}
+		off := c.dataOff
+		var counts [4]uint32
+		var err error
+		for i := range counts {
+			if counts[i], off, err = d.uleb128(off); err != nil {
+				return err
+			}
+		}
+		// skip the static and instance fields
+		for i := uint32(0); i < (counts[0]+counts[1])*2; i++ {
+			if _, off, err = d.uleb128(off); err != nil {
+				return err
+			}
+		}
+		// direct then virtual methods, each list's indexes are delta encoded
+		for _, n := range counts[2:] {
+			var idx uint32
+			for i := uint32(0); i < n; i++ {
+				var diff, access, codeOff uint32
+				if diff, off, err = d.uleb128(off); err != nil {
+					return err
+				}
+				if access, off, err = d.uleb128(off); err != nil {
+					return err
+				}
+				if codeOff, off, err = d.uleb128(off); err != nil {
+					return err
+				}
+				idx += diff
+				fn(dexMethod{
+					class:  c.name,
+					ref:    d.method(idx),
+					access: access,
+					insns:  d.code(codeOff),
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// classAnnotations returns the types of the annotations on class c itself
+func (d *dexFile) classAnnotations(c dexClass) []string {
+	if c.annotationsOff == 0 {
+		return nil
+	}
+	set := d.u32(c.annotationsOff)
+	if set == 0 || uint64(set)+4 > uint64(len(d.data)) {
+		return nil
+	}
+	size := d.u32(set)
+	if uint64(set)+4+uint64(size)*4 > uint64(len(d.data)) {
+		return nil
+	}
+	var types []string
+	for i := uint32(0); i < size; i++ {
+		// an annotation_item is a visibility byte followed by the annotation
+		item := d.u32(set + 4 + i*4)
+		typ, _, err := d.uleb128(item + 1)
+		if err != nil {
+			return types
+		}
+		types = append(types, d.typ(typ))
+	}
+	return types
+}
+
+// code returns the instructions of the code_item at off
+func (d *dexFile) code(off uint32) []uint16 {
+	if off == 0 {
+		return nil
+	}
+	size := d.u32(off + 12)
+	start := uint64(off) + 16
+	if start+uint64(size)*2 > uint64(len(d.data)) {
+		return nil
+	}
+	insns := make([]uint16, size)
+	for i := range insns {
+		insns[i] = binary.LittleEndian.Uint16(d.data[start+uint64(i)*2:])
+	}
+	return insns
+}
+
+func (d *dexFile) u16(off uint32) uint16 {
+	if uint64(off)+2 > uint64(len(d.data)) {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(d.data[off:])
+}
+
+func (d *dexFile) u32(off uint32) uint32 {
+	if uint64(off)+4 > uint64(len(d.data)) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(d.data[off:])
+}
+
+// uleb128 decodes the unsigned LEB128 value at off and returns the offset after it
+func (d *dexFile) uleb128(off uint32) (uint32, uint32, error) {
+	var v uint32
+	for i := uint32(0); i < 5; i++ {
+		if uint64(off+i) >= uint64(len(d.data)) {
+			return 0, 0, errBadDex
+		}
+		b := d.data[off+i]
+		v |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return v, off + i + 1, nil
+		}
+	}
+	return 0, 0, errBadDex
+}
+
+// readString decodes the MUTF-8 string_data_item at off
+func (d *dexFile) readString(off uint32) (string, error) {
+	n, off, err := d.uleb128(off)
+	if err != nil {
+		return "", err
+	}
+
+	// the length is the dex file's to claim, every unit takes a byte at least
+	if rest := uint32(len(d.data)) - off; n > rest {
+		n = rest
+	}
+	units := make([]uint16, 0, n)
+	for i := off; int(i) < len(d.data); {
+		b := d.data[i]
+		switch {
+		case b == 0:
+			return string(utf16.Decode(units)), nil
+		case b < 0x80:
+			units = append(units, uint16(b))
+			i++
+		case b&0xe0 == 0xc0 && int(i)+1 < len(d.data):
+			units = append(units, uint16(b&0x1f)<<6|uint16(d.data[i+1]&0x3f))
+			i += 2
+		case b&0xf0 == 0xe0 && int(i)+2 < len(d.data):
+			// surrogate pairs are encoded as two of these
+			units = append(units, uint16(b&0x0f)<<12|uint16(d.data[i+1]&0x3f)<<6|uint16(d.data[i+2]&0x3f))
+			i += 3
+		default:
+			return "", fmt.Errorf("invalid MUTF-8 string at %#x", off)
+		}
+	}
+	return "", errBadDex
+}
+
+// isDex reports whether an archive entry is one of the app's dex files
+func isDex(f *zip.File) bool {
+	name := path.Base(f.Name)
+	return path.Dir(f.Name) == "." && strings.HasPrefix(name, "classes") && strings.HasSuffix(name, ".dex")
+}
+
+// dexFiles are parsed on first use and shared by every analyzer of a scan
+type dexFiles struct {
+	once  sync.Once
+	files []*dexFile
+	err   error
+}
+
+// dexFiles returns the parsed classes*.dex files of an APK, dex files above
+// the max analyzed entry size are left out
+func (t *Target) dexFiles() ([]*dexFile, error) {
+	t.dex.once.Do(func() {
+		a, err := t.Archive()
+		if err != nil {
+			t.dex.err = err
+			return
+		}
+		for _, f := range a.File {
+			if !isDex(f) || !a.Analyzable(f) {
+				continue
+			}
+			data, err := a.ReadEntry(f)
+			if err != nil {
+				t.dex.err = fmt.Errorf("%s: %v", f.Name, err)
+				return
+			}
+			d, err := parseDex(f.Name, data)
+			if err != nil {
+				t.dex.err = fmt.Errorf("%s: %v", f.Name, err)
+				return
+			}
+			t.dex.files = append(t.dex.files, d)
+		}
+	})
+	return t.dex.files, t.dex.err
+}
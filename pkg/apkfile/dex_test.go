@@ -0,0 +1,324 @@
+package apkfile
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+// dexBuilder assembles small dex files for tests
+type dexBuilder struct {
+	strings   []string
+	stringIdx map[string]int
+	types     []int
+	typeIdx   map[string]int
+	protos    [][]int
+	protoIdx  map[string]int
+	fields    [][3]int
+	methods   [][3]int
+	classes   []builderClass
+	// mapTypes are written as the map_list when set
+	mapTypes []uint16
+}
+
+type builderClass struct {
+	name, super int
+	methods     []builderMethod
+	annotations []int
+}
+
+type builderMethod struct {
+	method int
+	insns  []uint16
+}
+
+func newDexBuilder() *dexBuilder {
+	return &dexBuilder{stringIdx: map[string]int{}, typeIdx: map[string]int{}, protoIdx: map[string]int{}}
+}
+
+func (b *dexBuilder) str(s string) int {
+	if i, ok := b.stringIdx[s]; ok {
+		return i
+	}
+	b.strings = append(b.strings, s)
+	b.stringIdx[s] = len(b.strings) - 1
+	return len(b.strings) - 1
+}
+
+func (b *dexBuilder) typ(desc string) int {
+	if i, ok := b.typeIdx[desc]; ok {
+		return i
+	}
+	b.types = append(b.types, b.str(desc))
+	b.typeIdx[desc] = len(b.types) - 1
+	return len(b.types) - 1
+}
+
+// method interns class->name with the given return and parameter types
+func (b *dexBuilder) method(class, name, ret string, params ...string) int {
+	key := ret
+	proto := []int{b.str("V"), b.typ(ret)}
+	for _, p := range params {
+		key += "," + p
+		proto = append(proto, b.typ(p))
+	}
+	pi, ok := b.protoIdx[key]
+	if !ok {
+		b.protos = append(b.protos, proto)
+		pi = len(b.protos) - 1
+		b.protoIdx[key] = pi
+	}
+	b.methods = append(b.methods, [3]int{b.typ(class), pi, b.str(name)})
+	return len(b.methods) - 1
+}
+
+// field interns class->name of the given type
+func (b *dexBuilder) field(class, name, typ string) int {
+	b.fields = append(b.fields, [3]int{b.typ(class), b.typ(typ), b.str(name)})
+	return len(b.fields) - 1
+}
+
+// class defines a class whose methods have the given bytecode
+func (b *dexBuilder) class(name, super string, methods ...builderMethod) {
+	sort.Slice(methods, func(i, j int) bool { return methods[i].method < methods[j].method })
+	b.classes = append(b.classes, builderClass{name: b.typ(name), super: b.typ(super), methods: methods})
+}
+
+// annotate adds class annotations of the given types to the last class defined
+func (b *dexBuilder) annotate(types ...string) {
+	c := &b.classes[len(b.classes)-1]
+	for _, t := range types {
+		c.annotations = append(c.annotations, b.typ(t))
+	}
+}
+
+func (b *dexBuilder) build() []byte {
+	stringsOff := 0x70
+	typesOff := stringsOff + 4*len(b.strings)
+	protosOff := typesOff + 4*len(b.types)
+	fieldsOff := protosOff + 12*len(b.protos)
+	methodsOff := fieldsOff + 8*len(b.fields)
+	classesOff := methodsOff + 8*len(b.methods)
+	data := make([]byte, classesOff+32*len(b.classes))
+
+	put32 := func(off, v int) { binary.LittleEndian.PutUint32(data[off:], uint32(v)) }
+	put16 := func(off, v int) { binary.LittleEndian.PutUint16(data[off:], uint16(v)) }
+	align := func() {
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	uleb := func(v int) {
+		for {
+			c := byte(v & 0x7f)
+			v >>= 7
+			if v != 0 {
+				data = append(data, c|0x80)
+				continue
+			}
+			data = append(data, c)
+			return
+		}
+	}
+
+	copy(data, "dex\n035\x00")
+	put32(0x38, len(b.strings))
+	put32(0x3C, stringsOff)
+	put32(0x40, len(b.types))
+	put32(0x44, typesOff)
+	put32(0x48, len(b.protos))
+	put32(0x4C, protosOff)
+	put32(0x50, len(b.fields))
+	put32(0x54, fieldsOff)
+	put32(0x58, len(b.methods))
+	put32(0x5C, methodsOff)
+	put32(0x60, len(b.classes))
+	put32(0x64, classesOff)
+
+	for i, s := range b.strings {
+		put32(stringsOff+4*i, len(data))
+		// the test strings are ASCII, so bytes and UTF-16 units match
+		uleb(len(s))
+		data = append(data, s...)
+		data = append(data, 0)
+	}
+	for i, s := range b.types {
+		put32(typesOff+4*i, s)
+	}
+	for i, p := range b.protos {
+		off := protosOff + 12*i
+		put32(off, p[0])
+		put32(off+4, p[1])
+		if len(p) > 2 {
+			align()
+			put32(off+8, len(data))
+			data = append(data, make([]byte, 4+2*(len(p)-2))...)
+			put32(len(data)-4-2*(len(p)-2), len(p)-2)
+			for j, t := range p[2:] {
+				put16(len(data)-2*(len(p)-2)+2*j, t)
+			}
+		}
+	}
+	for i, f := range b.fields {
+		off := fieldsOff + 8*i
+		put16(off, f[0])
+		put16(off+2, f[1])
+		put32(off+4, f[2])
+	}
+	for i, m := range b.methods {
+		off := methodsOff + 8*i
+		put16(off, m[0])
+		put16(off+2, m[1])
+		put32(off+4, m[2])
+	}
+	for i, c := range b.classes {
+		off := classesOff + 32*i
+		put32(off, c.name)
+		put32(off+8, c.super)
+		put32(off+12, 0)
+		put32(off+16, noIndex)
+
+		codeOffs := make([]int, len(c.methods))
+		for j, m := range c.methods {
+			if m.insns == nil {
+				// native methods have no code
+				continue
+			}
+			align()
+			codeOffs[j] = len(data)
+			data = append(data, make([]byte, 16)...)
+			put32(codeOffs[j]+12, len(m.insns))
+			for _, u := range m.insns {
+				data = append(data, byte(u), byte(u>>8))
+			}
+		}
+
+		if len(c.annotations) > 0 {
+			var items []int
+			for _, t := range c.annotations {
+				items = append(items, len(data))
+				data = append(data, 1) // VISIBILITY_RUNTIME
+				uleb(t)
+				uleb(0)
+			}
+			align()
+			set := len(data)
+			data = append(data, make([]byte, 4+4*len(items))...)
+			put32(set, len(items))
+			for j, item := range items {
+				put32(set+4+4*j, item)
+			}
+			put32(off+20, len(data))
+			data = append(data, make([]byte, 16)...)
+			put32(len(data)-16, set)
+		}
+
+		put32(off+24, len(data))
+		uleb(0)
+		uleb(0)
+		uleb(len(c.methods))
+		uleb(0)
+		prev := 0
+		for j, m := range c.methods {
+			uleb(m.method - prev)
+			prev = m.method
+			if m.insns == nil {
+				uleb(0x101)
+			} else {
+				uleb(0x1)
+			}
+			uleb(codeOffs[j])
+		}
+	}
+
+	if b.mapTypes != nil {
+		align()
+		put32(0x34, len(data))
+		data = append(data, make([]byte, 4+12*len(b.mapTypes))...)
+		put32(len(data)-12*len(b.mapTypes)-4, len(b.mapTypes))
+		for i, t := range b.mapTypes {
+			put16(len(data)-12*(len(b.mapTypes)-i), int(t))
+		}
+	}
+
+	return data
+}
+
+// TestParseDex tests the parseDex function.
+func TestParseDex(t *testing.T) {
+	b := newDexBuilder()
+	run := b.method("Lcom/example/Main;", "run", "V", "Ljava/lang/String;")
+	b.class("Lcom/example/Main;", "Ljava/lang/Object;", builderMethod{run, []uint16{0x000e}})
+	b.str("https://c2.example")
+
+	d, err := parseDex("classes.dex", b.build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.strings[len(d.strings)-1] != "https://c2.example" {
+		t.Errorf("unexpected strings: %q", d.strings)
+	}
+	if len(d.classes) != 1 || d.classes[0].name != "Lcom/example/Main;" || d.classes[0].super != "Ljava/lang/Object;" {
+		t.Errorf("unexpected classes: %#v", d.classes)
+	}
+
+	var methods []dexMethod
+	if err = d.eachMethod(func(m dexMethod) { methods = append(methods, m) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(methods) != 1 || methods[0].ref.String() != "Lcom/example/Main;->run" || len(methods[0].insns) != 1 {
+		t.Errorf("unexpected methods: %#v", methods)
+	}
+	if params := d.protos[methods[0].ref.proto].params; len(params) != 1 || params[0] != "Ljava/lang/String;" {
+		t.Errorf("unexpected parameters: %q", params)
+	}
+
+	if _, err = parseDex("classes.dex", []byte("PK\x03\x04")); err == nil {
+		t.Error("a zip should not parse as a dex file")
+	}
+}
+
+// TestReadStringMUTF8 tests decoding of MUTF-8 nulls and surrogate pairs.
+func TestReadStringMUTF8(t *testing.T) {
+	// "a\x00😀": NUL is 0xC0 0x80, the emoji is a CESU-8 surrogate pair
+	d := &dexFile{data: []byte{4, 'a', 0xc0, 0x80, 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80, 0}}
+	s, err := d.readString(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "a\x00😀" {
+		t.Errorf("got %q", s)
+	}
+}
+
+// TestReadStringHugeLength tests that a string's length doesn't size its buffer beyond the file.
+func TestReadStringHugeLength(t *testing.T) {
+	// a length of 0xffffffff units for a one letter string
+	d := &dexFile{data: []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 'a', 0}}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	s, err := d.readString(0)
+	runtime.ReadMemStats(&after)
+	if err != nil || s != "a" {
+		t.Fatalf("got %q, %v", s, err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("expected the length to be capped by the file, allocated %d bytes", allocated)
+	}
+}
+
+// TestEachInsn tests that instructions and payloads are walked by their widths.
+func TestEachInsn(t *testing.T) {
+	insns := []uint16{
+		0x001a, 0x0003, // const-string v0, string@3
+		0x106e, 0x0005, 0x0000, // invoke-virtual {v0}, method@5
+		0x000e,                               // return-void
+		0x0300, 0x0001, 0x0004, 0x0000, 1, 2, // fill-array-data-payload of 4 bytes
+	}
+	var ops []byte
+	eachInsn(insns, func(op byte, insn []uint16) { ops = append(ops, op) })
+	if string(ops) != "\x1a\x6e\x0e" {
+		t.Errorf("unexpected opcodes: % x", ops)
+	}
+}
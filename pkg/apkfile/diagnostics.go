@@ -0,0 +1,164 @@
+package apkfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+)
+
+// Diagnostic codes
+const (
+	// DiagnosticTimeout is an analyzer still running when the scan timed out
+	DiagnosticTimeout = "timeout"
+	// DiagnosticCancelled is an analyzer still running when the scan was cancelled
+	DiagnosticCancelled = "cancelled"
+	// DiagnosticToolMissing is an analyzer whose tool isn't installed
+	DiagnosticToolMissing = "tool_missing"
+	// DiagnosticPanic is an analyzer that crashed, e.g. on a malformed file
+	DiagnosticPanic = "panic"
+	// DiagnosticFailed is any other failure
+	DiagnosticFailed = "failed"
+	// DiagnosticRetried is an analyzer that only succeeded once retried
+	DiagnosticRetried = "retried"
+	// DiagnosticBuiltinMagic is a file type told without libmagic
+	DiagnosticBuiltinMagic = "builtin_detection"
+)
+
+// Diagnostic is an error or a warning of an analyzer, reported apart from its
+// section so the section only ever holds data
+type Diagnostic struct {
+	Analyzer string `json:"analyzer" structs:"analyzer"`
+	Code     string `json:"code" structs:"code"`
+	Message  string `json:"message" structs:"message"`
+	// Retryable is set when scanning again may succeed, e.g. after a timeout
+	Retryable bool `json:"retryable" structs:"retryable"`
+}
+
+// String is the analyzer and the message, e.g. for logs
+func (d Diagnostic) String() string {
+	return d.Analyzer + ": " + d.Message
+}
+
+// Diagnostics are the errors or the warnings of a report, by analyzer
+type Diagnostics []Diagnostic
+
+// Get returns the first diagnostic of analyzer
+func (d Diagnostics) Get(analyzer string) (Diagnostic, bool) {
+	for _, diag := range d {
+		if diag.Analyzer == analyzer {
+			return diag, true
+		}
+	}
+	return Diagnostic{}, false
+}
+
+// Without returns the diagnostics of the other analyzers, nil when there are
+// none
+func (d Diagnostics) Without(analyzer string) Diagnostics {
+	var rest Diagnostics
+	for _, diag := range d {
+		if diag.Analyzer != analyzer {
+			rest = append(rest, diag)
+		}
+	}
+	return rest
+}
+
+// UnmarshalJSON also reads the errors of reports stored before they were
+// structured, an analyzer to message object such as {"trid": "timeout"}
+func (d *Diagnostics) UnmarshalJSON(data []byte) error {
+	var list []Diagnostic
+	if err := json.Unmarshal(data, &list); err == nil {
+		*d = list
+		return nil
+	}
+	var legacy map[string]string
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	*d = nil
+	for analyzer, message := range legacy {
+		code := DiagnosticFailed
+		if message == DiagnosticTimeout || message == DiagnosticCancelled {
+			code = message
+		}
+		*d = append(*d, Diagnostic{Analyzer: analyzer, Code: code, Message: message, Retryable: code != DiagnosticFailed})
+	}
+	d.sort()
+	return nil
+}
+
+// sort orders the diagnostics by analyzer, keeping each analyzer's in order
+func (d Diagnostics) sort() {
+	sort.SliceStable(d, func(i, j int) bool { return d[i].Analyzer < d[j].Analyzer })
+}
+
+// newDiagnostic classifies the error an analyzer failed with, retryable tells
+// the transient ones
+func newDiagnostic(analyzer string, err error, retryable func(error) bool) Diagnostic {
+	d := Diagnostic{Analyzer: analyzer, Code: DiagnosticFailed, Message: err.Error()}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		d.Code, d.Message, d.Retryable = DiagnosticTimeout, "didn't finish before the scan timed out", true
+	case errors.Is(err, context.Canceled):
+		d.Code, d.Message, d.Retryable = DiagnosticCancelled, "the scan was cancelled before it finished", true
+	case errors.Is(err, exec.ErrNotFound):
+		d.Code = DiagnosticToolMissing
+	case errors.As(err, new(panicError)):
+		// the same sample crashes it again
+		d.Code = DiagnosticPanic
+	default:
+		d.Retryable = retryable != nil && retryable(err)
+	}
+	return d
+}
+
+// panicError is the value an analyzer panicked with
+type panicError struct {
+	value interface{}
+}
+
+func (e panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// warnings collects the warnings of one analyzer run
+type warnings struct {
+	sync.Mutex
+	list Diagnostics
+}
+
+type warningsKey struct{}
+
+// withWarnings returns a context that warn records warnings into
+func withWarnings(ctx context.Context, w *warnings) context.Context {
+	return context.WithValue(ctx, warningsKey{}, w)
+}
+
+// warn records a warning of the analyzer running with ctx, something that
+// didn't stop it but makes its section less reliable
+func warn(ctx context.Context, code, message string) {
+	w, ok := ctx.Value(warningsKey{}).(*warnings)
+	if !ok {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.list = append(w.list, Diagnostic{Code: code, Message: message})
+}
+
+// of returns the warnings recorded for analyzer
+func (w *warnings) of(analyzer string) Diagnostics {
+	w.Lock()
+	defer w.Unlock()
+	var list Diagnostics
+	for _, diag := range w.list {
+		diag.Analyzer = analyzer
+		list = append(list, diag)
+	}
+	return list
+}
@@ -0,0 +1,111 @@
+package apkfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+type failingAnalyzer struct {
+	name string
+	err  error
+}
+
+func (a failingAnalyzer) Name() string  { return a.name }
+func (failingAnalyzer) Available() bool { return true }
+
+func (a failingAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	return nil, a.err
+}
+
+type panickingAnalyzer struct{}
+
+func (panickingAnalyzer) Name() string    { return "panicking" }
+func (panickingAnalyzer) Available() bool { return true }
+
+func (panickingAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	var offsets []int
+	return offsets[3], nil
+}
+
+// TestScanPanic tests that an analyzer panicking only fails its own section.
+func TestScanPanic(t *testing.T) {
+	s := &Scanner{analyzers: []Analyzer{panickingAnalyzer{}, quickAnalyzer{}}, retry: RetryPolicy{Attempts: 3, Retryable: func(error) bool { return true }}}
+	fileInfo, err := s.Scan(context.Background(), "testdata/trid.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := fileInfo.Errors.Get("panicking"); e.Code != DiagnosticPanic || e.Retryable {
+		t.Errorf("expected a non-retryable panic error, got %#v", fileInfo.Errors)
+	}
+	if fileInfo.Analyzers["quick"] != "done" {
+		t.Errorf("expected the other sections, got %v", fileInfo.Analyzers)
+	}
+}
+
+// TestScanDiagnostics tests reporting failures as errors and retried analyzers as warnings, apart from the sections.
+func TestScanDiagnostics(t *testing.T) {
+	runs := 0
+	s := &Scanner{
+		analyzers: []Analyzer{
+			failingAnalyzer{"trid", fmt.Errorf("running trid: %w", exec.ErrNotFound)},
+			failingAnalyzer{"exiftool", errors.New("exiftool: unsupported file")},
+			flakyAnalyzer{&runs, syscall.ETXTBSY},
+			quickAnalyzer{},
+		},
+		retry: RetryPolicy{Attempts: 3},
+	}
+	fileInfo, err := s.Scan(context.Background(), "testdata/trid.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantErrors := Diagnostics{
+		{Analyzer: "exiftool", Code: DiagnosticFailed, Message: "exiftool: unsupported file"},
+		{Analyzer: "trid", Code: DiagnosticToolMissing, Message: "running trid: executable file not found in $PATH"},
+	}
+	if !reflect.DeepEqual(fileInfo.Errors, wantErrors) {
+		t.Errorf("expected errors %#v, got %#v", wantErrors, fileInfo.Errors)
+	}
+	if len(fileInfo.Warnings) != 1 || fileInfo.Warnings[0].Analyzer != "flaky" || fileInfo.Warnings[0].Code != DiagnosticRetried {
+		t.Errorf("expected the retried analyzer to be warned about, got %#v", fileInfo.Warnings)
+	}
+	if fileInfo.Exiftool != nil || fileInfo.TRiD != nil {
+		t.Errorf("expected no sections for the failed analyzers, got %v and %v", fileInfo.Exiftool, fileInfo.TRiD)
+	}
+	if fileInfo.Analyzers["flaky"] != "ok" || fileInfo.Analyzers["quick"] != "done" {
+		t.Errorf("unexpected sections %v", fileInfo.Analyzers)
+	}
+}
+
+// TestDiagnosticsUnmarshalJSON tests reading the errors of reports stored as an analyzer to message object.
+func TestDiagnosticsUnmarshalJSON(t *testing.T) {
+	var fi FileInfo
+	if err := json.Unmarshal([]byte(`{"errors": {"trid": "timeout", "exiftool": "exit status 1"}}`), &fi); err != nil {
+		t.Fatal(err)
+	}
+	want := Diagnostics{
+		{Analyzer: "exiftool", Code: DiagnosticFailed, Message: "exit status 1"},
+		{Analyzer: "trid", Code: DiagnosticTimeout, Message: "timeout", Retryable: true},
+	}
+	if !reflect.DeepEqual(fi.Errors, want) {
+		t.Errorf("expected %#v, got %#v", want, fi.Errors)
+	}
+
+	data, err := json.Marshal(fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi = FileInfo{}
+	if err := json.Unmarshal(data, &fi); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fi.Errors, want) {
+		t.Errorf("expected the errors to round trip, got %#v", fi.Errors)
+	}
+}
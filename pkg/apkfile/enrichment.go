@@ -0,0 +1,336 @@
+package apkfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEnrichmentTimeout is how long a lookup may take
+	DefaultEnrichmentTimeout = 10 * time.Second
+	// DefaultEnrichmentMaxWait is the longest a lookup waits for its
+	// provider's rate limit before it is skipped
+	DefaultEnrichmentMaxWait = 5 * time.Second
+	// DefaultEnrichmentCacheTTL is how long answers are cached
+	DefaultEnrichmentCacheTTL = 24 * time.Hour
+	// DefaultEnrichmentCacheSize caps the cached answers
+	DefaultEnrichmentCacheSize = 10000
+	// DefaultEnrichmentFailures is how many lookups of a provider must fail
+	// in a row for it to be considered down
+	DefaultEnrichmentFailures = 5
+	// DefaultEnrichmentCooldown is how long a provider that is down is
+	// skipped before it is tried again
+	DefaultEnrichmentCooldown = time.Minute
+)
+
+var (
+	errRateLimited  = errors.New("rate limited")
+	errProviderDown = errors.New("provider down, skipped")
+)
+
+// EnrichmentQuery is what providers look a sample up by
+type EnrichmentQuery struct {
+	SHA256 string
+	// Package is the APK's package name, empty for other files
+	Package string
+}
+
+// Enrichment is what an external service knows about the sample
+type Enrichment struct {
+	Provider string `json:"provider" structs:"provider"`
+	// Found is set when the service knows the sample, or lists the package
+	Found bool `json:"found" structs:"found"`
+	// Detected is set when the service considers the sample malicious
+	Detected bool `json:"detected,omitempty" structs:"detected,omitempty"`
+	// Detections is how many of Engines flag the sample
+	Detections int `json:"detections,omitempty" structs:"detections,omitempty"`
+	Engines    int `json:"engines,omitempty" structs:"engines,omitempty"`
+	// Label is the service's name for the threat, or for the app
+	Label string `json:"label,omitempty" structs:"label,omitempty"`
+	Link  string `json:"link,omitempty" structs:"link,omitempty"`
+	// Cached is set when the answer was cached from an earlier scan
+	Cached bool `json:"cached,omitempty" structs:"cached,omitempty"`
+}
+
+// Enrichments is the enrichment section, the answers of the providers and
+// why the others have none
+type Enrichments struct {
+	Results []Enrichment `json:"results,omitempty" structs:"results,omitempty"`
+	// Unavailable holds why a provider wasn't asked or didn't answer by name,
+	// e.g. rate limited or provider down, without failing the scan
+	Unavailable map[string]string `json:"unavailable,omitempty" structs:"unavailable,omitempty"`
+}
+
+// EnrichmentProvider looks samples up in an external service
+type EnrichmentProvider interface {
+	// Name is the key the provider's answers are reported under
+	Name() string
+	// Interval is the least time between two of its lookups, its quota
+	Interval() time.Duration
+	// Lookup asks the service about q, nil when q has nothing it can look
+	// up. Errors are outages, an unknown sample is an Enrichment that
+	// wasn't Found
+	Lookup(ctx context.Context, client *http.Client, q EnrichmentQuery) (*Enrichment, error)
+}
+
+// EnrichmentConfig adds an enrichment section looking samples up in external
+// services. Lookups are rate limited, cached and skipped while a provider is
+// down, so they never stall or fail scans
+type EnrichmentConfig struct {
+	// Client sends the lookups, http.DefaultClient when nil
+	Client    *http.Client
+	Providers []EnrichmentProvider
+	// Timeout, MaxWait, CacheTTL, CacheSize, Failures and Cooldown default
+	// to the DefaultEnrichment values
+	Timeout   time.Duration
+	MaxWait   time.Duration
+	CacheTTL  time.Duration
+	CacheSize int
+	Failures  int
+	Cooldown  time.Duration
+}
+
+// WithEnrichment looks every sample up with the providers of cfg
+func WithEnrichment(cfg EnrichmentConfig) Option {
+	return func(s *Scanner) {
+		if len(cfg.Providers) == 0 {
+			return
+		}
+		if cfg.Client == nil {
+			cfg.Client = http.DefaultClient
+		}
+		if cfg.Timeout == 0 {
+			cfg.Timeout = DefaultEnrichmentTimeout
+		}
+		if cfg.MaxWait == 0 {
+			cfg.MaxWait = DefaultEnrichmentMaxWait
+		}
+		if cfg.CacheTTL == 0 {
+			cfg.CacheTTL = DefaultEnrichmentCacheTTL
+		}
+		if cfg.CacheSize == 0 {
+			cfg.CacheSize = DefaultEnrichmentCacheSize
+		}
+		if cfg.Failures == 0 {
+			cfg.Failures = DefaultEnrichmentFailures
+		}
+		if cfg.Cooldown == 0 {
+			cfg.Cooldown = DefaultEnrichmentCooldown
+		}
+		e := &enricher{cfg: cfg, cache: make(map[string]cachedEnrichment)}
+		for _, p := range cfg.Providers {
+			e.providers = append(e.providers, &providerState{EnrichmentProvider: p})
+		}
+		s.enrichment = e
+	}
+}
+
+// enricher is the enrichment state of a scanner, shared by its scans
+type enricher struct {
+	cfg       EnrichmentConfig
+	providers []*providerState
+
+	mu    sync.Mutex
+	cache map[string]cachedEnrichment
+}
+
+type cachedEnrichment struct {
+	e       Enrichment
+	expires time.Time
+}
+
+// providerState is the rate limit and circuit breaker of a provider
+type providerState struct {
+	EnrichmentProvider
+
+	mu   sync.Mutex
+	next time.Time
+	// failures counts the lookups that failed in a row, the provider is
+	// skipped until openUntil once there are enough
+	failures  int
+	openUntil time.Time
+	// trial is set while the one lookup let through after the cooldown runs
+	trial bool
+}
+
+// reserve takes the provider's next lookup slot and returns when it is, or
+// fails when the provider is down or the slot is more than maxWait away
+func (p *providerState) reserve(now time.Time, failures int, maxWait time.Duration) (time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failures >= failures {
+		if now.Before(p.openUntil) || p.trial {
+			return time.Time{}, errProviderDown
+		}
+		// half open, one lookup finds out whether it's back
+		p.trial = true
+	}
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	if at.Sub(now) > maxWait {
+		p.trial = false
+		return time.Time{}, errRateLimited
+	}
+	p.next = at.Add(p.Interval())
+	return at, nil
+}
+
+// record counts a lookup's outcome, opening the circuit for cooldown after
+// too many failures in a row
+func (p *providerState) record(err error, failures int, cooldown time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.trial = false
+	if err == nil {
+		p.failures = 0
+		return
+	}
+	p.failures++
+	if p.failures >= failures {
+		p.openUntil = time.Now().Add(cooldown)
+	}
+}
+
+// release gives up a reserved lookup without counting it
+func (p *providerState) release() {
+	p.mu.Lock()
+	p.trial = false
+	p.mu.Unlock()
+}
+
+// cached returns the provider's unexpired answer for the hash
+func (e *enricher) cached(provider, sha256 string) (Enrichment, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c, ok := e.cache[provider+":"+sha256]
+	if !ok || time.Now().After(c.expires) {
+		return Enrichment{}, false
+	}
+	return c.e, true
+}
+
+// store caches an answer, making room by dropping expired answers, or any
+// answer when none has expired
+func (e *enricher) store(provider, sha256 string, answer Enrichment) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if len(e.cache) >= e.cfg.CacheSize {
+		for k, c := range e.cache {
+			if now.After(c.expires) {
+				delete(e.cache, k)
+			}
+		}
+		for k := range e.cache {
+			if len(e.cache) < e.cfg.CacheSize {
+				break
+			}
+			delete(e.cache, k)
+		}
+	}
+	e.cache[provider+":"+sha256] = cachedEnrichment{e: answer, expires: now.Add(e.cfg.CacheTTL)}
+}
+
+// lookup asks a provider about q, from the cache when it can
+func (e *enricher) lookup(ctx context.Context, p *providerState, q EnrichmentQuery) (*Enrichment, error) {
+	if answer, ok := e.cached(p.Name(), q.SHA256); ok {
+		answer.Cached = true
+		return &answer, nil
+	}
+
+	at, err := p.reserve(time.Now(), e.cfg.Failures, e.cfg.MaxWait)
+	if err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		p.release()
+		return nil, ctx.Err()
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	answer, err := p.Lookup(lookupCtx, e.cfg.Client, q)
+	if ctx.Err() != nil {
+		// the scan was canceled, that says nothing about the provider
+		p.release()
+		return nil, ctx.Err()
+	}
+	p.record(err, e.cfg.Failures, e.cfg.Cooldown)
+	if err != nil {
+		return nil, err
+	}
+	if answer != nil {
+		answer.Provider = p.Name()
+		e.store(p.Name(), q.SHA256, *answer)
+	}
+	return answer, nil
+}
+
+type enrichmentAnalyzer struct{ s *Scanner }
+
+func (enrichmentAnalyzer) Name() string      { return "enrichment" }
+func (a enrichmentAnalyzer) Available() bool { return a.s.enrichment != nil }
+
+func (a enrichmentAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	sha256sum, err := target.sha256()
+	if err != nil {
+		return nil, err
+	}
+	q := EnrichmentQuery{SHA256: sha256sum}
+	if root, err := target.manifest(); err == nil {
+		q.Package = root.Attr("package")
+	}
+
+	e := a.s.enrichment
+	answers := make([]*Enrichment, len(e.providers))
+	errs := make([]error, len(e.providers))
+	var wg sync.WaitGroup
+	for i, p := range e.providers {
+		wg.Add(1)
+		go func(i int, p *providerState) {
+			defer wg.Done()
+			answers[i], errs[i] = e.lookup(ctx, p, q)
+		}(i, p)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	section := &Enrichments{}
+	for i, p := range e.providers {
+		if errs[i] != nil {
+			if section.Unavailable == nil {
+				section.Unavailable = make(map[string]string)
+			}
+			section.Unavailable[p.Name()] = errs[i].Error()
+			continue
+		}
+		if answers[i] != nil {
+			section.Results = append(section.Results, *answers[i])
+		}
+	}
+	if len(section.Results) == 0 && len(section.Unavailable) == 0 {
+		return nil, nil
+	}
+	return section, nil
+}
+
+// statusError is the error of a provider answering with an unexpected status
+func statusError(resp *http.Response) error {
+	return fmt.Errorf("unexpected status %s", resp.Status)
+}
@@ -0,0 +1,105 @@
+package apkfile
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestEnrichmentAnalyzer tests looking samples up on VirusTotal, caching the
+// answers and skipping the provider while it is down.
+func TestEnrichmentAnalyzer(t *testing.T) {
+	requests, down := 0, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case down:
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		case r.Header.Get("x-apikey") != "k3y":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case r.URL.Path == "/files/aaaa":
+			w.Write([]byte(`{"data": {"attributes": {
+				"last_analysis_stats": {"malicious": 12, "suspicious": 1, "undetected": 51},
+				"popular_threat_classification": {"suggested_threat_label": "trojan.joker/smsreg"}}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	path := writeZip(t, map[string]string{"assets/a.txt": "a"})
+	defer os.Remove(path)
+
+	s := &Scanner{}
+	WithEnrichment(EnrichmentConfig{
+		Providers: []EnrichmentProvider{VirusTotal{APIKey: "k3y", URL: server.URL, PerMinute: 60000}},
+		Failures:  2,
+		Cooldown:  time.Hour,
+	})(s)
+	run := func(sha256 string) *Enrichments {
+		target := &Target{Path: path, Hashes: &FileHashes{SHA256: sha256}}
+		defer target.close()
+		section, err := enrichmentAnalyzer{s}.Run(context.Background(), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return section.(*Enrichments)
+	}
+
+	want := Enrichment{
+		Provider:   "virustotal",
+		Found:      true,
+		Detected:   true,
+		Detections: 12,
+		Engines:    64,
+		Label:      "trojan.joker/smsreg",
+		Link:       "https://www.virustotal.com/gui/file/aaaa",
+	}
+	if e := run("aaaa"); len(e.Results) != 1 || !reflect.DeepEqual(e.Results[0], want) {
+		t.Errorf("expected %+v, got %+v", want, e)
+	}
+	if e := run("bbbb"); len(e.Results) != 1 || e.Results[0].Found {
+		t.Errorf("expected an unknown sample, got %+v", e)
+	}
+
+	down = true
+	want.Cached = true
+	if e := run("aaaa"); len(e.Results) != 1 || !reflect.DeepEqual(e.Results[0], want) {
+		t.Errorf("expected the cached answer, got %+v", e)
+	}
+	for i := 0; i < 2; i++ {
+		if e := run("cccc"); e.Unavailable["virustotal"] != "unexpected status 503 Service Unavailable" {
+			t.Errorf("expected the outage to be reported, got %+v", e)
+		}
+	}
+	before := requests
+	if e := run("dddd"); e.Unavailable["virustotal"] != errProviderDown.Error() || requests != before {
+		t.Errorf("expected the provider to be skipped, got %+v after %d requests", e, requests-before)
+	}
+}
+
+// TestEnrichmentRateLimit tests skipping lookups that would wait too long for
+// the provider's quota.
+func TestEnrichmentRateLimit(t *testing.T) {
+	p := &providerState{EnrichmentProvider: VirusTotal{PerMinute: 1}}
+	now := time.Now()
+	if at, err := p.reserve(now, 5, time.Second); err != nil || !at.Equal(now) {
+		t.Fatalf("expected the first lookup to go through, got %v %v", at, err)
+	}
+	if _, err := p.reserve(now, 5, time.Second); err != errRateLimited {
+		t.Errorf("expected the second lookup to be rate limited, got %v", err)
+	}
+
+	p.record(errRateLimited, 1, time.Millisecond)
+	later := time.Now().Add(time.Hour)
+	if _, err := p.reserve(later, 1, time.Hour); err != nil {
+		t.Errorf("expected a trial lookup after the cooldown, got %v", err)
+	}
+	if _, err := p.reserve(later, 1, time.Hour); err != errProviderDown {
+		t.Errorf("expected one trial lookup at a time, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package apkfile
+
+import "bytes"
+
+// Kinds of evidence
+const (
+	// EvidenceFile is an archive entry, e.g. one whose name escapes the
+	// extraction directory
+	EvidenceFile = "file"
+	// EvidenceString is a string in an entry, at Offset when it was found there
+	EvidenceString = "string"
+	// EvidenceManifest is an attribute of AndroidManifest.xml
+	EvidenceManifest = "manifest"
+	// EvidenceCertificate is a field of a signing certificate
+	EvidenceCertificate = "certificate"
+	// EvidenceCode is an API or class the dex files reference
+	EvidenceCode = "code"
+	// EvidenceHash is a hash of the sample itself
+	EvidenceHash = "hash"
+	// EvidenceRule is the condition of a policy rule the report matches
+	EvidenceRule = "rule"
+)
+
+// Evidence is a concrete fact a flag was raised on, for analysts to verify
+// the finding without re-analyzing the sample
+type Evidence struct {
+	// Flag is the flag the evidence backs, only set in the verdict's, e.g.
+	// toll_fraud or blocklisted_signer
+	Flag string `json:"flag,omitempty" structs:"flag,omitempty"`
+	Kind string `json:"kind" structs:"kind"`
+	// Path is the archive entry it is in, e.g. classes.dex or assets/login.html
+	Path string `json:"path,omitempty" structs:"path,omitempty"`
+	// Offset is where the string starts in Path, in bytes
+	Offset *int64 `json:"offset,omitempty" structs:"offset,omitempty"`
+	// Attribute is the manifest element and attribute, e.g.
+	// uses-permission@android:name, or the certificate field, e.g. subject
+	Attribute string `json:"attribute,omitempty" structs:"attribute,omitempty"`
+	Value     string `json:"value,omitempty" structs:"value,omitempty"`
+	// Detail says what the evidence shows, e.g. requests SEND_SMS
+	Detail string `json:"detail" structs:"detail"`
+}
+
+// String is the evidence's detail, e.g. for the Markdown report
+func (e Evidence) String() string {
+	return e.Detail
+}
+
+// permissionEvidence is the <uses-permission> of a permission the app requests
+func permissionEvidence(permission, detail string) Evidence {
+	return Evidence{
+		Kind:      EvidenceManifest,
+		Path:      "AndroidManifest.xml",
+		Attribute: "uses-permission@android:name",
+		Value:     permission,
+		Detail:    detail,
+	}
+}
+
+// stringEvidence is value found in the entry path, with the offset of its
+// first occurrence in data, the entry's content, when it is there verbatim
+func stringEvidence(path string, data []byte, value, detail string) Evidence {
+	e := Evidence{Kind: EvidenceString, Path: path, Value: value, Detail: detail}
+	if i := bytes.Index(data, []byte(value)); i >= 0 {
+		offset := int64(i)
+		e.Offset = &offset
+	}
+	return e
+}
+
+// certificateEvidence is a field of a signing certificate
+func certificateEvidence(field, value, detail string) Evidence {
+	return Evidence{Kind: EvidenceCertificate, Attribute: field, Value: value, Detail: detail}
+}
@@ -0,0 +1,119 @@
+package apkfile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Limits are the rlimits every external tool runs under, zero means unlimited
+type Limits struct {
+	// CPU is the CPU time limit in seconds
+	CPU uint64
+	// Memory is the address space limit in bytes
+	Memory uint64
+	// FileSize is the largest file a tool may write in bytes
+	FileSize uint64
+	// NProc is the maximum number of processes/threads for the tool's user
+	NProc uint64
+}
+
+var (
+	prlimitOnce sync.Once
+	prlimitPath string
+)
+
+// enabled reports whether any limit is set
+func (l Limits) enabled() bool {
+	return l.CPU != 0 || l.Memory != 0 || l.FileSize != 0 || l.NProc != 0
+}
+
+// prlimitArgs returns the util-linux prlimit options for the limits that are set
+func (l Limits) prlimitArgs() []string {
+	args := []string{}
+	if l.CPU != 0 {
+		args = append(args, "--cpu="+strconv.FormatUint(l.CPU, 10))
+	}
+	if l.Memory != 0 {
+		args = append(args, "--as="+strconv.FormatUint(l.Memory, 10))
+	}
+	if l.FileSize != 0 {
+		args = append(args, "--fsize="+strconv.FormatUint(l.FileSize, 10))
+	}
+	if l.NProc != 0 {
+		args = append(args, "--nproc="+strconv.FormatUint(l.NProc, 10))
+	}
+	return args
+}
+
+// limitCommand wraps name and args with prlimit so the tool runs under l
+func limitCommand(l Limits, name string, args ...string) (string, []string) {
+	if !l.enabled() {
+		return name, args
+	}
+
+	prlimitOnce.Do(func() {
+		var err error
+		if prlimitPath, err = exec.LookPath("prlimit"); err != nil {
+			log.Warn("prlimit not found, external tools will run without resource limits")
+		}
+	})
+	if prlimitPath == "" {
+		return name, args
+	}
+
+	wrapped := append(l.prlimitArgs(), "--", name)
+	return prlimitPath, append(wrapped, args...)
+}
+
+// runTool runs an external tool against sample through the scanner's
+// execution backend and resource limits and returns its stdout
+func (s *Scanner) runTool(ctx context.Context, sample string, name string, args ...string) (string, error) {
+	return s.runToolInput(ctx, sample, nil, name, args...)
+}
+
+// runToolInput is runTool with stdin connected to input
+func (s *Scanner) runToolInput(ctx context.Context, sample string, input io.Reader, name string, args ...string) (string, error) {
+	name, args, err := s.backend.Wrap(s.limits, s.toolPath(name), args, sample)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = input
+	s.killOnCancel(cmd)
+	output, err := cmd.Output()
+	recordUsage(ctx, cmd.ProcessState)
+	if err != nil {
+		return string(output), err
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command %s timed out", name)
+	}
+
+	return string(output), nil
+}
+
+// killOnCancel makes cancelling a command's context send SIGTERM to its whole
+// process group, and SIGKILL once the scanner's kill grace period is over
+func (s *Scanner) killOnCancel(cmd *exec.Cmd) {
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		log.Debugf("killing %s, pid: %d", cmd.Path, cmd.Process.Pid)
+		signalProcessGroup(cmd, syscall.SIGTERM)
+		time.AfterFunc(s.killGrace, func() {
+			// tools may have exited already, in which case this is a no-op
+			signalProcessGroup(cmd, syscall.SIGKILL)
+		})
+		return nil
+	}
+	// grandchildren holding stdout open must not keep Wait blocked forever
+	cmd.WaitDelay = s.killGrace + time.Second
+}
@@ -0,0 +1,25 @@
+package apkfile
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestRunToolCancel tests that cancelling a scan kills tools that ignore SIGTERM.
+func TestRunToolCancel(t *testing.T) {
+	s := &Scanner{backend: localBackend{}, killGrace: 100 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	// the sleep is a grandchild holding stdout open, it dies with the process group
+	_, err := s.runTool(ctx, "", "sh", "-c", "trap '' TERM; sleep 30; echo done")
+	if err == nil {
+		t.Fatal("expected the cancelled tool to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("tool should be killed after the grace period, took %s", elapsed)
+	}
+}
@@ -0,0 +1,135 @@
+package apkfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ExpansionFile is an OBB expansion file shipped alongside an APK, apps
+// download it from Google Play to the device next to the APK
+type ExpansionFile struct {
+	Path string
+	// Name is the file's original name, the base name of Path when empty
+	Name string
+}
+
+// Expansion is the expansion file an APK was scanned with
+type Expansion struct {
+	Name   string     `json:"name" structs:"name"`
+	Size   int64      `json:"size" structs:"size"`
+	Hashes FileHashes `json:"hashes" structs:"hashes"`
+	// Type is archive for zip OBBs, apk for an APK renamed to one and file
+	// for anything else, e.g. jobb's FAT images
+	Type string `json:"type" structs:"type"`
+	// Kind, Version and Package are what the name says when it follows Google
+	// Play's main.<version>.<package>.obb convention, Kind is main or patch
+	Kind    string `json:"kind,omitempty" structs:"kind,omitempty"`
+	Version int64  `json:"version,omitempty" structs:"version,omitempty"`
+	Package string `json:"package,omitempty" structs:"package,omitempty"`
+	// Linked is set when Package is the APK's package
+	Linked            bool              `json:"linked" structs:"linked"`
+	Entries           []ArchiveEntry    `json:"entries,omitempty" structs:"entries,omitempty"`
+	SuspiciousEntries []SuspiciousEntry `json:"suspicious_entries,omitempty" structs:"suspicious_entries,omitempty"`
+	// Code are the entries that are DEX, ELF or APK files, expansion files are
+	// meant for assets and code in one is loaded at runtime
+	Code []string `json:"code,omitempty" structs:"code,omitempty"`
+}
+
+// obbName is Google Play's naming convention for expansion files
+var obbName = regexp.MustCompile(`^(main|patch)\.(\d+)\.(.+)\.obb$`)
+
+// ScanWithExpansion is ScanHashed for an APK shipped with an expansion file,
+// the report's expansion section enumerates and hashes it and links it to
+// the APK
+func (s *Scanner) ScanWithExpansion(ctx context.Context, path string, hashes FileHashes, obb ExpansionFile) (FileInfo, error) {
+	if obb.Name == "" {
+		obb.Name = filepath.Base(obb.Path)
+	}
+	return s.scan(ctx, path, &hashes, &obb, nil)
+}
+
+type expansionAnalyzer struct{}
+
+func (expansionAnalyzer) Name() string    { return "expansion" }
+func (expansionAnalyzer) Available() bool { return true }
+
+func (expansionAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	if target.expansion == nil {
+		return nil, nil
+	}
+	info, err := os.Stat(target.expansion.Path)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := HashFile(target.expansion.Path)
+	if err != nil {
+		return nil, err
+	}
+	obb := &Target{Path: target.expansion.Path, Hashes: &hashes, maxEntrySize: target.maxEntrySize}
+	defer obb.close()
+
+	e := &Expansion{
+		Name:   target.expansion.Name,
+		Size:   info.Size(),
+		Hashes: hashes,
+		Type:   obb.Type(),
+	}
+	if m := obbName.FindStringSubmatch(e.Name); m != nil {
+		e.Kind, e.Package = m[1], m[3]
+		e.Version, _ = strconv.ParseInt(m[2], 10, 64)
+		if root, err := target.manifest(); err == nil {
+			e.Linked = root.Attr("package") == e.Package
+		}
+	}
+
+	entries, err := entriesAnalyzer{}.Run(ctx, obb)
+	if err != nil {
+		return nil, err
+	}
+	if entries != nil {
+		e.Entries = entries.([]ArchiveEntry)
+	}
+	suspicious, err := suspiciousEntriesAnalyzer{}.Run(ctx, obb)
+	if err != nil {
+		return nil, err
+	}
+	if suspicious != nil {
+		e.SuspiciousEntries = suspicious.([]SuspiciousEntry)
+	}
+	if a, err := obb.Archive(); err == nil {
+		for _, f := range a.File {
+			if !f.FileInfo().IsDir() && isCode(f.Name, f.Open) {
+				e.Code = append(e.Code, f.Name)
+			}
+		}
+	}
+	return e, nil
+}
+
+// isCode reports whether the entry name opens is a DEX, ELF or APK file
+func isCode(name string, open func() (io.ReadCloser, error)) bool {
+	rc, err := open()
+	if err != nil {
+		return false
+	}
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(rc, head)
+	rc.Close()
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("dex\n")), bytes.HasPrefix(head, []byte("\x7fELF")):
+		return true
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		ext := strings.ToLower(path.Ext(name))
+		return ext == ".apk" || ext == ".jar" || ext == ".dex"
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestExpansionAnalyzer tests enumerating an expansion file and linking it to the APK.
+func TestExpansionAnalyzer(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.game.puzzle" android:versionCode="7"><application/></manifest>`
+	apk := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+	defer os.Remove(apk)
+	obb := writeZip(t, map[string]string{
+		"textures/level1.png": "\x89PNG\r\n\x1a\nlevel",
+		"data/update.bin":     "dex\n035\x00",
+	})
+	defer os.Remove(obb)
+	hashes, err := HashFile(obb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		kind   string
+		linked bool
+	}{
+		{"main.7.com.game.puzzle.obb", "main", true},
+		{"patch.7.com.other.app.obb", "patch", false},
+		{"assets.obb", "", false},
+	}
+	for _, tt := range tests {
+		target := &Target{Path: apk, expansion: &ExpansionFile{Path: obb, Name: tt.name}}
+		section, err := expansionAnalyzer{}.Run(context.Background(), target)
+		target.close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := section.(*Expansion)
+		if e.Kind != tt.kind || e.Linked != tt.linked || e.Hashes.SHA256 != hashes.SHA256 || e.Type != TargetArchive {
+			t.Errorf("%s: unexpected expansion %+v", tt.name, e)
+		}
+		if len(e.Entries) != 2 || len(e.Code) != 1 || e.Code[0] != "data/update.bin" {
+			t.Errorf("%s: unexpected entries %+v, code %v", tt.name, e.Entries, e.Code)
+		}
+	}
+
+	fi := FileInfo{Expansion: &Expansion{Name: "main.7.com.game.puzzle.obb", Code: []string{"data/update.bin"}}}
+	fi.judge()
+	if fi.Verdict == nil || fi.Verdict.Verdict != VerdictSuspicious {
+		t.Errorf("expected code in an expansion file to be suspicious, got %#v", fi.Verdict)
+	}
+
+	target := &Target{Path: apk}
+	defer target.close()
+	if section, err := (expansionAnalyzer{}).Run(context.Background(), target); section != nil || err != nil {
+		t.Errorf("expected nothing without an expansion file, got %v, %v", section, err)
+	}
+}
@@ -0,0 +1,124 @@
+package apkfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Kinds of malware feed matches, from most to least certain
+const (
+	FeedMatchExact     = "exact"
+	FeedMatchVersion   = "other_version"
+	FeedMatchLookalike = "lookalike"
+)
+
+// minLookalikeLength keeps short package names, which are a couple of edits
+// away from many others, from being matched as lookalikes
+const minLookalikeLength = 10
+
+// MalwarePackage is a package name a feed ties to a malware family
+type MalwarePackage struct {
+	Package string `json:"package"`
+	// VersionCodes are the builds known to be malicious, any build when empty
+	VersionCodes []int64 `json:"version_codes,omitempty"`
+	Family       string  `json:"family"`
+}
+
+// FeedMatch is a malware feed entry the APK matches
+type FeedMatch struct {
+	// Match is exact, other_version when only other builds of the package
+	// are known to be malicious, or lookalike for a package name a couple of
+	// characters away
+	Match       string `json:"match" structs:"match"`
+	Package     string `json:"package" structs:"package"`
+	VersionCode string `json:"version_code,omitempty" structs:"version_code,omitempty"`
+	Family      string `json:"family" structs:"family"`
+}
+
+// LoadMalwareFeed reads a malware package feed from a JSON file of the form
+//
+//	{"packages": [{"package": "com.example.flash", "version_codes": [12, 13], "family": "FluBot"}]}
+func LoadMalwareFeed(path string) ([]MalwarePackage, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed struct {
+		Packages []MalwarePackage `json:"packages"`
+	}
+	if err = json.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for _, p := range feed.Packages {
+		if p.Package == "" || p.Family == "" {
+			return nil, fmt.Errorf("parsing %s: every package needs a package name and a family", path)
+		}
+	}
+
+	return feed.Packages, nil
+}
+
+// WithMalwareFeed adds a malware_packages section matching the APK's package
+// name and versionCode against feed
+func WithMalwareFeed(feed []MalwarePackage) Option {
+	return func(s *Scanner) {
+		s.malwareFeed = feed
+	}
+}
+
+type feedAnalyzer struct{ s *Scanner }
+
+func (feedAnalyzer) Name() string      { return "malware_packages" }
+func (a feedAnalyzer) Available() bool { return len(a.s.malwareFeed) > 0 }
+
+func (a feedAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, versionCode := root.Attr("package"), root.Attr("versionCode")
+	lookalike := strings.ToLower(homoglyphs.Replace(pkg))
+	matches := []FeedMatch{}
+	for _, p := range a.s.malwareFeed {
+		match := FeedMatch{Package: p.Package, VersionCode: versionCode, Family: p.Family}
+		switch {
+		case p.Package == pkg && hasVersion(p.VersionCodes, versionCode):
+			match.Match = FeedMatchExact
+		case p.Package == pkg:
+			match.Match = FeedMatchVersion
+		case len(pkg) >= minLookalikeLength && (lookalike == p.Package || editDistance(pkg, p.Package) <= 2):
+			match.Match = FeedMatchLookalike
+		default:
+			continue
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+// hasVersion reports whether versionCode is one of codes, or codes is empty
+func hasVersion(codes []int64, versionCode string) bool {
+	if len(codes) == 0 {
+		return true
+	}
+	v, err := strconv.ParseInt(versionCode, 10, 64)
+	if err != nil {
+		return false
+	}
+	for _, c := range codes {
+		if c == v {
+			return true
+		}
+	}
+	return false
+}
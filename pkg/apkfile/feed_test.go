@@ -0,0 +1,75 @@
+package apkfile
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestLoadMalwareFeed tests reading a malware package feed.
+func TestLoadMalwareFeed(t *testing.T) {
+	f, err := ioutil.TempFile("", "feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"packages": [{"package": "com.flash.update", "version_codes": [12], "family": "FluBot"}]}`)
+	f.Close()
+
+	feed, err := LoadMalwareFeed(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MalwarePackage{{Package: "com.flash.update", VersionCodes: []int64{12}, Family: "FluBot"}}
+	if !reflect.DeepEqual(feed, want) {
+		t.Errorf("expected %v, got %v", want, feed)
+	}
+
+	ioutil.WriteFile(f.Name(), []byte(`{"packages": [{"package": "com.flash.update"}]}`), 0644)
+	if _, err := LoadMalwareFeed(f.Name()); err == nil {
+		t.Error("expected an error for a package without a family")
+	}
+}
+
+// TestFeedAnalyzer tests matching the package name and versionCode against the feed.
+func TestFeedAnalyzer(t *testing.T) {
+	s := &Scanner{malwareFeed: []MalwarePackage{
+		{Package: "com.flash.update", VersionCodes: []int64{12}, Family: "FluBot"},
+		{Package: "com.android.battery", Family: "Joker"},
+		{Package: "com.bank.token", Family: "Anatsa"},
+	}}
+
+	tests := []struct {
+		pkg, versionCode string
+		want             []FeedMatch
+	}{
+		{"com.flash.update", "12", []FeedMatch{{FeedMatchExact, "com.flash.update", "12", "FluBot"}}},
+		{"com.flash.update", "13", []FeedMatch{{FeedMatchVersion, "com.flash.update", "13", "FluBot"}}},
+		{"com.android.battery", "1", []FeedMatch{{FeedMatchExact, "com.android.battery", "1", "Joker"}}},
+		{"com.andr0id.battery", "1", []FeedMatch{{FeedMatchLookalike, "com.android.battery", "1", "Joker"}}},
+		{"com.bank.tokens", "1", []FeedMatch{{FeedMatchLookalike, "com.bank.token", "1", "Anatsa"}}},
+		{"com.example.notes", "1", []FeedMatch{}},
+	}
+	for _, tt := range tests {
+		manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="` + tt.pkg + `" android:versionCode="` + tt.versionCode + `"><application/></manifest>`
+		path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+		target := &Target{Path: path}
+		section, err := feedAnalyzer{s}.Run(context.Background(), target)
+		target.close()
+		os.Remove(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := section.([]FeedMatch); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s: expected %v, got %v", tt.pkg, tt.versionCode, tt.want, got)
+		}
+	}
+
+	fi := &FileInfo{MalwarePackages: []FeedMatch{{FeedMatchExact, "com.flash.update", "12", "FluBot"}}}
+	fi.judge()
+	if fi.Verdict == nil || fi.Verdict.Verdict != VerdictMalicious {
+		t.Errorf("unexpected verdict %#v", fi.Verdict)
+	}
+}
@@ -0,0 +1,77 @@
+package apkfile
+
+import (
+	"debug/elf"
+	"strings"
+)
+
+// Hardening is the exploit mitigations a native library was built with, as
+// reported by checksec
+type Hardening struct {
+	// NX is set when the stack isn't executable
+	NX bool `json:"nx" structs:"nx"`
+	// RELRO is full, partial or none
+	RELRO string `json:"relro" structs:"relro"`
+	// Canary is set when the library uses stack protector canaries
+	Canary bool `json:"canary" structs:"canary"`
+	// PIE is set for position independent code without text relocations
+	PIE bool `json:"pie" structs:"pie"`
+	// Fortify is set when the library calls _FORTIFY_SOURCE checked functions
+	Fortify  bool `json:"fortify" structs:"fortify"`
+	Stripped bool `json:"stripped" structs:"stripped"`
+}
+
+func checkHardening(f *elf.File) *Hardening {
+	h := &Hardening{RELRO: "none"}
+
+	// without a GNU_STACK header the loader makes the stack executable
+	for _, p := range f.Progs {
+		switch p.Type {
+		case elf.PT_GNU_STACK:
+			h.NX = p.Flags&elf.PF_X == 0
+		case elf.PT_GNU_RELRO:
+			h.RELRO = "partial"
+		}
+	}
+	if h.RELRO == "partial" && bindNow(f) {
+		h.RELRO = "full"
+	}
+
+	textrel := hasDynTag(f, elf.DT_TEXTREL)
+	if flags, _ := f.DynValue(elf.DT_FLAGS); len(flags) > 0 && elf.DynFlag(flags[0])&elf.DF_TEXTREL != 0 {
+		textrel = true
+	}
+	h.PIE = f.Type == elf.ET_DYN && !textrel
+
+	syms, _ := f.DynamicSymbols()
+	for _, s := range syms {
+		switch {
+		case s.Name == "__stack_chk_fail" || s.Name == "__stack_chk_guard":
+			h.Canary = true
+		case strings.HasPrefix(s.Name, "__") && strings.HasSuffix(s.Name, "_chk"):
+			h.Fortify = true
+		}
+	}
+
+	h.Stripped = f.Section(".symtab") == nil
+	return h
+}
+
+// bindNow reports whether every symbol is resolved at load time, which lets
+// the loader make the whole GOT read-only
+func bindNow(f *elf.File) bool {
+	if hasDynTag(f, elf.DT_BIND_NOW) {
+		return true
+	}
+	if flags, _ := f.DynValue(elf.DT_FLAGS); len(flags) > 0 && elf.DynFlag(flags[0])&elf.DF_BIND_NOW != 0 {
+		return true
+	}
+	flags, _ := f.DynValue(elf.DT_FLAGS_1)
+	return len(flags) > 0 && elf.DynFlag1(flags[0])&elf.DF_1_NOW != 0
+}
+
+// hasDynTag reports whether the dynamic section has tag
+func hasDynTag(f *elf.File, tag elf.DynTag) bool {
+	vals, _ := f.DynValue(tag)
+	return len(vals) > 0
+}
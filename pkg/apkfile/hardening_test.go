@@ -0,0 +1,52 @@
+package apkfile
+
+import (
+	"bytes"
+	"debug/elf"
+	"reflect"
+	"testing"
+)
+
+// TestCheckHardening tests the checksec style mitigation checks.
+func TestCheckHardening(t *testing.T) {
+	for name, tt := range map[string]struct {
+		lib  elfBuilder
+		want Hardening
+	}{
+		"none": {
+			elfBuilder{dynamic: []elf.Dyn64{{Tag: int64(elf.DT_TEXTREL)}}},
+			Hardening{RELRO: "none", Stripped: true},
+		},
+		"partial": {
+			elfBuilder{
+				imports: []string{"__stack_chk_fail"},
+				progs:   []elf.Prog64{{Type: uint32(elf.PT_GNU_STACK), Flags: uint32(elf.PF_R | elf.PF_W)}, {Type: uint32(elf.PT_GNU_RELRO)}},
+				symtab:  true,
+			},
+			Hardening{NX: true, RELRO: "partial", Canary: true, PIE: true},
+		},
+		"full": {
+			elfBuilder{
+				imports: []string{"__memcpy_chk", "__stack_chk_guard"},
+				progs:   []elf.Prog64{{Type: uint32(elf.PT_GNU_STACK), Flags: uint32(elf.PF_R | elf.PF_W)}, {Type: uint32(elf.PT_GNU_RELRO)}},
+				dynamic: []elf.Dyn64{{Tag: int64(elf.DT_FLAGS_1), Val: uint64(elf.DF_1_NOW)}},
+			},
+			Hardening{NX: true, RELRO: "full", Canary: true, PIE: true, Fortify: true, Stripped: true},
+		},
+		"executable stack": {
+			elfBuilder{
+				progs:   []elf.Prog64{{Type: uint32(elf.PT_GNU_STACK), Flags: uint32(elf.PF_R | elf.PF_W | elf.PF_X)}, {Type: uint32(elf.PT_GNU_RELRO)}},
+				dynamic: []elf.Dyn64{{Tag: int64(elf.DT_BIND_NOW)}},
+			},
+			Hardening{RELRO: "full", PIE: true, Stripped: true},
+		},
+	} {
+		f, err := elf.NewFile(bytes.NewReader(tt.lib.build()))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := checkHardening(f); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", name, tt.want, *got)
+		}
+	}
+}
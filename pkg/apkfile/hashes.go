@@ -0,0 +1,62 @@
+package apkfile
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+// FileHashes are the digests of the scanned file
+type FileHashes struct {
+	MD5    string `json:"md5" structs:"md5"`
+	SHA1   string `json:"sha1" structs:"sha1"`
+	SHA256 string `json:"sha256" structs:"sha256"`
+}
+
+// MultiHash computes every digest in a single pass over what is written to it
+type MultiHash struct {
+	io.Writer
+	md5    hash.Hash
+	sha1   hash.Hash
+	sha256 hash.Hash
+}
+
+// NewMultiHash returns a MultiHash ready to be written to
+func NewMultiHash() *MultiHash {
+	h := &MultiHash{
+		md5:    md5.New(),
+		sha1:   sha1.New(),
+		sha256: sha256.New(),
+	}
+	h.Writer = io.MultiWriter(h.md5, h.sha1, h.sha256)
+	return h
+}
+
+// Sum returns the hex digests of everything written so far
+func (h *MultiHash) Sum() FileHashes {
+	return FileHashes{
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA1:   hex.EncodeToString(h.sha1.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+	}
+}
+
+// HashFile reads path once and returns all of its digests
+func HashFile(path string) (FileHashes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileHashes{}, err
+	}
+	defer f.Close()
+
+	h := NewMultiHash()
+	if _, err = io.Copy(h, f); err != nil {
+		return FileHashes{}, err
+	}
+
+	return h.Sum(), nil
+}
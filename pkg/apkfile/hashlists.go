@@ -0,0 +1,80 @@
+package apkfile
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// HashList maps lowercase SHA256 digests to a note on why they are listed,
+// e.g. the vendor of an allowlisted system app
+type HashList map[string]string
+
+// LoadHashList reads a SHA256 list, one digest per line optionally followed
+// by a note, with # starting a comment
+//
+//	# Pixel 8 system apps
+//	5f2b3c...  com.google.android.gms 24.08
+func LoadHashList(path string) (HashList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := make(HashList)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		digest := strings.ToLower(strings.TrimSpace(fields[0]))
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != 64 {
+			return nil, fmt.Errorf("parsing %s: line %d: %q is not a SHA256", path, n, fields[0])
+		}
+		list[digest] = ""
+		if len(fields) == 2 {
+			list[digest] = strings.TrimSpace(fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return list, nil
+}
+
+// WithHashAllowlist skips the analysis of samples on list, their report only
+// has their hashes and a known_good verdict
+func WithHashAllowlist(list HashList) Option {
+	return func(s *Scanner) {
+		s.allowlist = list
+	}
+}
+
+// WithHashDenylist makes the verdict of samples on list malicious, whatever
+// the analyzers find
+func WithHashDenylist(list HashList) Option {
+	return func(s *Scanner) {
+		s.denylist = list
+	}
+}
+
+// listed returns the reason a sample is on a hash list, and whether it is
+func listed(list HashList, what string, hashes *FileHashes) (string, bool) {
+	if hashes == nil {
+		return "", false
+	}
+	note, ok := list[hashes.SHA256]
+	if !ok {
+		return "", false
+	}
+	reason := "SHA256 is on the hash " + what
+	if note != "" {
+		reason += ", " + note
+	}
+	return reason, true
+}
@@ -0,0 +1,69 @@
+package apkfile
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestHashLists tests loading hash lists and short-circuiting scans with them.
+func TestHashLists(t *testing.T) {
+	hashes, err := HashFile("testdata/trid.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "hashes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# known samples\n\n" + hashes.SHA256 + "  TRiD output, vendor build\n" +
+		"5F2B3C8A9D0E1F2A3B4C5D6E7F8091A2B3C4D5E6F708192A3B4C5D6E7F809102\n")
+	f.Close()
+	list, err := LoadHashList(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[hashes.SHA256] != "TRiD output, vendor build" {
+		t.Errorf("unexpected list %q", list)
+	}
+	if _, ok := list["5f2b3c8a9d0e1f2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f809102"]; !ok {
+		t.Error("expected digests to be lowercased")
+	}
+
+	s := &Scanner{analyzers: []Analyzer{quickAnalyzer{}}, retry: DefaultRetryPolicy}
+	WithHashAllowlist(list)(s)
+	fileInfo, err := s.Scan(context.Background(), "testdata/trid.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo.Verdict == nil || fileInfo.Verdict.Verdict != VerdictKnownGood || fileInfo.Hashes != hashes {
+		t.Errorf("unexpected allowlisted report %#v", fileInfo)
+	}
+	if fileInfo.Analyzers != nil {
+		t.Errorf("expected no analysis of an allowlisted sample, got %#v", fileInfo.Analyzers)
+	}
+
+	s = &Scanner{analyzers: []Analyzer{quickAnalyzer{}}, retry: DefaultRetryPolicy}
+	WithHashDenylist(list)(s)
+	fileInfo, err = s.Scan(context.Background(), "testdata/trid.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo.Verdict == nil || fileInfo.Verdict.Verdict != VerdictMalicious ||
+		fileInfo.Verdict.Reasons[0] != "SHA256 is on the hash denylist, TRiD output, vendor build" {
+		t.Errorf("unexpected denylisted verdict %#v", fileInfo.Verdict)
+	}
+	if fileInfo.Analyzers["quick"] != "done" {
+		t.Errorf("expected a denylisted sample to be analyzed, got %#v", fileInfo.Analyzers)
+	}
+
+	f, _ = os.Create(f.Name())
+	f.WriteString("not-a-hash\n")
+	f.Close()
+	if _, err := LoadHashList(f.Name()); err == nil {
+		t.Error("expected an error for a malformed list")
+	}
+}
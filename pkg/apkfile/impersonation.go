@@ -0,0 +1,115 @@
+package apkfile
+
+import (
+	"context"
+	"strings"
+)
+
+// Impersonation is what the manifest claims about who the app is
+type Impersonation struct {
+	Package      string `json:"package" structs:"package"`
+	SharedUserID string `json:"shared_user_id,omitempty" structs:"shared_user_id,omitempty"`
+	// Findings are the claims typical of privilege-seeking malware
+	Findings []ImpersonationFinding `json:"findings,omitempty" structs:"findings,omitempty"`
+}
+
+// ImpersonationFinding is one flagged claim
+type ImpersonationFinding struct {
+	Rule        string `json:"rule" structs:"rule"`
+	Description string `json:"description" structs:"description"`
+}
+
+// systemUIDs are the shared user IDs of the platform's privileged processes,
+// only apps signed with the platform key get them
+var systemUIDs = []string{
+	"android.uid.system", "android.uid.phone", "android.uid.shell", "android.uid.log",
+	"android.uid.nfc", "android.uid.bluetooth", "android.uid.networkstack", "android.uid.se",
+	"android.media",
+}
+
+// systemPrefixes are the package namespaces of platform and vendor components
+var systemPrefixes = []string{"android.", "com.android.", "com.google.android.", "com.samsung.android.", "com.sec.android."}
+
+// systemPackages are well known system apps malware names itself after
+var systemPackages = []string{
+	"com.android.systemui", "com.android.settings", "com.android.vending", "com.android.phone",
+	"com.android.chrome", "com.android.providers.telephony", "com.android.mms",
+	"com.google.android.gms", "com.google.android.gsf", "com.google.android.apps.messaging",
+	"com.android.packageinstaller", "com.google.android.packageinstaller",
+}
+
+// homoglyphs are substitutions that make a package name read like another
+var homoglyphs = strings.NewReplacer("0", "o", "1", "l", "I", "l", "rn", "m", "vv", "w")
+
+type impersonationAnalyzer struct{}
+
+func (impersonationAnalyzer) Name() string    { return "impersonation" }
+func (impersonationAnalyzer) Available() bool { return true }
+
+func (impersonationAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	imp := &Impersonation{Package: root.Attr("package"), SharedUserID: root.Attr("sharedUserId")}
+	add := func(rule, description string) {
+		imp.Findings = append(imp.Findings, ImpersonationFinding{rule, description})
+	}
+
+	if containsString(systemUIDs, imp.SharedUserID) {
+		add("system_uid", "asks to run as "+imp.SharedUserID+", which needs the platform signing key")
+	}
+	pkg := imp.Package
+	if hasAnyPrefix(pkg, systemPrefixes) {
+		add("system_package", "uses a package name reserved for system components")
+	} else if hasAnyPrefix(strings.ToLower(homoglyphs.Replace(pkg)), systemPrefixes) {
+		add("lookalike_package", "uses a package name that reads like a system component's")
+	}
+	for _, sys := range systemPackages {
+		if pkg != sys && editDistance(pkg, sys) <= 2 {
+			add("lookalike_package", "uses a package name close to "+sys)
+			break
+		}
+	}
+	return imp, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
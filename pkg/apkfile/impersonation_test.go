@@ -0,0 +1,56 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestImpersonationAnalyzer tests the system UID and lookalike package rules.
+func TestImpersonationAnalyzer(t *testing.T) {
+	for _, tt := range []struct {
+		pkg, sharedUserID string
+		rules             []string
+	}{
+		{"com.example.app", "", nil},
+		{"com.example.app", "com.example.shared", nil},
+		{"com.example.app", "android.uid.system", []string{"system_uid"}},
+		{"com.android.systemui", "android.uid.phone", []string{"system_uid", "system_package"}},
+		{"com.andr0id.update", "", []string{"lookalike_package"}},
+		{"com.google.android.gms.update", "", []string{"system_package"}},
+		{"com.goog1e.android.gms", "", []string{"lookalike_package", "lookalike_package"}},
+	} {
+		manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="` + tt.pkg + `"`
+		if tt.sharedUserID != "" {
+			manifest += ` android:sharedUserId="` + tt.sharedUserID + `"`
+		}
+		manifest += `><application/></manifest>`
+		path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+
+		target := &Target{Path: path}
+		section, err := impersonationAnalyzer{}.Run(context.Background(), target)
+		target.close()
+		os.Remove(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imp := section.(*Impersonation)
+		if imp.Package != tt.pkg || imp.SharedUserID != tt.sharedUserID {
+			t.Errorf("%s: unexpected identity %#v", tt.pkg, imp)
+		}
+		var rules []string
+		for _, f := range imp.Findings {
+			rules = append(rules, f.Rule)
+		}
+		if len(rules) != len(tt.rules) {
+			t.Errorf("%s: expected %v, got %v", tt.pkg, tt.rules, rules)
+			continue
+		}
+		for i := range rules {
+			if rules[i] != tt.rules[i] {
+				t.Errorf("%s: expected %v, got %v", tt.pkg, tt.rules, rules)
+			}
+		}
+	}
+}
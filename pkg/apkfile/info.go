@@ -0,0 +1,234 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ScannerInfo is what a scanner runs, so results from different instances
+// can be told apart
+type ScannerInfo struct {
+	// APKBackend produces the apk_file section, apkfile or androguard
+	APKBackend string `json:"apk_backend"`
+	// Analyzers are the analyzers whose tools are available
+	Analyzers []string            `json:"analyzers"`
+	Tools     map[string]ToolInfo `json:"tools"`
+	Rules     map[string]RuleSet  `json:"rules"`
+}
+
+// ToolInfo is the version of an external tool
+type ToolInfo struct {
+	Path    string `json:"path"`
+	Version string `json:"version,omitempty"`
+	// Error is why the version couldn't be detected, e.g. the tool isn't installed
+	Error string `json:"error,omitempty"`
+}
+
+// RuleSet identifies the rules or signatures a scanner loaded
+type RuleSet struct {
+	// Source is the file the rules were loaded from, when the scanner knows it
+	Source  string `json:"source,omitempty"`
+	Entries int    `json:"entries,omitempty"`
+	// SHA256 is a digest of the rules, equal on instances with the same ones
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// toolVersions are the commands printing the version of the external tools,
+// and where the version is in their output
+var toolVersions = []struct {
+	name string
+	args []string
+	re   *regexp.Regexp
+}{
+	// trid prints its banner, with the version, when run without a file
+	{"trid", nil, regexp.MustCompile(`TrID.*? v(\d+(?:\.\d+)+)`)},
+	{"exiftool", []string{"-ver"}, regexp.MustCompile(`(\d+(?:\.\d+)+)`)},
+	{"java", []string{"-version"}, regexp.MustCompile(`version "([^"]+)"`)},
+	{"python3", []string{"--version"}, regexp.MustCompile(`Python (\S+)`)},
+	{"aapt2", []string{"version"}, regexp.MustCompile(`\(aapt\) (\S+)`)},
+	{"apksigner", []string{"--version"}, regexp.MustCompile(`(\d+(?:\.\d+)+)`)},
+}
+
+// Info detects the versions of the scanner's external tools and identifies
+// the rules it loaded
+func (s *Scanner) Info(ctx context.Context) ScannerInfo {
+	info := ScannerInfo{
+		APKBackend: s.apkBackend,
+		Analyzers:  s.Analyzers(),
+		Tools:      make(map[string]ToolInfo),
+		Rules:      make(map[string]RuleSet),
+	}
+
+	for _, t := range toolVersions {
+		tool := ToolInfo{Path: s.toolPath(t.name)}
+		out, err := s.toolOutput(ctx, t.name, t.args...)
+		if m := t.re.FindStringSubmatch(out); m != nil {
+			tool.Version = m[1]
+		} else if err != nil {
+			tool.Error = err.Error()
+		} else {
+			tool.Error = "no version in its output"
+		}
+		info.Tools[t.name] = tool
+	}
+	info.Tools["apkfile.jar"] = jarInfo(s.apkfileJar)
+	if s.magic.builtin() {
+		// only listed when missing, the info of existing deployments is unchanged
+		info.Tools["libmagic"] = ToolInfo{Error: "not available, file types are sniffed without it"}
+	}
+
+	if path, err := exec.LookPath(s.toolPath("trid")); err == nil {
+		// trid loads its definitions from next to its binary
+		defs := filepath.Join(filepath.Dir(path), "triddefs.trd")
+		if h, err := HashFile(defs); err == nil {
+			info.Rules["triddefs"] = RuleSet{Source: defs, SHA256: h.SHA256}
+		}
+	}
+	for name, rules := range map[string]interface{}{
+		"secret_rules":     s.secretRules,
+		"signer_blocklist": s.signerBlocklist,
+		"malware_feed":     s.malwareFeed,
+		"hash_allowlist":   s.allowlist,
+		"hash_denylist":    s.denylist,
+		"policy":           s.policy,
+	} {
+		if set, ok := ruleSet(rules); ok {
+			info.Rules[name] = set
+		}
+	}
+	if s.quark.Rules != "" {
+		info.Rules["quark"] = RuleSet{Source: s.quark.Rules}
+	}
+	for _, a := range s.analyzers {
+		if p, ok := a.(pluginAnalyzer); ok && p.cfg.Rules != "" {
+			info.Rules["plugin:"+p.cfg.Name] = pathRuleSet(p.cfg.Rules)
+		}
+	}
+	return info
+}
+
+// pathRuleSet counts and digests the files of a rules file or directory,
+// their names and contents
+func pathRuleSet(root string) RuleSet {
+	set := RuleSet{Source: root}
+	h := sha256.New()
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		rel, _ := filepath.Rel(root, path)
+		h.Write([]byte(rel + "\x00"))
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		set.Entries++
+		return nil
+	})
+	if err == nil {
+		set.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	return set
+}
+
+// Analyzers are the names of the analyzers whose tools are available
+func (s *Scanner) Analyzers() []string {
+	names := []string{}
+	for _, a := range s.analyzers {
+		if a.Available() {
+			names = append(names, a.Name())
+		}
+	}
+	return names
+}
+
+// toolOutput runs an external tool without a sample and returns what it
+// printed on stdout and stderr, java prints its version on the latter
+func (s *Scanner) toolOutput(ctx context.Context, name string, args ...string) (string, error) {
+	// the docker sandbox needs something to mount
+	name, args, err := s.backend.Wrap(s.limits, s.toolPath(name), args, os.DevNull)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	s.killOnCancel(cmd)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// ruleSet counts and digests rules loaded into the scanner, it reports false
+// for the ones that aren't
+func ruleSet(rules interface{}) (RuleSet, bool) {
+	var n int
+	switch r := rules.(type) {
+	case []SecretRule:
+		n = len(r)
+	case []BlocklistEntry:
+		n = len(r)
+	case []MalwarePackage:
+		n = len(r)
+	case HashList:
+		n = len(r)
+	case *Policy:
+		if r != nil {
+			n = len(r.Rules)
+		}
+	}
+	if n == 0 {
+		return RuleSet{}, false
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return RuleSet{Entries: n}, true
+	}
+	sum := sha256.Sum256(data)
+	return RuleSet{Entries: n, SHA256: hex.EncodeToString(sum[:])}, true
+}
+
+// jarInfo reads the version apkfile.jar's manifest declares
+func jarInfo(path string) ToolInfo {
+	tool := ToolInfo{Path: path}
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		tool.Error = err.Error()
+		return tool
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name != "META-INF/MANIFEST.MF" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			tool.Error = err.Error()
+			return tool
+		}
+		defer rc.Close()
+		scanner := bufio.NewScanner(rc)
+		for scanner.Scan() {
+			if v := strings.TrimPrefix(scanner.Text(), "Implementation-Version:"); v != scanner.Text() {
+				tool.Version = strings.TrimSpace(v)
+				return tool
+			}
+		}
+	}
+	// builds without a version are still told apart by their digest
+	if h, err := HashFile(path); err == nil {
+		tool.Version = "sha256:" + h.SHA256
+	}
+	return tool
+}
@@ -0,0 +1,66 @@
+package apkfile
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestScannerInfo tests detecting tool versions and identifying loaded rules.
+func TestScannerInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rules := filepath.Join(dir, "rules")
+	if err := os.Mkdir(rules, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rules, "banker.yar"), []byte("rule banker { condition: true }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	apksigner := filepath.Join(dir, "apksigner")
+	if err := ioutil.WriteFile(apksigner, []byte("#!/bin/sh\necho 0.9\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	jar := writeZip(t, map[string]string{"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\r\nImplementation-Version: 1.3.0\r\n"})
+	defer os.Remove(jar)
+
+	s, err := NewScanner(
+		WithToolPath("apksigner", apksigner),
+		WithToolPath("exiftool", filepath.Join(dir, "missing")),
+		WithApkfileJar(jar),
+		WithHashAllowlist(HashList{"ab": "known good"}),
+		WithPlugin(PluginConfig{Name: "yara", Command: "yara-plugin", Rules: rules}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	info := s.Info(context.Background())
+
+	if tool := info.Tools["apksigner"]; tool.Version != "0.9" || tool.Path != apksigner {
+		t.Errorf("unexpected apksigner %#v", tool)
+	}
+	if tool := info.Tools["exiftool"]; tool.Version != "" || tool.Error == "" {
+		t.Errorf("expected an error for a missing tool, got %#v", tool)
+	}
+	if tool := info.Tools["apkfile.jar"]; tool.Version != "1.3.0" {
+		t.Errorf("unexpected apkfile.jar %#v", tool)
+	}
+	if rules, ok := info.Rules["hash_allowlist"]; !ok || rules.Entries != 1 || len(rules.SHA256) != 64 {
+		t.Errorf("unexpected allowlist %#v", rules)
+	}
+	if set := info.Rules["plugin:yara"]; set.Entries != 1 || len(set.SHA256) != 64 {
+		t.Errorf("unexpected plugin rules %#v", set)
+	}
+	if _, ok := info.Rules["hash_denylist"]; ok {
+		t.Error("expected no denylist when none is loaded")
+	}
+	if !containsString(info.Analyzers, "hashes") {
+		t.Errorf("expected the hashes analyzer, got %v", info.Analyzers)
+	}
+}
@@ -0,0 +1,176 @@
+package apkfile
+
+import (
+	"context"
+	"sort"
+	"strconv"
+)
+
+// IntentFilters maps the app's components to the intents they listen for
+type IntentFilters struct {
+	Components []ComponentIntents `json:"components" structs:"components"`
+	Indicators []IntentIndicator  `json:"indicators,omitempty" structs:"indicators,omitempty"`
+}
+
+// ComponentIntents are the actions and categories a component's intent
+// filters match
+type ComponentIntents struct {
+	Component  string   `json:"component" structs:"component"`
+	Kind       string   `json:"kind" structs:"kind"`
+	Exported   bool     `json:"exported" structs:"exported"`
+	Actions    []string `json:"actions,omitempty" structs:"actions,omitempty"`
+	Categories []string `json:"categories,omitempty" structs:"categories,omitempty"`
+	// Priority is the highest priority of the component's filters
+	Priority int `json:"priority,omitempty" structs:"priority,omitempty"`
+}
+
+// IntentIndicator is a combination of intents characteristic of malware
+type IntentIndicator struct {
+	Name        string   `json:"name" structs:"name"`
+	Description string   `json:"description" structs:"description"`
+	Components  []string `json:"components" structs:"components"`
+}
+
+var (
+	bootActions = []string{
+		"android.intent.action.BOOT_COMPLETED",
+		"android.intent.action.LOCKED_BOOT_COMPLETED",
+		"android.intent.action.QUICKBOOT_POWERON",
+		"com.htc.intent.action.QUICKBOOT_POWERON",
+		"android.intent.action.REBOOT",
+	}
+	// restartActions fire often enough to keep restarting a killed app
+	restartActions = []string{
+		"android.intent.action.USER_PRESENT",
+		"android.intent.action.SCREEN_ON",
+		"android.net.conn.CONNECTIVITY_CHANGE",
+		"android.intent.action.ACTION_POWER_CONNECTED",
+		"android.intent.action.MY_PACKAGE_REPLACED",
+		"android.intent.action.TIME_TICK",
+	}
+	smsActions = []string{
+		"android.provider.Telephony.SMS_RECEIVED",
+		"android.provider.Telephony.SMS_DELIVER",
+		"android.provider.Telephony.WAP_PUSH_RECEIVED",
+		"android.provider.Telephony.WAP_PUSH_DELIVER",
+	}
+	callActions = []string{
+		"android.intent.action.NEW_OUTGOING_CALL",
+		"android.intent.action.PHONE_STATE",
+	}
+	packageActions = []string{
+		"android.intent.action.PACKAGE_ADDED",
+		"android.intent.action.PACKAGE_REPLACED",
+		"android.intent.action.PACKAGE_REMOVED",
+	}
+)
+
+type intentsAnalyzer struct{}
+
+func (intentsAnalyzer) Name() string    { return "intent_filters" }
+func (intentsAnalyzer) Available() bool { return true }
+
+func (intentsAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	filters := &IntentFilters{Components: []ComponentIntents{}}
+	for _, c := range components(root) {
+		ci := ComponentIntents{Component: c.Name, Kind: c.Kind, Exported: c.exported()}
+		for _, f := range c.Element.All("intent-filter") {
+			for _, a := range f.All("action") {
+				ci.Actions = appendUnique(ci.Actions, a.Attr("name"))
+			}
+			for _, cat := range f.All("category") {
+				ci.Categories = appendUnique(ci.Categories, cat.Attr("name"))
+			}
+			if p, err := strconv.Atoi(f.Attr("priority")); err == nil && p > ci.Priority {
+				ci.Priority = p
+			}
+		}
+		if len(ci.Actions) > 0 {
+			filters.Components = append(filters.Components, ci)
+		}
+	}
+	filters.Indicators = intentIndicators(filters.Components)
+	return filters, nil
+}
+
+// intentIndicators flags the receivers used for persistence and SMS or call
+// interception, and the combinations of them typical of SMS stealers
+func intentIndicators(components []ComponentIntents) []IntentIndicator {
+	var indicators []IntentIndicator
+	add := func(name, description string, found []string) {
+		if len(found) > 0 {
+			indicators = append(indicators, IntentIndicator{name, description, found})
+		}
+	}
+
+	boot := receiving(components, bootActions, 0)
+	restart := receiving(components, restartActions, 0)
+	sms := receiving(components, smsActions, 0)
+
+	add("boot_persistence", "starts when the device boots", boot)
+	if len(boot) > 0 {
+		add("restart_persistence", "restarts on frequent system events besides boot", restart)
+	}
+	add("sms_interception", "receives incoming SMS", sms)
+	add("sms_priority", "receives SMS with a raised priority to see, and possibly abort, them before the SMS app",
+		receiving(components, smsActions, 1))
+	add("call_monitoring", "watches incoming and outgoing calls", receiving(components, callActions, 0))
+	add("package_monitoring", "watches apps being installed and removed", receiving(components, packageActions, 0))
+	add("device_admin", "asks for device administrator rights, which blocks uninstalling it",
+		receiving(components, []string{"android.app.action.DEVICE_ADMIN_ENABLED"}, 0))
+	if len(boot) > 0 && len(sms) > 0 {
+		add("sms_stealer", "combines boot persistence with SMS interception", union(boot, sms))
+	}
+	return indicators
+}
+
+// receiving returns the receivers listening for any of actions with a filter
+// priority of at least minPriority
+func receiving(components []ComponentIntents, actions []string, minPriority int) []string {
+	var found []string
+	for _, c := range components {
+		if c.Kind != "receiver" || c.Priority < minPriority {
+			continue
+		}
+		for _, a := range c.Actions {
+			if containsString(actions, a) {
+				found = append(found, c.Component)
+				break
+			}
+		}
+	}
+	return found
+}
+
+func appendUnique(list []string, s string) []string {
+	if s == "" || containsString(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func union(a, b []string) []string {
+	u := append([]string(nil), a...)
+	for _, s := range b {
+		u = appendUnique(u, s)
+	}
+	sort.Strings(u)
+	return u
+}
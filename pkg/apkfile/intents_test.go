@@ -0,0 +1,70 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestIntentsAnalyzer tests the component map and the persistence and SMS indicators.
+func TestIntentsAnalyzer(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <application>
+    <activity android:name=".MainActivity">
+      <intent-filter>
+        <action android:name="android.intent.action.MAIN"/>
+        <category android:name="android.intent.category.LAUNCHER"/>
+      </intent-filter>
+    </activity>
+    <receiver android:name=".Boot">
+      <intent-filter>
+        <action android:name="android.intent.action.BOOT_COMPLETED"/>
+        <action android:name="android.intent.action.USER_PRESENT"/>
+      </intent-filter>
+    </receiver>
+    <receiver android:name="com.example.app.Sms" android:exported="false">
+      <intent-filter android:priority="999">
+        <action android:name="android.provider.Telephony.SMS_RECEIVED"/>
+      </intent-filter>
+    </receiver>
+    <service android:name=".Idle"/>
+  </application>
+</manifest>`
+	path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := intentsAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := section.(*IntentFilters)
+
+	if len(filters.Components) != 3 {
+		t.Fatalf("expected 3 components with filters, got %#v", filters.Components)
+	}
+	sms := filters.Components[2]
+	if sms.Component != "com.example.app.Sms" || sms.Kind != "receiver" || sms.Exported || sms.Priority != 999 {
+		t.Errorf("unexpected SMS receiver %#v", sms)
+	}
+	if !filters.Components[1].Exported {
+		t.Errorf("receivers with intent filters are exported by default")
+	}
+
+	found := make(map[string][]string)
+	for _, i := range filters.Indicators {
+		found[i.Name] = i.Components
+	}
+	for _, name := range []string{"boot_persistence", "restart_persistence", "sms_interception", "sms_priority", "sms_stealer"} {
+		if _, ok := found[name]; !ok {
+			t.Errorf("expected a %s indicator, got %#v", name, filters.Indicators)
+		}
+	}
+	if len(found["sms_stealer"]) != 2 {
+		t.Errorf("expected both receivers in sms_stealer, got %v", found["sms_stealer"])
+	}
+	if _, ok := found["call_monitoring"]; ok {
+		t.Errorf("unexpected call_monitoring indicator")
+	}
+}
@@ -0,0 +1,40 @@
+//go:build cgo && !nolibmagic
+// +build cgo,!nolibmagic
+
+package apkfile
+
+import "github.com/rakyll/magicmime"
+
+// libmagic holds the libmagic handles of a magicDB
+type libmagic struct {
+	mime *magicmime.Decoder
+	desc *magicmime.Decoder
+}
+
+// openLibmagic loads the libmagic database
+func openLibmagic() (*libmagic, error) {
+	mime, err := magicmime.NewDecoder(magicmime.MAGIC_MIME_TYPE | magicmime.MAGIC_SYMLINK | magicmime.MAGIC_ERROR)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := magicmime.NewDecoder(magicmime.MAGIC_SYMLINK | magicmime.MAGIC_ERROR)
+	if err != nil {
+		mime.Close()
+		return nil, err
+	}
+	return &libmagic{mime: mime, desc: desc}, nil
+}
+
+// typeByFile returns either the mime-type or the textual description of a file path
+func (l *libmagic) typeByFile(path string, describe bool) (string, error) {
+	if describe {
+		return l.desc.TypeByFile(path)
+	}
+	return l.mime.TypeByFile(path)
+}
+
+// close releases the libmagic handles
+func (l *libmagic) close() {
+	l.mime.Close()
+	l.desc.Close()
+}
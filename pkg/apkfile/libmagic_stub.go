@@ -0,0 +1,20 @@
+//go:build !cgo || nolibmagic
+// +build !cgo nolibmagic
+
+package apkfile
+
+import "errors"
+
+// libmagic is missing from builds without cgo, e.g. cross-compiled for
+// Windows or macOS, and from builds with the nolibmagic tag
+type libmagic struct{}
+
+func openLibmagic() (*libmagic, error) {
+	return nil, errors.New("built without libmagic")
+}
+
+func (*libmagic) typeByFile(path string, describe bool) (string, error) {
+	return "", errors.New("built without libmagic")
+}
+
+func (*libmagic) close() {}
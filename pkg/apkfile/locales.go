@@ -0,0 +1,186 @@
+package apkfile
+
+import (
+	"context"
+	"sort"
+	"unicode"
+)
+
+// Locales profiles the market an app targets, which helps attribute
+// campaigns to the regions they target
+type Locales struct {
+	// Locales are the locales the resources are translated to, e.g. ru or
+	// zh-CN
+	Locales []string `json:"locales,omitempty" structs:"locales,omitempty"`
+	// Label is the app's label in the default configuration
+	Label string `json:"label,omitempty" structs:"label,omitempty"`
+	// Script is the writing system of the label, or of the default strings
+	// when the label is Latin, e.g. Cyrillic or Han
+	Script string `json:"script,omitempty" structs:"script,omitempty"`
+	// Language is what the default strings are most likely written in,
+	// guessed from Script and empty for Latin
+	Language     string        `json:"language,omitempty" structs:"language,omitempty"`
+	RegionalSDKs []RegionalSDK `json:"regional_sdks,omitempty" structs:"regional_sdks,omitempty"`
+	// Regions are the regions the regional SDKs serve
+	Regions []string `json:"regions,omitempty" structs:"regions,omitempty"`
+}
+
+// RegionalSDK is an SDK only used in the apps of one market
+type RegionalSDK struct {
+	Name string `json:"name" structs:"name"`
+	// Kind is payment, push, analytics, ads, login or store
+	Kind    string `json:"kind" structs:"kind"`
+	Region  string `json:"region" structs:"region"`
+	Package string `json:"package" structs:"package"`
+}
+
+// regionalSDKs are matched by the package of the classes they bundle
+var regionalSDKs = []RegionalSDK{
+	{"Alipay", "payment", "CN", "com.alipay"},
+	{"WeChat", "login", "CN", "com.tencent.mm.opensdk"},
+	{"UnionPay", "payment", "CN", "com.unionpay"},
+	{"Tencent Push", "push", "CN", "com.tencent.android.tpush"},
+	{"Getui", "push", "CN", "com.igexin"},
+	{"JPush", "push", "CN", "cn.jpush"},
+	{"Xiaomi Push", "push", "CN", "com.xiaomi.mipush"},
+	{"OPPO Push", "push", "CN", "com.heytap.msp"},
+	{"vivo Push", "push", "CN", "com.vivo.push"},
+	{"Meizu Push", "push", "CN", "com.meizu.cloud.pushsdk"},
+	{"Umeng", "analytics", "CN", "com.umeng"},
+	{"Pangle", "ads", "CN", "com.bytedance.sdk.openadsdk"},
+	{"YooMoney", "payment", "RU", "ru.yoomoney"},
+	{"Yandex.Money", "payment", "RU", "com.yandex.money"},
+	{"Tinkoff Acquiring", "payment", "RU", "ru.tinkoff.acquiring"},
+	{"CloudPayments", "payment", "RU", "ru.cloudpayments"},
+	{"AppMetrica", "analytics", "RU", "com.yandex.metrica"},
+	{"Yandex Mobile Ads", "ads", "RU", "com.yandex.mobile.ads"},
+	{"VK", "login", "RU", "com.vk.api.sdk"},
+	{"RuStore", "store", "RU", "ru.rustore.sdk"},
+	{"Paytm", "payment", "IN", "com.paytm"},
+	{"Razorpay", "payment", "IN", "com.razorpay"},
+	{"PhonePe", "payment", "IN", "com.phonepe"},
+	{"Kakao", "login", "KR", "com.kakao.sdk"},
+	{"Naver Login", "login", "KR", "com.navercorp.nid"},
+	{"Cafe Bazaar", "store", "IR", "com.farsitel.bazaar"},
+	{"Tapsell", "ads", "IR", "ir.tapsell"},
+	{"Mercado Pago", "payment", "LATAM", "com.mercadopago"},
+}
+
+// scriptLanguages are the scripts the default strings are checked for, and
+// the language each one most likely means
+var scriptLanguages = []struct {
+	script   string
+	table    *unicode.RangeTable
+	language string
+}{
+	// kana first, Japanese is written with Han characters as well
+	{"Hiragana", unicode.Hiragana, "ja"},
+	{"Katakana", unicode.Katakana, "ja"},
+	{"Han", unicode.Han, "zh"},
+	{"Hangul", unicode.Hangul, "ko"},
+	{"Cyrillic", unicode.Cyrillic, "ru"},
+	{"Arabic", unicode.Arabic, "ar"},
+	{"Hebrew", unicode.Hebrew, "he"},
+	{"Greek", unicode.Greek, "el"},
+	{"Thai", unicode.Thai, "th"},
+	{"Devanagari", unicode.Devanagari, "hi"},
+	{"Latin", unicode.Latin, ""},
+}
+
+// minScriptShare is the share of the default strings' letters a script
+// other than Latin needs, libraries bring English strings with them
+const minScriptShare = 0.2
+
+type localesAnalyzer struct{}
+
+func (localesAnalyzer) Name() string    { return "locales" }
+func (localesAnalyzer) Available() bool { return true }
+
+func (localesAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	res, err := target.resources()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dexes, err := target.dexFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Locales{Locales: res.locales}
+	sort.Strings(l.Locales)
+	if root, err := target.manifest(); err == nil {
+		for _, app := range root.All("application") {
+			l.Label = res.label(app.Attr("label"))
+		}
+	}
+
+	// the label's script wins, then a script other than Latin with enough
+	// of the default strings' letters
+	var all []rune
+	for _, values := range res.strings {
+		all = append(all, []rune(values[""])...)
+	}
+	label := dominantScript([]rune(l.Label), 0)
+	if label >= 0 && scriptLanguages[label].script != "Latin" {
+		l.Script, l.Language = scriptLanguages[label].script, scriptLanguages[label].language
+	} else if s := dominantScript(all, minScriptShare); s >= 0 {
+		l.Script, l.Language = scriptLanguages[s].script, scriptLanguages[s].language
+	}
+
+	var prefixes []string
+	for _, sdk := range regionalSDKs {
+		prefixes = append(prefixes, sdk.Package)
+	}
+	found := embeddedPackages(dexes, prefixes)
+	for _, sdk := range regionalSDKs {
+		if found[sdk.Package] {
+			l.RegionalSDKs = append(l.RegionalSDKs, sdk)
+			l.Regions = appendUnique(l.Regions, sdk.Region)
+		}
+	}
+	sort.Strings(l.Regions)
+
+	if len(l.Locales) == 0 && l.Label == "" && l.Script == "" && len(l.RegionalSDKs) == 0 {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// dominantScript returns the index in scriptLanguages of the first script
+// other than Latin with at least share of the letters in runes, else of the
+// script with the most letters, -1 when there are none
+func dominantScript(runes []rune, share float64) int {
+	counts := make([]int, len(scriptLanguages))
+	letters := 0
+	for _, r := range runes {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for i, s := range scriptLanguages {
+			if unicode.Is(s.table, r) {
+				counts[i]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return -1
+	}
+	best := -1
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		if share > 0 && scriptLanguages[i].script != "Latin" && float64(n) >= share*float64(letters) {
+			return i
+		}
+		if best < 0 || n > counts[best] {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,67 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestLocalesAnalyzer tests profiling the locales, default language and
+// regional SDKs of an app.
+func TestLocalesAnalyzer(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <application android:label="@0x7f010000"/>
+</manifest>`
+	b := newDexBuilder()
+	b.class("Lcom/alipay/sdk/app/PayTask;", "Ljava/lang/Object;")
+	b.class("Lcn/jpush/android/api/JPushInterface;", "Ljava/lang/Object;")
+	b.class("Lcom/example/app/Main;", "Landroid/app/Activity;")
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml": string(encodeAXML(t, manifest)),
+		"classes.dex":         string(b.build()),
+		"resources.arsc": string(encodeARSC(map[string][]string{
+			"":   {"手电筒", "Navigate up", "More options"},
+			"en": {"Flashlight", "Navigate up", "More options"},
+		})),
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := localesAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Locales{
+		Locales:  []string{"en"},
+		Label:    "手电筒",
+		Script:   "Han",
+		Language: "zh",
+		RegionalSDKs: []RegionalSDK{
+			{"Alipay", "payment", "CN", "com.alipay"},
+			{"JPush", "push", "CN", "cn.jpush"},
+		},
+		Regions: []string{"CN"},
+	}
+	if !reflect.DeepEqual(section, want) {
+		t.Errorf("expected %+v, got %+v", want, section)
+	}
+}
+
+// TestDominantScript tests that libraries' English strings don't hide the
+// script of the app's own.
+func TestDominantScript(t *testing.T) {
+	for text, want := range map[string]string{
+		"Navigate up More options":                            "Latin",
+		"Navigate up More options Фонарик Включить":           "Cyrillic",
+		"Navigate up More options Search Clear query Фонарик": "Latin",
+		"写真を撮る": "Hiragana",
+	} {
+		i := dominantScript([]rune(text), minScriptShare)
+		if i < 0 || scriptLanguages[i].script != want {
+			t.Errorf("expected %s for %q, got %d", want, text, i)
+		}
+	}
+}
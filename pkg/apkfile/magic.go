@@ -0,0 +1,127 @@
+package apkfile
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// magicDB holds the libmagic handles shared by every scan a Scanner runs.
+// Without libmagic file types are told by sniffType instead
+type magicDB struct {
+	// libmagic handles are not safe to use from multiple goroutines at once
+	sync.Mutex
+	lib    *libmagic
+	opened bool
+}
+
+// open loads the libmagic database, falling back to sniffType when libmagic
+// or its database is missing
+func (m *magicDB) open() {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.opened {
+		return
+	}
+	lib, err := openLibmagic()
+	if err != nil {
+		log.WithError(err).Warn("libmagic is not available, using the built-in file type detection")
+		lib = nil
+	}
+	m.lib = lib
+	m.opened = true
+}
+
+// close releases the libmagic handles
+func (m *magicDB) close() {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.lib != nil {
+		m.lib.close()
+		m.lib = nil
+	}
+	m.opened = false
+}
+
+// builtin reports whether file types are told without libmagic
+func (m *magicDB) builtin() bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.opened && m.lib == nil
+}
+
+// typeByFile returns either the mime-type or the textual description of a file path
+func (m *magicDB) typeByFile(path string, describe bool) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.opened {
+		return "", fmt.Errorf("libmagic database is closed")
+	}
+	if m.lib == nil {
+		return sniffType(path, describe)
+	}
+	return m.lib.typeByFile(path, describe)
+}
+
+// getFileMimeType returns the mime-type of a file path
+func (s *Scanner) getFileMimeType(ctx context.Context, path string) (string, error) {
+
+	c := make(chan struct {
+		mimetype string
+		err      error
+	}, 1)
+
+	go func() {
+		mt, err := s.magic.typeByFile(path, false)
+		pack := struct {
+			mimetype string
+			err      error
+		}{mt, err}
+		c <- pack
+	}()
+
+	select {
+	case <-ctx.Done():
+		// libmagic can't be interrupted, c is buffered so the lookup is abandoned
+		return "", ctx.Err()
+	case ok := <-c:
+		if ok.err != nil {
+			return "", ok.err
+		}
+		return ok.mimetype, nil
+	}
+}
+
+// getFileDescription returns the textual libmagic type of a file path
+func (s *Scanner) getFileDescription(ctx context.Context, path string) (string, error) {
+
+	c := make(chan struct {
+		magicdesc string
+		err       error
+	}, 1)
+
+	go func() {
+		magicdesc, err := s.magic.typeByFile(path, true)
+		pack := struct {
+			magicdesc string
+			err       error
+		}{magicdesc, err}
+		c <- pack
+	}()
+
+	select {
+	case <-ctx.Done():
+		// libmagic can't be interrupted, c is buffered so the lookup is abandoned
+		return "", ctx.Err()
+	case ok := <-c:
+		if ok.err != nil {
+			return "", ok.err
+		}
+		return ok.magicdesc, nil
+	}
+}
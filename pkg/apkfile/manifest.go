@@ -0,0 +1,66 @@
+package apkfile
+
+import "strings"
+
+// componentKinds are the manifest elements that declare app components
+var componentKinds = []string{"activity", "activity-alias", "service", "receiver", "provider"}
+
+// manifestComponent is an app component declared in the manifest
+type manifestComponent struct {
+	// Kind is the element name, e.g. receiver
+	Kind string
+	// Name is the fully qualified class name
+	Name    string
+	Element *xmlElement
+}
+
+// components returns every component declared under <application>
+func components(root *xmlElement) []manifestComponent {
+	pkg := root.Attr("package")
+	var found []manifestComponent
+	for _, app := range root.All("application") {
+		for _, c := range app.Children {
+			for _, kind := range componentKinds {
+				if c.Name == kind {
+					found = append(found, manifestComponent{kind, componentName(pkg, c.Attr("name")), c})
+				}
+			}
+		}
+	}
+	return found
+}
+
+// componentName resolves a component name relative to the manifest package
+// the way PackageManager does
+func componentName(pkg, name string) string {
+	switch {
+	case strings.HasPrefix(name, "."):
+		return pkg + name
+	case !strings.Contains(name, "."):
+		return pkg + "." + name
+	}
+	return name
+}
+
+// exported reports whether a component can be started by other apps, which
+// before Android 12 was the default for components with intent filters
+func (c manifestComponent) exported() bool {
+	switch c.Element.Attr("exported") {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return len(c.Element.All("intent-filter")) > 0
+}
+
+// usesPermissions returns the permissions the app requests
+func usesPermissions(root *xmlElement) []string {
+	var found []string
+	for _, kind := range []string{"uses-permission", "uses-permission-sdk-23"} {
+		for _, p := range root.All(kind) {
+			found = appendUnique(found, p.Attr("name"))
+		}
+	}
+	return found
+}
@@ -0,0 +1,245 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"debug/elf"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NativeLibs describes the native code shipped in an APK
+type NativeLibs struct {
+	Libraries []NativeLib `json:"libraries" structs:"libraries"`
+	// NativeMethods are the methods the dex files declare native, e.g.
+	// Lcom/foo/Bar;->decrypt
+	NativeMethods []string `json:"native_methods,omitempty" structs:"native_methods,omitempty"`
+}
+
+// NativeLib is an ELF shared library
+type NativeLib struct {
+	Path    string `json:"path" structs:"path"`
+	Machine string `json:"machine,omitempty" structs:"machine,omitempty"`
+	// JNIExports are the exported Java_* functions, bound to their Java
+	// methods by name
+	JNIExports []JNIExport `json:"jni_exports,omitempty" structs:"jni_exports,omitempty"`
+	JNIOnLoad  bool        `json:"jni_onload" structs:"jni_onload"`
+	// RegisterNatives is set when JNI_OnLoad likely binds methods itself
+	// with RegisterNatives, which hides which methods it implements
+	RegisterNatives bool `json:"register_natives" structs:"register_natives"`
+	// Signatures are the JNI method signatures in the library's read-only
+	// data, e.g. (Ljava/lang/String;)[B, as passed to RegisterNatives
+	Signatures []string   `json:"signatures,omitempty" structs:"signatures,omitempty"`
+	Hardening  *Hardening `json:"hardening,omitempty" structs:"hardening,omitempty"`
+	// Entropy is the entropy of the whole library in bits per byte
+	Entropy float64 `json:"entropy" structs:"entropy"`
+	// Packer is the packer that was recognized, e.g. UPX
+	Packer string `json:"packer,omitempty" structs:"packer,omitempty"`
+	// Packed lists why the library looks packed or encrypted
+	Packed []string `json:"packed,omitempty" structs:"packed,omitempty"`
+	// AntiDebug lists how the library resists debugging
+	AntiDebug []string `json:"anti_debug,omitempty" structs:"anti_debug,omitempty"`
+	// Skipped is set for libraries too large to be parsed
+	Skipped bool   `json:"skipped,omitempty" structs:"skipped,omitempty"`
+	Error   string `json:"error,omitempty" structs:"error,omitempty"`
+}
+
+// JNIExport is a Java_* symbol and the method it implements
+type JNIExport struct {
+	Symbol string `json:"symbol" structs:"symbol"`
+	// Method is e.g. com.foo.Bar.decrypt, followed by the parameter
+	// descriptors for overloaded methods
+	Method string `json:"method" structs:"method"`
+}
+
+// jniSignatureRegexp matches JNI method descriptors
+var jniSignatureRegexp = regexp.MustCompile(`^\((?:\[*(?:[ZBCSIJFD]|L[\w/$]+;))*\)\[*(?:[ZBCSIJFDV]|L[\w/$]+;)$`)
+
+// soNameRegexp matches shared library names, including versioned ones
+var soNameRegexp = regexp.MustCompile(`\.so(?:\.\d+)*$`)
+
+// accNative is the access flag of native methods
+const accNative = 0x100
+
+type nativeAnalyzer struct{}
+
+func (nativeAnalyzer) Name() string    { return "native_libs" }
+func (nativeAnalyzer) Available() bool { return true }
+
+func (nativeAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	a, err := target.Archive()
+	if err == ErrNotArchive {
+		return nativeFile(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	libs := &NativeLibs{Libraries: []NativeLib{}}
+	for _, f := range a.File {
+		if !isNativeLib(f) {
+			continue
+		}
+		if !a.Analyzable(f) {
+			libs.Libraries = append(libs.Libraries, NativeLib{Path: f.Name, Skipped: true})
+			continue
+		}
+		data, err := a.ReadEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		libs.Libraries = append(libs.Libraries, analyzeNativeLib(f.Name, data))
+	}
+
+	dexes, err := target.dexFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dexes {
+		err := d.eachMethod(func(m dexMethod) {
+			if m.access&accNative != 0 {
+				libs.NativeMethods = append(libs.NativeMethods, m.ref.String())
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(libs.Libraries) == 0 && len(libs.NativeMethods) == 0 {
+		return nil, nil
+	}
+	return libs, nil
+}
+
+// nativeFile analyzes a target that is an ELF file itself
+func nativeFile(target *Target) (Section, error) {
+	info, err := os.Stat(target.Path)
+	if err != nil {
+		return nil, err
+	}
+	if target.maxEntrySize > 0 && info.Size() > target.maxEntrySize {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(target.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(elf.ELFMAG)) {
+		return nil, nil
+	}
+	return &NativeLibs{Libraries: []NativeLib{analyzeNativeLib(path.Base(target.Path), data)}}, nil
+}
+
+// isNativeLib reports whether f is a shared library, loaders also hide them
+// in assets/ under other directories
+func isNativeLib(f *zip.File) bool {
+	return soNameRegexp.MatchString(f.Name)
+}
+
+func analyzeNativeLib(name string, data []byte) NativeLib {
+	lib := NativeLib{Path: name}
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		lib.Error = err.Error()
+		if e := byteEntropy(data); e > packedEntropy {
+			lib.Entropy = math.Round(e*100) / 100
+			lib.Packed = append(lib.Packed, "encrypted, not a valid ELF file")
+		}
+		return lib
+	}
+	defer f.Close()
+	lib.Machine = f.Machine.String()
+
+	// libraries without a dynamic symbol table export nothing
+	syms, _ := f.DynamicSymbols()
+	for _, s := range syms {
+		if s.Section == elf.SHN_UNDEF || elf.ST_TYPE(s.Info) != elf.STT_FUNC {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(s.Name, "Java_"):
+			lib.JNIExports = append(lib.JNIExports, JNIExport{s.Name, jniMethod(s.Name)})
+		case s.Name == "JNI_OnLoad":
+			lib.JNIOnLoad = true
+		}
+	}
+
+	if rodata := f.Section(".rodata"); rodata != nil && rodata.Type != elf.SHT_NOBITS {
+		if data, err := rodata.Data(); err == nil {
+			seen := make(map[string]bool)
+			for _, s := range bytes.Split(data, []byte{0}) {
+				if sig := string(s); jniSignatureRegexp.MatchString(sig) && !seen[sig] {
+					seen[sig] = true
+					lib.Signatures = append(lib.Signatures, sig)
+				}
+			}
+			sort.Strings(lib.Signatures)
+		}
+	}
+	lib.RegisterNatives = lib.JNIOnLoad && len(lib.Signatures) > 0
+
+	lib.Hardening = checkHardening(f)
+	checkPacked(&lib, f, data)
+	checkAntiDebug(&lib, f)
+	return lib
+}
+
+// jniMethod returns the Java method a Java_* symbol implements, undoing the
+// JNI name mangling, e.g. Java_com_foo_Bar_run_1now__I is com.foo.Bar.run_now(I)
+func jniMethod(symbol string) string {
+	s := strings.TrimPrefix(symbol, "Java_")
+	var sig string
+	if i := strings.Index(s, "__"); i >= 0 {
+		s, sig = s[:i], s[i+2:]
+	}
+	method := unmangleJNI(s, '.')
+	if sig != "" {
+		method += "(" + unmangleJNI(sig, '/') + ")"
+	}
+	return method
+}
+
+// unmangleJNI decodes the JNI escapes in s, replacing separators with sep
+func unmangleJNI(s string, sep byte) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '_' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) {
+			switch s[i+1] {
+			case '1':
+				b.WriteByte('_')
+				i++
+				continue
+			case '2':
+				b.WriteByte(';')
+				i++
+				continue
+			case '3':
+				b.WriteByte('[')
+				i++
+				continue
+			case '0':
+				if i+5 < len(s) {
+					if r, err := strconv.ParseUint(s[i+2:i+6], 16, 16); err == nil {
+						b.WriteRune(rune(r))
+						i += 5
+						continue
+					}
+				}
+			}
+		}
+		b.WriteByte(sep)
+	}
+	return b.String()
+}
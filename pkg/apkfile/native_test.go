@@ -0,0 +1,201 @@
+package apkfile
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// elfBuilder writes minimal ELF64 shared libraries for the tests
+type elfBuilder struct {
+	exports []string
+	// imports are undefined dynamic symbols
+	imports []string
+	rodata  []string
+	// text is the content of an executable .text section
+	text    []byte
+	progs   []elf.Prog64
+	dynamic []elf.Dyn64
+	// symtab adds an empty .symtab, i.e. the library isn't stripped
+	symtab bool
+}
+
+func (b elfBuilder) build() []byte {
+	type section struct {
+		name       string
+		typ        elf.SectionType
+		flags      elf.SectionFlag
+		link       uint32
+		entsize    uint64
+		data       []byte
+		nameOffset uint32
+	}
+
+	var dynstr bytes.Buffer
+	dynstr.WriteByte(0)
+	var dynsym bytes.Buffer
+	binary.Write(&dynsym, binary.LittleEndian, elf.Sym64{})
+	addSym := func(name string, shndx uint16) {
+		binary.Write(&dynsym, binary.LittleEndian, elf.Sym64{
+			Name:  uint32(dynstr.Len()),
+			Info:  elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC),
+			Shndx: shndx,
+			Value: 0x1000,
+		})
+		dynstr.WriteString(name)
+		dynstr.WriteByte(0)
+	}
+	for _, name := range b.exports {
+		addSym(name, 3)
+	}
+	for _, name := range b.imports {
+		addSym(name, uint16(elf.SHN_UNDEF))
+	}
+	var rodata bytes.Buffer
+	for _, s := range b.rodata {
+		rodata.WriteString(s)
+		rodata.WriteByte(0)
+	}
+
+	sections := []*section{
+		{},
+		{name: ".dynsym", typ: elf.SHT_DYNSYM, link: 2, entsize: 24, data: dynsym.Bytes()},
+		{name: ".dynstr", typ: elf.SHT_STRTAB, data: dynstr.Bytes()},
+		{name: ".rodata", typ: elf.SHT_PROGBITS, flags: elf.SHF_ALLOC, data: rodata.Bytes()},
+	}
+	if b.text != nil {
+		sections = append(sections, &section{name: ".text", typ: elf.SHT_PROGBITS, flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR, data: b.text})
+	}
+	if b.dynamic != nil {
+		var dynamic bytes.Buffer
+		binary.Write(&dynamic, binary.LittleEndian, b.dynamic)
+		binary.Write(&dynamic, binary.LittleEndian, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+		sections = append(sections, &section{name: ".dynamic", typ: elf.SHT_DYNAMIC, flags: elf.SHF_ALLOC | elf.SHF_WRITE, link: 2, entsize: 16, data: dynamic.Bytes()})
+	}
+	if b.symtab {
+		sections = append(sections, &section{name: ".symtab", typ: elf.SHT_SYMTAB, link: 2, entsize: 24, data: make([]byte, 24)})
+	}
+	sections = append(sections, &section{name: ".shstrtab", typ: elf.SHT_STRTAB})
+	shstrndx := len(sections) - 1
+	var shstrtab bytes.Buffer
+	shstrtab.WriteByte(0)
+	for _, s := range sections[1:] {
+		s.nameOffset = uint32(shstrtab.Len())
+		shstrtab.WriteString(s.name)
+		shstrtab.WriteByte(0)
+	}
+	sections[shstrndx].data = shstrtab.Bytes()
+
+	headers := 64 + 56*len(b.progs)
+	var body bytes.Buffer
+	offsets := make([]uint64, len(sections))
+	for i, s := range sections {
+		offsets[i] = uint64(headers + body.Len())
+		body.Write(s.data)
+		for body.Len()%8 != 0 {
+			body.WriteByte(0)
+		}
+	}
+
+	var out bytes.Buffer
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(elf.EM_AARCH64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(headers + body.Len()),
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     uint16(len(b.progs)),
+		Shentsize: 64,
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  uint16(shstrndx),
+	}
+	if len(b.progs) > 0 {
+		hdr.Phoff = 64
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	binary.Write(&out, binary.LittleEndian, hdr)
+	binary.Write(&out, binary.LittleEndian, b.progs)
+	out.Write(body.Bytes())
+	for i, s := range sections {
+		binary.Write(&out, binary.LittleEndian, elf.Section64{
+			Name:      s.nameOffset,
+			Type:      uint32(s.typ),
+			Flags:     uint64(s.flags),
+			Off:       offsets[i],
+			Size:      uint64(len(s.data)),
+			Link:      s.link,
+			Addralign: 1,
+			Entsize:   s.entsize,
+		})
+	}
+	return out.Bytes()
+}
+
+// TestNativeAnalyzer tests the JNI exports and RegisterNatives detection.
+func TestNativeAnalyzer(t *testing.T) {
+	b := newDexBuilder()
+	decrypt := b.method("Lcom/example/Native;", "decrypt", "[B", "[B")
+	b.class("Lcom/example/Native;", "Ljava/lang/Object;", builderMethod{decrypt, nil})
+
+	jni := elfBuilder{
+		exports: []string{"Java_com_example_Native_decrypt", "Java_com_example_Native_run_1now__ILjava_lang_String_2", "malloc_hook"},
+	}
+	loader := elfBuilder{
+		exports: []string{"JNI_OnLoad"},
+		rodata:  []string{"com/example/Native", "decrypt", "([B)[B", "()V", "(I)", "hello"},
+	}
+	path := writeZip(t, map[string]string{
+		"classes.dex":                  string(b.build()),
+		"lib/arm64-v8a/libjni.so":      string(jni.build()),
+		"assets/payload.so":            string(loader.build()),
+		"lib/arm64-v8a/libbroken.so":   "not an ELF",
+		"lib/arm64-v8a/libjni.so.json": "{}",
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := nativeAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	libs := section.(*NativeLibs)
+
+	if !reflect.DeepEqual(libs.NativeMethods, []string{"Lcom/example/Native;->decrypt"}) {
+		t.Errorf("unexpected native methods %v", libs.NativeMethods)
+	}
+
+	byPath := make(map[string]NativeLib)
+	for _, l := range libs.Libraries {
+		byPath[l.Path] = l
+	}
+	if len(byPath) != 3 {
+		t.Fatalf("expected 3 libraries, got %#v", libs.Libraries)
+	}
+
+	lib := byPath["lib/arm64-v8a/libjni.so"]
+	wantExports := []JNIExport{
+		{"Java_com_example_Native_decrypt", "com.example.Native.decrypt"},
+		{"Java_com_example_Native_run_1now__ILjava_lang_String_2", "com.example.Native.run_now(ILjava/lang/String;)"},
+	}
+	if !reflect.DeepEqual(lib.JNIExports, wantExports) || lib.Machine != "EM_AARCH64" || lib.RegisterNatives {
+		t.Errorf("unexpected JNI library %#v", lib)
+	}
+
+	lib = byPath["assets/payload.so"]
+	if !lib.JNIOnLoad || !lib.RegisterNatives || !reflect.DeepEqual(lib.Signatures, []string{"()V", "([B)[B"}) {
+		t.Errorf("unexpected RegisterNatives library %#v", lib)
+	}
+
+	if byPath["lib/arm64-v8a/libbroken.so"].Error == "" {
+		t.Errorf("expected an error for a library that isn't an ELF")
+	}
+}
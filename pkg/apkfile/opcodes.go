@@ -0,0 +1,110 @@
+package apkfile
+
+import (
+	"context"
+	"math"
+)
+
+// OpcodeStats are Dalvik opcode frequencies, compact features for
+// classifying samples into families downstream
+type OpcodeStats struct {
+	OpcodeFeatures
+	// Vector is the frequency of each opcode over all the dex files, indexed
+	// by opcode and summing to 1
+	Vector []float64        `json:"vector" structs:"vector"`
+	Dex    []DexOpcodeStats `json:"dex" structs:"dex"`
+}
+
+// DexOpcodeStats are the opcode counts of one dex file
+type DexOpcodeStats struct {
+	Name string `json:"name" structs:"name"`
+	OpcodeFeatures
+	// Histogram counts the instructions of each opcode, indexed by opcode
+	Histogram []int `json:"histogram" structs:"histogram"`
+}
+
+// OpcodeFeatures sum up an opcode histogram
+type OpcodeFeatures struct {
+	Methods      int `json:"methods" structs:"methods"`
+	Instructions int `json:"instructions" structs:"instructions"`
+	// InvokeDensity is the share of instructions that call a method
+	InvokeDensity float64 `json:"invoke_density" structs:"invoke_density"`
+	// ConstStringRatio is the share of instructions that load a string
+	ConstStringRatio float64 `json:"const_string_ratio" structs:"const_string_ratio"`
+	// MeanMethodLength is the mean number of instructions of the methods with code
+	MeanMethodLength float64 `json:"mean_method_length" structs:"mean_method_length"`
+}
+
+type opcodesAnalyzer struct{}
+
+func (opcodesAnalyzer) Name() string    { return "opcodes" }
+func (opcodesAnalyzer) Available() bool { return true }
+
+func (opcodesAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	dexes, err := target.dexFiles()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(dexes) == 0 {
+		return nil, nil
+	}
+
+	stats := &OpcodeStats{}
+	total := make([]int, 256)
+	for _, d := range dexes {
+		ds := DexOpcodeStats{Name: d.name, Histogram: make([]int, 256)}
+		err := d.eachMethod(func(m dexMethod) {
+			if m.insns == nil {
+				return
+			}
+			ds.Methods++
+			eachInsn(m.insns, func(op byte, insn []uint16) {
+				ds.Histogram[op]++
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		ds.OpcodeFeatures = opcodeFeatures(ds.Histogram, ds.Methods)
+		stats.Dex = append(stats.Dex, ds)
+
+		stats.Methods += ds.Methods
+		for op, n := range ds.Histogram {
+			total[op] += n
+		}
+	}
+
+	stats.OpcodeFeatures = opcodeFeatures(total, stats.Methods)
+	stats.Vector = make([]float64, 256)
+	for op, n := range total {
+		stats.Vector[op] = ratio(n, stats.Instructions)
+	}
+	return stats, nil
+}
+
+func opcodeFeatures(histogram []int, methods int) OpcodeFeatures {
+	f := OpcodeFeatures{Methods: methods}
+	var invokes int
+	for op, n := range histogram {
+		f.Instructions += n
+		if isInvoke(byte(op)) {
+			invokes += n
+		}
+	}
+	f.InvokeDensity = ratio(invokes, f.Instructions)
+	f.ConstStringRatio = ratio(histogram[opConstString]+histogram[opConstStringJumbo], f.Instructions)
+	f.MeanMethodLength = ratio(f.Instructions, methods)
+	return f
+}
+
+// ratio is n/d rounded to 4 decimals, which is plenty for features and keeps
+// the report small, 0 when d is
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(d)*1e4) / 1e4
+}
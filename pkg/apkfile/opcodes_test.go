@@ -0,0 +1,47 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestOpcodesAnalyzer tests the opcode histogram and features.
+func TestOpcodesAnalyzer(t *testing.T) {
+	b := newDexBuilder()
+	run := b.method("Lcom/example/Main;", "run", "V")
+	log := b.method("Landroid/util/Log;", "d", "I", stringClass, stringClass)
+	native := b.method("Lcom/example/Main;", "decrypt", "V")
+	hello := b.str("hello")
+	b.class("Lcom/example/Main;", "Ljava/lang/Object;",
+		builderMethod{run, []uint16{
+			0x001a, uint16(hello), // const-string v0
+			0x2071, uint16(log), 0x0000, // invoke-static {v0, v0}
+			0x000e, // return-void
+		}},
+		builderMethod{native, nil},
+	)
+
+	path := writeZip(t, map[string]string{"classes.dex": string(b.build())})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := opcodesAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := section.(*OpcodeStats)
+
+	want := OpcodeFeatures{Methods: 1, Instructions: 3, InvokeDensity: 0.3333, ConstStringRatio: 0.3333, MeanMethodLength: 3}
+	if stats.OpcodeFeatures != want || len(stats.Dex) != 1 || stats.Dex[0].OpcodeFeatures != want {
+		t.Errorf("expected %+v, got %+v", want, stats)
+	}
+	h := stats.Dex[0].Histogram
+	if len(h) != 256 || h[0x1a] != 1 || h[0x71] != 1 || h[0x0e] != 1 {
+		t.Errorf("unexpected histogram %v", h)
+	}
+	if len(stats.Vector) != 256 || stats.Vector[0x71] != 0.3333 || stats.Vector[0x00] != 0 {
+		t.Errorf("unexpected vector %v", stats.Vector)
+	}
+}
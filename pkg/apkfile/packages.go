@@ -0,0 +1,133 @@
+package apkfile
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// packageDepth is how many levels the package tree is collapsed to, e.g.
+// com.google.android.gms and com.google.firebase are both com.google
+const packageDepth = 2
+
+// PackageTree is the classes in the dex files grouped by package
+type PackageTree struct {
+	Classes  int            `json:"classes" structs:"classes"`
+	Packages []PackageCount `json:"packages" structs:"packages"`
+	// ClassList is every class, only with WithClassList
+	ClassList []string `json:"class_list,omitempty" structs:"class_list,omitempty"`
+}
+
+// PackageCount is the number of classes in a package and its subpackages
+type PackageCount struct {
+	Name    string `json:"name" structs:"name"`
+	Classes int    `json:"classes" structs:"classes"`
+	// App is set for the package named in the manifest, the app's own code
+	App bool `json:"app,omitempty" structs:"app,omitempty"`
+}
+
+// WithClassList adds every class name to the packages section
+func WithClassList() Option {
+	return func(s *Scanner) {
+		s.classList = true
+	}
+}
+
+type packagesAnalyzer struct{ s *Scanner }
+
+func (packagesAnalyzer) Name() string    { return "packages" }
+func (packagesAnalyzer) Available() bool { return true }
+
+func (a packagesAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	dexes, err := target.dexFiles()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(dexes) == 0 {
+		return nil, nil
+	}
+
+	// the app's own package is kept whole however deep it is, so it isn't
+	// lumped together with the SDKs of its vendor
+	var app string
+	if root, err := target.manifest(); err == nil {
+		app = root.Attr("package")
+	}
+
+	tree := &PackageTree{}
+	counts := map[string]*PackageCount{}
+	for _, d := range dexes {
+		for _, c := range d.classes {
+			name := className(c.name)
+			tree.Classes++
+			if a.s.classList {
+				tree.ClassList = append(tree.ClassList, name)
+			}
+
+			pkg := collapsePackage(name, app)
+			count, ok := counts[pkg]
+			if !ok {
+				count = &PackageCount{Name: pkg, App: app != "" && pkg == app}
+				counts[pkg] = count
+			}
+			count.Classes++
+		}
+	}
+
+	for _, count := range counts {
+		tree.Packages = append(tree.Packages, *count)
+	}
+	sort.Slice(tree.Packages, func(i, j int) bool {
+		pi, pj := tree.Packages[i], tree.Packages[j]
+		if pi.Classes != pj.Classes {
+			return pi.Classes > pj.Classes
+		}
+		return pi.Name < pj.Name
+	})
+	sort.Strings(tree.ClassList)
+	return tree, nil
+}
+
+// className turns a type descriptor into a Java class name, e.g.
+// Lcom/foo/Bar$1; is com.foo.Bar$1
+func className(desc string) string {
+	return strings.Replace(strings.TrimSuffix(strings.TrimPrefix(desc, "L"), ";"), "/", ".", -1)
+}
+
+// embeddedPackages returns the packages of prefixes, e.g. com.alipay, that
+// classes of the dex files are in
+func embeddedPackages(dexes []*dexFile, prefixes []string) map[string]bool {
+	found := make(map[string]bool)
+	for _, d := range dexes {
+		for _, c := range d.classes {
+			name := className(c.name)
+			for _, p := range prefixes {
+				if strings.HasPrefix(name, p+".") {
+					found[p] = true
+				}
+			}
+		}
+	}
+	return found
+}
+
+// collapsePackage returns the package class is counted under, its first
+// packageDepth levels or app when it is in it, "(default)" for classes
+// without a package
+func collapsePackage(class, app string) string {
+	if app != "" && strings.HasPrefix(class, app+".") {
+		return app
+	}
+	parts := strings.Split(class, ".")
+	if len(parts) == 1 {
+		return "(default)"
+	}
+	parts = parts[:len(parts)-1]
+	if len(parts) > packageDepth {
+		parts = parts[:packageDepth]
+	}
+	return strings.Join(parts, ".")
+}
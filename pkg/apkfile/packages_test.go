@@ -0,0 +1,56 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestPackagesAnalyzer tests collapsing the classes into a package tree.
+func TestPackagesAnalyzer(t *testing.T) {
+	b := newDexBuilder()
+	for _, class := range []string{
+		"Lcom/google/android/gms/Auth;",
+		"Lcom/google/firebase/App;",
+		"Lcom/google/gson/Gson;",
+		"Lcom/example/shop/Main;",
+		"Lcom/example/shop/ui/Cart;",
+		"Lokhttp3/Call;",
+		"LPayload;",
+	} {
+		b.class(class, "Ljava/lang/Object;")
+	}
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.shop"><application/></manifest>`
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml": string(encodeAXML(t, manifest)),
+		"classes.dex":         string(b.build()),
+	})
+	defer os.Remove(path)
+
+	for _, classList := range []bool{false, true} {
+		target := &Target{Path: path}
+		section, err := packagesAnalyzer{&Scanner{classList: classList}}.Run(context.Background(), target)
+		target.close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := section.(*PackageTree)
+
+		want := []PackageCount{
+			{Name: "com.google", Classes: 3},
+			{Name: "com.example.shop", Classes: 2, App: true},
+			{Name: "(default)", Classes: 1},
+			{Name: "okhttp3", Classes: 1},
+		}
+		if tree.Classes != 7 || !reflect.DeepEqual(tree.Packages, want) {
+			t.Errorf("expected %v, got %+v", want, tree)
+		}
+		if classList != (len(tree.ClassList) == 7) {
+			t.Errorf("unexpected class list %v", tree.ClassList)
+		}
+		if classList && tree.ClassList[0] != "Payload" {
+			t.Errorf("expected the class list sorted, got %v", tree.ClassList)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package apkfile
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+)
+
+const (
+	// packedEntropy is the entropy above which code is compressed or encrypted,
+	// machine code is usually below 6.5 bits per byte
+	packedEntropy = 7.2
+	// minSymbols is how many dynamic symbols a library of minSymbolsSize has
+	// at least when it isn't packed
+	minSymbols     = 4
+	minSymbolsSize = 64 << 10
+)
+
+// packerLibs are the library names of commercial Android packers
+var packerLibs = map[string]string{
+	"libjiagu":        "Jiagu (Qihoo 360)",
+	"libsecexe":       "Bangcle",
+	"libsecmain":      "Bangcle",
+	"libdexhelper":    "SecNeo",
+	"libshella":       "Tencent Legu",
+	"libshellx":       "Tencent Legu",
+	"libexec":         "Ijiami",
+	"libexecmain":     "Ijiami",
+	"libnqshield":     "NQ Shield",
+	"libapkprotect":   "APKProtect",
+	"libprotectclass": "Ijiami",
+	"libbaiduprotect": "Baidu",
+	"libkwscmm":       "Kiwisec",
+	"libsgmain":       "Alibaba",
+}
+
+// byteEntropy is the Shannon entropy of data in bits per byte
+func byteEntropy(data []byte) float64 {
+	var counts [256]float64
+	for _, b := range data {
+		counts[b]++
+	}
+	return countsEntropy(&counts, len(data))
+}
+
+// readerEntropy is byteEntropy for data too large to hold in memory
+func readerEntropy(r io.Reader) (float64, error) {
+	var counts [256]float64
+	n := 0
+	buf := make([]byte, 32<<10)
+	for {
+		m, err := r.Read(buf)
+		for _, b := range buf[:m] {
+			counts[b]++
+		}
+		n += m
+		if err == io.EOF {
+			return countsEntropy(&counts, n), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// countsEntropy returns the entropy of n bytes with the given byte counts
+func countsEntropy(counts *[256]float64, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	var e float64
+	for _, c := range counts {
+		if c > 0 {
+			p := c / float64(n)
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+// checkPacked flags the signs of a packed or encrypted library: a known packer,
+// high entropy code, section headers stripped or out of line with the
+// segments, and a symbol table too small for the library's size
+func checkPacked(lib *NativeLib, f *elf.File, data []byte) {
+	lib.Entropy = math.Round(byteEntropy(data)*100) / 100
+
+	base := soNameRegexp.ReplaceAllString(strings.ToLower(path.Base(lib.Path)), "")
+	if packer, ok := packerLibs[base]; ok {
+		lib.Packer = packer
+		lib.Packed = append(lib.Packed, "library of the "+packer+" packer")
+	}
+	if bytes.Contains(data, []byte("UPX!")) || f.Section("UPX0") != nil || f.Section("UPX1") != nil {
+		lib.Packer = "UPX"
+		lib.Packed = append(lib.Packed, "UPX header")
+	}
+
+	if len(f.Sections) == 0 {
+		lib.Packed = append(lib.Packed, "no section headers")
+	}
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_EXECINSTR == 0 || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		if s.Flags&elf.SHF_WRITE != 0 {
+			lib.Packed = append(lib.Packed, "writable code section "+s.Name)
+		}
+		if code, err := s.Data(); err == nil && len(code) >= 1024 {
+			if e := byteEntropy(code); e > packedEntropy {
+				lib.Packed = append(lib.Packed, fmt.Sprintf("high entropy code section %s (%.2f)", s.Name, e))
+			}
+		}
+	}
+	for _, p := range f.Progs {
+		// code decompressed into memory the file doesn't back
+		if p.Type == elf.PT_LOAD && p.Flags&elf.PF_X != 0 && p.Memsz > 4*p.Filesz && p.Memsz-p.Filesz > 4096 {
+			lib.Packed = append(lib.Packed, fmt.Sprintf("executable segment %d times larger in memory than on disk", p.Memsz/(p.Filesz+1)+1))
+		}
+	}
+
+	syms, _ := f.DynamicSymbols()
+	if len(data) >= minSymbolsSize && len(syms) < minSymbols {
+		lib.Packed = append(lib.Packed, fmt.Sprintf("dynamic symbol table too small (%d)", len(syms)))
+	}
+}
@@ -0,0 +1,61 @@
+package apkfile
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestCheckPacked tests the packer and packed code heuristics.
+func TestCheckPacked(t *testing.T) {
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rand.New(rand.NewSource(1)).Read(b)
+		return b
+	}
+	// machine code looks nothing like random data
+	code := bytes.Repeat([]byte{0xfd, 0x7b, 0xbf, 0xa9, 0xfd, 0x03, 0x00, 0x91, 0x1f, 0x20, 0x03, 0xd5}, 8<<10)
+
+	path := writeZip(t, map[string]string{
+		"lib/arm64-v8a/libplain.so": string(elfBuilder{exports: []string{"a", "b", "c", "d"}, text: code}.build()),
+		"lib/arm64-v8a/libjiagu.so": string(elfBuilder{exports: []string{"JNI_OnLoad"}, text: random(64 << 10)}.build()),
+		"assets/libupx.so":          string(elfBuilder{rodata: []string{"UPX!"}}.build()),
+		"assets/libenc.so":          string(random(4096)),
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := nativeAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	libs := make(map[string]NativeLib)
+	for _, l := range section.(*NativeLibs).Libraries {
+		libs[l.Path] = l
+	}
+
+	if l := libs["lib/arm64-v8a/libplain.so"]; l.Packed != nil || l.Packer != "" || l.Entropy == 0 {
+		t.Errorf("unexpected packed library %#v", l)
+	}
+
+	l := libs["lib/arm64-v8a/libjiagu.so"]
+	if l.Packer != "Jiagu (Qihoo 360)" || l.Entropy < packedEntropy {
+		t.Errorf("unexpected Jiagu library %#v", l)
+	}
+	for _, want := range []string{"Jiagu", "high entropy code section .text", "dynamic symbol table too small (1)"} {
+		if !strings.Contains(strings.Join(l.Packed, "\n"), want) {
+			t.Errorf("expected %q among %q", want, l.Packed)
+		}
+	}
+
+	if l := libs["assets/libupx.so"]; l.Packer != "UPX" {
+		t.Errorf("unexpected UPX library %#v", l)
+	}
+	if l := libs["assets/libenc.so"]; l.Error == "" || len(l.Packed) != 1 {
+		t.Errorf("unexpected encrypted library %#v", l)
+	}
+}
@@ -0,0 +1,90 @@
+package apkfile
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/maliceio/go-plugin-utils/utils"
+)
+
+// ParseExiftoolOutput convert exiftool -j -G output into JSON, keeping exiftool's
+// number types and turning its date strings into times
+func ParseExiftoolOutput(exifout string) map[string]interface{} {
+	var ignoreTags = []string{
+		"SourceFile",
+		"File:Directory",
+		"File:FileName",
+		"File:FilePermissions",
+		"File:FileModifyDate",
+		"File:FileAccessDate",
+		"File:FileInodeChangeDate",
+	}
+
+	log.Debugln("Exiftool output: ", exifout)
+
+	var results []map[string]interface{}
+
+	dec := json.NewDecoder(strings.NewReader(exifout))
+	dec.UseNumber()
+	if err := dec.Decode(&results); err != nil || len(results) == 0 {
+		// exiftool prints nothing on stdout for a missing file
+		return nil
+	}
+
+	datas := make(map[string]interface{}, len(results[0]))
+
+	for key, value := range results[0] {
+		if utils.StringInSlice(key, ignoreTags) {
+			continue
+		}
+		if str, ok := value.(string); ok {
+			if t, err := parseExiftoolDate(str); err == nil {
+				datas[key] = t
+				continue
+			}
+		}
+		datas[key] = value
+	}
+
+	return datas
+}
+
+// parseExiftoolDate parses exiftool's "2006:01:02 15:04:05" date format with or without a zone
+func parseExiftoolDate(value string) (time.Time, error) {
+	t, err := time.Parse("2006:01:02 15:04:05Z07:00", value)
+	if err != nil {
+		return time.Parse("2006:01:02 15:04:05", value)
+	}
+	return t, nil
+}
+
+// tridMatch is a line of trid's matches, e.g.
+//
+//	31.0% (.EXE) Win32 Executable MS Visual C++ (generic) (31206/45/13)
+//
+// the counts at the end are the definition's points and are dropped
+var tridMatch = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)%\s+\(\.?([^)]*)\)\s+(.*?)(?:\s+\(\d+(?:/\d+)*\))?\s*$`)
+
+// ParseTRiDOutput parses trid's match lines, most probable first, whatever
+// banner and version lines precede them
+func ParseTRiDOutput(tridout string) []TRiDMatch {
+	log.Debugln("TRiD output: ", tridout)
+
+	var matches []TRiDMatch
+	for _, line := range strings.Split(tridout, "\n") {
+		m := tridMatch.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		probability, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		matches = append(matches, TRiDMatch{Extension: m[2], Description: m[3], Probability: probability})
+	}
+	return matches
+}
@@ -0,0 +1,64 @@
+package apkfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// TestParseExiftool tests the ParseExiftoolOutput function.
+func TestParseExiftool(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/exiftool.json")
+	if err != nil {
+		fmt.Print(err)
+	}
+
+	results := ParseExiftoolOutput(string(b))
+
+	if err != nil {
+		t.Log(err)
+	}
+
+	if _, ok := results["EXE:CodeSize"].(json.Number); !ok {
+		t.Errorf("EXE:CodeSize should be a number, got %T", results["EXE:CodeSize"])
+	}
+	if _, ok := results["EXE:TimeStamp"].(time.Time); !ok {
+		t.Errorf("EXE:TimeStamp should be a time, got %T", results["EXE:TimeStamp"])
+	}
+	if _, ok := results["File:FileName"]; ok {
+		t.Error("File:FileName should be ignored")
+	}
+
+	if true {
+		t.Log("results: ", results)
+	}
+}
+
+// TestParseTRiD tests the ParseTRiDOutput function.
+func TestParseTRiD(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/trid.out") // just pass the file name
+	if err != nil {
+		fmt.Print(err)
+	}
+
+	trid := ParseTRiDOutput(string(b))
+
+	if len(trid) != 5 {
+		t.Fatalf("expected 5 matches, got %v", trid)
+	}
+	if want := (TRiDMatch{Extension: "EXE", Description: "Win32 Executable MS Visual C++ (generic)", Probability: 31}); trid[0] != want {
+		t.Errorf("expected %+v, got %+v", want, trid[0])
+	}
+	if trid[3].Extension != "DLL" || trid[3].Probability != 6.5 {
+		t.Errorf("unexpected match %+v", trid[3])
+	}
+
+	// short output, e.g. a missing file or another banner, has no matches
+	for _, out := range []string{"", "TrID - File Identifier v2.24\nError: found no file(s) to analyze!\n", " 50.1% (.) ELF Executable and Linkable format (Linux) (4025/14)"} {
+		if got := ParseTRiDOutput(out); len(got) > 1 || len(got) == 1 && got[0].Extension != "" {
+			t.Errorf("unexpected matches %+v of %q", got, out)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package apkfile
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// CustomPermission is a <permission> the app defines
+type CustomPermission struct {
+	Name            string `json:"name" structs:"name"`
+	ProtectionLevel string `json:"protection_level" structs:"protection_level"`
+	Group           string `json:"group,omitempty" structs:"group,omitempty"`
+	// Guards are the app's components that require the permission
+	Guards []string `json:"guards,omitempty" structs:"guards,omitempty"`
+	// Weak are the exported services, receivers and providers it guards
+	// although, being normal level, any app can be granted it
+	Weak []string `json:"weak,omitempty" structs:"weak,omitempty"`
+}
+
+// protectionLevels are the base levels in the low bits of protectionLevel
+var protectionLevels = []string{"normal", "dangerous", "signature", "signatureOrSystem", "internal"}
+
+// protectionFlags are the flags that can be added to the base level
+var protectionFlags = []struct {
+	bit  int64
+	name string
+}{
+	{0x10, "privileged"}, {0x20, "development"}, {0x40, "appop"}, {0x80, "pre23"},
+	{0x100, "installer"}, {0x200, "verifier"}, {0x400, "preinstalled"}, {0x800, "setup"},
+}
+
+// protectionLevelName formats a compiled protectionLevel the way it is
+// written in the source manifest, e.g. 0x12 is signature|privileged
+func protectionLevelName(v string) string {
+	if v == "" {
+		return "normal"
+	}
+	n, err := strconv.ParseInt(v, 0, 64)
+	if err != nil {
+		// text manifests have the names already
+		return v
+	}
+	name := strconv.FormatInt(n&0xf, 10)
+	if int(n&0xf) < len(protectionLevels) {
+		name = protectionLevels[n&0xf]
+	}
+	for _, f := range protectionFlags {
+		if n&f.bit != 0 {
+			name += "|" + f.name
+		}
+	}
+	return name
+}
+
+type permissionsAnalyzer struct{}
+
+func (permissionsAnalyzer) Name() string    { return "custom_permissions" }
+func (permissionsAnalyzer) Available() bool { return true }
+
+func (permissionsAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// components without a permission of their own inherit the application's
+	var appPermission string
+	if app := root.All("application"); len(app) > 0 {
+		appPermission = app[0].Attr("permission")
+	}
+
+	perms := []CustomPermission{}
+	for _, p := range root.All("permission") {
+		perm := CustomPermission{
+			Name:            p.Attr("name"),
+			ProtectionLevel: protectionLevelName(p.Attr("protectionLevel")),
+			Group:           p.Attr("permissionGroup"),
+		}
+		normal := strings.SplitN(perm.ProtectionLevel, "|", 2)[0] == "normal"
+		for _, c := range components(root) {
+			guard := c.Element.Attr("permission")
+			if guard == "" {
+				guard = appPermission
+			}
+			if guard != perm.Name && c.Element.Attr("readPermission") != perm.Name && c.Element.Attr("writePermission") != perm.Name {
+				continue
+			}
+			perm.Guards = append(perm.Guards, c.Name)
+			if normal && c.Kind != "activity" && c.Kind != "activity-alias" && c.exported() {
+				perm.Weak = append(perm.Weak, c.Name)
+			}
+		}
+		perms = append(perms, perm)
+	}
+	return perms, nil
+}
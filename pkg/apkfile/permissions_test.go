@@ -0,0 +1,54 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestPermissionsAnalyzer tests that custom permissions are matched to the components they guard.
+func TestPermissionsAnalyzer(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <permission android:name="com.example.app.CONTROL" android:protectionLevel="0"/>
+  <permission android:name="com.example.app.READ" android:protectionLevel="signature"/>
+  <application android:permission="com.example.app.CONTROL">
+    <service android:name=".Remote" android:exported="true"/>
+    <activity android:name=".Settings" android:exported="true"/>
+    <receiver android:name=".Internal" android:exported="false"/>
+    <provider android:name=".Data" android:exported="true" android:readPermission="com.example.app.READ"/>
+  </application>
+</manifest>`
+	path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := permissionsAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []CustomPermission{
+		{
+			Name:            "com.example.app.CONTROL",
+			ProtectionLevel: "normal",
+			Guards:          []string{"com.example.app.Remote", "com.example.app.Settings", "com.example.app.Internal", "com.example.app.Data"},
+			Weak:            []string{"com.example.app.Remote", "com.example.app.Data"},
+		},
+		{
+			Name:            "com.example.app.READ",
+			ProtectionLevel: "signature",
+			Guards:          []string{"com.example.app.Data"},
+		},
+	}
+	if got := section.([]CustomPermission); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+
+	for in, want := range map[string]string{"": "normal", "0x12": "signature|privileged", "1": "dangerous", "signature|appop": "signature|appop"} {
+		if got := protectionLevelName(in); got != want {
+			t.Errorf("protectionLevelName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package apkfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// PluginConfig declares an external analyzer plugin. Plugins are run once per
+// scan, read a PluginRequest as JSON on stdin and write a PluginResponse as
+// JSON on stdout.
+type PluginConfig struct {
+	// Name is the key the plugin's output is reported under
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// Rules is the file or directory the plugin loads its rules from, e.g.
+	// YARA rules, their digest tells the reports of different rules apart
+	Rules string `json:"rules,omitempty"`
+}
+
+// PluginRequest is what a plugin receives on stdin
+type PluginRequest struct {
+	Path   string      `json:"path"`
+	Hashes *FileHashes `json:"hashes,omitempty"`
+}
+
+// PluginResponse is what a plugin writes on stdout
+type PluginResponse struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// LoadPlugins reads the plugin declarations from a JSON config file of the form
+//
+//	{"plugins": [{"name": "yara", "command": "/usr/local/bin/yara-plugin", "args": ["--rules", "/rules"], "rules": "/rules"}]}
+func LoadPlugins(path string) ([]PluginConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Plugins []PluginConfig `json:"plugins"`
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for _, p := range config.Plugins {
+		if p.Name == "" || p.Command == "" {
+			return nil, fmt.Errorf("parsing %s: every plugin needs a name and a command", path)
+		}
+	}
+
+	return config.Plugins, nil
+}
+
+// WithPlugin adds an external analyzer plugin to every scan
+func WithPlugin(cfg PluginConfig) Option {
+	return func(s *Scanner) {
+		s.analyzers = append(s.analyzers, pluginAnalyzer{cfg: cfg, s: s})
+	}
+}
+
+// pluginAnalyzer runs an external plugin through the scanner's backend
+type pluginAnalyzer struct {
+	cfg PluginConfig
+	s   *Scanner
+}
+
+func (p pluginAnalyzer) Name() string    { return p.cfg.Name }
+func (p pluginAnalyzer) Available() bool { return p.s.toolAvailable(p.cfg.Command) }
+
+func (p pluginAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	// sandboxes mount the sample at its absolute path
+	path, err := filepath.Abs(target.Path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := json.Marshal(PluginRequest{Path: path, Hashes: target.Hashes})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := p.s.runToolInput(ctx, target.Path, bytes.NewReader(req), p.cfg.Command, p.cfg.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp PluginResponse
+	if err = json.Unmarshal([]byte(out), &resp); err != nil {
+		return nil, fmt.Errorf("invalid plugin response: %v", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	var result interface{}
+	if len(resp.Result) != 0 {
+		if err = json.Unmarshal(resp.Result, &result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,32 @@
+package apkfile
+
+import (
+	"context"
+	"testing"
+)
+
+// TestPluginAnalyzer tests the JSON over stdin/stdout plugin protocol.
+func TestPluginAnalyzer(t *testing.T) {
+	s := &Scanner{backend: localBackend{}}
+	p := pluginAnalyzer{
+		cfg: PluginConfig{
+			Name:    "echo",
+			Command: "sh",
+			Args:    []string{"-c", `grep -q '"path":"/' && echo '{"result": {"rules": ["android_banker"]}}'`},
+		},
+		s: s,
+	}
+
+	section, err := p.Run(context.Background(), &Target{Path: "testdata/trid.out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, ok := section.(map[string]interface{})
+	if !ok {
+		t.Fatalf("plugin result should be an object, got %#v", section)
+	}
+	if rules, ok := result["rules"].([]interface{}); !ok || len(rules) != 1 || rules[0] != "android_banker" {
+		t.Errorf("unexpected plugin result: %#v", result)
+	}
+}
@@ -0,0 +1,130 @@
+package apkfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/google/cel-go/cel"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// PolicyRule raises the verdict and tags the report when its condition holds
+type PolicyRule struct {
+	Name string `yaml:"name"`
+	// When is a CEL expression over the JSON report, which is the report
+	// variable, e.g. report.secrets.exists(s, s.rule == "private_key")
+	When string `yaml:"when"`
+	// Verdict is suspicious or malicious, or empty to only tag the report
+	Verdict string `yaml:"verdict,omitempty"`
+	// Reason is added to the verdict's reasons, it defaults to the rule's name
+	Reason string   `yaml:"reason,omitempty"`
+	Tags   []string `yaml:"tags,omitempty"`
+
+	program cel.Program
+}
+
+// Policy is a deployment's own conditions for verdicts and tags, evaluated
+// once every analyzer is done
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// LoadPolicy reads a policy from a YAML file of the form
+//
+//	rules:
+//	  - name: overlay_banker
+//	    when: has(report.behaviors) && report.behaviors.exists(b, b.name == "overlay_attack")
+//	    verdict: malicious
+//	    tags: [banker]
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if err = yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	if err = p.compile(); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return &p, nil
+}
+
+// WithPolicy evaluates p against every report once its analyzers are done
+func WithPolicy(p *Policy) Option {
+	return func(s *Scanner) {
+		s.policy = p
+	}
+}
+
+// compile checks the rules and compiles their conditions
+func (p *Policy) compile() error {
+	env, err := cel.NewEnv(cel.Variable("report", cel.MapType(cel.StringType, cel.DynType)))
+	if err != nil {
+		return err
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" || r.When == "" {
+			return fmt.Errorf("every rule needs a name and a when condition")
+		}
+		if r.Verdict == "" && len(r.Tags) == 0 {
+			return fmt.Errorf("rule %s: needs a verdict or tags", r.Name)
+		}
+		if r.Verdict != "" && r.Verdict != VerdictSuspicious && r.Verdict != VerdictMalicious {
+			return fmt.Errorf("rule %s: unknown verdict %q", r.Name, r.Verdict)
+		}
+		ast, issues := env.Compile(r.When)
+		if issues != nil && issues.Err() != nil {
+			return fmt.Errorf("rule %s: %v", r.Name, issues.Err())
+		}
+		if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+			return fmt.Errorf("rule %s: condition is a %s, not a bool", r.Name, t)
+		}
+		if r.program, err = env.Program(ast); err != nil {
+			return fmt.Errorf("rule %s: %v", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply flags and tags fi with the rules that match it, they all see the
+// report as the analyzers left it
+func (p *Policy) apply(fi *FileInfo) error {
+	data, err := json.Marshal(fi)
+	if err != nil {
+		return err
+	}
+	var report map[string]interface{}
+	if err = json.Unmarshal(data, &report); err != nil {
+		return err
+	}
+
+	vars := map[string]interface{}{"report": report}
+	for _, r := range p.Rules {
+		out, _, err := r.program.Eval(vars)
+		if err != nil {
+			// mostly sections the report doesn't have, which has() guards against
+			log.WithError(err).Debugf("policy rule %s failed", r.Name)
+			continue
+		}
+		if match, ok := out.Value().(bool); !ok || !match {
+			continue
+		}
+		if r.Verdict != "" {
+			reason := r.Reason
+			if reason == "" {
+				reason = "matches policy rule " + r.Name
+			}
+			fi.flag(r.Verdict, "policy:"+r.Name, reason, Evidence{Kind: EvidenceRule, Value: r.When, Detail: "matches policy rule " + r.Name})
+		}
+		for _, tag := range r.Tags {
+			fi.Tags = appendUnique(fi.Tags, tag)
+		}
+	}
+	return nil
+}
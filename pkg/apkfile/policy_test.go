@@ -0,0 +1,91 @@
+package apkfile
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writePolicy writes a policy file and loads it
+func writePolicy(t *testing.T, policy string) (*Policy, error) {
+	f, err := ioutil.TempFile("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(policy)
+	f.Close()
+	return LoadPolicy(f.Name())
+}
+
+// TestPolicy tests flagging and tagging reports with policy rules.
+func TestPolicy(t *testing.T) {
+	p, err := writePolicy(t, `
+rules:
+  - name: overlay_banker
+    when: has(report.behaviors) && report.behaviors.exists(b, b.name == "overlay_attack")
+    verdict: malicious
+    reason: draws over banking apps
+    tags: [banker]
+  - name: leaked_keys
+    when: report.secrets.exists(s, s.rule == "private_key")
+    verdict: suspicious
+  - name: many_signers
+    when: has(report.signers) && size(report.signers) > 1
+    tags: [resigned, banker]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi := FileInfo{
+		Behaviors: []Behavior{{Name: "overlay_attack"}},
+		Signers:   []Signer{{SHA256: "a"}, {SHA256: "b"}},
+	}
+	if err := p.apply(&fi); err != nil {
+		t.Fatal(err)
+	}
+	// leaked_keys fails on the missing secrets section instead of matching
+	want := &Verdict{
+		Verdict: VerdictMalicious,
+		Reasons: []string{"draws over banking apps"},
+		Evidence: []Evidence{{
+			Flag:   "policy:overlay_banker",
+			Kind:   EvidenceRule,
+			Value:  `has(report.behaviors) && report.behaviors.exists(b, b.name == "overlay_attack")`,
+			Detail: "matches policy rule overlay_banker",
+		}},
+	}
+	if !reflect.DeepEqual(fi.Verdict, want) {
+		t.Errorf("expected verdict %#v, got %#v", want, fi.Verdict)
+	}
+	if !reflect.DeepEqual(fi.Tags, []string{"banker", "resigned"}) {
+		t.Errorf("unexpected tags %q", fi.Tags)
+	}
+
+	fi = FileInfo{Secrets: []SecretFinding{{Rule: "private_key"}}}
+	if err := p.apply(&fi); err != nil {
+		t.Fatal(err)
+	}
+	if fi.Verdict == nil || !reflect.DeepEqual(fi.Verdict.Reasons, []string{"matches policy rule leaked_keys"}) || len(fi.Verdict.Evidence) != 1 || fi.Verdict.Verdict != VerdictSuspicious || fi.Tags != nil {
+		t.Errorf("unexpected verdict %#v and tags %q", fi.Verdict, fi.Tags)
+	}
+}
+
+// TestLoadPolicyErrors tests rejecting invalid policies.
+func TestLoadPolicyErrors(t *testing.T) {
+	for policy, msg := range map[string]string{
+		"rules:\n  - name: a\n    when: 'true'\n":                                    "needs a verdict or tags",
+		"rules:\n  - name: a\n    when: 'true'\n    verdict: known_good\n":           `unknown verdict "known_good"`,
+		"rules:\n  - name: a\n    when: 'report.x +'\n    verdict: suspicious\n":     "rule a: ERROR",
+		"rules:\n  - name: a\n    when: '\"yes\"'\n    verdict: suspicious\n":        "not a bool",
+		"rules:\n  - when: 'true'\n    verdict: suspicious\n":                        "needs a name",
+		"rules:\n  - name: a\n    when: 'true'\n    verdict: suspicious\n    x: 1\n": "field x not found",
+	} {
+		if _, err := writePolicy(t, policy); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected %q to fail with %q, got %v", policy, msg, err)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package apkfile
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op, windows has no process groups to signal
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup kills the process of a started cmd, windows can't deliver
+// other signals
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,174 @@
+package apkfile
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// VirusTotal looks samples up in VirusTotal's file reports
+type VirusTotal struct {
+	APIKey string
+	// URL is the API, https://www.virustotal.com/api/v3 when empty
+	URL string
+	// PerMinute is the key's quota, 4 lookups a minute for public keys when 0
+	PerMinute int
+}
+
+func (VirusTotal) Name() string { return "virustotal" }
+
+func (v VirusTotal) Interval() time.Duration {
+	if v.PerMinute == 0 {
+		return time.Minute / 4
+	}
+	return time.Minute / time.Duration(v.PerMinute)
+}
+
+func (v VirusTotal) Lookup(ctx context.Context, client *http.Client, q EnrichmentQuery) (*Enrichment, error) {
+	base := v.URL
+	if base == "" {
+		base = "https://www.virustotal.com/api/v3"
+	}
+	req, err := http.NewRequest("GET", base+"/files/"+q.SHA256, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-apikey", v.APIKey)
+
+	var report struct {
+		Data struct {
+			Attributes struct {
+				Stats                map[string]int `json:"last_analysis_stats"`
+				ThreatClassification struct {
+					Label string `json:"suggested_threat_label"`
+				} `json:"popular_threat_classification"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	found, err := getJSON(ctx, client, req, &report)
+	if err != nil {
+		return nil, err
+	}
+	e := &Enrichment{Found: found, Link: "https://www.virustotal.com/gui/file/" + q.SHA256}
+	if !found {
+		return e, nil
+	}
+	a := report.Data.Attributes
+	for _, n := range a.Stats {
+		e.Engines += n
+	}
+	e.Detections = a.Stats["malicious"]
+	e.Detected = e.Detections > 0
+	e.Label = a.ThreatClassification.Label
+	return e, nil
+}
+
+// Koodous looks samples up in Koodous' APK database
+type Koodous struct {
+	Token string
+	// URL is the API, https://developer.koodous.com when empty
+	URL string
+}
+
+func (Koodous) Name() string            { return "koodous" }
+func (Koodous) Interval() time.Duration { return time.Second }
+
+func (k Koodous) Lookup(ctx context.Context, client *http.Client, q EnrichmentQuery) (*Enrichment, error) {
+	base := k.URL
+	if base == "" {
+		base = "https://developer.koodous.com"
+	}
+	req, err := http.NewRequest("GET", base+"/apks/"+q.SHA256+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Token "+k.Token)
+
+	var apk struct {
+		Detected bool   `json:"is_detected"`
+		App      string `json:"app"`
+	}
+	found, err := getJSON(ctx, client, req, &apk)
+	if err != nil {
+		return nil, err
+	}
+	e := &Enrichment{Found: found, Link: "https://koodous.com/apks/" + q.SHA256}
+	if !found {
+		return e, nil
+	}
+	e.Detected = apk.Detected
+	e.Label = apk.App
+	return e, nil
+}
+
+// GooglePlay looks up whether the APK's package is listed on Google Play
+type GooglePlay struct {
+	// URL is the store, https://play.google.com when empty
+	URL string
+}
+
+func (GooglePlay) Name() string            { return "google_play" }
+func (GooglePlay) Interval() time.Duration { return 2 * time.Second }
+
+// playTitle is the app name in the og:title of a listing
+var playTitle = regexp.MustCompile(`<meta property="og:title" content="([^"]*?)(?: - Apps on Google Play)?"`)
+
+func (g GooglePlay) Lookup(ctx context.Context, client *http.Client, q EnrichmentQuery) (*Enrichment, error) {
+	if q.Package == "" {
+		return nil, nil
+	}
+	base := g.URL
+	if base == "" {
+		base = "https://play.google.com"
+	}
+	link := base + "/store/apps/details?id=" + url.QueryEscape(q.Package)
+	req, err := http.NewRequest("GET", link+"&hl=en", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	e := &Enrichment{Link: link}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return e, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, statusError(resp)
+	}
+	e.Found = true
+	page, err := ioutil.ReadAll(io.LimitReader(resp.Body, 2<<20))
+	if err != nil {
+		return nil, err
+	}
+	if m := playTitle.FindSubmatch(page); m != nil {
+		e.Label = html.UnescapeString(string(m[1]))
+	}
+	return e, nil
+}
+
+// getJSON decodes the answer to req into v, false when it is a 404
+func getJSON(ctx context.Context, client *http.Client, req *http.Request, v interface{}) (bool, error) {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode != http.StatusOK:
+		return false, statusError(resp)
+	}
+	return true, json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(v)
+}
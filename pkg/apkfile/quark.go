@@ -0,0 +1,137 @@
+package apkfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultQuarkConfidence is the confidence from which Quark crimes are
+// reported, Quark's 60% stage is where the rule's APIs are called together
+const DefaultQuarkConfidence = 60
+
+// QuarkConfig runs Quark-Engine's behavior rules against APKs
+type QuarkConfig struct {
+	// Helper is the path to helpers/quark_report.py, which calls Quark's
+	// Python API and prints its JSON report
+	Helper string
+	// Rules is a Quark rule file or directory of them
+	Rules string
+	// MinConfidence drops crimes Quark is less confident about, in percent
+	MinConfidence int
+}
+
+// QuarkReport is Quark-Engine's verdict on an APK
+type QuarkReport struct {
+	ThreatLevel string       `json:"threat_level" structs:"threat_level"`
+	TotalScore  float64      `json:"total_score" structs:"total_score"`
+	Crimes      []QuarkCrime `json:"crimes" structs:"crimes"`
+}
+
+// QuarkCrime is a behavior rule Quark matched
+type QuarkCrime struct {
+	Crime       string   `json:"crime" structs:"crime"`
+	Rule        string   `json:"rule,omitempty" structs:"rule,omitempty"`
+	Confidence  int      `json:"confidence" structs:"confidence"`
+	Score       float64  `json:"score" structs:"score"`
+	Weight      float64  `json:"weight" structs:"weight"`
+	Labels      []string `json:"labels,omitempty" structs:"labels,omitempty"`
+	Permissions []string `json:"permissions,omitempty" structs:"permissions,omitempty"`
+	// APIs are the calls the rule combines, e.g. Landroid/telephony/SmsManager;->sendTextMessage
+	APIs []string `json:"apis,omitempty" structs:"apis,omitempty"`
+}
+
+// WithQuark adds a quark section with the crimes Quark-Engine finds
+func WithQuark(cfg QuarkConfig) Option {
+	return func(s *Scanner) {
+		if cfg.MinConfidence == 0 {
+			cfg.MinConfidence = DefaultQuarkConfidence
+		}
+		s.quark = cfg
+	}
+}
+
+type quarkAnalyzer struct{ s *Scanner }
+
+func (quarkAnalyzer) Name() string { return "quark" }
+func (a quarkAnalyzer) Available() bool {
+	return a.s.quark.Rules != "" && a.s.toolAvailable("python3")
+}
+
+func (quarkAnalyzer) apkOnly() {}
+
+func (a quarkAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	if _, err := target.manifest(); err == ErrNotAPK {
+		return nil, nil
+	}
+	// sandboxes mount the sample at its absolute path
+	path, err := filepath.Abs(target.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := a.s.quark
+	out, err := a.s.runTool(ctx, target.Path, "python3", cfg.Helper, cfg.Rules, path)
+	if err != nil {
+		return nil, err
+	}
+	return parseQuarkReport(out, cfg.MinConfidence)
+}
+
+// parseQuarkReport reads Quark's JSON report, keeping the crimes with at
+// least minConfidence, most dangerous first
+func parseQuarkReport(out string, minConfidence int) (*QuarkReport, error) {
+	var raw struct {
+		ThreatLevel string  `json:"threat_level"`
+		TotalScore  float64 `json:"total_score"`
+		Crimes      []struct {
+			Crime       string   `json:"crime"`
+			Rule        string   `json:"rule"`
+			Confidence  string   `json:"confidence"`
+			Score       float64  `json:"score"`
+			Weight      float64  `json:"weight"`
+			Label       []string `json:"label"`
+			Permissions []string `json:"permissions"`
+			NativeAPI   []struct {
+				Class  string `json:"class"`
+				Method string `json:"method"`
+			} `json:"native_api"`
+		} `json:"crimes"`
+	}
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		return nil, fmt.Errorf("invalid quark report: %v", err)
+	}
+
+	report := &QuarkReport{ThreatLevel: raw.ThreatLevel, TotalScore: raw.TotalScore, Crimes: []QuarkCrime{}}
+	for _, c := range raw.Crimes {
+		confidence, err := strconv.Atoi(strings.TrimSuffix(c.Confidence, "%"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid quark confidence %q", c.Confidence)
+		}
+		if confidence < minConfidence {
+			continue
+		}
+		crime := QuarkCrime{
+			Crime:       c.Crime,
+			Rule:        c.Rule,
+			Confidence:  confidence,
+			Score:       c.Score,
+			Weight:      c.Weight,
+			Labels:      c.Label,
+			Permissions: c.Permissions,
+		}
+		for _, api := range c.NativeAPI {
+			crime.APIs = append(crime.APIs, api.Class+"->"+api.Method)
+		}
+		report.Crimes = append(report.Crimes, crime)
+	}
+	sort.SliceStable(report.Crimes, func(i, j int) bool {
+		return report.Crimes[i].Weight > report.Crimes[j].Weight
+	})
+
+	return report, nil
+}
@@ -0,0 +1,52 @@
+package apkfile
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// TestParseQuarkReport tests reading Quark-Engine's JSON report.
+func TestParseQuarkReport(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/quark.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := parseQuarkReport(string(b), DefaultQuarkConfidence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ThreatLevel != "High Risk" || report.TotalScore != 200 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	want := []QuarkCrime{
+		{
+			Crime:       "Send SMS",
+			Rule:        "00022.json",
+			Confidence:  100,
+			Score:       1,
+			Weight:      1,
+			Labels:      []string{"sms"},
+			Permissions: []string{"android.permission.SEND_SMS"},
+			APIs:        []string{"Landroid/telephony/SmsManager;->getDefault", "Landroid/telephony/SmsManager;->sendTextMessage"},
+		},
+		{
+			Crime:       "Read file and put it into a stream",
+			Rule:        "00013.json",
+			Confidence:  60,
+			Score:       1,
+			Weight:      0.0625,
+			Labels:      []string{"file"},
+			Permissions: []string{},
+			APIs:        []string{"Ljava/io/File;->exists", "Ljava/io/FileInputStream;-><init>"},
+		},
+	}
+	if !reflect.DeepEqual(report.Crimes, want) {
+		t.Errorf("expected %+v, got %+v", want, report.Crimes)
+	}
+
+	if _, err := parseQuarkReport("Traceback (most recent call last):", DefaultQuarkConfidence); err == nil {
+		t.Error("expected an error for a report that isn't JSON")
+	}
+}
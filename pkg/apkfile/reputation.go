@@ -0,0 +1,68 @@
+package apkfile
+
+import "context"
+
+// SignerReputation is what earlier scans say about a signing certificate
+type SignerReputation struct {
+	SHA256 string `json:"sha256" structs:"sha256"`
+	// Samples is how many other samples were signed with the certificate
+	Samples int `json:"samples" structs:"samples"`
+	// Verdicts counts those samples by verdict, none for the ones without one
+	Verdicts map[string]int `json:"verdicts,omitempty" structs:"verdicts,omitempty"`
+	// Packages are their most common package names
+	Packages []string `json:"packages,omitempty" structs:"packages,omitempty"`
+}
+
+// ReputationStore looks up earlier scans, e.g. in the database the results
+// are written to
+type ReputationStore interface {
+	// SignerReputation sums up the scans of the samples signed with the
+	// certificate fingerprint, except the one with the SHA256 exclude
+	SignerReputation(ctx context.Context, fingerprint, exclude string) (SignerReputation, error)
+}
+
+// WithReputationStore adds a signer_reputation section looking up the APK's
+// signers in store
+func WithReputationStore(store ReputationStore) Option {
+	return func(s *Scanner) {
+		s.reputation = store
+	}
+}
+
+type reputationAnalyzer struct{ s *Scanner }
+
+func (reputationAnalyzer) Name() string      { return "signer_reputation" }
+func (a reputationAnalyzer) Available() bool { return a.s.reputation != nil }
+
+func (a reputationAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	certs, err := target.signingCerts()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil || len(certs) == 0 {
+		return nil, err
+	}
+
+	// rescans of the sample itself don't count
+	exclude, err := target.sha256()
+	if err != nil {
+		return nil, err
+	}
+
+	reputations := []SignerReputation{}
+	seen := make(map[string]bool)
+	for _, c := range certs {
+		fingerprint := newSigner(c.cert).SHA256
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		r, err := a.s.reputation.SignerReputation(ctx, fingerprint, exclude)
+		if err != nil {
+			return nil, err
+		}
+		r.SHA256 = fingerprint
+		reputations = append(reputations, r)
+	}
+	return reputations, nil
+}
@@ -0,0 +1,58 @@
+package apkfile
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type fakeReputationStore struct {
+	lookups [][2]string
+}
+
+func (f *fakeReputationStore) SignerReputation(ctx context.Context, fingerprint, exclude string) (SignerReputation, error) {
+	f.lookups = append(f.lookups, [2]string{fingerprint, exclude})
+	return SignerReputation{Samples: 3, Verdicts: map[string]int{VerdictMalicious: 2, "none": 1}, Packages: []string{"com.flash.update"}}, nil
+}
+
+// TestReputationAnalyzer tests that every signer is looked up once, without the sample itself.
+func TestReputationAnalyzer(t *testing.T) {
+	cert := selfSignedCert(t, pkix.Name{CommonName: "Flash Player Update"})
+	path := writeZip(t, map[string]string{"META-INF/CERT.RSA": string(pkcs7SignedData(t, cert))})
+	defer os.Remove(path)
+	addSigningBlock(t, path, apkSignatureV2, cert)
+	hashes, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &fakeReputationStore{}
+	s := &Scanner{}
+	WithReputationStore(store)(s)
+	a := reputationAnalyzer{s}
+	if !a.Available() {
+		t.Fatal("expected the analyzer to be available with a store")
+	}
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := a.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint := newSigner(mustParseCert(t, cert)).SHA256
+	if !reflect.DeepEqual(store.lookups, [][2]string{{fingerprint, hashes.SHA256}}) {
+		t.Errorf("unexpected lookups %v", store.lookups)
+	}
+	want := []SignerReputation{{SHA256: fingerprint, Samples: 3, Verdicts: map[string]int{VerdictMalicious: 2, "none": 1}, Packages: []string{"com.flash.update"}}}
+	if !reflect.DeepEqual(section, want) {
+		t.Errorf("expected %#v, got %#v", want, section)
+	}
+
+	if (reputationAnalyzer{&Scanner{}}).Available() {
+		t.Error("expected the analyzer to be unavailable without a store")
+	}
+}
@@ -0,0 +1,236 @@
+package apkfile
+
+import "time"
+
+// FileMagic is file magic
+type FileMagic struct {
+	Mime        string `json:"mime" structs:"mime"`
+	Description string `json:"description" structs:"description"`
+}
+
+// TRiDMatch is a file type TRiD identified the file as
+type TRiDMatch struct {
+	// Extension is the type's usual extension, e.g. EXE, empty when it has none
+	Extension   string `json:"extension" structs:"extension"`
+	Description string `json:"description" structs:"description"`
+	// Probability is the share of the definition's points among the matches,
+	// in percent
+	Probability float64 `json:"probability" structs:"probability"`
+}
+
+// FileInfo json object
+type FileInfo struct {
+	// Verdict is set when the findings are conclusive enough for one
+	Verdict *Verdict `json:"verdict,omitempty" structs:"verdict,omitempty"`
+	// Tags are the labels of the policy rules the report matches
+	Tags []string `json:"tags,omitempty" structs:"tags,omitempty"`
+	// TargetType is apk, archive or file, only APKs get the APK sections
+	TargetType        string                 `json:"target_type,omitempty" structs:"target_type,omitempty"`
+	Magic             FileMagic              `json:"magic" structs:"magic"`
+	Hashes            FileHashes             `json:"hashes" structs:"hashes"`
+	SSDeep            string                 `json:"ssdeep" structs:"ssdeep"`
+	TRiD              []TRiDMatch            `json:"trid" structs:"trid"`
+	Exiftool          map[string]interface{} `json:"exiftool" structs:"exiftool"`
+	MarkDown          string                 `json:"markdown,omitempty" structs:"markdown,omitempty"`
+	APKFile           string                 `json:"apk_file" structs:"apk_file"`
+	Entries           []ArchiveEntry         `json:"entries,omitempty" structs:"entries,omitempty"`
+	Timestamps        *Timestamps            `json:"timestamps,omitempty" structs:"timestamps,omitempty"`
+	SuspiciousEntries []SuspiciousEntry      `json:"suspicious_entries,omitempty" structs:"suspicious_entries,omitempty"`
+	Expansion         *Expansion             `json:"expansion,omitempty" structs:"expansion,omitempty"`
+	Vulnerabilities   []Vulnerability        `json:"vulnerabilities,omitempty" structs:"vulnerabilities,omitempty"`
+	Stego             []StegoImage           `json:"stego,omitempty" structs:"stego,omitempty"`
+	Strings           *Strings               `json:"strings,omitempty" structs:"strings,omitempty"`
+	Decompiled        *Decompiled            `json:"decompiled,omitempty" structs:"decompiled,omitempty"`
+	Artifacts         []Artifact             `json:"artifacts,omitempty" structs:"artifacts,omitempty"`
+	Secrets           []SecretFinding        `json:"secrets,omitempty" structs:"secrets,omitempty"`
+	CloudBackends     *CloudBackends         `json:"cloud_backends,omitempty" structs:"cloud_backends,omitempty"`
+	Crypto            []CryptoFinding        `json:"crypto_findings,omitempty" structs:"crypto_findings,omitempty"`
+	Signers           []Signer               `json:"signers,omitempty" structs:"signers,omitempty"`
+	CrossCheck        *CrossCheck            `json:"cross_check,omitempty" structs:"cross_check,omitempty"`
+	SignerReputation  []SignerReputation     `json:"signer_reputation,omitempty" structs:"signer_reputation,omitempty"`
+	UpdateAnalysis    *UpdateAnalysis        `json:"update_analysis,omitempty" structs:"update_analysis,omitempty"`
+	MalwarePackages   []FeedMatch            `json:"malware_packages,omitempty" structs:"malware_packages,omitempty"`
+	Enrichment        *Enrichments           `json:"enrichment,omitempty" structs:"enrichment,omitempty"`
+	Quark             *QuarkReport           `json:"quark,omitempty" structs:"quark,omitempty"`
+	Androguard        *AndroguardReport      `json:"androguard,omitempty" structs:"androguard,omitempty"`
+	Toolchain         *Toolchain             `json:"toolchain,omitempty" structs:"toolchain,omitempty"`
+	Opcodes           *OpcodeStats           `json:"opcodes,omitempty" structs:"opcodes,omitempty"`
+	APIUsage          *APIUsage              `json:"api_usage,omitempty" structs:"api_usage,omitempty"`
+	Packages          *PackageTree           `json:"packages,omitempty" structs:"packages,omitempty"`
+	NativeLibs        *NativeLibs            `json:"native_libs,omitempty" structs:"native_libs,omitempty"`
+	Impersonation     *Impersonation         `json:"impersonation,omitempty" structs:"impersonation,omitempty"`
+	Locales           *Locales               `json:"locales,omitempty" structs:"locales,omitempty"`
+	Intents           *IntentFilters         `json:"intent_filters,omitempty" structs:"intent_filters,omitempty"`
+	TaskHijacking     *TaskHijacking         `json:"task_hijacking,omitempty" structs:"task_hijacking,omitempty"`
+	Attestation       []AttestationAPI       `json:"attestation,omitempty" structs:"attestation,omitempty"`
+	WebView           *WebView               `json:"webview,omitempty" structs:"webview,omitempty"`
+	AntiAnalysis      *AntiAnalysis          `json:"anti_analysis,omitempty" structs:"anti_analysis,omitempty"`
+	Behaviors         []Behavior             `json:"behaviors,omitempty" structs:"behaviors,omitempty"`
+	Billing           *Billing               `json:"billing,omitempty" structs:"billing,omitempty"`
+	Permissions       []CustomPermission     `json:"custom_permissions,omitempty" structs:"custom_permissions,omitempty"`
+	RuntimePerms      *RuntimePermissions    `json:"runtime_permissions,omitempty" structs:"runtime_permissions,omitempty"`
+	DeepLinks         []DeepLink             `json:"deep_links,omitempty" structs:"deep_links,omitempty"`
+	// Analyzers holds the sections of third-party analyzers by name
+	Analyzers map[string]interface{} `json:"analyzers,omitempty" structs:"analyzers,omitempty"`
+	// Errors are why analyzers' sections are missing or incomplete
+	Errors Diagnostics `json:"errors,omitempty" structs:"errors,omitempty"`
+	// Warnings are what makes the sections of analyzers that didn't fail less
+	// reliable, e.g. a file type told without libmagic
+	Warnings Diagnostics `json:"warnings,omitempty" structs:"warnings,omitempty"`
+	// Timings holds how long each analyzer ran and what its tools used by name
+	Timings map[string]Timing `json:"timings,omitempty" structs:"timings,omitempty"`
+	// Scanner is a digest of the plugin version, tools, analyzers and rules
+	// that produced the report, set when fileinfo stores it
+	Scanner string `json:"scanner,omitempty" structs:"scanner,omitempty"`
+	// Revision counts the re-scans that replaced the stored report
+	Revision int `json:"revision,omitempty" structs:"revision,omitempty"`
+	// ScannedAt is when the scan started
+	ScannedAt *time.Time `json:"scanned_at,omitempty" structs:"scanned_at,omitempty,omitnested"`
+	// Submission is what the submitter attached to group the scan, set when
+	// fileinfo scans a sample it was given one for
+	Submission *Submission `json:"submission,omitempty" structs:"submission,omitempty"`
+	// Sections are the sections refreshed since the scan by name, set when
+	// fileinfo merges them into a stored report it serves
+	Sections map[string]SectionStamp `json:"sections,omitempty" structs:"sections,omitempty,omitnested"`
+}
+
+// SectionStamp is when and by what a section was produced
+type SectionStamp struct {
+	ScannedAt time.Time `json:"scanned_at"`
+	// Version is the plugin's version and Scanner the digest of its scanner
+	Version string `json:"version,omitempty"`
+	Scanner string `json:"scanner,omitempty"`
+}
+
+// Submission is the tags and metadata a scan was submitted with, e.g. the
+// case or campaign it belongs to
+type Submission struct {
+	// Submitter is the name of the API key the sample was submitted with
+	Submitter string            `json:"submitter,omitempty" structs:"submitter,omitempty"`
+	Tags      []string          `json:"tags,omitempty" structs:"tags,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty" structs:"metadata,omitempty"`
+}
+
+// Partial reports whether any analyzer failed or timed out
+func (fi FileInfo) Partial() bool {
+	return len(fi.Errors) > 0
+}
+
+// setSection stores an analyzer's section in its field of the report,
+// sections of third-party analyzers go into Analyzers
+func (fi *FileInfo) setSection(name string, section Section) {
+	var ok bool
+
+	switch name {
+	case "magic":
+		fi.Magic, ok = section.(FileMagic)
+	case "hashes":
+		fi.Hashes, ok = section.(FileHashes)
+	case "ssdeep":
+		fi.SSDeep, ok = section.(string)
+	case "trid":
+		fi.TRiD, ok = section.([]TRiDMatch)
+	case "exiftool":
+		fi.Exiftool, ok = section.(map[string]interface{})
+	case "apk_file":
+		fi.APKFile, ok = section.(string)
+	case "entries":
+		fi.Entries, ok = section.([]ArchiveEntry)
+	case "timestamps":
+		fi.Timestamps, ok = section.(*Timestamps)
+	case "suspicious_entries":
+		fi.SuspiciousEntries, ok = section.([]SuspiciousEntry)
+	case "expansion":
+		fi.Expansion, ok = section.(*Expansion)
+	case "vulnerabilities":
+		fi.Vulnerabilities, ok = section.([]Vulnerability)
+	case "stego":
+		fi.Stego, ok = section.([]StegoImage)
+	case "strings":
+		fi.Strings, ok = section.(*Strings)
+	case "decompiled":
+		fi.Decompiled, ok = section.(*Decompiled)
+	case "secrets":
+		fi.Secrets, ok = section.([]SecretFinding)
+	case "cloud_backends":
+		fi.CloudBackends, ok = section.(*CloudBackends)
+	case "crypto_findings":
+		fi.Crypto, ok = section.([]CryptoFinding)
+	case "signers":
+		fi.Signers, ok = section.([]Signer)
+	case "cross_check":
+		fi.CrossCheck, ok = section.(*CrossCheck)
+	case "update_analysis":
+		fi.UpdateAnalysis, ok = section.(*UpdateAnalysis)
+	case "artifacts":
+		fi.Artifacts, ok = section.([]Artifact)
+	case "signer_reputation":
+		fi.SignerReputation, ok = section.([]SignerReputation)
+	case "malware_packages":
+		fi.MalwarePackages, ok = section.([]FeedMatch)
+	case "enrichment":
+		fi.Enrichment, ok = section.(*Enrichments)
+	case "quark":
+		fi.Quark, ok = section.(*QuarkReport)
+	case "androguard":
+		fi.Androguard, ok = section.(*AndroguardReport)
+	case "toolchain":
+		fi.Toolchain, ok = section.(*Toolchain)
+	case "opcodes":
+		fi.Opcodes, ok = section.(*OpcodeStats)
+	case "api_usage":
+		fi.APIUsage, ok = section.(*APIUsage)
+	case "packages":
+		fi.Packages, ok = section.(*PackageTree)
+	case "native_libs":
+		fi.NativeLibs, ok = section.(*NativeLibs)
+	case "impersonation":
+		fi.Impersonation, ok = section.(*Impersonation)
+	case "locales":
+		fi.Locales, ok = section.(*Locales)
+	case "intent_filters":
+		fi.Intents, ok = section.(*IntentFilters)
+	case "task_hijacking":
+		fi.TaskHijacking, ok = section.(*TaskHijacking)
+	case "attestation":
+		fi.Attestation, ok = section.([]AttestationAPI)
+	case "webview":
+		fi.WebView, ok = section.(*WebView)
+	case "anti_analysis":
+		fi.AntiAnalysis, ok = section.(*AntiAnalysis)
+	case "behaviors":
+		fi.Behaviors, ok = section.([]Behavior)
+	case "billing":
+		fi.Billing, ok = section.(*Billing)
+	case "custom_permissions":
+		fi.Permissions, ok = section.([]CustomPermission)
+	case "runtime_permissions":
+		fi.RuntimePerms, ok = section.(*RuntimePermissions)
+	case "deep_links":
+		fi.DeepLinks, ok = section.([]DeepLink)
+	}
+
+	if !ok {
+		fi.setAnalyzer(name, section)
+	}
+}
+
+func (fi *FileInfo) setAnalyzer(name string, section Section) {
+	if fi.Analyzers == nil {
+		fi.Analyzers = make(map[string]interface{})
+	}
+	fi.Analyzers[name] = section
+}
+
+// setError records why an analyzer failed, retryable tells the transient
+// errors
+func (fi *FileInfo) setError(name string, err error, retryable func(error) bool) {
+	fi.Errors = append(fi.Errors, newDiagnostic(name, err, retryable))
+}
+
+func (fi *FileInfo) setTiming(name string, t Timing) {
+	if fi.Timings == nil {
+		fi.Timings = make(map[string]Timing)
+	}
+	fi.Timings[name] = t
+}
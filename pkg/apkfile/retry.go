@@ -0,0 +1,93 @@
+package apkfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// RetryPolicy controls how analyzers are retried after transient failures
+type RetryPolicy struct {
+	// Attempts is the number of times an analyzer is run, 1 disables retries
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for every retry after it
+	Backoff time.Duration
+	// Retryable classifies errors, it defaults to IsTransient
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy retries transient failures twice
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 500 * time.Millisecond}
+
+// WithRetryPolicy sets how analyzers are retried after transient failures
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(s *Scanner) {
+		s.retry = p
+	}
+}
+
+// IsTransient reports whether an external tool failed in a way that may not
+// happen again, e.g. "text file busy" or being killed by the OOM killer
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, syscall.ETXTBSY) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ENOMEM) {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			// SIGKILL is what the OOM killer sends
+			return status.Signal() == syscall.SIGKILL
+		}
+		return false
+	}
+	return strings.Contains(err.Error(), "text file busy")
+}
+
+// retryAnalyzer re-runs an analyzer after transient failures
+type retryAnalyzer struct {
+	Analyzer
+	policy RetryPolicy
+}
+
+// retryable is the policy's classifier of transient errors
+func (p RetryPolicy) retryable() func(error) bool {
+	if p.Retryable == nil {
+		return IsTransient
+	}
+	return p.Retryable
+}
+
+func (r retryAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	retryable := r.policy.retryable()
+	backoff := r.policy.Backoff
+
+	var failure error
+	for attempt := 1; ; attempt++ {
+		section, err := r.Analyzer.Run(ctx, target)
+		if err == nil && failure != nil {
+			warn(ctx, DiagnosticRetried, fmt.Sprintf("succeeded on attempt %d, after %v", attempt, failure))
+		}
+		if err == nil || attempt >= r.policy.Attempts || !retryable(err) {
+			return section, err
+		}
+		failure = err
+
+		log.WithError(err).Debugf("%s analyzer failed, retrying in %s", r.Name(), backoff)
+
+		select {
+		case <-ctx.Done():
+			return section, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,45 @@
+package apkfile
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+)
+
+type flakyAnalyzer struct {
+	runs *int
+	err  error
+}
+
+func (flakyAnalyzer) Name() string    { return "flaky" }
+func (flakyAnalyzer) Available() bool { return true }
+
+func (a flakyAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	*a.runs++
+	if *a.runs < 3 {
+		return nil, a.err
+	}
+	return "ok", nil
+}
+
+// TestRetryAnalyzer tests that only transient failures are retried.
+func TestRetryAnalyzer(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3}
+
+	runs := 0
+	w := &warnings{}
+	section, err := retryAnalyzer{flakyAnalyzer{&runs, syscall.ETXTBSY}, policy}.Run(withWarnings(context.Background(), w), &Target{})
+	if err != nil || section != "ok" || runs != 3 {
+		t.Errorf("transient failure: got %v, %v after %d runs", section, err, runs)
+	}
+	if list := w.of("flaky"); len(list) != 1 || list[0].Code != DiagnosticRetried || list[0].Analyzer != "flaky" {
+		t.Errorf("expected a warning about the retries, got %#v", list)
+	}
+
+	runs = 0
+	_, err = retryAnalyzer{flakyAnalyzer{&runs, errors.New("bad input")}, policy}.Run(context.Background(), &Target{})
+	if err == nil || runs != 1 {
+		t.Errorf("permanent failure should not be retried, got %v after %d runs", err, runs)
+	}
+}
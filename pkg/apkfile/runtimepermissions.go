@@ -0,0 +1,219 @@
+package apkfile
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// RuntimePermissions tells the dangerous permissions the app asks the user
+// for apart from the ones it only declares, dormant declarations are often
+// left over from libraries while requested ones are capabilities in use
+type RuntimePermissions struct {
+	Requested []RequestedPermission `json:"requested,omitempty" structs:"requested,omitempty"`
+	// Dormant are the dangerous permissions declared in the manifest but
+	// never requested with a constant
+	Dormant []string `json:"dormant,omitempty" structs:"dormant,omitempty"`
+	// Unresolved are the methods requesting permissions that aren't
+	// constants, any dormant permission may be among them
+	Unresolved []string `json:"unresolved,omitempty" structs:"unresolved,omitempty"`
+}
+
+// RequestedPermission is a dangerous permission requested at runtime
+type RequestedPermission struct {
+	Name string `json:"name" structs:"name"`
+	// Declared is unset when the manifest lacks the permission, Android then
+	// denies the request without asking
+	Declared bool `json:"declared" structs:"declared"`
+	// Locations are the dex files and methods requesting it
+	Locations []string `json:"locations" structs:"locations"`
+}
+
+// dangerousPermissions are the permissions with the dangerous protection
+// level, the ones granted by the user at runtime since Android 6
+var dangerousPermissions = map[string]bool{
+	"android.permission.ACCEPT_HANDOVER":                 true,
+	"android.permission.ACCESS_BACKGROUND_LOCATION":      true,
+	"android.permission.ACCESS_COARSE_LOCATION":          true,
+	"android.permission.ACCESS_FINE_LOCATION":            true,
+	"android.permission.ACCESS_MEDIA_LOCATION":           true,
+	"android.permission.ACTIVITY_RECOGNITION":            true,
+	"android.permission.ADD_VOICEMAIL":                   true,
+	"android.permission.ANSWER_PHONE_CALLS":              true,
+	"android.permission.BLUETOOTH_ADVERTISE":             true,
+	"android.permission.BLUETOOTH_CONNECT":               true,
+	"android.permission.BLUETOOTH_SCAN":                  true,
+	"android.permission.BODY_SENSORS":                    true,
+	"android.permission.BODY_SENSORS_BACKGROUND":         true,
+	"android.permission.CALL_PHONE":                      true,
+	"android.permission.CAMERA":                          true,
+	"android.permission.GET_ACCOUNTS":                    true,
+	"android.permission.NEARBY_WIFI_DEVICES":             true,
+	"android.permission.POST_NOTIFICATIONS":              true,
+	"android.permission.PROCESS_OUTGOING_CALLS":          true,
+	"android.permission.READ_CALENDAR":                   true,
+	"android.permission.READ_CALL_LOG":                   true,
+	"android.permission.READ_CONTACTS":                   true,
+	"android.permission.READ_EXTERNAL_STORAGE":           true,
+	"android.permission.READ_MEDIA_AUDIO":                true,
+	"android.permission.READ_MEDIA_IMAGES":               true,
+	"android.permission.READ_MEDIA_VIDEO":                true,
+	"android.permission.READ_MEDIA_VISUAL_USER_SELECTED": true,
+	"android.permission.READ_PHONE_NUMBERS":              true,
+	"android.permission.READ_PHONE_STATE":                true,
+	"android.permission.READ_SMS":                        true,
+	"android.permission.RECEIVE_MMS":                     true,
+	"android.permission.RECEIVE_SMS":                     true,
+	"android.permission.RECEIVE_WAP_PUSH":                true,
+	"android.permission.RECORD_AUDIO":                    true,
+	"android.permission.SEND_SMS":                        true,
+	"android.permission.USE_SIP":                         true,
+	"android.permission.UWB_RANGING":                     true,
+	"android.permission.WRITE_CALENDAR":                  true,
+	"android.permission.WRITE_CALL_LOG":                  true,
+	"android.permission.WRITE_CONTACTS":                  true,
+	"android.permission.WRITE_EXTERNAL_STORAGE":          true,
+}
+
+// permissionRequests are the methods asking for permissions, by class and
+// name, with the argument register holding the permissions: a String[] or,
+// for ActivityResultLauncher, a String as well
+var permissionRequests = []struct {
+	class, name string
+	arg         int
+}{
+	{"Landroid/app/Activity;", "requestPermissions", 1},
+	{"Landroid/app/Fragment;", "requestPermissions", 1},
+	{"Landroidx/core/app/ActivityCompat;", "requestPermissions", 1},
+	{"Landroid/support/v4/app/ActivityCompat;", "requestPermissions", 1},
+	{"Landroidx/fragment/app/Fragment;", "requestPermissions", 1},
+	{"Landroid/support/v4/app/Fragment;", "requestPermissions", 1},
+	{"Landroidx/activity/result/ActivityResultLauncher;", "launch", 1},
+}
+
+type runtimePermissionsAnalyzer struct{}
+
+func (runtimePermissionsAnalyzer) Name() string    { return "runtime_permissions" }
+func (runtimePermissionsAnalyzer) Available() bool { return true }
+
+func (runtimePermissionsAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dexes, err := target.dexFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	requested := make(map[string][]string)
+	var unresolved []string
+	for _, d := range dexes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		err := d.eachMethod(func(m dexMethod) {
+			if m.insns == nil {
+				return
+			}
+			location := d.name + ":" + m.ref.String()
+			perms, ok := permissionsRequested(d, m.insns)
+			if !ok {
+				unresolved = appendUnique(unresolved, location)
+			}
+			for _, p := range perms {
+				requested[p] = appendUnique(requested[p], location)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	declared := usesPermissions(root)
+	r := &RuntimePermissions{Unresolved: unresolved}
+	for p, locations := range requested {
+		if dangerousPermissions[p] {
+			r.Requested = append(r.Requested, RequestedPermission{Name: p, Declared: containsString(declared, p), Locations: locations})
+		}
+	}
+	sort.Slice(r.Requested, func(i, j int) bool { return r.Requested[i].Name < r.Requested[j].Name })
+	for _, p := range declared {
+		if _, ok := requested[p]; dangerousPermissions[p] && !ok {
+			r.Dormant = append(r.Dormant, p)
+		}
+	}
+	sort.Strings(r.Dormant)
+
+	if len(r.Requested) == 0 && len(r.Dormant) == 0 && len(r.Unresolved) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// permissionsRequested returns the constant permissions one method requests,
+// and false when it requests some that aren't constants. String arrays are
+// followed through new-array and aput-object, and filled-new-array, the way
+// javac and d8 build them
+func permissionsRequested(d *dexFile, insns []uint16) ([]string, bool) {
+	strs := make(map[uint16]string)
+	arrays := make(map[uint16][]string)
+	var filled []string
+	var found []string
+	resolved := true
+
+	eachInsn(insns, func(op byte, insn []uint16) {
+		switch {
+		case op == opConstString || op == opConstStringJumbo:
+			strs[insn[0]>>8] = d.str(stringIndex(op, insn))
+		case op == 0x23: // new-array vA, vB, type@CCCC
+			arrays[insn[0]>>8&0xf] = []string{}
+		case op == 0x4d: // aput-object vAA, vBB, vCC
+			if a, ok := arrays[insn[1]&0xff]; ok {
+				if s, ok := strs[insn[0]>>8]; ok {
+					arrays[insn[1]&0xff] = append(a, s)
+				}
+			}
+		case op == 0x24: // filled-new-array {vC, vD, vE, vF, vG}, type@BBBB
+			filled = []string{}
+			for _, r := range invokeRegisters(opInvokeVirtual, insn) {
+				if s, ok := strs[r]; ok {
+					filled = append(filled, s)
+				}
+			}
+		case op == 0x0c: // move-result-object vAA
+			if filled != nil {
+				arrays[insn[0]>>8] = filled
+				filled = nil
+			}
+		case isInvoke(op):
+			filled = nil
+			ref := d.method(uint32(insn[1]))
+			for _, req := range permissionRequests {
+				if ref.class != req.class || ref.name != req.name {
+					continue
+				}
+				regs := invokeRegisters(op, insn)
+				if req.arg >= len(regs) {
+					break
+				}
+				if a, ok := arrays[regs[req.arg]]; ok && len(a) > 0 {
+					for _, p := range a {
+						found = appendUnique(found, p)
+					}
+				} else if s, ok := strs[regs[req.arg]]; ok && strings.HasPrefix(s, "android.permission.") {
+					found = appendUnique(found, s)
+				} else if req.name == "requestPermissions" {
+					// launchers run every kind of contract, only the
+					// requestPermissions calls surely ask for permissions
+					resolved = false
+				}
+				break
+			}
+		}
+	})
+	return found, resolved
+}
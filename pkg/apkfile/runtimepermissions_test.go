@@ -0,0 +1,93 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestRuntimePermissionsAnalyzer tests telling requested permissions from
+// dormant declarations.
+func TestRuntimePermissionsAnalyzer(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <uses-permission android:name="android.permission.CAMERA"/>
+  <uses-permission android:name="android.permission.READ_CONTACTS"/>
+  <uses-permission android:name="android.permission.SEND_SMS"/>
+  <uses-permission android:name="android.permission.READ_SMS"/>
+  <uses-permission android:name="android.permission.INTERNET"/>
+</manifest>`
+
+	b := newDexBuilder()
+	compat := b.method("Landroidx/core/app/ActivityCompat;", "requestPermissions", "V", "Landroid/app/Activity;", "[Ljava/lang/String;", "I")
+	activity := b.method("Landroid/app/Activity;", "requestPermissions", "V", "[Ljava/lang/String;", "I")
+	launch := b.method("Landroidx/activity/result/ActivityResultLauncher;", "launch", "V", "Ljava/lang/Object;")
+	onCreate := b.method("Lcom/example/Main;", "onCreate", "V")
+	onSms := b.method("Lcom/example/Main;", "onSms", "V")
+	onAsk := b.method("Lcom/example/Main;", "onAsk", "V")
+	onRecord := b.method("Lcom/example/Main;", "onRecord", "V")
+	array := b.typ("[Ljava/lang/String;")
+	camera := b.str("android.permission.CAMERA")
+	contacts := b.str("android.permission.READ_CONTACTS")
+	sms := b.str("android.permission.SEND_SMS")
+	audio := b.str("android.permission.RECORD_AUDIO")
+
+	b.class("Lcom/example/Main;", "Landroid/app/Activity;",
+		builderMethod{onCreate, []uint16{
+			0x0123, uint16(array), // new-array v1, v0
+			0x021a, uint16(camera), // const-string v2
+			0x0312,         // const/4 v3, #0
+			0x024d, 0x0301, // aput-object v2, v1, v3
+			0x021a, uint16(contacts), // const-string v2
+			0x1312,         // const/4 v3, #1
+			0x024d, 0x0301, // aput-object v2, v1, v3
+			0x3071, uint16(compat), 0x0014, // invoke-static {v4, v1, v0}
+			0x000e,
+		}},
+		builderMethod{onSms, []uint16{
+			0x021a, uint16(sms), // const-string v2
+			0x1024, uint16(array), 0x0002, // filled-new-array {v2}
+			0x010c,                           // move-result-object v1
+			0x306e, uint16(activity), 0x0310, // invoke-virtual {v0, v1, v3}
+			0x000e,
+		}},
+		builderMethod{onAsk, []uint16{
+			0x306e, uint16(activity), 0x0350, // invoke-virtual {v0, v5, v3}
+			0x000e,
+		}},
+		builderMethod{onRecord, []uint16{
+			0x011a, uint16(audio), // const-string v1
+			0x206e, uint16(launch), 0x0010, // invoke-virtual {v0, v1}
+			0x000e,
+		}},
+	)
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml": string(encodeAXML(t, manifest)),
+		"classes.dex":         string(b.build()),
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := runtimePermissionsAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := section.(*RuntimePermissions)
+
+	want := []RequestedPermission{
+		{Name: "android.permission.CAMERA", Declared: true, Locations: []string{"classes.dex:Lcom/example/Main;->onCreate"}},
+		{Name: "android.permission.READ_CONTACTS", Declared: true, Locations: []string{"classes.dex:Lcom/example/Main;->onCreate"}},
+		{Name: "android.permission.RECORD_AUDIO", Locations: []string{"classes.dex:Lcom/example/Main;->onRecord"}},
+		{Name: "android.permission.SEND_SMS", Declared: true, Locations: []string{"classes.dex:Lcom/example/Main;->onSms"}},
+	}
+	if !reflect.DeepEqual(r.Requested, want) {
+		t.Errorf("expected requested permissions %+v, got %+v", want, r.Requested)
+	}
+	if want := []string{"android.permission.READ_SMS"}; !reflect.DeepEqual(r.Dormant, want) {
+		t.Errorf("expected dormant permissions %q, got %q", want, r.Dormant)
+	}
+	if want := []string{"classes.dex:Lcom/example/Main;->onAsk"}; !reflect.DeepEqual(r.Unresolved, want) {
+		t.Errorf("expected unresolved requests %q, got %q", want, r.Unresolved)
+	}
+}
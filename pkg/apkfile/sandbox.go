@@ -0,0 +1,244 @@
+package apkfile
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// Backend decides how an external tool process is launched
+type Backend interface {
+	// Wrap returns the command line that runs name with args under l. sample is
+	// the file the tool is pointed at, or empty for long lived tools that are fed
+	// many samples over their lifetime.
+	Wrap(l Limits, name string, args []string, sample string) (string, []string, error)
+}
+
+// NewBackend returns the execution backend registered under name, one of
+// local, bwrap, nsjail or docker (which runs tools in image)
+func NewBackend(name, image string) (Backend, error) {
+	switch name {
+	case "", "local":
+		return localBackend{}, nil
+	case "bwrap":
+		return bwrapBackend{}, nil
+	case "nsjail":
+		return nsjailBackend{}, nil
+	case "docker":
+		if image == "" {
+			return nil, fmt.Errorf("the docker sandbox needs --sandbox-image")
+		}
+		return dockerBackend{image: image}, nil
+	}
+	return nil, fmt.Errorf("unknown sandbox backend %q", name)
+}
+
+// localBackend runs tools directly on the host
+type localBackend struct{}
+
+func (localBackend) Wrap(l Limits, name string, args []string, sample string) (string, []string, error) {
+	name, args = limitCommand(l, name, args...)
+	return name, args, nil
+}
+
+// samplePath is the host path a sandboxed tool reads its samples from, the
+// sample or, for long lived tools fed one sample after the other, the temp
+// directory samples are written to by default. It is mounted back over the
+// sandbox's private /tmp
+func samplePath(sample string) (string, error) {
+	if sample == "" {
+		sample = os.TempDir()
+	}
+	return filepath.Abs(sample)
+}
+
+// sandboxSystemPaths are the host paths every tool may need to run, its
+// interpreter, shared libraries and, for java, the alternatives and JDK
+// configuration in /etc. The directories on the PATH are added to them, for
+// the tools helper scripts run
+var sandboxSystemPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/opt",
+	"/etc/alternatives", "/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d", "/etc/java-*",
+}
+
+// toolPaths are the host paths a tool reads besides the system ones: the
+// directory it is installed in, e.g. for trid's definitions, and the files
+// and class path entries it is given as arguments
+func toolPaths(name string, args []string) []string {
+	var paths []string
+	if path, err := exec.LookPath(name); err == nil {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			path = real
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			paths = append(paths, filepath.Dir(abs))
+		}
+	}
+	for _, arg := range args {
+		for _, path := range filepath.SplitList(arg) {
+			if path == "" {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if abs, err := filepath.Abs(path); err == nil {
+				paths = append(paths, abs)
+			}
+		}
+	}
+	return paths
+}
+
+// bwrapBackend runs tools under bubblewrap with no network, a read-only view
+// of the system directories, the tool and the sample, and a private /tmp
+type bwrapBackend struct{}
+
+func (bwrapBackend) Wrap(l Limits, name string, args []string, sample string) (string, []string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", nil, err
+	}
+	abs, err := samplePath(sample)
+	if err != nil {
+		return "", nil, err
+	}
+	tool := toolPaths(name, args)
+	name, args = limitCommand(l, name, args...)
+
+	var wrapped []string
+	for _, pattern := range append(sandboxSystemPaths, filepath.SplitList(os.Getenv("PATH"))...) {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			if path, err = filepath.Abs(path); err != nil {
+				continue
+			}
+			wrapped = append(wrapped, "--ro-bind", path, path)
+		}
+	}
+	wrapped = append(wrapped,
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--dir", cwd,
+	)
+	// after /tmp, which tools and samples may be in
+	for _, path := range tool {
+		wrapped = append(wrapped, "--ro-bind", path, path)
+	}
+	wrapped = append(wrapped,
+		"--ro-bind", abs, abs,
+		"--unshare-all",
+		"--die-with-parent",
+		"--new-session",
+		"--chdir", cwd,
+		"--", name,
+	)
+	return "bwrap", append(wrapped, args...), nil
+}
+
+// nsjailBackend runs tools under nsjail, which by default gives them an empty
+// network namespace and a read-only view of the host
+type nsjailBackend struct{}
+
+func (nsjailBackend) Wrap(l Limits, name string, args []string, sample string) (string, []string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", nil, err
+	}
+	abs, err := samplePath(sample)
+	if err != nil {
+		return "", nil, err
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		name = path
+	}
+	wrapped := []string{
+		"--mode", "o",
+		"--quiet",
+		"--chroot", "/",
+		"--cwd", cwd,
+		"--tmpfsmount", "/tmp",
+		"--bindmount_ro", abs,
+		"--time_limit", "0",
+		// nsjail enforces the limits itself, "inf" lifts its own defaults
+		"--rlimit_cpu", rlimitValue(l.CPU),
+		"--rlimit_as", rlimitValue(megabytes(l.Memory)),
+		"--rlimit_fsize", rlimitValue(megabytes(l.FileSize)),
+		"--rlimit_nproc", rlimitValue(l.NProc),
+		"--", name,
+	}
+	return "nsjail", append(wrapped, args...), nil
+}
+
+// dockerBackend runs every tool in a throw away container of image without
+// network, with only the sample mounted read-only
+type dockerBackend struct {
+	image string
+}
+
+func (d dockerBackend) Wrap(l Limits, name string, args []string, sample string) (string, []string, error) {
+	if sample == "" {
+		return "", nil, fmt.Errorf("the docker sandbox can't host long lived tools")
+	}
+	abs, err := filepath.Abs(sample)
+	if err != nil {
+		return "", nil, err
+	}
+
+	wrapped := []string{
+		"run", "--rm", "-i",
+		// an init forwards the SIGTERM docker proxies when a scan is cancelled
+		"--init",
+		"--network", "none",
+		"--read-only",
+		"--tmpfs", "/tmp",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"-v", abs + ":" + abs + ":ro",
+	}
+	if l.CPU != 0 {
+		wrapped = append(wrapped, "--ulimit", "cpu="+strconv.FormatUint(l.CPU, 10))
+	}
+	if l.Memory != 0 {
+		wrapped = append(wrapped, "--memory", strconv.FormatUint(l.Memory, 10))
+	}
+	if l.FileSize != 0 {
+		wrapped = append(wrapped, "--ulimit", "fsize="+strconv.FormatUint(l.FileSize, 10))
+	}
+	if l.NProc != 0 {
+		wrapped = append(wrapped, "--pids-limit", strconv.FormatUint(l.NProc, 10))
+	}
+	wrapped = append(wrapped, "--entrypoint", name, d.image)
+
+	// point the tool at the sample's absolute path inside the container
+	toolArgs := make([]string, len(args))
+	for i, arg := range args {
+		if arg == sample {
+			arg = abs
+		}
+		toolArgs[i] = arg
+	}
+
+	return "docker", append(wrapped, toolArgs...), nil
+}
+
+// megabytes converts a limit in bytes to the MB nsjail takes, rounding up so
+// that a limit under 1 MB doesn't become 0, i.e. unlimited
+func megabytes(v uint64) uint64 {
+	mb := v >> 20
+	if v&(1<<20-1) != 0 {
+		mb++
+	}
+	return mb
+}
+
+// rlimitValue formats a limit for nsjail where zero means unlimited
+func rlimitValue(v uint64) string {
+	if v == 0 {
+		return "inf"
+	}
+	return strconv.FormatUint(v, 10)
+}
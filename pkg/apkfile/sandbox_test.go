@@ -0,0 +1,85 @@
+package apkfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSandboxSampleUnderTmp tests that the sandboxes mount a sample in the temp directory back over their private /tmp.
+func TestSandboxSampleUnderTmp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scan_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sample := filepath.Join(dir, "sample")
+
+	for name, want := range map[Backend][]string{
+		bwrapBackend{}:  {"--tmpfs /tmp", "--ro-bind " + sample + " " + sample},
+		nsjailBackend{}: {"--tmpfsmount /tmp", "--bindmount_ro " + sample},
+	} {
+		_, args, err := name.Wrap(Limits{}, "trid", []string{sample}, sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := strings.Join(args, " ")
+		tmpfs, bind := strings.Index(line, want[0]), strings.Index(line, want[1])
+		if tmpfs < 0 || bind < tmpfs {
+			t.Errorf("%T: expected %q after %q, got %s", name, want[1], want[0], line)
+		}
+	}
+
+	// long lived tools are fed the samples written to the temp directory
+	_, args, err := bwrapBackend{}.Wrap(Limits{}, "java", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmp, _ := filepath.Abs(os.TempDir()); !strings.Contains(strings.Join(args, " "), "--ro-bind "+tmp+" "+tmp) {
+		t.Errorf("expected the temp directory to be mounted, got %q", args)
+	}
+}
+
+// TestBwrapMounts tests that bwrap only shows tools the system directories, their own directory and their arguments.
+func TestBwrapMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trid := fakeTool(t, dir, "trid", "")
+	jar := filepath.Join(dir, "apkfile.jar")
+	if err := ioutil.WriteFile(jar, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, args, err := bwrapBackend{}.Wrap(Limits{}, trid, []string{"-cp", jar + ":/nonexistent"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Join(args, " ")
+	if strings.Contains(line, "--ro-bind / /") || strings.Contains(line, "/nonexistent /nonexistent") {
+		t.Errorf("expected only the paths tools need to be mounted, got %s", line)
+	}
+	for _, want := range []string{"--ro-bind /usr /usr", "--ro-bind " + dir + " " + dir, "--ro-bind " + jar + " " + jar} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected %q, got %s", want, line)
+		}
+	}
+}
+
+// TestNsjailMemoryLimit tests that memory limits under 1 MB stay limits.
+func TestNsjailMemoryLimit(t *testing.T) {
+	_, args, err := nsjailBackend{}.Wrap(Limits{Memory: 512 << 10, FileSize: 3<<20 + 1}, "trid", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Join(args, " ")
+	for _, want := range []string{"--rlimit_as 1 ", "--rlimit_fsize 4 "} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected %q, got %s", want, line)
+		}
+	}
+}
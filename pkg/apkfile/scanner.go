@@ -0,0 +1,326 @@
+// Package apkfile extracts file metadata (libmagic, hashes, ssdeep, TRiD,
+// exiftool and apkfile.jar) from APKs and any other file.
+package apkfile
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Scanner runs the file info tools against files, it is safe for concurrent
+// use by multiple goroutines
+type Scanner struct {
+	limits     Limits
+	backend    Backend
+	magic      *magicDB
+	jvm        *apkWorker
+	apkfileJar string
+	// apkBackend produces the apk_file section, apkfile.jar or androguard
+	apkBackend       string
+	androguardHelper string
+	analyzers        []Analyzer
+	retry            RetryPolicy
+	killGrace        time.Duration
+	// tools maps tool names to the binaries run for them
+	tools        map[string]string
+	maxEntrySize int64
+	stringsLimit int
+	rawStrings   bool
+	classList    bool
+	secretRules  []SecretRule
+	// signerBlocklist is DefaultSignerBlocklist and the entries added to it
+	signerBlocklist []BlocklistEntry
+	reputation      ReputationStore
+	history         ScanHistory
+	malwareFeed     []MalwarePackage
+	quark           QuarkConfig
+	decompile       DecompileConfig
+	allowlist       HashList
+	denylist        HashList
+	policy          *Policy
+	artifacts       ArtifactStore
+	cloudProbe      *cloudProber
+	enrichment      *enricher
+}
+
+// Option configures a Scanner
+type Option func(*Scanner)
+
+// WithLimits runs every external tool under l
+func WithLimits(l Limits) Option {
+	return func(s *Scanner) {
+		s.limits = l
+	}
+}
+
+// WithBackend runs every external tool through b instead of directly on the host
+func WithBackend(b Backend) Option {
+	return func(s *Scanner) {
+		s.backend = b
+	}
+}
+
+// WithToolPath runs path whenever the scanner needs the external tool name,
+// e.g. WithToolPath("trid", "/opt/trid/trid")
+func WithToolPath(name, path string) Option {
+	return func(s *Scanner) {
+		if s.tools == nil {
+			s.tools = make(map[string]string)
+		}
+		s.tools[name] = path
+	}
+}
+
+// WithMaxEntrySize sets the largest archive entry analyzers parse, bigger
+// entries are still hashed, 0 means no limit
+func WithMaxEntrySize(n int64) Option {
+	return func(s *Scanner) {
+		s.maxEntrySize = n
+	}
+}
+
+// WithStringsLimit sets how many strings of each kind the strings section
+// lists, 0 means no limit
+func WithStringsLimit(n int) Option {
+	return func(s *Scanner) {
+		s.stringsLimit = n
+	}
+}
+
+// WithRawStrings adds every string found to the strings section
+func WithRawStrings() Option {
+	return func(s *Scanner) {
+		s.rawStrings = true
+	}
+}
+
+// WithKillGrace sets how long tools get to exit after SIGTERM when their scan is
+// cancelled before their process group is sent SIGKILL
+func WithKillGrace(d time.Duration) Option {
+	return func(s *Scanner) {
+		s.killGrace = d
+	}
+}
+
+// WithAPKWorker keeps a resident apkfile JVM running ApkfileWorker.class from
+// the classpath directory
+func WithAPKWorker(classpath string) Option {
+	return func(s *Scanner) {
+		s.jvm.classpath = classpath
+	}
+}
+
+// WithAnalyzer adds a third-party analyzer to every scan, its section is
+// reported under FileInfo.Analyzers
+func WithAnalyzer(a Analyzer) Option {
+	return func(s *Scanner) {
+		s.analyzers = append(s.analyzers, a)
+	}
+}
+
+// WithApkfileJar sets the path to apkfile.jar, it defaults to apkfile.jar in
+// the current directory
+func WithApkfileJar(path string) Option {
+	return func(s *Scanner) {
+		s.apkfileJar = path
+	}
+}
+
+// NewScanner loads the libmagic database, when there is one, and returns a
+// Scanner configured by opts
+func NewScanner(opts ...Option) (*Scanner, error) {
+	s := &Scanner{
+		backend:         localBackend{},
+		magic:           &magicDB{},
+		jvm:             &apkWorker{},
+		apkfileJar:      "apkfile.jar",
+		apkBackend:      APKBackendApkfile,
+		retry:           DefaultRetryPolicy,
+		killGrace:       2 * time.Second,
+		maxEntrySize:    DefaultMaxEntrySize,
+		stringsLimit:    DefaultStringsLimit,
+		secretRules:     DefaultSecretRules,
+		signerBlocklist: append([]BlocklistEntry(nil), DefaultSignerBlocklist...),
+	}
+	s.analyzers = builtinAnalyzers(s)
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	var err error
+	if s.secretRules, err = compileSecretRules(s.secretRules); err != nil {
+		return nil, err
+	}
+
+	if s.apkBackend != APKBackendApkfile && s.apkBackend != APKBackendAndroguard {
+		return nil, fmt.Errorf("unknown apk backend %q", s.apkBackend)
+	}
+
+	s.magic.open()
+
+	return s, nil
+}
+
+// Close releases the libmagic database and stops the apkfile JVM worker
+func (s *Scanner) Close() {
+	s.jvm.Close()
+	s.magic.close()
+}
+
+// Scan runs every available analyzer against path concurrently, each one
+// getting its own context derived from ctx. Analyzers that fail, or haven't
+// finished when ctx is done, are reported in FileInfo.Errors and the rest of
+// the report is returned as is. FileInfo.Warnings has what makes the
+// sections of the others less reliable
+func (s *Scanner) Scan(ctx context.Context, path string) (FileInfo, error) {
+	return s.scan(ctx, path, nil, nil, nil)
+}
+
+// ScanHashed is Scan for a file whose hashes were already computed, e.g. while
+// it was being written to disk
+func (s *Scanner) ScanHashed(ctx context.Context, path string, hashes FileHashes) (FileInfo, error) {
+	return s.scan(ctx, path, &hashes, nil, nil)
+}
+
+// ScanSections runs only the named analyzers against path, e.g. to refresh
+// the enrichment section of a stored report. The verdict and the policy
+// aren't applied, they need the whole report
+func (s *Scanner) ScanSections(ctx context.Context, path string, hashes FileHashes, names []string) (FileInfo, error) {
+	known := make(map[string]bool)
+	for _, a := range s.analyzers {
+		known[a.Name()] = true
+	}
+	only := make(map[string]bool)
+	for _, name := range names {
+		if !known[name] {
+			return FileInfo{}, fmt.Errorf("no %s analyzer", name)
+		}
+		only[name] = true
+	}
+	return s.scan(ctx, path, &hashes, nil, only)
+}
+
+// scan runs the analyzers against path, all of them or, when only is set,
+// the ones it holds
+func (s *Scanner) scan(ctx context.Context, path string, hashes *FileHashes, expansion *ExpansionFile, only map[string]bool) (FileInfo, error) {
+	var fileInfo FileInfo
+	now := time.Now().UTC()
+	fileInfo.ScannedAt = &now
+
+	type result struct {
+		i        int
+		section  Section
+		err      error
+		timing   Timing
+		warnings Diagnostics
+	}
+
+	if (len(s.allowlist) > 0 || len(s.denylist) > 0) && hashes == nil {
+		h, err := HashFile(path)
+		if err != nil {
+			return fileInfo, err
+		}
+		hashes = &h
+	}
+	if reason, ok := listed(s.allowlist, "allowlist", hashes); ok {
+		fileInfo.Hashes = *hashes
+		fileInfo.Verdict = &Verdict{Verdict: VerdictKnownGood, Reasons: []string{reason}}
+		return fileInfo, nil
+	}
+
+	target := &Target{Path: path, Hashes: hashes, maxEntrySize: s.maxEntrySize, expansion: expansion}
+	defer target.close()
+	fileInfo.TargetType = target.Type()
+	// buffered so analyzers still running after the deadline don't block
+	results := make(chan result, len(s.analyzers))
+	pending := make(map[int]*usage)
+
+	for i, a := range s.analyzers {
+		if only != nil && !only[a.Name()] {
+			continue
+		}
+		if !a.Available() {
+			log.Debugf("skipping %s analyzer, it is not available", a.Name())
+			continue
+		}
+		if _, ok := a.(apkSpecific); ok && fileInfo.TargetType != TargetAPK {
+			log.Debugf("skipping %s analyzer, the target is not an APK", a.Name())
+			continue
+		}
+		u := &usage{start: time.Now()}
+		pending[i] = u
+		go func(i int, a Analyzer) {
+			w := &warnings{}
+			tctx, cancel := context.WithCancel(withWarnings(withUsage(ctx, u), w))
+			defer cancel()
+			var section Section
+			var err error
+			defer func() {
+				// a parser tripping over a hostile sample only fails its analyzer
+				if p := recover(); p != nil {
+					log.Errorf("%s analyzer panicked: %v\n%s", a.Name(), p, debug.Stack())
+					section, err = nil, panicError{p}
+				}
+				results <- result{i, section, err, u.timing(), w.of(a.Name())}
+			}()
+			section, err = retryAnalyzer{a, s.retry}.Run(tctx, target)
+		}(i, a)
+	}
+
+wait:
+	for len(pending) > 0 {
+		select {
+		case r := <-results:
+			delete(pending, r.i)
+			a := s.analyzers[r.i]
+			fileInfo.setTiming(a.Name(), r.timing)
+			if r.err != nil {
+				log.WithError(r.err).Debugf("%s analyzer failed", a.Name())
+				if ctx.Err() != nil {
+					// tools killed by the deadline fail with "signal: killed"
+					r.err = ctx.Err()
+				}
+				fileInfo.setError(a.Name(), r.err, s.retry.retryable())
+			}
+			fileInfo.Warnings = append(fileInfo.Warnings, r.warnings...)
+			if r.section != nil {
+				fileInfo.setSection(a.Name(), r.section)
+			}
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	// report whatever completed, the analyzers that didn't are abandoned
+	for i, u := range pending {
+		fileInfo.setError(s.analyzers[i].Name(), ctx.Err(), nil)
+		fileInfo.setTiming(s.analyzers[i].Name(), u.timing())
+	}
+	// analyzers finish in any order
+	fileInfo.Errors.sort()
+	fileInfo.Warnings.sort()
+
+	if only != nil {
+		return fileInfo, nil
+	}
+	if reason, ok := listed(s.denylist, "denylist", hashes); ok {
+		fileInfo.flag(VerdictMalicious, "denylist", reason, Evidence{Kind: EvidenceHash, Attribute: "sha256", Value: hashes.SHA256, Detail: "SHA256 is on the hash denylist"})
+	}
+	fileInfo.judge()
+	if s.policy != nil {
+		if err := s.policy.apply(&fileInfo); err != nil {
+			fileInfo.setError("policy", err, nil)
+		}
+	}
+
+	return fileInfo, nil
+}
+
+// MimeType returns the libmagic mime-type of path
+func (s *Scanner) MimeType(ctx context.Context, path string) (string, error) {
+	return s.getFileMimeType(ctx, path)
+}
@@ -0,0 +1,125 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+type slowAnalyzer struct{}
+
+func (slowAnalyzer) Name() string    { return "slow" }
+func (slowAnalyzer) Available() bool { return true }
+
+// Run ignores ctx like a tool stuck in a syscall would
+func (slowAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	time.Sleep(time.Second)
+	return "done", nil
+}
+
+type quickAnalyzer struct{}
+
+func (quickAnalyzer) Name() string    { return "quick" }
+func (quickAnalyzer) Available() bool { return true }
+
+func (quickAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	return "done", nil
+}
+
+// TestScanPartialResults tests that a deadline returns the analyzers that finished.
+func TestScanPartialResults(t *testing.T) {
+	s := &Scanner{analyzers: []Analyzer{slowAnalyzer{}, quickAnalyzer{}}, retry: DefaultRetryPolicy}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	fileInfo, err := s.Scan(ctx, "testdata/trid.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo.Analyzers["quick"] != "done" {
+		t.Errorf("quick analyzer section missing: %#v", fileInfo.Analyzers)
+	}
+	if _, ok := fileInfo.Analyzers["slow"]; ok {
+		t.Errorf("slow analyzer should not have finished: %#v", fileInfo.Analyzers)
+	}
+	if e, _ := fileInfo.Errors.Get("slow"); e.Code != DiagnosticTimeout || !e.Retryable || !fileInfo.Partial() {
+		t.Errorf("slow analyzer should be reported as timed out: %#v", fileInfo.Errors)
+	}
+	if _, ok := fileInfo.Timings["quick"]; !ok {
+		t.Errorf("quick analyzer timing missing: %#v", fileInfo.Timings)
+	}
+	if fileInfo.Timings["slow"].Duration < 0.05 {
+		t.Errorf("slow analyzer should be timed until the deadline: %#v", fileInfo.Timings)
+	}
+}
+
+// TestRecordUsage tests that tool exit codes and peak memory reach the analyzer timing.
+func TestRecordUsage(t *testing.T) {
+	s := &Scanner{backend: localBackend{}}
+	u := &usage{start: time.Now()}
+
+	if _, err := s.runTool(withUsage(context.Background(), u), "", "sh", "-c", "exit 3"); err == nil {
+		t.Fatal("expected the tool to fail")
+	}
+
+	timing := u.timing()
+	if timing.ExitCode != 3 {
+		t.Errorf("exit code should be 3, got %d", timing.ExitCode)
+	}
+	if timing.PeakMemory <= 0 {
+		t.Errorf("peak memory should be recorded, got %d", timing.PeakMemory)
+	}
+}
+
+type apkOnlyAnalyzer struct{ quickAnalyzer }
+
+func (apkOnlyAnalyzer) Name() string { return "apk_only" }
+func (apkOnlyAnalyzer) apkOnly()     {}
+
+// TestScanTargetType tests that APK-specific analyzers only run against APKs.
+func TestScanTargetType(t *testing.T) {
+	apk := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, `<manifest package="com.example"/>`))})
+	defer os.Remove(apk)
+	jar := writeZip(t, map[string]string{"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\n"})
+	defer os.Remove(jar)
+
+	s := &Scanner{analyzers: []Analyzer{apkOnlyAnalyzer{}, quickAnalyzer{}}, retry: DefaultRetryPolicy}
+	for path, want := range map[string]string{apk: TargetAPK, jar: TargetArchive, "testdata/trid.out": TargetFile} {
+		fileInfo, err := s.Scan(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fileInfo.TargetType != want {
+			t.Errorf("expected %s to be a %s, got %q", path, want, fileInfo.TargetType)
+		}
+		if _, ran := fileInfo.Analyzers["apk_only"]; ran != (want == TargetAPK) {
+			t.Errorf("unexpected analyzers %v for a %s", fileInfo.Analyzers, want)
+		}
+		if fileInfo.Analyzers["quick"] != "done" {
+			t.Errorf("expected the generic analyzer to run against a %s, got %v", want, fileInfo.Analyzers)
+		}
+	}
+}
+
+// TestScanSections tests running only some of the analyzers.
+func TestScanSections(t *testing.T) {
+	s := &Scanner{analyzers: []Analyzer{slowAnalyzer{}, quickAnalyzer{}}, retry: DefaultRetryPolicy}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	fileInfo, err := s.ScanSections(ctx, "testdata/trid.out", FileHashes{SHA256: "c0ffee"}, []string{"quick"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo.Analyzers["quick"] != "done" || fileInfo.Partial() {
+		t.Errorf("expected only the quick analyzer to run, got %v %v", fileInfo.Analyzers, fileInfo.Errors)
+	}
+	if _, ok := fileInfo.Timings["slow"]; ok {
+		t.Errorf("expected the slow analyzer to be skipped, got %v", fileInfo.Timings)
+	}
+	if _, err := s.ScanSections(ctx, "testdata/trid.out", FileHashes{}, []string{"missing"}); err == nil {
+		t.Error("expected an unknown section to be refused")
+	}
+}
@@ -0,0 +1,150 @@
+package apkfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+)
+
+// SecretRule matches one kind of hardcoded secret
+type SecretRule struct {
+	Name string `json:"name"`
+	// Pattern is the regexp matched against every extracted string, when it
+	// has a capture group the first one is the secret
+	Pattern string `json:"pattern"`
+	// MinEntropy is the Shannon entropy in bits per character the secret
+	// needs, which weeds out placeholders like "your_api_key_here"
+	MinEntropy float64 `json:"min_entropy,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// DefaultSecretRules are the rules used unless WithSecretRules replaces them
+var DefaultSecretRules = []SecretRule{
+	{Name: "aws_access_key_id", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "aws_secret_access_key", Pattern: `(?i)aws.{0,20}?(?:secret|key).{0,20}?['":=\s]([0-9a-zA-Z/+]{40})\b`, MinEntropy: 4},
+	{Name: "google_api_key", Pattern: `\bAIza[0-9A-Za-z_\-]{35}\b`},
+	{Name: "google_oauth_client_secret", Pattern: `\bGOCSPX-[0-9A-Za-z_\-]{28}\b`},
+	{Name: "firebase_url", Pattern: `\bhttps://[a-z0-9-]+\.(?:firebaseio\.com|firebasedatabase\.app)\b`},
+	{Name: "slack_token", Pattern: `\bxox[baprs]-[0-9A-Za-z-]{10,}\b`},
+	{Name: "stripe_secret_key", Pattern: `\b(?:sk|rk)_live_[0-9a-zA-Z]{24,}\b`},
+	{Name: "github_token", Pattern: `\bgh[pousr]_[0-9A-Za-z]{36}\b`},
+	{Name: "private_key", Pattern: `-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED )?PRIVATE KEY-----`},
+	{Name: "generic_secret", Pattern: `(?i)(?:secret|api_?key|access_?token|passw(?:or)?d)["']?\s*[:=]\s*["']([0-9A-Za-z_\-+/=]{16,})["']`, MinEntropy: 3.5},
+}
+
+// LoadSecretRules reads secret rules from a JSON config file of the form
+//
+//	{"rules": [{"name": "internal_token", "pattern": "\\bitk_[0-9a-f]{32}\\b", "min_entropy": 3}]}
+func LoadSecretRules(path string) ([]SecretRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Rules []SecretRule `json:"rules"`
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for _, r := range config.Rules {
+		if r.Name == "" || r.Pattern == "" {
+			return nil, fmt.Errorf("parsing %s: every rule needs a name and a pattern", path)
+		}
+	}
+
+	return config.Rules, nil
+}
+
+// WithSecretRules replaces the rules hardcoded secrets are detected with
+func WithSecretRules(rules []SecretRule) Option {
+	return func(s *Scanner) {
+		s.secretRules = rules
+	}
+}
+
+// compileSecretRules compiles the rules' patterns
+func compileSecretRules(rules []SecretRule) ([]SecretRule, error) {
+	compiled := make([]SecretRule, len(rules))
+	for i, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("secret rule %s: %v", r.Name, err)
+		}
+		r.re = re
+		compiled[i] = r
+	}
+	return compiled, nil
+}
+
+// SecretFinding is a hardcoded secret and where it was found
+type SecretFinding struct {
+	Rule     string  `json:"rule" structs:"rule"`
+	Secret   string  `json:"secret" structs:"secret"`
+	Location string  `json:"location" structs:"location"`
+	Entropy  float64 `json:"entropy" structs:"entropy"`
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]float64)
+	n := 0.0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var e float64
+	for _, c := range counts {
+		p := c / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+type secretsAnalyzer struct{ s *Scanner }
+
+func (secretsAnalyzer) Name() string    { return "secrets" }
+func (secretsAnalyzer) Available() bool { return true }
+
+func (a secretsAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	found, err := target.extractStrings()
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []SecretFinding{}
+	seen := make(map[string]bool)
+	for _, str := range found {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, rule := range a.s.secretRules {
+			for _, m := range rule.re.FindAllStringSubmatch(str.Value, -1) {
+				secret := m[0]
+				if len(m) > 1 && m[1] != "" {
+					secret = m[1]
+				}
+				e := entropy(secret)
+				if e < rule.MinEntropy || seen[rule.Name+secret] {
+					continue
+				}
+				seen[rule.Name+secret] = true
+				findings = append(findings, SecretFinding{
+					Rule:     rule.Name,
+					Secret:   secret,
+					Location: str.Location,
+					Entropy:  math.Round(e*100) / 100,
+				})
+			}
+		}
+	}
+
+	return findings, nil
+}
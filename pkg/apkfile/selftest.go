@@ -0,0 +1,200 @@
+package apkfile
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SelfTestResult is whether an analyzer reported what it should for the
+// self-test APK
+type SelfTestResult struct {
+	Analyzer string `json:"analyzer"`
+	Passed   bool   `json:"passed"`
+	// Error is what went wrong when it didn't
+	Error string `json:"error,omitempty"`
+}
+
+// selftestSHA256 is the SHA256 of selftestAPK
+const selftestSHA256 = "fbe2dd14c6c1e07f64fc9549a841c77fe712ee9f62b6df7c025f7877cfa815ff"
+
+var ssdeepHash = regexp.MustCompile(`^\d+:[0-9A-Za-z/+]+:[0-9A-Za-z/+]+$`)
+
+// selftestGolden checks the sections of the analyzers every deployment has
+// against what they report for the self-test APK, an analyzer listed here
+// that isn't available fails the self-test
+var selftestGolden = map[string]func(fi FileInfo) error{
+	"hashes": func(fi FileInfo) error {
+		return expect("sha256", fi.Hashes.SHA256, selftestSHA256)
+	},
+	"magic": func(fi FileInfo) error {
+		for _, mime := range []string{"zip", "java-archive", "android"} {
+			if strings.Contains(fi.Magic.Mime, mime) {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected a zip mime type, got %q", fi.Magic.Mime)
+	},
+	"ssdeep": func(fi FileInfo) error {
+		if !ssdeepHash.MatchString(fi.SSDeep) {
+			return fmt.Errorf("expected a fuzzy hash, got %q", fi.SSDeep)
+		}
+		return nil
+	},
+	"trid": func(fi FileInfo) error {
+		for _, t := range fi.TRiD {
+			if t.Extension == "APK" {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected an Android Package, got %v", fi.TRiD)
+	},
+	"exiftool": func(fi FileInfo) error {
+		return expect("ZipFileName", fmt.Sprint(fi.Exiftool["ZipFileName"]), "AndroidManifest.xml")
+	},
+	"apk_file": func(fi FileInfo) error {
+		if !strings.Contains(fi.APKFile, "org.malice.selftest") {
+			return fmt.Errorf("expected the package name in %q", fi.APKFile)
+		}
+		return nil
+	},
+	"entries": func(fi FileInfo) error {
+		var names []string
+		for _, e := range fi.Entries {
+			names = append(names, e.Name)
+		}
+		return expect("entries", strings.Join(names, ", "),
+			"AndroidManifest.xml, classes.dex, res/values/strings.xml, META-INF/MANIFEST.MF, META-INF/CERT.RSA")
+	},
+	"signers": func(fi FileInfo) error {
+		if len(fi.Signers) != 1 {
+			return fmt.Errorf("expected a signer, got %d", len(fi.Signers))
+		}
+		if err := expect("subject", fi.Signers[0].Subject, "CN=Malice Self-Test, O=Malice"); err != nil {
+			return err
+		}
+		return expect("sha256", fi.Signers[0].SHA256, "0504d7da590246428d3c4e4bb1d8de80978550ba6a50d4fd6a9afa5c8c7aa7b7")
+	},
+	"packages": func(fi FileInfo) error {
+		if fi.Packages == nil || len(fi.Packages.Packages) != 1 {
+			return fmt.Errorf("expected a package, got %+v", fi.Packages)
+		}
+		return expect("package", fi.Packages.Packages[0].Name, "org.malice.selftest")
+	},
+	"intent_filters": func(fi FileInfo) error {
+		if fi.Intents == nil || len(fi.Intents.Components) != 1 {
+			return fmt.Errorf("expected a component, got %+v", fi.Intents)
+		}
+		return expect("component", fi.Intents.Components[0].Component, "org.malice.selftest.MainActivity")
+	},
+}
+
+func expect(what, got, want string) error {
+	if got != want {
+		return fmt.Errorf("expected %s %q, got %q", what, want, got)
+	}
+	return nil
+}
+
+// SelfTest scans a benign APK built into the package and checks every
+// analyzer reported what it should, to verify a deployment works. Analyzers
+// without golden values pass when they don't fail, the verdict must be clean
+func (s *Scanner) SelfTest(ctx context.Context) ([]SelfTestResult, error) {
+	apk, err := base64.StdEncoding.DecodeString(strings.Replace(selftestAPK, "\n", "", -1))
+	if err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile("", "selftest")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(apk)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := s.Scan(ctx, f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SelfTestResult
+	for _, a := range s.analyzers {
+		golden, ok := selftestGolden[a.Name()]
+		result := SelfTestResult{Analyzer: a.Name(), Passed: true}
+		failure, failed := fi.Errors.Get(a.Name())
+		switch {
+		case !a.Available():
+			if !ok {
+				continue
+			}
+			err = fmt.Errorf("not available, its tools aren't installed")
+		case failed:
+			err = fmt.Errorf("%s", failure.Message)
+		case ok:
+			err = golden(fi)
+		default:
+			err = nil
+		}
+		if err != nil {
+			result.Passed = false
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	verdict := SelfTestResult{Analyzer: "verdict", Passed: true}
+	if fi.Verdict != nil {
+		verdict.Passed = false
+		verdict.Error = fmt.Sprintf("expected no verdict for a benign APK, got %s: %s",
+			fi.Verdict.Verdict, strings.Join(fi.Verdict.Reasons, ", "))
+	}
+	return append(results, verdict), nil
+}
+
+// selftestAPK is testdata/selftest.apk, a signed APK with a launcher activity
+// and nothing else, encoded with base64 -w 76
+const selftestAPK = `
+UEsDBBQACAAIAAAAdEsAAAAAAAAAAAAAAAATAAkAQW5kcm9pZE1hbmlmZXN0LnhtbFVUBQABABsS
+WoSTvW4TXRCGnzmbn/2SONn4J4ryRSgFBQVegURBayIQSMEFAWqWeG0tWdsre2OgQS64DMQFcAkU
+XAAV4hq4D9AZHzu28YrTnPXMO8+8ZzT28Bmvg3DMDwMHXJ989gVHwD3gGTACPgKfgS/AN+An8AvY
+FTgUuC3wSOCNwAeBTwJfBb4LGAMHBrYZETNgSEKfHqf0aRHzd6ZJRFczJbok9DinxSUvF1QQkBMx
+oENMXqBZJyXiNTGpdopISenzlgdEXHDJFRmwRm/W1SfmHRl9BuTEtDTWJaJHQpuYoU5rk8wxIvUA
+Fa3pEKo6JeGCmJCh9m8rbVLrcZeQO0q+0vyQOkN958RnRuYIEfnsPQFP58gnnDtynecztq+ubM2I
+hJz3OslQK+00GyuyNm7d9cip0yYh1d8DYGPGm3g40km0GNAnoUW4UB0uqG3XBk9oqq/JW2I6Oifr
+6+QfrOWKkDMavKDJKY95qBsKY/G5BfxvRI6NyI4RyYyIIDI2Ih4iASJGAl5h9x9+u+MDVap4bvtt
+7D9gSx3jbTntNOdDMK2397bT2dvyz5b4O45v5vjG1VtWzX177raxG3ZDJOBwBWtVj9KKHmv2/+m8
+7Tr2+nWPMgV+91awNnTzJqzAMTbnWPa2rJtLrH3Hmh6rub+kKTuNOI2N2n4V169SMItyAa9awKs5
+Xq2AVy2I7xfE9wripYK4D/wZAFBLBwg6GcMCEwIAAIAFAABQSwMEFAAIAAgAAAB0SwAAAAAAAAAA
+AAAAAAsACQBjbGFzc2VzLmRleFVUBQABABsSWpSPMYrCQBiFv8kuW2yxbLUH2MpuBLFSBPvY2g/J
+KAMxCckg2nkAC0uP4FEED2NpOTLyi1r6wfDge/CGP7er726vz7t8AjXwAWwABWyl2wOJZPQH8ZEj
+cALOwEWskp1nlGzcnxKfSIYQQsyOFGrKf1o1c70whcusbm0x87b1emJcOc68Wzq/HvA1dKXzI/5S
+U+ZN5XJt6lo/+hduN/7GD34ABWqXXAcAUEsHCAd6ZASnAAAAMAEAAFBLAwQUAAgACAAAAHRLAAAA
+AAAAAAAAAAAAFgAJAHJlcy92YWx1ZXMvc3RyaW5ncy54bWxVVAUAAQAbEloASAC3/zxyZXNvdXJj
+ZXM+PHN0cmluZyBuYW1lPSJhcHBfbmFtZSI+TWFsaWNlIFNlbGYtVGVzdDwvc3RyaW5nPjwvcmVz
+b3VyY2VzPgMAUEsHCOhJzTZPAAAASAAAAFBLAwQUAAgACAAAAHRLAAAAAAAAAAAAAAAAFAAJAE1F
+VEEtSU5GL01BTklGRVNULk1GVVQFAAEAGxJaAC0A0v9NYW5pZmVzdC1WZXJzaW9uOiAxLjANCkNy
+ZWF0ZWQtQnk6IG1hbGljZQ0KDQoDAFBLBwgy8GDsNAAAAC0AAABQSwMEFAAIAAgAAAB0SwAAAAAA
+AAAAAAAAABEACQBNRVRBLUlORi9DRVJULlJTQVVUBQABABsSWpSPP0gycRzG7/f7HeerL+f7vsib
+hCBZU5r0PS3NQfqDlQ7RYAXWUBp3GVhDSjTWJUe4BS0OxRHFUU1BQ0HioEsFR4WjGC0F/XGxCBoq
+KqHWxufzwMPnARElGK1V8ktPLNJgWUQ8iCiMEeIo+P3VIFlEARBRNyzcygQjjJEVdMwvq+RXvTTB
+0MT9AZYhg7TOwPSFY5PjPFcLxndADH8/QV2Qjwn2AT6eALORhTZwODzAOZ0trmEj62wFN+euxh+u
+hcDAaD5MMKoqEaQhXRS9d+nZUhvH6s2KdKGXi/vuTdW05tU+pmzH6bnCdvw6tFpKRv308syBb+Vf
+nmae14VczX1D3j7f336VOf9+kQQo6MEWqpSC/9NL2SGVTCioOe07zO5E9C+RiEco45tXRcAWarG8
+UdjtPSmO3OVOk4qL7eyImmyZo8zoQ+UsODtV4ai3AQBQSwcIqOnar1EBAAB4AQAAUEsBAhQAFAAI
+AAgAAAB0SzoZwwITAgAAgAUAABMACQAAAAAAAAAAAAAAAAAAAEFuZHJvaWRNYW5pZmVzdC54bWxV
+VAUAAQAbElpQSwECFAAUAAgACAAAAHRLB3pkBKcAAAAwAQAACwAJAAAAAAAAAAAAAABdAgAAY2xh
+c3Nlcy5kZXhVVAUAAQAbElpQSwECFAAUAAgACAAAAHRL6EnNNk8AAABIAAAAFgAJAAAAAAAAAAAA
+AABGAwAAcmVzL3ZhbHVlcy9zdHJpbmdzLnhtbFVUBQABABsSWlBLAQIUABQACAAIAAAAdEsy8GDs
+NAAAAC0AAAAUAAkAAAAAAAAAAAAAAOIDAABNRVRBLUlORi9NQU5JRkVTVC5NRlVUBQABABsSWlBL
+AQIUABQACAAIAAAAdEuo6dqvUQEAAHgBAAARAAkAAAAAAAAAAAAAAGEEAABNRVRBLUlORi9DRVJU
+LlJTQVVUBQABABsSWlBLBQYAAAAABQAFAGwBAAD6BQAAAAA=
+`
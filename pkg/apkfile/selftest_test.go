@@ -0,0 +1,63 @@
+package apkfile
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestSelfTestAPK tests that the embedded APK is testdata/selftest.apk.
+func TestSelfTestAPK(t *testing.T) {
+	apk, err := base64.StdEncoding.DecodeString(strings.Replace(selftestAPK, "\n", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("testdata/selftest.apk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(apk) != string(want) {
+		t.Error("selftestAPK differs from testdata/selftest.apk")
+	}
+	hashes, err := HashFile("testdata/selftest.apk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes.SHA256 != selftestSHA256 {
+		t.Errorf("expected selftestSHA256 %s", hashes.SHA256)
+	}
+}
+
+// TestSelfTest tests checking the analyzers against the self-test APK.
+func TestSelfTest(t *testing.T) {
+	s, err := NewScanner(WithToolPath("trid", "/nonexistent/trid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	results, err := s.SelfTest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passed := make(map[string]bool)
+	for _, r := range results {
+		passed[r.Analyzer] = r.Passed
+		if r.Passed != (r.Error == "") {
+			t.Errorf("%s: unexpected error %q", r.Analyzer, r.Error)
+		}
+	}
+	for _, name := range []string{"hashes", "ssdeep", "entries", "signers", "packages", "intent_filters", "timestamps", "verdict"} {
+		if !passed[name] {
+			t.Errorf("expected %s to pass, got %+v", name, results)
+		}
+	}
+	if p, ok := passed["trid"]; !ok || p {
+		t.Error("expected trid to fail without its tool")
+	}
+	if _, ok := passed["quark"]; ok {
+		t.Error("expected optional analyzers that aren't available to be left out")
+	}
+}
@@ -0,0 +1,206 @@
+package apkfile
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Signer is a certificate the APK is signed with
+type Signer struct {
+	// Schemes are the APK signature schemes that carry the certificate, v1 to v3.1
+	Schemes []string `json:"schemes" structs:"schemes"`
+	// Subject and Issuer are formatted like apksigner and keytool print them,
+	// e.g. CN=Android Debug, O=Android, C=US
+	Subject            string    `json:"subject" structs:"subject"`
+	Issuer             string    `json:"issuer" structs:"issuer"`
+	SerialNumber       string    `json:"serial_number" structs:"serial_number"`
+	SHA256             string    `json:"sha256" structs:"sha256"`
+	SHA1               string    `json:"sha1" structs:"sha1"`
+	SignatureAlgorithm string    `json:"signature_algorithm" structs:"signature_algorithm"`
+	PublicKeyAlgorithm string    `json:"public_key_algorithm" structs:"public_key_algorithm"`
+	KeySize            int       `json:"key_size" structs:"key_size"`
+	NotBefore          time.Time `json:"not_before" structs:"not_before"`
+	NotAfter           time.Time `json:"not_after" structs:"not_after"`
+	// Issues are what's wrong with the certificate, e.g. a debug certificate or a weak key
+	Issues []string `json:"issues,omitempty" structs:"issues,omitempty"`
+	// Blocklisted is the signer blocklist entry the certificate matches
+	Blocklisted *BlocklistEntry `json:"blocklisted,omitempty" structs:"blocklisted,omitempty"`
+}
+
+// Signer blocklist categories
+const (
+	// BlocklistMalware is for certificates of known malware campaigns
+	BlocklistMalware = "malware"
+	// BlocklistTestKey is for keys whose private half is public, anyone can
+	// sign with them
+	BlocklistTestKey = "test_key"
+)
+
+// BlocklistEntry is a known-bad signing certificate, matched by fingerprint
+// or, for keys shared by many certificates, by subject
+type BlocklistEntry struct {
+	SHA256   string `json:"sha256,omitempty" structs:"sha256,omitempty"`
+	Subject  string `json:"subject,omitempty" structs:"subject,omitempty"`
+	Name     string `json:"name" structs:"name"`
+	Category string `json:"category" structs:"category"`
+}
+
+// DefaultSignerBlocklist are the test keys that ship with AOSP and the SDK,
+// apps signed with them can be forged by anyone, and on ROMs built with the
+// AOSP platform key get system privileges
+var DefaultSignerBlocklist = []BlocklistEntry{
+	{
+		Subject:  "EMAILADDRESS=android@android.com, CN=Android, OU=Android, O=Android, L=Mountain View, ST=California, C=US",
+		Name:     "AOSP test key (testkey, platform, shared or media)",
+		Category: BlocklistTestKey,
+	},
+	{
+		Subject:  "CN=Android Debug, O=Android, C=US",
+		Name:     "Android SDK debug key",
+		Category: BlocklistTestKey,
+	},
+}
+
+// LoadSignerBlocklist reads blocklist entries from a JSON file of the form
+//
+//	{"certificates": [{"sha256": "5f2b...", "name": "FluBot", "category": "malware"}]}
+func LoadSignerBlocklist(path string) ([]BlocklistEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Certificates []BlocklistEntry `json:"certificates"`
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for i, e := range config.Certificates {
+		if e.SHA256 == "" && e.Subject == "" {
+			return nil, fmt.Errorf("parsing %s: every certificate needs a sha256 or a subject", path)
+		}
+		if e.Category == "" {
+			config.Certificates[i].Category = BlocklistMalware
+		}
+		config.Certificates[i].SHA256 = normalizeFingerprint(e.SHA256)
+	}
+
+	return config.Certificates, nil
+}
+
+// WithSignerBlocklist adds entries to the built-in signer blocklist
+func WithSignerBlocklist(entries []BlocklistEntry) Option {
+	return func(s *Scanner) {
+		s.signerBlocklist = append(s.signerBlocklist, entries...)
+	}
+}
+
+// normalizeFingerprint accepts fingerprints as keytool prints them, e.g. 5F:2B:...
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.Replace(fp, ":", "", -1))
+}
+
+// match returns the entry cert is blocklisted by
+func match(blocklist []BlocklistEntry, s Signer) *BlocklistEntry {
+	for i, e := range blocklist {
+		if (e.SHA256 != "" && e.SHA256 == s.SHA256) || (e.Subject != "" && e.Subject == s.Subject) {
+			return &blocklist[i]
+		}
+	}
+	return nil
+}
+
+// rdnNames are the attribute type names apksigner prints
+var rdnNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.5":                    "SERIALNUMBER",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "STREET",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.12":                   "T",
+	"1.2.840.113549.1.9.1":       "EMAILADDRESS",
+	"0.9.2342.19200300.100.1.25": "DC",
+}
+
+// distinguishedName formats a name with the most specific attribute first
+// the way apksigner and keytool print it
+func distinguishedName(raw []byte) string {
+	var rdns pkix.RDNSequence
+	if _, err := asn1.Unmarshal(raw, &rdns); err != nil {
+		return ""
+	}
+	var parts []string
+	for i := len(rdns) - 1; i >= 0; i-- {
+		for _, atv := range rdns[i] {
+			name, ok := rdnNames[atv.Type.String()]
+			if !ok {
+				name = "OID." + atv.Type.String()
+			}
+			parts = append(parts, fmt.Sprintf("%s=%v", name, atv.Value))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func newSigner(cert *x509.Certificate) Signer {
+	sha256sum := sha256.Sum256(cert.Raw)
+	sha1sum := sha1.Sum(cert.Raw)
+	return Signer{
+		Subject:            distinguishedName(cert.RawSubject),
+		Issuer:             distinguishedName(cert.RawIssuer),
+		SerialNumber:       cert.SerialNumber.Text(16),
+		SHA256:             hex.EncodeToString(sha256sum[:]),
+		SHA1:               hex.EncodeToString(sha1sum[:]),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		PublicKeyAlgorithm: cert.PublicKeyAlgorithm.String(),
+		KeySize:            keySize(cert),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+	}
+}
+
+type signersAnalyzer struct{ s *Scanner }
+
+func (signersAnalyzer) Name() string    { return "signers" }
+func (signersAnalyzer) Available() bool { return true }
+
+func (a signersAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	certs, err := target.signingCerts()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signers := []Signer{}
+	index := make(map[string]int)
+	now := time.Now()
+	for _, c := range certs {
+		s := newSigner(c.cert)
+		i, ok := index[s.SHA256]
+		if !ok {
+			s.Issues = certIssues(c.cert, now)
+			s.Blocklisted = match(a.s.signerBlocklist, s)
+			signers = append(signers, s)
+			i = len(signers) - 1
+			index[s.SHA256] = i
+		}
+		signers[i].Schemes = appendUnique(signers[i].Schemes, c.scheme)
+	}
+	return signers, nil
+}
@@ -0,0 +1,196 @@
+package apkfile
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// aospTestKeySubject is the subject of the AOSP test keys
+var aospTestKeySubject = pkix.Name{
+	Country:            []string{"US"},
+	Province:           []string{"California"},
+	Locality:           []string{"Mountain View"},
+	Organization:       []string{"Android"},
+	OrganizationalUnit: []string{"Android"},
+	CommonName:         "Android",
+	ExtraNames:         []pkix.AttributeTypeAndValue{{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}, Value: "android@android.com"}},
+}
+
+// selfSignedCert returns a DER certificate for subject
+func selfSignedCert(t *testing.T, subject pkix.Name) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      subject,
+		NotBefore:    time.Date(2008, 2, 29, 1, 33, 46, 0, time.UTC),
+		NotAfter:     time.Date(2035, 7, 17, 1, 33, 46, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func mustParseCert(t *testing.T, der []byte) *x509.Certificate {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// pkcs7SignedData wraps certs in a PKCS #7 SignedData without signer infos
+func pkcs7SignedData(t *testing.T, certs ...[]byte) []byte {
+	var all []byte
+	for _, c := range certs {
+		all = append(all, c...)
+	}
+	sd, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+		ContentInfo:      struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: all},
+		SignerInfos:      asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// addSigningBlock inserts an APK Signing Block with a v2 or v3 signer of
+// certs before the central directory of the zip at path
+func addSigningBlock(t *testing.T, path string, id uint32, certs ...[]byte) {
+	lp := func(parts ...[]byte) []byte {
+		var b []byte
+		for _, p := range parts {
+			b = binary.LittleEndian.AppendUint32(b, uint32(len(p)))
+			b = append(b, p...)
+		}
+		return b
+	}
+	var certSeq []byte
+	for _, c := range certs {
+		certSeq = append(certSeq, lp(c)...)
+	}
+	signedData := append(append(lp(nil), lp(certSeq)...), lp(nil)...)
+	signer := append(append(lp(signedData), lp(nil)...), lp(nil)...)
+	value := lp(lp(signer))
+
+	pairs := binary.LittleEndian.AppendUint64(nil, uint64(len(value)+4))
+	pairs = binary.LittleEndian.AppendUint32(pairs, id)
+	pairs = append(pairs, value...)
+	size := uint64(len(pairs) + 24)
+	block := binary.LittleEndian.AppendUint64(nil, size)
+	block = append(block, pairs...)
+	block = binary.LittleEndian.AppendUint64(block, size)
+	block = append(block, apkSigBlockMagic...)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eocd := len(data) - eocdSize
+	cdOffset := binary.LittleEndian.Uint32(data[eocd+16:])
+	out := append(append(append([]byte(nil), data[:cdOffset]...), block...), data[cdOffset:]...)
+	binary.LittleEndian.PutUint32(out[eocd+len(block)+16:], cdOffset+uint32(len(block)))
+	if err := ioutil.WriteFile(path, out, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSignersAnalyzer tests the v1, v2 and v3 signer extraction and the blocklist.
+func TestSignersAnalyzer(t *testing.T) {
+	testKey := selfSignedCert(t, aospTestKeySubject)
+	campaign := selfSignedCert(t, pkix.Name{CommonName: "Flash Player Update", Organization: []string{"Adobe"}})
+	sum := sha256.Sum256(campaign)
+	fingerprint := strings.ToUpper(hex.EncodeToString(sum[:2])) + ":" + hex.EncodeToString(sum[2:])
+
+	blocklist, err := ioutil.TempFile("", "blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(blocklist.Name())
+	blocklist.WriteString(`{"certificates": [{"sha256": "` + fingerprint + `", "name": "fake Flash campaign"}]}`)
+	blocklist.Close()
+	entries, err := LoadSignerBlocklist(blocklist.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{}
+	WithSignerBlocklist(append(DefaultSignerBlocklist, entries...))(s)
+
+	path := writeZip(t, map[string]string{
+		"classes.dex":       "dex\n035\x00",
+		"META-INF/CERT.SF":  "Signature-Version: 1.0\r\n",
+		"META-INF/CERT.RSA": string(pkcs7SignedData(t, testKey)),
+	})
+	defer os.Remove(path)
+	addSigningBlock(t, path, apkSignatureV3, testKey, campaign)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := signersAnalyzer{s}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signers := section.([]Signer)
+	if len(signers) != 2 {
+		t.Fatalf("expected 2 signers, got %#v", signers)
+	}
+
+	aosp := signers[0]
+	if !reflect.DeepEqual(aosp.Schemes, []string{"v1", "v3"}) || aosp.Subject != DefaultSignerBlocklist[0].Subject ||
+		aosp.Blocklisted == nil || aosp.Blocklisted.Category != BlocklistTestKey || aosp.SerialNumber != "2a" {
+		t.Errorf("unexpected test key signer %#v", aosp)
+	}
+	flash := signers[1]
+	if flash.Subject != "CN=Flash Player Update, O=Adobe" || flash.Blocklisted == nil || flash.Blocklisted.Category != BlocklistMalware {
+		t.Errorf("unexpected campaign signer %#v", flash)
+	}
+
+	var fi FileInfo
+	fi.setSection("signers", section)
+	fi.judge()
+	if fi.Verdict == nil || fi.Verdict.Verdict != VerdictMalicious || len(fi.Verdict.Reasons) != 2 {
+		t.Fatalf("unexpected verdict %#v", fi.Verdict)
+	}
+	// each signer is pointed at by the field its blocklist entry matched
+	evidence := fi.Verdict.Evidence
+	if len(evidence) != 2 || evidence[0].Flag != "blocklisted_signer" || evidence[0].Attribute != "subject" || evidence[0].Value != aosp.Subject ||
+		evidence[1].Attribute != "sha256" || evidence[1].Value != flash.SHA256 {
+		t.Errorf("unexpected evidence %#v", evidence)
+	}
+}
@@ -0,0 +1,285 @@
+package apkfile
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// signingCert is a certificate an APK is signed with and the signature
+// scheme that carries it
+type signingCert struct {
+	scheme string
+	cert   *x509.Certificate
+}
+
+type signingCerts struct {
+	once  sync.Once
+	certs []signingCert
+	err   error
+}
+
+// signingCerts returns the certificates of the target's v1 JAR signatures and
+// of its v2 and v3 APK Signing Block, the same certificate can be in several
+func (t *Target) signingCerts() ([]signingCert, error) {
+	t.signing.once.Do(func() {
+		a, err := t.Archive()
+		if err != nil {
+			t.signing.err = err
+			return
+		}
+		for _, f := range a.File {
+			if !isJARSignature(f.Name) || !a.Analyzable(f) {
+				continue
+			}
+			data, err := a.ReadEntry(f)
+			if err != nil {
+				t.signing.err = fmt.Errorf("%s: %v", f.Name, err)
+				return
+			}
+			certs, err := pkcs7Certificates(data)
+			if err != nil {
+				t.signing.err = fmt.Errorf("%s: %v", f.Name, err)
+				return
+			}
+			for _, c := range certs {
+				t.signing.certs = append(t.signing.certs, signingCert{"v1", c})
+			}
+		}
+
+		block, err := readSigningBlock(t.Path)
+		if err != nil {
+			t.signing.err = err
+			return
+		}
+		for _, s := range []struct {
+			id     uint32
+			scheme string
+		}{{apkSignatureV2, "v2"}, {apkSignatureV3, "v3"}, {apkSignatureV31, "v3.1"}} {
+			certs, err := signatureSchemeCerts(block[s.id])
+			if err != nil {
+				t.signing.err = fmt.Errorf("%s signature: %v", s.scheme, err)
+				return
+			}
+			for _, c := range certs {
+				t.signing.certs = append(t.signing.certs, signingCert{s.scheme, c})
+			}
+		}
+	})
+	return t.signing.certs, t.signing.err
+}
+
+// isJARSignature reports whether name is a v1 signature block
+func isJARSignature(name string) bool {
+	if path.Dir(name) != "META-INF" {
+		return false
+	}
+	switch strings.ToUpper(path.Ext(name)) {
+	case ".RSA", ".DSA", ".EC":
+		return true
+	}
+	return false
+}
+
+// pkcs7Certificates returns the certificates of a PKCS #7 SignedData
+func pkcs7Certificates(der []byte) ([]*x509.Certificate, error) {
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	}
+	var sd struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+		CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+		SignerInfos      asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for rest := sd.Certificates.Bytes; len(rest) > 0; {
+		var raw asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &raw); err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// IDs of the APK Signing Block pairs
+const (
+	apkSignatureV2  = 0x7109871a
+	apkSignatureV3  = 0xf05368c0
+	apkSignatureV31 = 0x1b93ad61
+)
+
+const (
+	apkSigBlockMagic = "APK Sig Block 42"
+	// maxSigningBlock keeps a corrupt block size from being read into memory
+	maxSigningBlock = 16 << 20
+	eocdSize        = 22
+)
+
+var errBadSigningBlock = errors.New("malformed APK Signing Block")
+
+// readSigningBlock returns the values of the APK Signing Block that sits
+// right before the zip central directory by ID, nil for v1 only APKs
+func readSigningBlock(name string) (map[uint32][]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// the end of central directory record is followed by up to 64KB of comment
+	tailSize := int64(eocdSize + 0xffff)
+	if tailSize > info.Size() {
+		tailSize = info.Size()
+	}
+	tail := make([]byte, tailSize)
+	if _, err := f.ReadAt(tail, info.Size()-tailSize); err != nil {
+		return nil, err
+	}
+	eocd := -1
+	for i := len(tail) - eocdSize; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) == 0x06054b50 {
+			eocd = i
+			break
+		}
+	}
+	if eocd < 0 {
+		return nil, ErrNotArchive
+	}
+	cdOffset := int64(binary.LittleEndian.Uint32(tail[eocd+16:]))
+	if cdOffset < 24 || cdOffset > info.Size() {
+		return nil, nil
+	}
+
+	footer := make([]byte, 24)
+	if _, err := f.ReadAt(footer, cdOffset-24); err != nil {
+		return nil, err
+	}
+	if string(footer[8:]) != apkSigBlockMagic {
+		return nil, nil
+	}
+	size := int64(binary.LittleEndian.Uint64(footer))
+	if size < 24 || size > maxSigningBlock || size+8 > cdOffset {
+		return nil, errBadSigningBlock
+	}
+	// the pairs are between the leading and trailing copies of the size
+	block := make([]byte, size-24)
+	if _, err := f.ReadAt(block, cdOffset-size); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	pairs := make(map[uint32][]byte)
+	for len(block) > 0 {
+		if len(block) < 12 {
+			return nil, errBadSigningBlock
+		}
+		n := binary.LittleEndian.Uint64(block)
+		if n < 4 || n > uint64(len(block)-8) {
+			return nil, errBadSigningBlock
+		}
+		pairs[binary.LittleEndian.Uint32(block[8:])] = block[12 : 8+n]
+		block = block[8+n:]
+	}
+	return pairs, nil
+}
+
+// lengthPrefixed splits a sequence of uint32 length-prefixed values
+func lengthPrefixed(data []byte) ([][]byte, error) {
+	var values [][]byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errBadSigningBlock
+		}
+		n := binary.LittleEndian.Uint32(data)
+		if uint64(n) > uint64(len(data)-4) {
+			return nil, errBadSigningBlock
+		}
+		values = append(values, data[4:4+n])
+		data = data[4+n:]
+	}
+	return values, nil
+}
+
+// field returns the length-prefixed value at the start of data
+func field(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errBadSigningBlock
+	}
+	n := binary.LittleEndian.Uint32(data)
+	if uint64(n) > uint64(len(data)-4) {
+		return nil, errBadSigningBlock
+	}
+	return data[4 : 4+n], nil
+}
+
+// signatureSchemeCerts returns the certificates of a v2 or v3 signature
+// scheme block, a sequence of signers each with signed data of digests
+// followed by certificates
+func signatureSchemeCerts(value []byte) ([]*x509.Certificate, error) {
+	if value == nil {
+		return nil, nil
+	}
+	signersField, err := field(value)
+	if err != nil {
+		return nil, err
+	}
+	signers, err := lengthPrefixed(signersField)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for _, signer := range signers {
+		signedData, err := field(signer)
+		if err != nil {
+			return nil, err
+		}
+		digests, err := field(signedData)
+		if err != nil {
+			return nil, err
+		}
+		certsField, err := field(signedData[4+len(digests):])
+		if err != nil {
+			return nil, err
+		}
+		ders, err := lengthPrefixed(certsField)
+		if err != nil {
+			return nil, err
+		}
+		for _, der := range ders {
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
@@ -0,0 +1,74 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffType tells the mime-type, or a textual description, of the file types
+// samples come as without libmagic. Anything else is left to
+// http.DetectContentType
+func sniffType(path string, describe bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	mimetype, desc := "", ""
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		mimetype, desc = sniffZip(path)
+	case bytes.HasPrefix(head, []byte("dex\n")) && len(head) >= 8:
+		mimetype = "application/vnd.android.dex"
+		desc = "Dalvik dex file version " + strings.TrimRight(string(head[4:8]), "\x00")
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		mimetype, desc = "application/x-executable", "ELF"
+	default:
+		mimetype, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+		desc = mimetype
+		if n == 0 {
+			mimetype, desc = "application/x-empty", "empty"
+		}
+	}
+	if describe {
+		return desc, nil
+	}
+	return mimetype, nil
+}
+
+// sniffZip tells APKs and JARs from other zip archives by their entries
+func sniffZip(path string) (string, string) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return "application/zip", "Zip archive data"
+	}
+	defer r.Close()
+
+	jar := false
+	for _, f := range r.File {
+		switch f.Name {
+		case "AndroidManifest.xml", "classes.dex":
+			return "application/vnd.android.package-archive", "Android package (APK)"
+		case "META-INF/MANIFEST.MF":
+			jar = true
+		}
+	}
+	if jar {
+		return "application/java-archive", "Java archive data (JAR)"
+	}
+	return "application/zip", fmt.Sprintf("Zip archive data, %d entries", len(r.File))
+}
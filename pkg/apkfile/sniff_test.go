@@ -0,0 +1,45 @@
+package apkfile
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestSniffType tests telling file types without libmagic.
+func TestSniffType(t *testing.T) {
+	apk := writeZip(t, map[string]string{"AndroidManifest.xml": "manifest", "classes.dex": "dex\n035\x00"})
+	defer os.Remove(apk)
+	jar := writeZip(t, map[string]string{"META-INF/MANIFEST.MF": "Manifest-Version: 1.0"})
+	defer os.Remove(jar)
+	dex, err := ioutil.TempFile("", "dex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dex.WriteString("dex\n035\x00" + string(make([]byte, 104)))
+	dex.Close()
+	defer os.Remove(dex.Name())
+	text, err := ioutil.TempFile("", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text.WriteString("just some notes\n")
+	text.Close()
+	defer os.Remove(text.Name())
+
+	for _, tt := range []struct {
+		path, mime, desc string
+	}{
+		{apk, "application/vnd.android.package-archive", "Android package (APK)"},
+		{jar, "application/java-archive", "Java archive data (JAR)"},
+		{dex.Name(), "application/vnd.android.dex", "Dalvik dex file version 035"},
+		{text.Name(), "text/plain", "text/plain"},
+	} {
+		if mime, err := sniffType(tt.path, false); err != nil || mime != tt.mime {
+			t.Errorf("expected %s, got %s %v", tt.mime, mime, err)
+		}
+		if desc, err := sniffType(tt.path, true); err != nil || desc != tt.desc {
+			t.Errorf("expected %s, got %s %v", tt.desc, desc, err)
+		}
+	}
+}
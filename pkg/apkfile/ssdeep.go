@@ -0,0 +1,145 @@
+package apkfile
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// the constants of ssdeep's context triggered piecewise hashing
+const (
+	ssdeepWindow    = 7
+	ssdeepMinBlock  = 3
+	ssdeepLength    = 64
+	ssdeepHashInit  = 0x28021967
+	ssdeepHashPrime = 0x01000193
+	ssdeepBase64    = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+// rollingHash is ssdeep's rolling hash over the last 7 bytes, which triggers
+// the ends of the pieces
+type rollingHash struct {
+	window     [ssdeepWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *rollingHash) roll(c byte) uint32 {
+	r.h2 -= r.h1
+	r.h2 += ssdeepWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%ssdeepWindow])
+	r.window[r.n%ssdeepWindow] = c
+	r.n++
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+	return r.h1 + r.h2 + r.h3
+}
+
+// SSDeepFile computes the ssdeep fuzzy hash of a file, the same one the
+// ssdeep tool prints
+func SSDeepFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return SSDeep(f, info.Size())
+}
+
+// SSDeep computes the ssdeep fuzzy hash of the size bytes of r. The block
+// size is guessed from the size and halved, reading r again, while the
+// digest is too short to compare
+func SSDeep(r io.ReadSeeker, size int64) (string, error) {
+	blockSize := uint32(ssdeepMinBlock)
+	for int64(blockSize)*ssdeepLength < size {
+		blockSize *= 2
+	}
+	for {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		d := ssdeepDigest{blockSize: blockSize}
+		if err := d.write(r); err != nil {
+			return "", err
+		}
+		if blockSize > ssdeepMinBlock && d.n1 < ssdeepLength/2 {
+			blockSize /= 2
+			continue
+		}
+		return d.String(), nil
+	}
+}
+
+// ssdeepDigest hashes pieces of blockSize and twice blockSize on average
+type ssdeepDigest struct {
+	blockSize uint32
+	roll      rollingHash
+	// h1 and h2 are the FNV hashes of the current pieces
+	h1, h2 uint32
+	// d1 and d2 are the digests so far, a piece's hash goes into the last
+	// character until the next one once they are full
+	d1     [ssdeepLength]byte
+	d2     [ssdeepLength / 2]byte
+	n1, n2 int
+}
+
+func (d *ssdeepDigest) write(r io.Reader) error {
+	d.h1, d.h2 = ssdeepHashInit, ssdeepHashInit
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, c := range buf[:n] {
+			d.h1 = d.h1*ssdeepHashPrime ^ uint32(c)
+			d.h2 = d.h2*ssdeepHashPrime ^ uint32(c)
+			h := d.roll.roll(c)
+			if h%d.blockSize != d.blockSize-1 {
+				continue
+			}
+			d.d1[d.n1] = ssdeepBase64[d.h1%64]
+			if d.n1 < len(d.d1)-1 {
+				d.h1 = ssdeepHashInit
+				d.n1++
+			}
+			if h%(d.blockSize*2) != d.blockSize*2-1 {
+				continue
+			}
+			d.d2[d.n2] = ssdeepBase64[d.h2%64]
+			if d.n2 < len(d.d2)-1 {
+				d.h2 = ssdeepHashInit
+				d.n2++
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// String is the hash, blocksize:digest:digest of twice the block size. The
+// pieces still open at the end are hashed unless the rolling hash is 0
+func (d *ssdeepDigest) String() string {
+	n1, n2 := d.n1, d.n2
+	if d.roll.h1+d.roll.h2+d.roll.h3 != 0 {
+		d.d1[n1] = ssdeepBase64[d.h1%64]
+		d.d2[n2] = ssdeepBase64[d.h2%64]
+		n1++
+		n2++
+	} else {
+		// a full digest keeps its last piece
+		if d.d1[n1] != 0 {
+			n1++
+		}
+		if d.d2[n2] != 0 {
+			n2++
+		}
+	}
+	return fmt.Sprintf("%d:%s:%s", d.blockSize, d.d1[:n1], d.d2[:n2])
+}
@@ -0,0 +1,38 @@
+package apkfile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestSSDeep tests computing the fuzzy hashes the ssdeep tool prints.
+func TestSSDeep(t *testing.T) {
+	for _, tt := range []struct {
+		data, hash string
+	}{
+		{"Also called fuzzy hashes, Ctph can match inputs that have homologies.", "3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C"},
+		{"Also called fuzzy hashes, CTPH can match inputs that have homologies.", "3:AXGBicFlIHBGcL6wCrFQEv:AXGH6xLsr2C"},
+		{"", "3::"},
+		// nothing triggers a piece, the guessed block size is halved down to 3
+		{string(make([]byte, 10000)), "3::"},
+	} {
+		hash, err := SSDeep(strings.NewReader(tt.data), int64(len(tt.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != tt.hash {
+			t.Errorf("expected %s, got %s", tt.hash, hash)
+		}
+	}
+
+	// the block size of larger inputs is guessed from their size
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 2000)
+	hash, err := SSDeep(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ssdeepHash.MatchString(hash) || strings.HasPrefix(hash, "3:") {
+		t.Errorf("unexpected hash %s", hash)
+	}
+}
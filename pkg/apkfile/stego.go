@@ -0,0 +1,281 @@
+package apkfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"math"
+	"path"
+	"strings"
+)
+
+// StegoImage is an image asset that may carry hidden data
+type StegoImage struct {
+	Path     string         `json:"path" structs:"path"`
+	Format   string         `json:"format" structs:"format"`
+	Findings []StegoFinding `json:"findings" structs:"findings"`
+}
+
+// StegoFinding is where in an image data may be hidden, with the offset and
+// length to carve it from
+type StegoFinding struct {
+	Kind        string `json:"kind" structs:"kind"`
+	Offset      int64  `json:"offset" structs:"offset"`
+	Length      int64  `json:"length,omitempty" structs:"length,omitempty"`
+	Description string `json:"description" structs:"description"`
+}
+
+// Stego finding kinds
+const (
+	StegoAppended     = "appended_data"
+	StegoMalformed    = "malformed"
+	StegoBadCRC       = "bad_crc"
+	StegoUnknownChunk = "unknown_chunk"
+	StegoLargeChunk   = "large_chunk"
+	StegoLSB          = "lsb_random"
+)
+
+const (
+	// maxMetadataSize is the largest text chunk or JPEG segment that isn't
+	// suspicious, EXIF and ICC profiles stay well below it
+	maxMetadataSize = 64 << 10
+	// minLSBSamples is how many channel samples an image needs for its
+	// least significant bits to be judged
+	minLSBSamples = 4096
+	// maxLSBPixels keeps huge images from being decoded
+	maxLSBPixels = 16 << 20
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngChunks are the registered PNG chunks, the APNG ones and the ones
+// aapt adds to nine-patch images
+var pngChunks = map[string]bool{
+	"IHDR": true, "PLTE": true, "IDAT": true, "IEND": true,
+	"tRNS": true, "cHRM": true, "gAMA": true, "iCCP": true, "sBIT": true, "sRGB": true,
+	"cICP": true, "mDCV": true, "cLLI": true, "tEXt": true, "zTXt": true, "iTXt": true,
+	"bKGD": true, "hIST": true, "pHYs": true, "sPLT": true, "eXIf": true, "tIME": true,
+	"acTL": true, "fcTL": true, "fdAT": true,
+	"npTc": true, "npLb": true, "npOl": true,
+}
+
+type stegoAnalyzer struct{}
+
+func (stegoAnalyzer) Name() string    { return "stego" }
+func (stegoAnalyzer) Available() bool { return true }
+
+func (stegoAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	a, err := target.Archive()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var images []StegoImage
+	for _, f := range a.File {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(f.Name, "assets/") && !strings.HasPrefix(f.Name, "res/") || !a.Analyzable(f) {
+			continue
+		}
+		var check func([]byte) []StegoFinding
+		var format string
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".png":
+			format, check = "png", checkPNG
+		case ".jpg", ".jpeg":
+			format, check = "jpeg", checkJPEG
+		default:
+			continue
+		}
+		data, err := a.ReadEntry(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		if findings := check(data); len(findings) > 0 {
+			images = append(images, StegoImage{Path: f.Name, Format: format, Findings: findings})
+		}
+	}
+	if len(images) == 0 {
+		return nil, nil
+	}
+	return images, nil
+}
+
+// checkPNG walks the chunks of a PNG, and looks at the least significant
+// bits of its pixels
+func checkPNG(data []byte) []StegoFinding {
+	if !bytes.HasPrefix(data, pngSignature) {
+		// the suspicious_entries section reports .png files that aren't PNGs
+		return nil
+	}
+	var findings []StegoFinding
+	firstIDAT := int64(-1)
+	off := len(pngSignature)
+	for {
+		if off+12 > len(data) {
+			findings = append(findings, StegoFinding{StegoMalformed, int64(off), int64(len(data) - off), "truncated before IEND"})
+			return findings
+		}
+		length := int(binary.BigEndian.Uint32(data[off:]))
+		typ := string(data[off+4 : off+8])
+		end := off + 12 + length
+		if end > len(data) {
+			findings = append(findings, StegoFinding{StegoMalformed, int64(off), int64(len(data) - off), fmt.Sprintf("%q chunk of %d bytes runs past the end", typ, length)})
+			return findings
+		}
+		if crc32.ChecksumIEEE(data[off+4:end-4]) != binary.BigEndian.Uint32(data[end-4:]) {
+			findings = append(findings, StegoFinding{StegoBadCRC, int64(off), int64(end - off), fmt.Sprintf("%q chunk with a wrong CRC", typ)})
+		}
+		switch {
+		case !pngChunks[typ]:
+			findings = append(findings, StegoFinding{StegoUnknownChunk, int64(off), int64(end - off), fmt.Sprintf("unknown %q chunk of %d bytes", typ, length)})
+		case (typ == "tEXt" || typ == "zTXt" || typ == "iTXt") && length > maxMetadataSize:
+			findings = append(findings, StegoFinding{StegoLargeChunk, int64(off), int64(end - off), fmt.Sprintf("%s chunk of %d bytes", typ, length)})
+		case typ == "IDAT" && firstIDAT < 0:
+			firstIDAT = int64(off)
+		}
+		off = end
+		if typ == "IEND" {
+			break
+		}
+	}
+	if off < len(data) {
+		findings = append(findings, StegoFinding{StegoAppended, int64(off), int64(len(data) - off), fmt.Sprintf("%d bytes after IEND", len(data)-off)})
+	}
+
+	if firstIDAT >= 0 && randomLSBs(data) {
+		findings = append(findings, StegoFinding{StegoLSB, firstIDAT, 0, "the least significant bits are random while the image is smooth"})
+	}
+	return findings
+}
+
+// randomLSBs reports whether the least significant bits of an image look
+// like encrypted data while the rest of the image is smooth, as when they
+// were replaced with a payload. The bits of natural graphics follow the
+// image, so neighbouring pixels mostly agree on them
+func randomLSBs(data []byte) bool {
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxLSBPixels {
+		return false
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+
+	var pix []uint8
+	var stride, channels int
+	switch i := img.(type) {
+	case *image.NRGBA:
+		pix, stride, channels = i.Pix, i.Stride, 4
+	case *image.RGBA:
+		pix, stride, channels = i.Pix, i.Stride, 4
+	case *image.Gray:
+		pix, stride, channels = i.Pix, i.Stride, 1
+	default:
+		// palette indices and 16-bit samples aren't checked
+		return false
+	}
+	colors := channels
+	if channels == 4 {
+		// alpha is usually flat and would dilute the color channels
+		colors = 3
+	}
+
+	b := img.Bounds()
+	var samples, ones, lsbAgree, restAgree int
+	for y := 0; y < b.Dy(); y++ {
+		row := pix[y*stride:]
+		for x := 1; x < b.Dx(); x++ {
+			for c := 0; c < colors; c++ {
+				v, left := row[x*channels+c], row[(x-1)*channels+c]
+				samples++
+				ones += int(v & 1)
+				if v&1 == left&1 {
+					lsbAgree++
+				}
+				if v>>1 == left>>1 {
+					restAgree++
+				}
+			}
+		}
+	}
+	if samples < minLSBSamples {
+		return false
+	}
+	p := float64(ones) / float64(samples)
+	if p == 0 || p == 1 {
+		return false
+	}
+	bitEntropy := -p*math.Log2(p) - (1-p)*math.Log2(1-p)
+	agree := float64(lsbAgree) / float64(samples)
+	smooth := float64(restAgree) / float64(samples)
+	return bitEntropy > 0.99 && math.Abs(agree-0.5) < 0.02 && smooth > 0.5
+}
+
+// checkJPEG walks the segments of a JPEG up to the end of its scan
+func checkJPEG(data []byte) []StegoFinding {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return nil
+	}
+	var findings []StegoFinding
+	off := 2
+	for {
+		if off+2 > len(data) || data[off] != 0xff {
+			return append(findings, StegoFinding{StegoMalformed, int64(off), int64(len(data) - off), "no valid marker"})
+		}
+		marker := data[off+1]
+		if marker == 0xd9 {
+			off += 2
+			break
+		}
+		switch {
+		case marker == 0xff:
+			// fill bytes
+			off++
+			continue
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			// markers without a segment
+			off += 2
+			continue
+		case off+4 > len(data):
+			return append(findings, StegoFinding{StegoMalformed, int64(off), int64(len(data) - off), "truncated before EOI"})
+		}
+		length := int(binary.BigEndian.Uint16(data[off+2:]))
+		end := off + 2 + length
+		if length < 2 || end > len(data) {
+			return append(findings, StegoFinding{StegoMalformed, int64(off), int64(len(data) - off), fmt.Sprintf("segment 0x%02x runs past the end", marker)})
+		}
+		if (marker >= 0xe0 && marker <= 0xef || marker == 0xfe) && length > maxMetadataSize {
+			findings = append(findings, StegoFinding{StegoLargeChunk, int64(off), int64(end - off), fmt.Sprintf("segment 0x%02x of %d bytes", marker, length)})
+		}
+		off = end
+		if marker != 0xda {
+			continue
+		}
+		// the entropy coded scan ends at the first marker that isn't a
+		// stuffed 0xff00 or a restart marker
+		for off+1 < len(data) && !(data[off] == 0xff && data[off+1] != 0 && (data[off+1] < 0xd0 || data[off+1] > 0xd7)) {
+			off++
+		}
+		if off+1 >= len(data) {
+			return append(findings, StegoFinding{StegoMalformed, int64(off), 0, "truncated before EOI"})
+		}
+	}
+	if off < len(data) {
+		desc := fmt.Sprintf("%d bytes after EOI", len(data)-off)
+		if bytes.HasPrefix(data[off:], []byte{0xff, 0xd8}) {
+			desc += ", another JPEG as in multi-picture files"
+		}
+		findings = append(findings, StegoFinding{StegoAppended, int64(off), int64(len(data) - off), desc})
+	}
+	return findings
+}
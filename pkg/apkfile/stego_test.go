@@ -0,0 +1,112 @@
+package apkfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// blockyImage returns a 128x128 image of flat colored blocks, like UI graphics
+func blockyImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x / 32 * 60), uint8(y / 32 * 60), 200, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// insertChunk adds a chunk right after IHDR
+func insertChunk(data []byte, typ string, body []byte, crc uint32) []byte {
+	chunk := make([]byte, 8, 12+len(body))
+	binary.BigEndian.PutUint32(chunk, uint32(len(body)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, body...)
+	if crc == 0 {
+		crc = crc32.ChecksumIEEE(chunk[4:])
+	}
+	chunk = binary.BigEndian.AppendUint32(chunk, crc)
+	at := len(pngSignature) + 25
+	return append(append(append([]byte{}, data[:at]...), chunk...), data[at:]...)
+}
+
+// TestStegoAnalyzer tests finding data hidden in image assets.
+func TestStegoAnalyzer(t *testing.T) {
+	clean := encodePNG(t, blockyImage())
+
+	stego := blockyImage()
+	r := rand.New(rand.NewSource(1))
+	for i := range stego.Pix {
+		if i%4 != 3 {
+			stego.Pix[i] = stego.Pix[i]&^1 | uint8(r.Intn(2))
+		}
+	}
+
+	var photo bytes.Buffer
+	if err := jpeg.Encode(&photo, blockyImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeZip(t, map[string]string{
+		"res/drawable/clean.png": string(clean),
+		"assets/lsb.png":         string(encodePNG(t, stego)),
+		"assets/appended.png":    string(clean) + "PK\x03\x04payload",
+		"assets/chunks.png":      string(insertChunk(insertChunk(clean, "zzZz", []byte("hidden"), 0), "tEXt", []byte("Comment\x00hi"), 1)),
+		"assets/photo.jpg":       photo.String() + "secret",
+		"assets/clean.jpg":       photo.String(),
+		"icon.png":               string(clean) + "outside assets",
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := stegoAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]StegoFinding)
+	for _, img := range section.([]StegoImage) {
+		got[img.Path] = img.Findings
+	}
+	if len(got) != 4 {
+		t.Errorf("expected 4 images, got %+v", got)
+	}
+
+	idat := int64(len(pngSignature) + 25)
+	if f := got["assets/lsb.png"]; len(f) != 1 || f[0].Kind != StegoLSB || f[0].Offset != idat {
+		t.Errorf("unexpected LSB findings %+v", f)
+	}
+	want := []StegoFinding{{StegoAppended, int64(len(clean)), 11, "11 bytes after IEND"}}
+	if f := got["assets/appended.png"]; !reflect.DeepEqual(f, want) {
+		t.Errorf("expected %+v, got %+v", want, f)
+	}
+	want = []StegoFinding{
+		{StegoBadCRC, idat, 22, `"tEXt" chunk with a wrong CRC`},
+		{StegoUnknownChunk, idat + 22, 18, `unknown "zzZz" chunk of 6 bytes`},
+	}
+	if f := got["assets/chunks.png"]; !reflect.DeepEqual(f, want) {
+		t.Errorf("expected %+v, got %+v", want, f)
+	}
+	want = []StegoFinding{{StegoAppended, int64(photo.Len()), 6, "6 bytes after EOI"}}
+	if f := got["assets/photo.jpg"]; !reflect.DeepEqual(f, want) {
+		t.Errorf("expected %+v, got %+v", want, f)
+	}
+}
@@ -0,0 +1,255 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultStringsLimit is how many strings of each kind the strings section lists
+const DefaultStringsLimit = 100
+
+// minStringLength is the shortest run of printable characters kept as a string
+const minStringLength = 6
+
+// foundString is a string and the archive entry it was found in
+type foundString struct {
+	Value    string
+	Location string
+	// Decrypted is set for the dex constants recovered by decrypting them
+	Decrypted *DecryptedString
+}
+
+// foundStrings are extracted on first use and shared by every analyzer of a scan
+type foundStrings struct {
+	once    sync.Once
+	strings []foundString
+	err     error
+}
+
+// extractStrings returns the unique strings of the target's dex string tables,
+// native libraries and assets, or of the target itself when it isn't an APK
+func (t *Target) extractStrings() ([]foundString, error) {
+	t.strings.once.Do(func() {
+		seen := make(map[string]bool)
+		add := func(location string, values []string) {
+			for _, v := range values {
+				if !seen[v] {
+					seen[v] = true
+					t.strings.strings = append(t.strings.strings, foundString{Value: v, Location: location})
+				}
+			}
+		}
+
+		a, err := t.Archive()
+		if err == ErrNotArchive {
+			t.strings.err = t.extractFileStrings(add)
+			return
+		}
+		if err != nil {
+			t.strings.err = err
+			return
+		}
+
+		dexes, err := t.dexFiles()
+		if err != nil {
+			t.strings.err = err
+			return
+		}
+		for _, d := range dexes {
+			add(d.name, d.strings)
+			// the string table is listed even when the bytecode can't be walked
+			decrypted, _ := decryptStrings(d)
+			for i := range decrypted {
+				if v := decrypted[i].Value; !seen[v] {
+					seen[v] = true
+					t.strings.strings = append(t.strings.strings, foundString{Value: v, Location: decrypted[i].Location, Decrypted: &decrypted[i]})
+				}
+			}
+		}
+
+		for _, f := range a.File {
+			if !hasStrings(f) || !a.Analyzable(f) {
+				continue
+			}
+			data, err := a.ReadEntry(f)
+			if err != nil {
+				t.strings.err = fmt.Errorf("%s: %v", f.Name, err)
+				return
+			}
+			add(f.Name, printableStrings(data))
+		}
+	})
+	return t.strings.strings, t.strings.err
+}
+
+func (t *Target) extractFileStrings(add func(string, []string)) error {
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return err
+	}
+	if t.maxEntrySize > 0 && info.Size() > t.maxEntrySize {
+		return ErrEntryTooLarge
+	}
+	data, err := ioutil.ReadFile(t.Path)
+	if err != nil {
+		return err
+	}
+	add(path.Base(t.Path), printableStrings(data))
+	return nil
+}
+
+// hasStrings reports whether the strings of an entry are extracted, dex files
+// are read through their string table instead
+func hasStrings(f *zip.File) bool {
+	name := f.Name
+	return name == "resources.arsc" ||
+		(strings.HasPrefix(name, "lib/") && strings.HasSuffix(name, ".so")) ||
+		strings.HasPrefix(name, "assets/") ||
+		strings.HasPrefix(name, "res/raw/")
+}
+
+// printableStrings returns the runs of printable ASCII and UTF-16LE characters in data
+func printableStrings(data []byte) []string {
+	var found []string
+
+	printable := func(b byte) bool { return b >= 0x20 && b < 0x7f || b == '\t' }
+
+	// ASCII
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && printable(data[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= minStringLength {
+			found = append(found, string(data[start:i]))
+		}
+		start = -1
+	}
+
+	// UTF-16LE, at both alignments
+	for align := 0; align < 2; align++ {
+		var run []byte
+		for i := align; i+1 <= len(data); i += 2 {
+			if i+1 < len(data) && printable(data[i]) && data[i+1] == 0 {
+				run = append(run, data[i])
+				continue
+			}
+			if len(run) >= minStringLength {
+				found = append(found, string(run))
+			}
+			run = run[:0]
+		}
+	}
+
+	return found
+}
+
+// Strings is the strings section, the IOCs found in the target's strings
+type Strings struct {
+	// Total is the number of unique strings found
+	Total   int      `json:"total" structs:"total"`
+	URLs    []string `json:"urls,omitempty" structs:"urls,omitempty"`
+	IPs     []string `json:"ips,omitempty" structs:"ips,omitempty"`
+	Emails  []string `json:"emails,omitempty" structs:"emails,omitempty"`
+	Bitcoin []string `json:"bitcoin,omitempty" structs:"bitcoin,omitempty"`
+	Monero  []string `json:"monero,omitempty" structs:"monero,omitempty"`
+	Phones  []string `json:"phones,omitempty" structs:"phones,omitempty"`
+	// Decrypted are the dex string constants recovered from the app's string
+	// decryptors, their IOCs are in the lists above
+	Decrypted []DecryptedString `json:"decrypted,omitempty" structs:"decrypted,omitempty"`
+	// Truncated is set when a list was cut at the strings limit
+	Truncated bool `json:"truncated,omitempty" structs:"truncated,omitempty"`
+	// Raw is every string found, only dumped when enabled with WithRawStrings
+	Raw []string `json:"raw,omitempty" structs:"raw,omitempty"`
+}
+
+var (
+	urlRegexp     = regexp.MustCompile(`(?i)\b(?:https?|ftp|wss?)://[^\s"'<>\\]+`)
+	ipRegexp      = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	emailRegexp   = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)
+	bitcoinRegexp = regexp.MustCompile(`\b(?:bc1[ac-hj-np-z02-9]{11,71}|[13][a-km-zA-HJ-NP-Z1-9]{25,34})\b`)
+	moneroRegexp  = regexp.MustCompile(`\b4[0-9AB][1-9A-HJ-NP-Za-km-z]{93}\b`)
+	phoneRegexp   = regexp.MustCompile(`\+[1-9]\d{7,14}\b`)
+)
+
+type stringsAnalyzer struct{ s *Scanner }
+
+func (stringsAnalyzer) Name() string    { return "strings" }
+func (stringsAnalyzer) Available() bool { return true }
+
+func (a stringsAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	found, err := target.extractStrings()
+	if err != nil {
+		return nil, err
+	}
+	return a.s.classifyStrings(ctx, found)
+}
+
+// classifyStrings picks the IOCs out of found
+func (s *Scanner) classifyStrings(ctx context.Context, found []foundString) (*Strings, error) {
+	section := Strings{Total: len(found)}
+	seen := make(map[*[]string]map[string]bool)
+	add := func(list *[]string, v string) {
+		if seen[list] == nil {
+			seen[list] = make(map[string]bool)
+		}
+		if seen[list][v] {
+			return
+		}
+		seen[list][v] = true
+		if s.stringsLimit > 0 && len(*list) >= s.stringsLimit {
+			section.Truncated = true
+			return
+		}
+		*list = append(*list, v)
+	}
+
+	for _, str := range found {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, m := range urlRegexp.FindAllString(str.Value, -1) {
+			add(&section.URLs, m)
+		}
+		for _, m := range ipRegexp.FindAllString(str.Value, -1) {
+			if net.ParseIP(m) != nil {
+				add(&section.IPs, m)
+			}
+		}
+		for _, m := range emailRegexp.FindAllString(str.Value, -1) {
+			add(&section.Emails, m)
+		}
+		for _, m := range bitcoinRegexp.FindAllString(str.Value, -1) {
+			add(&section.Bitcoin, m)
+		}
+		for _, m := range moneroRegexp.FindAllString(str.Value, -1) {
+			add(&section.Monero, m)
+		}
+		for _, m := range phoneRegexp.FindAllString(str.Value, -1) {
+			add(&section.Phones, m)
+		}
+		if str.Decrypted != nil {
+			if s.stringsLimit > 0 && len(section.Decrypted) >= s.stringsLimit {
+				section.Truncated = true
+			} else {
+				section.Decrypted = append(section.Decrypted, *str.Decrypted)
+			}
+		}
+		if s.rawStrings {
+			add(&section.Raw, str.Value)
+		}
+	}
+
+	return &section, nil
+}
@@ -0,0 +1,64 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestPrintableStrings tests the printableStrings function.
+func TestPrintableStrings(t *testing.T) {
+	data := []byte("\x00\x01http://evil.example/gate.php\x00\x01\x01h\x00t\x00t\x00p\x00s\x00:\x00/\x00/\x00c\x002\x00\x00\x00")
+
+	found := printableStrings(data)
+	want := map[string]bool{"http://evil.example/gate.php": false, "https://c2": false}
+	for _, s := range found {
+		if _, ok := want[s]; ok {
+			want[s] = true
+		}
+	}
+	for s, ok := range want {
+		if !ok {
+			t.Errorf("%q not found in %q", s, found)
+		}
+	}
+}
+
+// TestStringsAnalyzer tests IOC classification of the strings in an APK.
+func TestStringsAnalyzer(t *testing.T) {
+	path := writeZip(t, map[string]string{
+		"assets/config.json": `{"gate": "https://panel.example.com/api", "mail": "ops@example.com", "ip": "185.12.45.9", "sms": "+447700900123",
+			"wallet": "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"}`,
+		"lib/arm64-v8a/libpayload.so": "\x7fELF\x00\x00http://10.0.0.1:8080/x\x00",
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+
+	s := &Scanner{stringsLimit: DefaultStringsLimit}
+	section, err := stringsAnalyzer{s}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs := section.(*Strings)
+
+	checks := map[string][]string{
+		"url":     strs.URLs,
+		"ip":      strs.IPs,
+		"email":   strs.Emails,
+		"phone":   strs.Phones,
+		"bitcoin": strs.Bitcoin,
+	}
+	for kind, list := range checks {
+		if len(list) == 0 {
+			t.Errorf("no %s found in %#v", kind, strs)
+		}
+	}
+	if len(strs.URLs) != 2 || len(strs.IPs) != 2 {
+		t.Errorf("expected 2 URLs and 2 IPs, got %q and %q", strs.URLs, strs.IPs)
+	}
+	if strs.Raw != nil {
+		t.Error("raw strings should only be dumped when enabled")
+	}
+}
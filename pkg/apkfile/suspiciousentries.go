@@ -0,0 +1,199 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// SuspiciousEntry is a zip entry whose name hides it or misleads about its content
+type SuspiciousEntry struct {
+	Name        string `json:"name" structs:"name"`
+	Rule        string `json:"rule" structs:"rule"`
+	Description string `json:"description" structs:"description"`
+}
+
+// Suspicious entry rules
+const (
+	EntryHidden       = "hidden"
+	EntryControlChars = "control_characters"
+	EntryBidi         = "bidi_override"
+	EntryTypeMismatch = "type_mismatch"
+	EntryOversized    = "oversized"
+)
+
+// bidiControls reorder the text around them, e.g. U+202E makes
+// "payload\u202egnp.dex" display as "payloadxed.png"
+var bidiControls = map[rune]bool{
+	'\u061c': true, '\u200e': true, '\u200f': true,
+	'\u202a': true, '\u202b': true, '\u202c': true, '\u202d': true, '\u202e': true,
+	'\u2066': true, '\u2067': true, '\u2068': true, '\u2069': true,
+}
+
+// contentTypes are the magic numbers of the types entries are checked for,
+// and the extensions each type may have
+var contentTypes = []struct {
+	name       string
+	magic      [][]byte
+	extensions []string
+}{
+	{"DEX", [][]byte{[]byte("dex\n")}, []string{".dex", ".odex", ".vdex"}},
+	{"ELF", [][]byte{[]byte("\x7fELF")}, []string{".so", ".bin", ""}},
+	{"zip", [][]byte{[]byte("PK\x03\x04")}, []string{".zip", ".jar", ".apk", ".apks", ".aar", ".obb", ".xapk", ".dm"}},
+	{"PNG", [][]byte{[]byte("\x89PNG")}, []string{".png"}},
+	{"JPEG", [][]byte{[]byte("\xff\xd8\xff")}, []string{".jpg", ".jpeg"}},
+	{"GIF", [][]byte{[]byte("GIF87a"), []byte("GIF89a")}, []string{".gif"}},
+}
+
+// imageExtensions are the types an entry claims to be that it has to be,
+// a .png that is no image at all usually hides an encrypted payload
+var imageExtensions = map[string]string{".png": "PNG", ".jpg": "JPEG", ".jpeg": "JPEG", ".gif": "GIF"}
+
+// maxResourceSizes is the size above which an entry of each type is out of
+// proportion, large high entropy resources hide payloads
+var maxResourceSizes = map[string]uint64{
+	".xml":        1 << 20,
+	".json":       5 << 20,
+	".txt":        5 << 20,
+	".html":       5 << 20,
+	".htm":        5 << 20,
+	".js":         5 << 20,
+	".css":        5 << 20,
+	".properties": 5 << 20,
+	".png":        20 << 20,
+	".jpg":        20 << 20,
+	".jpeg":       20 << 20,
+	".gif":        20 << 20,
+	".webp":       20 << 20,
+	".ttf":        20 << 20,
+	".otf":        20 << 20,
+}
+
+type suspiciousEntriesAnalyzer struct{}
+
+func (suspiciousEntriesAnalyzer) Name() string    { return "suspicious_entries" }
+func (suspiciousEntriesAnalyzer) Available() bool { return true }
+
+func (suspiciousEntriesAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	a, err := target.Archive()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var found []SuspiciousEntry
+	for _, f := range a.File {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		found = append(found, checkEntryName(f.Name)...)
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if e := checkEntryType(f); e != nil {
+			found = append(found, *e)
+		}
+		e, err := checkEntrySize(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		if e != nil {
+			found = append(found, *e)
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return found, nil
+}
+
+// checkEntryName flags names that hide an entry or disguise it
+func checkEntryName(name string) []SuspiciousEntry {
+	var found []SuspiciousEntry
+	for _, part := range strings.Split(strings.TrimSuffix(name, "/"), "/") {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			found = append(found, SuspiciousEntry{name, EntryHidden, "hidden " + part + ", a name starting with a dot"})
+			break
+		}
+	}
+
+	var control, bidi bool
+	for _, r := range name {
+		control = control || unicode.IsControl(r)
+		bidi = bidi || bidiControls[r]
+	}
+	if control {
+		found = append(found, SuspiciousEntry{name, EntryControlChars, "the name contains control characters"})
+	}
+	if bidi {
+		found = append(found, SuspiciousEntry{name, EntryBidi, "the name contains bidirectional text controls, it displays differently than it reads"})
+	}
+	return found
+}
+
+// checkEntryType flags entries whose extension contradicts their magic number
+func checkEntryType(f *zip.File) *SuspiciousEntry {
+	rc, err := f.Open()
+	if err != nil {
+		return nil
+	}
+	head := make([]byte, 8)
+	n, _ := io.ReadFull(rc, head)
+	rc.Close()
+	head = head[:n]
+
+	ext := strings.ToLower(path.Ext(f.Name))
+	for _, t := range contentTypes {
+		for _, magic := range t.magic {
+			if !bytes.HasPrefix(head, magic) {
+				continue
+			}
+			if containsString(t.extensions, ext) {
+				return nil
+			}
+			return &SuspiciousEntry{f.Name, EntryTypeMismatch, describeExtension(ext) + " but is a " + t.name + " file"}
+		}
+	}
+	if want, ok := imageExtensions[ext]; ok && n > 0 {
+		return &SuspiciousEntry{f.Name, EntryTypeMismatch, "named " + ext + " but is not a " + want + " image"}
+	}
+	return nil
+}
+
+// checkEntrySize flags resources and assets far larger than their type
+// warrants that are also compressed or encrypted, it streams them so sizes
+// above the max analyzed entry size are checked too
+func checkEntrySize(f *zip.File) (*SuspiciousEntry, error) {
+	ext := strings.ToLower(path.Ext(f.Name))
+	max, ok := maxResourceSizes[ext]
+	if !ok || f.UncompressedSize64 <= max {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	e, err := readerEntropy(rc)
+	if err != nil {
+		return nil, err
+	}
+	if e <= packedEntropy {
+		return nil, nil
+	}
+	return &SuspiciousEntry{f.Name, EntryOversized, fmt.Sprintf("a %s of %d MB with an entropy of %.2f", ext, f.UncompressedSize64>>20, e)}, nil
+}
+
+func describeExtension(ext string) string {
+	if ext == "" {
+		return "has no extension"
+	}
+	return "named " + ext
+}
@@ -0,0 +1,76 @@
+package apkfile
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestSuspiciousEntriesAnalyzer tests flagging hidden, disguised and mistyped entries.
+func TestSuspiciousEntriesAnalyzer(t *testing.T) {
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml":          "manifest",
+		"classes.dex":                  "dex\n035\x00",
+		"res/drawable/icon.png":        "\x89PNG\r\n\x1a\n",
+		"res/drawable/splash.png":      "dex\n035\x00",
+		"assets/.cache/payload":        "\x7fELF",
+		"assets/data.bin":              "\x7fELF",
+		"assets/banner.jpg":            "\x13\x37\xca\xfe",
+		"assets/update\u202egnp.apk":   "PK\x03\x04",
+		"assets/run\x07.sh":            "#!/bin/sh",
+		"lib/arm64-v8a/libnative.so":   "\x7fELF",
+		"assets/fonts/Roboto-Bold.ttf": "\x00\x01\x00\x00",
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := suspiciousEntriesAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range section.([]SuspiciousEntry) {
+		got = append(got, e.Rule+" "+e.Name+": "+e.Description)
+	}
+	sort.Strings(got)
+	want := []string{
+		"bidi_override assets/update\u202egnp.apk: the name contains bidirectional text controls, it displays differently than it reads",
+		"control_characters assets/run\x07.sh: the name contains control characters",
+		"hidden assets/.cache/payload: hidden .cache, a name starting with a dot",
+		"type_mismatch assets/banner.jpg: named .jpg but is not a JPEG image",
+		"type_mismatch res/drawable/splash.png: named .png but is a DEX file",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// TestOversizedEntries tests flagging large high entropy resources.
+func TestOversizedEntries(t *testing.T) {
+	random := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(random)
+	path := writeZip(t, map[string]string{
+		"res/values/strings.xml": string(random),
+		"res/xml/big.xml":        strings.Repeat("<item>value</item>", 1<<17),
+		"assets/game.pak":        string(random),
+		"res/drawable/icon.png":  "\x89PNG" + string(random[:1024]),
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path, maxEntrySize: 1 << 20}
+	defer target.close()
+	section, err := suspiciousEntriesAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := section.([]SuspiciousEntry)
+	if len(entries) != 1 || entries[0].Name != "res/values/strings.xml" || entries[0].Rule != EntryOversized ||
+		entries[0].Description != "a .xml of 2 MB with an entropy of 8.00" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
@@ -0,0 +1,130 @@
+package apkfile
+
+import (
+	"context"
+	"strings"
+)
+
+// TaskHijacking is how the app's activities join tasks, which StrandHogg style
+// phishing abuses to slip an activity into another app's task
+type TaskHijacking struct {
+	// Activities are the activities with a non-default task configuration
+	Activities []TaskActivity  `json:"activities" structs:"activities"`
+	Indicators []TaskIndicator `json:"indicators,omitempty" structs:"indicators,omitempty"`
+}
+
+// TaskActivity is the task configuration of an activity
+type TaskActivity struct {
+	Activity string `json:"activity" structs:"activity"`
+	// TaskAffinity is the task the activity prefers, inherited from the
+	// application and the package name by default
+	TaskAffinity         string `json:"task_affinity" structs:"task_affinity"`
+	LaunchMode           string `json:"launch_mode" structs:"launch_mode"`
+	AllowTaskReparenting bool   `json:"allow_task_reparenting,omitempty" structs:"allow_task_reparenting,omitempty"`
+	ExcludeFromRecents   bool   `json:"exclude_from_recents,omitempty" structs:"exclude_from_recents,omitempty"`
+	Exported             bool   `json:"exported" structs:"exported"`
+	// Foreign is set when the affinity is another app's package
+	Foreign bool `json:"foreign,omitempty" structs:"foreign,omitempty"`
+}
+
+// TaskIndicator is a task configuration that enables task hijacking
+type TaskIndicator struct {
+	Name        string   `json:"name" structs:"name"`
+	Description string   `json:"description" structs:"description"`
+	Activities  []string `json:"activities" structs:"activities"`
+}
+
+// launchModes are the android:launchMode values by their enum value
+var launchModes = map[string]string{
+	"0": "standard",
+	"1": "singleTop",
+	"2": "singleTask",
+	"3": "singleInstance",
+	"4": "singleInstancePerTask",
+}
+
+type taskHijackingAnalyzer struct{}
+
+func (taskHijackingAnalyzer) Name() string    { return "task_hijacking" }
+func (taskHijackingAnalyzer) Available() bool { return true }
+
+func (taskHijackingAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := root.Attr("package")
+	appAffinity := pkg
+	for _, app := range root.All("application") {
+		if affinity, ok := app.Attrs["taskAffinity"]; ok {
+			appAffinity = affinity
+		}
+	}
+
+	tasks := &TaskHijacking{Activities: []TaskActivity{}}
+	for _, c := range components(root) {
+		if c.Kind != "activity" {
+			continue
+		}
+		a := TaskActivity{
+			Activity:             c.Name,
+			TaskAffinity:         appAffinity,
+			LaunchMode:           launchMode(c.Element.Attr("launchMode")),
+			AllowTaskReparenting: c.Element.Attr("allowTaskReparenting") == "true",
+			ExcludeFromRecents:   c.Element.Attr("excludeFromRecents") == "true",
+			Exported:             c.exported(),
+		}
+		// an empty affinity keeps the activity out of every other task
+		if affinity, ok := c.Element.Attrs["taskAffinity"]; ok {
+			a.TaskAffinity = affinity
+		}
+		a.Foreign = a.TaskAffinity != "" && a.TaskAffinity != pkg && !strings.HasPrefix(a.TaskAffinity, pkg+".")
+		if a.TaskAffinity != pkg || a.AllowTaskReparenting || a.LaunchMode != "standard" && a.LaunchMode != "singleTop" {
+			tasks.Activities = append(tasks.Activities, a)
+		}
+	}
+	tasks.Indicators = taskIndicators(tasks.Activities)
+	return tasks, nil
+}
+
+// launchMode names an android:launchMode value, apktool's text manifests
+// already have the name
+func launchMode(value string) string {
+	if value == "" {
+		return "standard"
+	}
+	if name, ok := launchModes[value]; ok {
+		return name
+	}
+	return value
+}
+
+// taskIndicators flags the activities set up to join another app's task
+func taskIndicators(activities []TaskActivity) []TaskIndicator {
+	var indicators []TaskIndicator
+	add := func(name, description string, match func(TaskActivity) bool) {
+		var found []string
+		for _, a := range activities {
+			if a.Foreign && match(a) {
+				found = append(found, a.Activity)
+			}
+		}
+		if len(found) > 0 {
+			indicators = append(indicators, TaskIndicator{name, description, found})
+		}
+	}
+
+	add("foreign_task_affinity", "activity prefers the task of another app",
+		func(TaskActivity) bool { return true })
+	add("task_reparenting", "activity moves into the other app's task when it comes to the front, StrandHogg's phishing setup",
+		func(a TaskActivity) bool { return a.AllowTaskReparenting })
+	add("single_task_affinity", "activity is started as the root of, or alone in, the other app's task",
+		func(a TaskActivity) bool { return a.LaunchMode == "singleTask" || a.LaunchMode == "singleInstance" })
+	add("hidden_task", "activity in another app's task is hidden from the recent apps",
+		func(a TaskActivity) bool { return a.ExcludeFromRecents })
+	return indicators
+}
@@ -0,0 +1,54 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestTaskHijackingAnalyzer tests the task configurations and the StrandHogg indicators.
+func TestTaskHijackingAnalyzer(t *testing.T) {
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app">
+  <application>
+    <activity android:name=".MainActivity"/>
+    <activity android:name=".Settings" android:launchMode="1"/>
+    <activity android:name=".Isolated" android:taskAffinity=""/>
+    <activity android:name=".Login" android:taskAffinity="com.bank.mobile" android:allowTaskReparenting="true" android:excludeFromRecents="true"/>
+    <activity android:name=".Overlay" android:taskAffinity="com.bank.mobile" android:launchMode="singleTask" android:exported="true"/>
+    <activity android:name=".Share" android:taskAffinity="com.example.app.share" android:launchMode="3"/>
+    <service android:name=".Sync" android:taskAffinity="com.bank.mobile"/>
+  </application>
+</manifest>`
+	path := writeZip(t, map[string]string{"AndroidManifest.xml": string(encodeAXML(t, manifest))})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := taskHijackingAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks := section.(*TaskHijacking)
+
+	wantActivities := []TaskActivity{
+		{Activity: "com.example.app.Isolated", TaskAffinity: "", LaunchMode: "standard"},
+		{Activity: "com.example.app.Login", TaskAffinity: "com.bank.mobile", LaunchMode: "standard", AllowTaskReparenting: true, ExcludeFromRecents: true, Foreign: true},
+		{Activity: "com.example.app.Overlay", TaskAffinity: "com.bank.mobile", LaunchMode: "singleTask", Exported: true, Foreign: true},
+		{Activity: "com.example.app.Share", TaskAffinity: "com.example.app.share", LaunchMode: "singleInstance"},
+	}
+	if !reflect.DeepEqual(tasks.Activities, wantActivities) {
+		t.Errorf("expected activities %+v, got %+v", wantActivities, tasks.Activities)
+	}
+
+	var names []string
+	for _, i := range tasks.Indicators {
+		names = append(names, i.Name)
+	}
+	if want := []string{"foreign_task_affinity", "task_reparenting", "single_task_affinity", "hidden_task"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected indicators %v, got %v", want, names)
+	}
+	if got := tasks.Indicators[1].Activities; !reflect.DeepEqual(got, []string{"com.example.app.Login"}) {
+		t.Errorf("unexpected task_reparenting activities %v", got)
+	}
+}
@@ -0,0 +1,122 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// freshCertificate is how recently a certificate has to be created to be fresh
+	freshCertificate = 90 * 24 * time.Hour
+	// futureSlack allows for zip timestamps being in local time, without a zone
+	futureSlack = 24 * time.Hour
+)
+
+// Timestamps is the distribution of the modification times of an APK's
+// entries, which build tools and repackaging tools each set their own way
+type Timestamps struct {
+	Oldest time.Time `json:"oldest" structs:"oldest"`
+	Newest time.Time `json:"newest" structs:"newest"`
+	// Years is the number of entries modified in each year
+	Years map[int]int `json:"years" structs:"years"`
+	// Distinct is the number of distinct timestamps
+	Distinct int `json:"distinct" structs:"distinct"`
+	// Epoch is the number of entries without a timestamp, at the zip epoch 1980-01-01
+	Epoch int `json:"epoch" structs:"epoch"`
+	// Future is the number of entries dated after the scan
+	Future int `json:"future" structs:"future"`
+	// CertificateCreated is when the newest signing certificate became valid
+	CertificateCreated *time.Time `json:"certificate_created,omitempty" structs:"certificate_created,omitempty"`
+	Anomalies          []string   `json:"anomalies,omitempty" structs:"anomalies,omitempty"`
+}
+
+type timestampsAnalyzer struct{}
+
+func (timestampsAnalyzer) Name() string    { return "timestamps" }
+func (timestampsAnalyzer) Available() bool { return true }
+
+func (timestampsAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	a, err := target.Archive()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(a.File) == 0 {
+		return nil, nil
+	}
+
+	// signatures that can't be read are reported by the signers section
+	var created *time.Time
+	certs, _ := target.signingCerts()
+	for _, c := range certs {
+		if nb := c.cert.NotBefore; created == nil || nb.After(*created) {
+			created = &nb
+		}
+	}
+	return analyzeTimestamps(a.File, created, time.Now()), nil
+}
+
+// dosEpoch is the DOS date of 1980-01-01, the first day zip can store
+const dosEpoch = 1<<5 | 1
+
+// zipEpoch reports whether an entry has no timestamp, i.e. midnight on
+// 1980-01-01 or a DOS date of 0
+func zipEpoch(f *zip.File) bool {
+	return f.ModifiedDate <= dosEpoch && f.ModifiedTime == 0
+}
+
+func analyzeTimestamps(files []*zip.File, created *time.Time, now time.Time) *Timestamps {
+	ts := &Timestamps{Years: make(map[int]int), CertificateCreated: created}
+	distinct := make(map[time.Time]bool)
+	for _, f := range files {
+		m := f.Modified
+		if zipEpoch(f) {
+			ts.Epoch++
+			m = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		if ts.Oldest.IsZero() || m.Before(ts.Oldest) {
+			ts.Oldest = m
+		}
+		if m.After(ts.Newest) {
+			ts.Newest = m
+		}
+		if m.After(now.Add(futureSlack)) {
+			ts.Future++
+		}
+		ts.Years[m.Year()]++
+		distinct[m] = true
+	}
+	ts.Distinct = len(distinct)
+
+	allEpoch := ts.Epoch == len(files)
+	switch {
+	case allEpoch:
+		ts.Anomalies = append(ts.Anomalies, "every entry is at the zip epoch, 1980-01-01")
+	case ts.Distinct == 1 && !androidGradleTimestamp(ts.Newest):
+		ts.Anomalies = append(ts.Anomalies, "every entry has the same timestamp, "+ts.Newest.Format("2006-01-02 15:04:05"))
+	}
+	if ts.Future > 0 {
+		ts.Anomalies = append(ts.Anomalies, fmt.Sprintf("%d entries are dated in the future", ts.Future))
+	}
+	if created != nil {
+		switch {
+		case allEpoch && now.Sub(*created) < freshCertificate:
+			ts.Anomalies = append(ts.Anomalies, "signed with a certificate created on "+created.Format("2006-01-02")+
+				" and every entry is at the zip epoch, likely repackaged")
+		case ts.Epoch == 0 && ts.Newest.AddDate(1, 0, 0).Before(*created) && !androidGradleTimestamp(ts.Newest):
+			ts.Anomalies = append(ts.Anomalies, "the newest entry is from "+ts.Newest.Format("2006-01-02")+
+				", more than a year before the certificate was created on "+created.Format("2006-01-02"))
+		}
+	}
+	return ts
+}
+
+// androidGradleTimestamp reports whether t is the fixed timestamp the
+// Android Gradle plugin gives every entry for reproducible builds
+func androidGradleTimestamp(t time.Time) bool {
+	return t.Equal(time.Date(1981, 1, 1, 1, 1, 2, 0, time.UTC))
+}
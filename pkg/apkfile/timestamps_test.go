@@ -0,0 +1,83 @@
+package apkfile
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// zipWithTimes opens a zip archive whose entries have the given modification times
+func zipWithTimes(t *testing.T, times ...time.Time) *zip.ReadCloser {
+	f, err := ioutil.TempFile("", "apk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	w := zip.NewWriter(f)
+	for i, m := range times {
+		h := &zip.FileHeader{Name: string(rune('a' + i))}
+		if !m.IsZero() {
+			h.SetModTime(m)
+		}
+		if _, err := w.CreateHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	f.Close()
+
+	r, err := zip.OpenReader(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// TestAnalyzeTimestamps tests the entry timestamp distribution and anomalies.
+func TestAnalyzeTimestamps(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 10, 30, 0, 0, time.UTC) }
+	fresh := now.AddDate(0, 0, -10)
+	old := day(2020, 3, 1)
+
+	r := zipWithTimes(t, time.Time{}, time.Time{})
+	defer r.Close()
+	ts := analyzeTimestamps(r.File, &fresh, now)
+	if ts.Epoch != 2 || ts.Distinct != 1 || !reflect.DeepEqual(ts.Years, map[int]int{1980: 2}) {
+		t.Errorf("unexpected epoch timestamps %+v", ts)
+	}
+	want := []string{
+		"every entry is at the zip epoch, 1980-01-01",
+		"signed with a certificate created on 2024-05-22 and every entry is at the zip epoch, likely repackaged",
+	}
+	if !reflect.DeepEqual(ts.Anomalies, want) {
+		t.Errorf("expected %q, got %q", want, ts.Anomalies)
+	}
+
+	r = zipWithTimes(t, day(2015, 1, 2), day(2016, 5, 6), day(2016, 5, 6), day(2031, 1, 1))
+	defer r.Close()
+	ts = analyzeTimestamps(r.File, &old, now)
+	if !ts.Oldest.Equal(day(2015, 1, 2)) || !ts.Newest.Equal(day(2031, 1, 1)) || ts.Distinct != 3 || ts.Future != 1 {
+		t.Errorf("unexpected timestamps %+v", ts)
+	}
+	if want := []string{"1 entries are dated in the future"}; !reflect.DeepEqual(ts.Anomalies, want) {
+		t.Errorf("expected %q, got %q", want, ts.Anomalies)
+	}
+
+	r = zipWithTimes(t, day(2015, 1, 2), day(2016, 5, 6))
+	defer r.Close()
+	ts = analyzeTimestamps(r.File, &old, now)
+	if want := []string{"the newest entry is from 2016-05-06, more than a year before the certificate was created on 2020-03-01"}; !reflect.DeepEqual(ts.Anomalies, want) {
+		t.Errorf("expected %q, got %q", want, ts.Anomalies)
+	}
+
+	gradle := time.Date(1981, 1, 1, 1, 1, 2, 0, time.UTC)
+	r = zipWithTimes(t, gradle, gradle)
+	defer r.Close()
+	if ts := analyzeTimestamps(r.File, &old, now); ts.Anomalies != nil {
+		t.Errorf("unexpected anomalies for a Gradle build %q", ts.Anomalies)
+	}
+}
@@ -0,0 +1,58 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// Timing is how long an analyzer ran and what its external tools used
+type Timing struct {
+	// Duration is the analyzer's wall clock time in seconds, retries included
+	Duration float64 `json:"duration" structs:"duration"`
+	// ExitCode is the exit code of the analyzer's last tool, -1 if it was killed
+	ExitCode int `json:"exit_code" structs:"exit_code"`
+	// PeakMemory is the largest resident set size of the analyzer's tools in bytes
+	PeakMemory int64 `json:"peak_memory,omitempty" structs:"peak_memory,omitempty"`
+}
+
+// usage collects the resource usage of the tools an analyzer runs
+type usage struct {
+	sync.Mutex
+	start      time.Time
+	exitCode   int
+	peakMemory int64
+}
+
+type usageKey struct{}
+
+// withUsage returns a context that runTool records tool usage into
+func withUsage(ctx context.Context, u *usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, u)
+}
+
+// recordUsage adds a finished tool's exit code and peak memory to the usage in ctx
+func recordUsage(ctx context.Context, state *os.ProcessState) {
+	u, ok := ctx.Value(usageKey{}).(*usage)
+	if !ok || state == nil {
+		return
+	}
+
+	u.Lock()
+	defer u.Unlock()
+	u.exitCode = state.ExitCode()
+	if rss := maxRSS(state); rss > u.peakMemory {
+		u.peakMemory = rss
+	}
+}
+
+func (u *usage) timing() Timing {
+	u.Lock()
+	defer u.Unlock()
+	return Timing{
+		Duration:   time.Since(u.start).Seconds(),
+		ExitCode:   u.exitCode,
+		PeakMemory: u.peakMemory,
+	}
+}
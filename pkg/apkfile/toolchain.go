@@ -0,0 +1,151 @@
+package apkfile
+
+import (
+	"context"
+	"strings"
+)
+
+// Toolchain is what the app was written in and built with
+type Toolchain struct {
+	// Language is kotlin when the app's classes carry Kotlin metadata, java otherwise
+	Language string `json:"language" structs:"language"`
+	// Compiler is the dx, d8, r8 or dexlib2 (smali, apktool) that produced classes.dex
+	Compiler string `json:"compiler,omitempty" structs:"compiler,omitempty"`
+	// Marker is the version and settings d8 and r8 record in the dex, e.g.
+	// {"compilation-mode":"release","min-api":21,"version":"8.1.56"}
+	Marker string `json:"marker,omitempty" structs:"marker,omitempty"`
+	// Frameworks are the cross-platform frameworks the app is built on
+	Frameworks []string `json:"frameworks,omitempty" structs:"frameworks,omitempty"`
+	// Rebuilt is set when a dex was reassembled with dexlib2, as apps
+	// repackaged with apktool are, which official builds never are
+	Rebuilt bool `json:"rebuilt" structs:"rebuilt"`
+}
+
+// dex map_list item types
+const (
+	mapCodeItem       = 0x2001
+	mapStringDataItem = 0x2002
+)
+
+// frameworkFiles are entries only apps built on a framework have
+var frameworkFiles = []struct {
+	framework string
+	match     func(name string) bool
+}{
+	{"flutter", func(name string) bool { return strings.HasSuffix(name, "/libflutter.so") }},
+	{"react_native", func(name string) bool {
+		return strings.HasSuffix(name, "/libreactnativejni.so") || name == "assets/index.android.bundle"
+	}},
+	{"xamarin", func(name string) bool {
+		return strings.HasSuffix(name, "/libmonodroid.so") || strings.HasPrefix(name, "assemblies/")
+	}},
+	{"unity", func(name string) bool { return strings.HasSuffix(name, "/libunity.so") }},
+	{"cordova", func(name string) bool { return name == "assets/www/cordova.js" }},
+	{"b4a", func(name string) bool { return strings.HasPrefix(name, "assets/") && strings.HasSuffix(name, ".bal") }},
+}
+
+type toolchainAnalyzer struct{}
+
+func (toolchainAnalyzer) Name() string    { return "toolchain" }
+func (toolchainAnalyzer) Available() bool { return true }
+
+func (toolchainAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	a, err := target.Archive()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dexes, err := target.dexFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(dexes) == 0 {
+		return nil, nil
+	}
+
+	tc := &Toolchain{Language: "java"}
+	for _, d := range dexes {
+		compiler, marker := d.compiler()
+		if d.name == "classes.dex" || tc.Compiler == "" {
+			tc.Compiler, tc.Marker = compiler, marker
+		}
+		if compiler == "dexlib2" {
+			tc.Rebuilt = true
+		}
+		if d.kotlin() {
+			tc.Language = "kotlin"
+		}
+	}
+
+	for _, f := range a.File {
+		for _, fw := range frameworkFiles {
+			if fw.match(f.Name) {
+				tc.Frameworks = appendUnique(tc.Frameworks, fw.framework)
+			}
+		}
+	}
+	return tc, nil
+}
+
+// kotlin reports whether the dex has classes compiled from Kotlin, which all
+// carry the kotlin.Metadata annotation, bundling the stdlib alone doesn't count
+func (d *dexFile) kotlin() bool {
+	for _, c := range d.classes {
+		if strings.HasPrefix(c.name, "Lkotlin/") {
+			continue
+		}
+		for _, a := range d.classAnnotations(c) {
+			if a == "Lkotlin/Metadata;" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compiler tells d8 and r8 apart by the marker they add to the string table,
+// and dx from dexlib2 by the order they lay out the data section in: dx
+// writes code items before string data, dexlib2 the other way around
+func (d *dexFile) compiler() (compiler, marker string) {
+	for _, s := range d.strings {
+		for _, prefix := range []string{"~~D8", "~~R8", "~~L8"} {
+			if strings.HasPrefix(s, prefix+"{") {
+				compiler = strings.ToLower(prefix[2:])
+				if compiler == "l8" {
+					// L8 only desugars the library, the app is still built by d8 or r8
+					continue
+				}
+				return compiler, s[len(prefix):]
+			}
+		}
+	}
+
+	for _, t := range d.mapTypes() {
+		switch t {
+		case mapCodeItem:
+			return "dx", ""
+		case mapStringDataItem:
+			return "dexlib2", ""
+		}
+	}
+	return "", ""
+}
+
+// mapTypes returns the item types of the map_list in file order
+func (d *dexFile) mapTypes() []uint16 {
+	off := d.u32(0x34)
+	if off == 0 || uint64(off)+4 > uint64(len(d.data)) {
+		return nil
+	}
+	size := d.u32(off)
+	if uint64(off)+4+uint64(size)*12 > uint64(len(d.data)) {
+		return nil
+	}
+	types := make([]uint16, size)
+	for i := range types {
+		types[i] = d.u16(off + 4 + uint32(i)*12)
+	}
+	return types
+}
@@ -0,0 +1,66 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestToolchainAnalyzer tests the language, compiler and framework detection.
+func TestToolchainAnalyzer(t *testing.T) {
+	// the map_lists as dx and dexlib2 lay them out, header and ids first
+	dxMap := []uint16{0x0000, 0x0001, 0x0002, 0x0003, 0x0005, 0x0006, 0x1003, mapCodeItem, 0x1001, mapStringDataItem, 0x2003, 0x2000, 0x1000}
+	dexlibMap := []uint16{0x0000, 0x0001, 0x0002, 0x0003, 0x0005, 0x0006, mapStringDataItem, 0x1001, 0x1003, 0x2003, mapCodeItem, 0x2000, 0x1000}
+
+	kotlin := newDexBuilder()
+	kotlin.class("Lcom/example/MainActivity;", "Landroid/app/Activity;")
+	kotlin.annotate("Lkotlin/Metadata;")
+	kotlin.str(`~~R8{"backend":"dex","compilation-mode":"release","min-api":24,"version":"8.1.56"}`)
+
+	// the Kotlin stdlib bundled in a Java app
+	stdlib := newDexBuilder()
+	stdlib.class("Lkotlin/Unit;", "Ljava/lang/Object;")
+	stdlib.annotate("Lkotlin/Metadata;")
+	stdlib.class("Lcom/example/Main;", "Ljava/lang/Object;")
+	stdlib.mapTypes = dxMap
+
+	rebuilt := newDexBuilder()
+	rebuilt.class("Lcom/example/Main;", "Ljava/lang/Object;")
+	rebuilt.mapTypes = dexlibMap
+
+	for name, tt := range map[string]struct {
+		entries map[string]string
+		want    Toolchain
+	}{
+		"kotlin r8": {
+			map[string]string{"classes.dex": string(kotlin.build()), "lib/arm64-v8a/libflutter.so": ""},
+			Toolchain{
+				Language:   "kotlin",
+				Compiler:   "r8",
+				Marker:     `{"backend":"dex","compilation-mode":"release","min-api":24,"version":"8.1.56"}`,
+				Frameworks: []string{"flutter"},
+			},
+		},
+		"java dx": {
+			map[string]string{"classes.dex": string(stdlib.build())},
+			Toolchain{Language: "java", Compiler: "dx"},
+		},
+		"apktool rebuild": {
+			map[string]string{"classes.dex": string(stdlib.build()), "classes2.dex": string(rebuilt.build())},
+			Toolchain{Language: "java", Compiler: "dx", Rebuilt: true},
+		},
+	} {
+		path := writeZip(t, tt.entries)
+		target := &Target{Path: path}
+		section, err := toolchainAnalyzer{}.Run(context.Background(), target)
+		target.close()
+		os.Remove(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := section.(*Toolchain); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", name, tt.want, *got)
+		}
+	}
+}
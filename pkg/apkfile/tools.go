@@ -0,0 +1,65 @@
+package apkfile
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// toolAliases are the names the tools go by when installed on an OS
+var toolAliases = map[string]map[string][]string{
+	"windows": {
+		"exiftool": {"exiftool(-k)"},
+		"python3":  {"python", "py"},
+	},
+}
+
+// toolDirs are searched for tools missing from PATH, where their installers
+// or package managers put them outside of it
+var toolDirs = defaultToolDirs(runtime.GOOS)
+
+func defaultToolDirs(goos string) []string {
+	switch goos {
+	case "darwin":
+		// Homebrew on Apple silicon and Intel, then MacPorts
+		return []string{"/opt/homebrew/bin", "/usr/local/bin", "/opt/local/bin"}
+	case "windows":
+		var dirs []string
+		for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)"} {
+			if root := os.Getenv(env); root != "" {
+				dirs = append(dirs, filepath.Join(root, "TrID"), filepath.Join(root, "exiftool"), filepath.Join(root, "jadx", "bin"))
+			}
+		}
+		return dirs
+	default:
+		return []string{"/usr/local/bin"}
+	}
+}
+
+// findTool returns name when it is on PATH, otherwise the first of its
+// aliases on PATH or binary in toolDirs. name is returned when the tool
+// isn't found at all, running it then fails with exec's "not found"
+func findTool(name string) string {
+	if strings.ContainsAny(name, `/\`) {
+		return name
+	}
+	if _, err := exec.LookPath(name); err == nil {
+		return name
+	}
+	names := append([]string{name}, toolAliases[runtime.GOOS][name]...)
+	for _, n := range names[1:] {
+		if _, err := exec.LookPath(n); err == nil {
+			return n
+		}
+	}
+	for _, dir := range toolDirs {
+		for _, n := range names {
+			if path, err := exec.LookPath(filepath.Join(dir, n)); err == nil {
+				return path
+			}
+		}
+	}
+	return name
+}
@@ -0,0 +1,37 @@
+package apkfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestFindTool tests finding tools outside of PATH.
+func TestFindTool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test tool is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(dirs []string) { toolDirs = dirs }(toolDirs)
+	toolDirs = []string{filepath.Join(dir, "missing"), dir}
+
+	tool := filepath.Join(dir, "fileinfo-test-tool")
+	if err := ioutil.WriteFile(tool, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if path := findTool("fileinfo-test-tool"); path != tool {
+		t.Errorf("expected %s, got %s", tool, path)
+	}
+	if path := findTool("fileinfo-missing-tool"); path != "fileinfo-missing-tool" {
+		t.Errorf("expected a missing tool to keep its name, got %s", path)
+	}
+	if path := findTool("sh"); path != "sh" {
+		t.Errorf("expected a tool on PATH to keep its name, got %s", path)
+	}
+}
@@ -0,0 +1,124 @@
+package apkfile
+
+import (
+	"context"
+	"sort"
+	"strconv"
+)
+
+// PackageScan is what a scan recorded about an APK, for later scans of the
+// same package to compare against
+type PackageScan struct {
+	SHA256      string `json:"sha256" structs:"sha256"`
+	Package     string `json:"package" structs:"package"`
+	VersionCode int64  `json:"version_code" structs:"version_code"`
+	// Signers are the SHA256 fingerprints of the signing certificates
+	Signers     []string `json:"signers" structs:"signers"`
+	Permissions []string `json:"permissions" structs:"permissions"`
+}
+
+// UpdateAnalysis compares an APK with the latest earlier scan of its package
+type UpdateAnalysis struct {
+	// Current is the APK itself, which later scans of the package look up
+	Current PackageScan `json:"current" structs:"current"`
+	// Previous is the earlier scan with the highest version code, nil when
+	// the package was never scanned before
+	Previous *PackageScan `json:"previous,omitempty" structs:"previous,omitempty"`
+	// SignerChanged is set when none of the previous signers signed the APK,
+	// which Android refuses as an update unless it is uninstalled first
+	SignerChanged bool `json:"signer_changed" structs:"signer_changed"`
+	// Downgrade is set when the version code is lower than the previous one
+	Downgrade          bool     `json:"downgrade" structs:"downgrade"`
+	AddedPermissions   []string `json:"added_permissions,omitempty" structs:"added_permissions,omitempty"`
+	RemovedPermissions []string `json:"removed_permissions,omitempty" structs:"removed_permissions,omitempty"`
+}
+
+// ScanHistory looks up earlier scans by package, e.g. in the database the
+// results are written to
+type ScanHistory interface {
+	// PackageScans returns the earlier scans of pkg, except the one with the
+	// SHA256 exclude
+	PackageScans(ctx context.Context, pkg, exclude string) ([]PackageScan, error)
+}
+
+// WithScanHistory adds an update_analysis section comparing APKs with the
+// earlier scans of the same package in history
+func WithScanHistory(history ScanHistory) Option {
+	return func(s *Scanner) {
+		s.history = history
+	}
+}
+
+type updateAnalyzer struct{ s *Scanner }
+
+func (updateAnalyzer) Name() string      { return "update_analysis" }
+func (a updateAnalyzer) Available() bool { return a.s.history != nil }
+
+func (a updateAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	root, err := target.manifest()
+	if err == ErrNotAPK {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	certs, err := target.signingCerts()
+	if err != nil {
+		return nil, err
+	}
+	sha256sum, err := target.sha256()
+	if err != nil {
+		return nil, err
+	}
+
+	current := PackageScan{
+		SHA256:      sha256sum,
+		Package:     root.Attr("package"),
+		Permissions: usesPermissions(root),
+	}
+	current.VersionCode, _ = strconv.ParseInt(root.Attr("versionCode"), 0, 64)
+	for _, c := range certs {
+		current.Signers = appendUnique(current.Signers, newSigner(c.cert).SHA256)
+	}
+	sort.Strings(current.Permissions)
+	update := &UpdateAnalysis{Current: current}
+
+	scans, err := a.s.history.PackageScans(ctx, current.Package, current.SHA256)
+	if err != nil || len(scans) == 0 {
+		// the section is reported either way, it's what later scans compare against
+		return update, err
+	}
+	previous := scans[0]
+	for _, s := range scans[1:] {
+		if s.VersionCode > previous.VersionCode {
+			previous = s
+		}
+	}
+	update.compare(previous)
+	return update, nil
+}
+
+// compare fills in what changed since previous
+func (u *UpdateAnalysis) compare(previous PackageScan) {
+	current := u.Current
+	u.Previous = &previous
+	u.Downgrade = current.VersionCode < previous.VersionCode
+	// unsigned APKs can't be installed at all, they aren't a signer change
+	u.SignerChanged = len(current.Signers) > 0 && len(previous.Signers) > 0
+	for _, s := range previous.Signers {
+		if containsString(current.Signers, s) {
+			u.SignerChanged = false
+			break
+		}
+	}
+	for _, p := range current.Permissions {
+		if !containsString(previous.Permissions, p) {
+			u.AddedPermissions = append(u.AddedPermissions, p)
+		}
+	}
+	for _, p := range previous.Permissions {
+		if !containsString(current.Permissions, p) {
+			u.RemovedPermissions = append(u.RemovedPermissions, p)
+		}
+	}
+}
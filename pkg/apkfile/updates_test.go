@@ -0,0 +1,85 @@
+package apkfile
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type fakeScanHistory struct {
+	scans   []PackageScan
+	lookups [][2]string
+}
+
+func (f *fakeScanHistory) PackageScans(ctx context.Context, pkg, exclude string) ([]PackageScan, error) {
+	f.lookups = append(f.lookups, [2]string{pkg, exclude})
+	return f.scans, nil
+}
+
+// TestUpdateAnalyzer tests comparing an APK with the earlier scans of its package.
+func TestUpdateAnalyzer(t *testing.T) {
+	cert := selfSignedCert(t, pkix.Name{CommonName: "Bank"})
+	manifest := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.bank.mobile" android:versionCode="411">
+		<uses-permission android:name="android.permission.READ_SMS"/>
+		<uses-permission android:name="android.permission.INTERNET"/>
+		<application/></manifest>`
+	path := writeZip(t, map[string]string{
+		"AndroidManifest.xml": string(encodeAXML(t, manifest)),
+		"META-INF/CERT.RSA":   string(pkcs7SignedData(t, cert)),
+	})
+	defer os.Remove(path)
+	hashes, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := newSigner(mustParseCert(t, cert)).SHA256
+	current := PackageScan{
+		SHA256:      hashes.SHA256,
+		Package:     "com.bank.mobile",
+		VersionCode: 411,
+		Signers:     []string{fingerprint},
+		Permissions: []string{"android.permission.INTERNET", "android.permission.READ_SMS"},
+	}
+
+	older := PackageScan{SHA256: "a", Package: "com.bank.mobile", VersionCode: 410, Signers: []string{fingerprint}, Permissions: []string{"android.permission.INTERNET"}}
+	latest := PackageScan{SHA256: "b", Package: "com.bank.mobile", VersionCode: 412, Signers: []string{"c0ffee"},
+		Permissions: []string{"android.permission.INTERNET", "android.permission.CAMERA"}}
+	tests := []struct {
+		scans []PackageScan
+		want  *UpdateAnalysis
+	}{
+		{nil, &UpdateAnalysis{Current: current}},
+		{[]PackageScan{older}, &UpdateAnalysis{Current: current, Previous: &older, AddedPermissions: []string{"android.permission.READ_SMS"}}},
+		{[]PackageScan{older, latest}, &UpdateAnalysis{Current: current, Previous: &latest, SignerChanged: true, Downgrade: true,
+			AddedPermissions: []string{"android.permission.READ_SMS"}, RemovedPermissions: []string{"android.permission.CAMERA"}}},
+	}
+	for _, tt := range tests {
+		history := &fakeScanHistory{scans: tt.scans}
+		s := &Scanner{}
+		WithScanHistory(history)(s)
+		target := &Target{Path: path}
+		section, err := updateAnalyzer{s}.Run(context.Background(), target)
+		target.close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(section, tt.want) {
+			t.Errorf("expected %#v, got %#v", tt.want, section)
+		}
+		if !reflect.DeepEqual(history.lookups, [][2]string{{"com.bank.mobile", hashes.SHA256}}) {
+			t.Errorf("unexpected lookups %v", history.lookups)
+		}
+	}
+
+	fi := FileInfo{UpdateAnalysis: &UpdateAnalysis{Current: current, Previous: &latest, SignerChanged: true}}
+	fi.judge()
+	if fi.Verdict == nil || fi.Verdict.Verdict != VerdictSuspicious {
+		t.Errorf("expected a signer change to be suspicious, got %#v", fi.Verdict)
+	}
+
+	if (updateAnalyzer{&Scanner{}}).Available() {
+		t.Error("expected the analyzer to be unavailable without a history")
+	}
+}
@@ -0,0 +1,104 @@
+package apkfile
+
+import "strings"
+
+// Verdicts, from least to most severe
+const (
+	// VerdictKnownGood is for samples on the hash allowlist, which aren't analyzed
+	VerdictKnownGood  = "known_good"
+	VerdictSuspicious = "suspicious"
+	VerdictMalicious  = "malicious"
+)
+
+// Verdict is the conclusion the report's findings lead to, it is only set
+// when something was flagged
+type Verdict struct {
+	Verdict string   `json:"verdict" structs:"verdict"`
+	Reasons []string `json:"reasons" structs:"reasons"`
+	// Evidence is what the reasons were raised on, by flag
+	Evidence []Evidence `json:"evidence,omitempty" structs:"evidence,omitempty"`
+}
+
+// flag raises the verdict to at least verdict for the flag name, e.g.
+// zip_slip, and records the evidence it was raised on
+func (fi *FileInfo) flag(verdict, name, reason string, evidence ...Evidence) {
+	if fi.Verdict == nil {
+		fi.Verdict = &Verdict{Verdict: verdict}
+	} else if verdict == VerdictMalicious {
+		fi.Verdict.Verdict = verdict
+	}
+	fi.Verdict.Reasons = append(fi.Verdict.Reasons, reason)
+	for _, e := range evidence {
+		e.Flag = name
+		fi.Verdict.Evidence = append(fi.Verdict.Evidence, e)
+	}
+}
+
+// packageName is the package the manifest declares, empty when the analyzers
+// reporting it didn't run
+func (fi *FileInfo) packageName() string {
+	if fi.UpdateAnalysis != nil {
+		return fi.UpdateAnalysis.Current.Package
+	}
+	if fi.Impersonation != nil {
+		return fi.Impersonation.Package
+	}
+	return ""
+}
+
+// judge sets the verdict from the findings that are conclusive on their own,
+// once every analyzer is done
+func (fi *FileInfo) judge() {
+	for _, s := range fi.Signers {
+		if b := s.Blocklisted; b != nil {
+			verdict := VerdictSuspicious
+			if b.Category == BlocklistMalware {
+				verdict = VerdictMalicious
+			}
+			// the field the blocklist entry matched
+			e := certificateEvidence("sha256", s.SHA256, "certificate is blocklisted as "+b.Name)
+			if b.SHA256 == "" {
+				e = certificateEvidence("subject", s.Subject, "certificate subject is blocklisted as "+b.Name)
+			}
+			fi.flag(verdict, "blocklisted_signer", "signed with a blocklisted certificate, "+b.Name+" ("+s.SHA256+")", e)
+		}
+	}
+	if u := fi.UpdateAnalysis; u != nil && u.SignerChanged {
+		var evidence []Evidence
+		for _, s := range u.Current.Signers {
+			evidence = append(evidence, certificateEvidence("sha256", s, "didn't sign "+u.Previous.SHA256))
+		}
+		fi.flag(VerdictSuspicious, "signer_changed", "signed with other certificates than the earlier scan of "+u.Previous.Package+" ("+u.Previous.SHA256+")", evidence...)
+	}
+	for _, m := range fi.MalwarePackages {
+		// the APK's package is the feed's unless it's a lookalike
+		e := Evidence{Kind: EvidenceManifest, Path: "AndroidManifest.xml", Attribute: "manifest@package", Value: m.Package}
+		switch m.Match {
+		case FeedMatchExact:
+			e.Detail = "package of the " + m.Family + " samples"
+			fi.flag(VerdictMalicious, "malware_package", "package "+m.Package+" is known "+m.Family, e)
+		case FeedMatchVersion:
+			e.Detail = "package of other " + m.Family + " builds"
+			fi.flag(VerdictSuspicious, "malware_package", "other builds of package "+m.Package+" are known "+m.Family, e)
+		case FeedMatchLookalike:
+			e.Value = fi.packageName()
+			e.Detail = "package looks like " + m.Package + " of " + m.Family
+			fi.flag(VerdictSuspicious, "malware_package", "package name looks like "+m.Package+", known "+m.Family, e)
+		}
+	}
+	for _, v := range fi.Vulnerabilities {
+		if v.Name == "zip_slip" {
+			fi.flag(VerdictSuspicious, v.Name, "entry names traverse out of the extraction directory, "+strings.Join(v.Locations, ", "), v.Evidence...)
+		}
+	}
+	if e := fi.Expansion; e != nil && len(e.Code) > 0 {
+		var evidence []Evidence
+		for _, c := range e.Code {
+			evidence = append(evidence, Evidence{Kind: EvidenceFile, Path: c, Value: e.Name, Detail: "DEX, ELF or APK file in " + e.Name})
+		}
+		fi.flag(VerdictSuspicious, "expansion_code", "expansion file "+e.Name+" ships code, "+strings.Join(e.Code, ", "), evidence...)
+	}
+	for _, b := range fi.Behaviors {
+		fi.flag(VerdictSuspicious, b.Name, "behaves like "+b.Name+": "+b.Description, b.Evidence...)
+	}
+}
@@ -0,0 +1,70 @@
+package apkfile
+
+import (
+	"context"
+	"strings"
+)
+
+// Vulnerability is a flaw in the APK that can be exploited, on the device or
+// in the tools that process it
+type Vulnerability struct {
+	Name        string `json:"name" structs:"name"`
+	Description string `json:"description" structs:"description"`
+	// Locations are where it was found, e.g. the entry names
+	Locations []string `json:"locations" structs:"locations"`
+	// Evidence details every location
+	Evidence []Evidence `json:"evidence,omitempty" structs:"evidence,omitempty"`
+}
+
+type vulnerabilitiesAnalyzer struct{}
+
+func (vulnerabilitiesAnalyzer) Name() string    { return "vulnerabilities" }
+func (vulnerabilitiesAnalyzer) Available() bool { return true }
+
+func (vulnerabilitiesAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	a, err := target.Archive()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var vulns []Vulnerability
+	var traversal []string
+	var evidence []Evidence
+	for _, f := range a.File {
+		if zipSlip(f.Name) {
+			traversal = append(traversal, f.Name)
+			evidence = append(evidence, Evidence{Kind: EvidenceFile, Path: f.Name, Detail: "entry name escapes the extraction directory"})
+		}
+	}
+	if len(traversal) > 0 {
+		vulns = append(vulns, Vulnerability{
+			Name:        "zip_slip",
+			Description: "entry names that escape the directory they are extracted to, overwriting files of extractors that trust them",
+			Locations:   traversal,
+			Evidence:    evidence,
+		})
+	}
+	if len(vulns) == 0 {
+		return nil, nil
+	}
+	return vulns, nil
+}
+
+// zipSlip reports whether an entry name is absolute or climbs out of the
+// extraction directory, with either kind of slash since Windows extractors
+// accept both
+func zipSlip(name string) bool {
+	name = strings.Replace(name, `\`, "/", -1)
+	if strings.HasPrefix(name, "/") || len(name) > 1 && name[1] == ':' {
+		return true
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
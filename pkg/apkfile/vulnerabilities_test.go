@@ -0,0 +1,43 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestZipSlip tests finding entries that escape their extraction directory.
+func TestZipSlip(t *testing.T) {
+	path := writeZip(t, map[string]string{
+		"classes.dex":                  "dex\n035\x00",
+		"assets/../../../data/evil.so": "\x7fELF",
+		"/system/bin/sh":               "#!/bin/sh",
+		`assets\..\..\startup.bat`:     "echo",
+		"C:/Windows/evil.dll":          "MZ",
+		"assets/..hidden/file":         "ok",
+		"res/raw/notes..txt":           "ok",
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := vulnerabilitiesAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vulns := section.([]Vulnerability)
+	if len(vulns) != 1 || vulns[0].Name != "zip_slip" {
+		t.Fatalf("expected a zip_slip, got %+v", vulns)
+	}
+	got := vulns[0].Locations
+	sort.Strings(got)
+	want := []string{"/system/bin/sh", "C:/Windows/evil.dll", "assets/../../../data/evil.so", `assets\..\..\startup.bat`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if len(vulns[0].Evidence) != len(want) || vulns[0].Evidence[0].Kind != EvidenceFile {
+		t.Errorf("expected file evidence for every entry, got %#v", vulns[0].Evidence)
+	}
+}
@@ -0,0 +1,180 @@
+package apkfile
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+)
+
+// WebView is how the app configures the WebViews it shows pages in, the
+// vector of ad-fraud and phishing apps loading remote or bundled pages
+type WebView struct {
+	Settings []WebViewSetting `json:"settings,omitempty" structs:"settings,omitempty"`
+	// Interfaces are the Java objects exposed to the pages' JavaScript
+	Interfaces []JavascriptInterface `json:"javascript_interfaces,omitempty" structs:"javascript_interfaces,omitempty"`
+	// FileURLs are the file:// URLs the app loads, e.g. its bundled pages
+	FileURLs []string `json:"file_urls,omitempty" structs:"file_urls,omitempty"`
+	// Assets are the HTML and JavaScript files bundled in assets/ and res/raw/
+	Assets []string `json:"assets,omitempty" structs:"assets,omitempty"`
+}
+
+// WebViewSetting is a risky WebView setting the app turns on
+type WebViewSetting struct {
+	Name        string `json:"name" structs:"name"`
+	Description string `json:"description" structs:"description"`
+	// Location is the dex file and method, e.g. classes.dex:Lcom/foo/Bar;->onCreate
+	Location string `json:"location" structs:"location"`
+}
+
+// JavascriptInterface is an addJavascriptInterface call
+type JavascriptInterface struct {
+	// Name is the JavaScript global the object is exposed as, empty when it
+	// isn't a constant
+	Name     string `json:"name,omitempty" structs:"name,omitempty"`
+	Location string `json:"location" structs:"location"`
+}
+
+const (
+	webSettingsClass = "Landroid/webkit/WebSettings;"
+	webViewClass     = "Landroid/webkit/WebView;"
+)
+
+// webViewSettings are the setters reported unless the argument at arg, the
+// register index with this counting as 0, is a literal other than risky
+var webViewSettings = []struct {
+	class, name string
+	arg         int
+	risky       int64
+	description string
+}{
+	{webSettingsClass, "setJavaScriptEnabled", 1, 1, "runs the pages' JavaScript"},
+	{webSettingsClass, "setAllowFileAccess", 1, 1, "lets pages load files from the device"},
+	{webSettingsClass, "setAllowFileAccessFromFileURLs", 1, 1, "lets pages loaded from file:// URLs read other files"},
+	{webSettingsClass, "setAllowUniversalAccessFromFileURLs", 1, 1, "lets pages loaded from file:// URLs read any origin, e.g. to send local files anywhere"},
+	// MIXED_CONTENT_ALWAYS_ALLOW
+	{webSettingsClass, "setMixedContentMode", 1, 0, "loads HTTP content into HTTPS pages"},
+	{webViewClass, "setWebContentsDebuggingEnabled", 0, 1, "lets the pages be debugged over USB"},
+}
+
+type webViewAnalyzer struct{}
+
+func (webViewAnalyzer) Name() string    { return "webview" }
+func (webViewAnalyzer) Available() bool { return true }
+
+func (webViewAnalyzer) Run(ctx context.Context, target *Target) (Section, error) {
+	a, err := target.Archive()
+	if err == ErrNotArchive {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dexes, err := target.dexFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WebView{}
+	for _, d := range dexes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		err := d.eachMethod(func(m dexMethod) {
+			if m.insns != nil {
+				w.add(d, m)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range a.File {
+		dir := strings.SplitN(f.Name, "/", 2)[0]
+		ext := strings.ToLower(path.Ext(f.Name))
+		if (dir == "assets" || strings.HasPrefix(f.Name, "res/raw/")) && (ext == ".html" || ext == ".htm" || ext == ".js") {
+			w.Assets = append(w.Assets, f.Name)
+		}
+	}
+	sort.Strings(w.FileURLs)
+
+	if len(w.Settings) == 0 && len(w.Interfaces) == 0 && len(w.FileURLs) == 0 && len(w.Assets) == 0 {
+		return nil, nil
+	}
+	return w, nil
+}
+
+// add records the WebView calls of one method. The arguments are the last
+// constants loaded into their registers, which is how javac and d8 pass
+// literals, other values count as unknown
+func (w *WebView) add(d *dexFile, m dexMethod) {
+	location := d.name + ":" + m.ref.String()
+	literals := make(map[uint16]int64)
+	strs := make(map[uint16]string)
+
+	eachInsn(m.insns, func(op byte, insn []uint16) {
+		switch {
+		case op == 0x12: // const/4 vA, #+B
+			literals[(insn[0]>>8)&0xf] = int64(int8(insn[0]>>8) >> 4)
+		case op == 0x13: // const/16 vAA, #+BBBB
+			literals[insn[0]>>8] = int64(int16(insn[1]))
+		case op == opConstString || op == opConstStringJumbo:
+			strs[insn[0]>>8] = d.str(stringIndex(op, insn))
+		case isInvoke(op):
+			regs := invokeRegisters(op, insn)
+			ref := d.method(uint32(insn[1]))
+			w.call(ref, regs, literals, strs, location)
+		}
+	})
+}
+
+func (w *WebView) call(ref dexMethodRef, regs []uint16, literals map[uint16]int64, strs map[uint16]string, location string) {
+	for _, s := range webViewSettings {
+		if ref.class != s.class || ref.name != s.name {
+			continue
+		}
+		if s.arg < len(regs) {
+			if v, ok := literals[regs[s.arg]]; ok && v != s.risky {
+				return
+			}
+		}
+		w.Settings = append(w.Settings, WebViewSetting{Name: s.name, Description: s.description, Location: location})
+		return
+	}
+	if ref.class != webViewClass {
+		return
+	}
+	switch ref.name {
+	case "addJavascriptInterface":
+		i := JavascriptInterface{Location: location}
+		if len(regs) > 2 {
+			i.Name = strs[regs[2]]
+		}
+		w.Interfaces = append(w.Interfaces, i)
+	case "loadUrl":
+		if len(regs) > 1 {
+			if url := strs[regs[1]]; strings.HasPrefix(url, "file://") {
+				w.FileURLs = appendUnique(w.FileURLs, url)
+			}
+		}
+	}
+}
+
+// invokeRegisters returns the argument registers of an invoke instruction
+func invokeRegisters(op byte, insn []uint16) []uint16 {
+	if op >= opInvokeVirtualR {
+		// invoke-*/range {vCCCC .. vNNNN}, AA registers
+		regs := make([]uint16, insn[0]>>8)
+		for i := range regs {
+			regs[i] = insn[2] + uint16(i)
+		}
+		return regs
+	}
+	// invoke-* {vC, vD, vE, vF, vG}, A registers
+	n := int(insn[0] >> 12)
+	all := []uint16{insn[2] & 0xf, insn[2] >> 4 & 0xf, insn[2] >> 8 & 0xf, insn[2] >> 12, insn[0] >> 8 & 0xf}
+	if n > len(all) {
+		n = len(all)
+	}
+	return all[:n]
+}
@@ -0,0 +1,81 @@
+package apkfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestWebViewAnalyzer tests finding WebView settings, JavaScript interfaces
+// and bundled pages.
+func TestWebViewAnalyzer(t *testing.T) {
+	b := newDexBuilder()
+	javaScript := b.method(webSettingsClass, "setJavaScriptEnabled", "V", "Z")
+	fileAccess := b.method(webSettingsClass, "setAllowFileAccess", "V", "Z")
+	mixedContent := b.method(webSettingsClass, "setMixedContentMode", "V", "I")
+	addInterface := b.method(webViewClass, "addJavascriptInterface", "V", "Ljava/lang/Object;", stringClass)
+	loadURL := b.method(webViewClass, "loadUrl", "V", stringClass)
+	debugging := b.method(webViewClass, "setWebContentsDebuggingEnabled", "V", "Z")
+	onCreate := b.method("Lcom/example/Web;", "onCreate", "V")
+	bridge := b.str("Android")
+	page := b.str("file:///android_asset/www/index.html")
+
+	b.class("Lcom/example/Web;", "Ljava/lang/Object;",
+		builderMethod{onCreate, []uint16{
+			0x1112,                             // const/4 v1, #1
+			0x206e, uint16(javaScript), 0x0010, // invoke-virtual {v0, v1}
+			0x0212,                             // const/4 v2, #0
+			0x206e, uint16(fileAccess), 0x0020, // invoke-virtual {v0, v2}
+			0x0312,                               // const/4 v3, #0
+			0x206e, uint16(mixedContent), 0x0030, // invoke-virtual {v0, v3}
+			0x0413, 0x0002, // const/16 v4, #2
+			0x206e, uint16(mixedContent), 0x0040, // invoke-virtual {v0, v4}
+			0x021a, uint16(bridge), // const-string v2
+			0x306e, uint16(addInterface), 0x0265, // invoke-virtual {v5, v6, v2}
+			0x021a, uint16(page), // const-string v2
+			0x206e, uint16(loadURL), 0x0025, // invoke-virtual {v5, v2}
+			0x1071, uint16(debugging), 0x0001, // invoke-static {v1}
+			0x000e,
+		}},
+	)
+	path := writeZip(t, map[string]string{
+		"classes.dex":           string(b.build()),
+		"assets/www/index.html": "<html></html>",
+		"assets/data.bin":       "data",
+		"res/raw/bridge.js":     "Android.send()",
+	})
+	defer os.Remove(path)
+
+	target := &Target{Path: path}
+	defer target.close()
+	section, err := webViewAnalyzer{}.Run(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := section.(*WebView)
+
+	var settings []string
+	for _, s := range w.Settings {
+		settings = append(settings, s.Name)
+	}
+	if want := []string{"setJavaScriptEnabled", "setMixedContentMode", "setWebContentsDebuggingEnabled"}; !reflect.DeepEqual(settings, want) {
+		t.Errorf("expected settings %q, got %q", want, settings)
+	}
+	if want := "classes.dex:Lcom/example/Web;->onCreate"; len(w.Settings) > 0 && w.Settings[0].Location != want {
+		t.Errorf("expected location %q, got %q", want, w.Settings[0].Location)
+	}
+	if len(w.Interfaces) != 1 || w.Interfaces[0].Name != "Android" {
+		t.Errorf("unexpected JavaScript interfaces %+v", w.Interfaces)
+	}
+	if want := []string{"file:///android_asset/www/index.html"}; !reflect.DeepEqual(w.FileURLs, want) {
+		t.Errorf("expected file URLs %q, got %q", want, w.FileURLs)
+	}
+	assets := map[string]bool{}
+	for _, a := range w.Assets {
+		assets[a] = true
+	}
+	if len(assets) != 2 || !assets["assets/www/index.html"] || !assets["res/raw/bridge.js"] {
+		t.Errorf("unexpected assets %q", w.Assets)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/go-redis/redis"
+	nats "github.com/nats-io/nats.go"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// scanJob is a request to scan a file that is reachable from this host
+type scanJob struct {
+	// ID is the Malice scan ID, it defaults to the file's SHA256
+	ID   string `json:"id,omitempty"`
+	Path string `json:"path"`
+	// Expansion is an OBB expansion file shipped with the APK at Path, and
+	// ExpansionName its original name when the file was renamed
+	Expansion     string `json:"expansion,omitempty"`
+	ExpansionName string `json:"expansion_name,omitempty"`
+	// Priority orders the jobs waiting in the local bolt queue, higher ones
+	// are scanned first, e.g. analysts' submissions ahead of bulk re-scans
+	Priority int `json:"priority,omitempty"`
+	// Cleanup removes Path and Expansion once the job is finished, it is only
+	// honoured by the local bolt queue for samples uploaded to the web service
+	Cleanup bool `json:"cleanup,omitempty"`
+	// Dir is the upload's private scan directory holding Path and Expansion,
+	// Cleanup removes it whole
+	Dir string `json:"dir,omitempty"`
+	// Submission is stored with the results, e.g. the case or campaign tags
+	Submission *apkfile.Submission `json:"submission,omitempty"`
+
+	// raw is the job as it was read from the queue
+	raw []byte
+	// handle is the queue specific delivery handle used to ack the job
+	handle interface{}
+}
+
+// jobQueue is a source of scan jobs for the worker daemon
+type jobQueue interface {
+	// Next blocks until a job is available or ctx is done
+	Next(ctx context.Context) (scanJob, error)
+	// Ack marks a job as processed so it isn't delivered again
+	Ack(job scanJob) error
+	Close() error
+}
+
+// retryQueue is implemented by queues that can redeliver failed jobs later
+type retryQueue interface {
+	Fail(job scanJob, err error) error
+}
+
+// resultQueue is implemented by queues that keep the results of their jobs
+type resultQueue interface {
+	Complete(job scanJob, result interface{}) error
+}
+
+// openJobQueue connects to the queue described by rawurl, one of
+//
+//	dir:///path/to/jobs
+//	redis://host:6379/0?key=fileinfo
+//	nats://host:4222?subject=fileinfo&group=fileinfo
+//	kafka://broker1:9092,broker2:9092?topic=fileinfo&group=fileinfo
+func openJobQueue(rawurl string) (jobQueue, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+
+	switch u.Scheme {
+	case "dir", "file":
+		return newDirQueue(localPath(u.Path))
+	case "redis":
+		opts, err := redis.ParseURL(strings.SplitN(rawurl, "?", 2)[0])
+		if err != nil {
+			return nil, err
+		}
+		return &redisQueue{
+			client: redis.NewClient(opts),
+			key:    getQuery(q, "key", "fileinfo"),
+		}, nil
+	case "nats":
+		nc, err := nats.Connect(u.Scheme + "://" + u.Host)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := nc.QueueSubscribeSync(getQuery(q, "subject", "fileinfo"), getQuery(q, "group", "fileinfo"))
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+		return &natsQueue{conn: nc, sub: sub}, nil
+	case "kafka":
+		return &kafkaQueue{
+			reader: kafka.NewReader(kafka.ReaderConfig{
+				Brokers: strings.Split(u.Host, ","),
+				Topic:   getQuery(q, "topic", "fileinfo"),
+				GroupID: getQuery(q, "group", "fileinfo"),
+			}),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported queue %q", rawurl)
+}
+
+func getQuery(q url.Values, key, dfault string) string {
+	if v := q.Get(key); v != "" {
+		return v
+	}
+	return dfault
+}
+
+// decodeJob accepts either a JSON job or a bare file path
+func decodeJob(data []byte) (scanJob, error) {
+	job := scanJob{raw: data}
+
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal([]byte(trimmed), &job); err != nil {
+			return job, err
+		}
+		// only the web service may hand its samples over to the queue
+		job.Cleanup, job.Dir = false, ""
+	} else {
+		job.Path = trimmed
+	}
+	if job.Path == "" {
+		return job, fmt.Errorf("scan job has no path: %q", trimmed)
+	}
+
+	return job, nil
+}
+
+// dirQueue reads one job per file from a directory, jobs are claimed by moving
+// them into the .processing sub-directory so several workers can share it
+type dirQueue struct {
+	dir        string
+	processing string
+	poll       time.Duration
+}
+
+// defaultJobQueue is the jobs directory of the Docker image's /malware volume,
+// or one in the temp directory where there is no such volume
+func defaultJobQueue() string {
+	dir := "/malware"
+	if fi, err := os.Stat(dir); runtime.GOOS == "windows" || err != nil || !fi.IsDir() {
+		dir = filepath.Join(os.TempDir(), "malice")
+	}
+	path := filepath.ToSlash(filepath.Join(dir, "jobs"))
+	if !strings.HasPrefix(path, "/") {
+		// C:/Users/... would be taken for the host "C:"
+		path = "/" + path
+	}
+	return "dir://" + path
+}
+
+// localPath turns the path of a dir:// URL back into a file path, dropping
+// the slash in front of a Windows drive letter
+func localPath(path string) string {
+	if runtime.GOOS == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path)
+}
+
+func newDirQueue(dir string) (*dirQueue, error) {
+	processing := filepath.Join(dir, ".processing")
+	if err := os.MkdirAll(processing, 0700); err != nil {
+		return nil, err
+	}
+	return &dirQueue{dir: dir, processing: processing, poll: time.Second}, nil
+}
+
+func (d *dirQueue) Next(ctx context.Context) (scanJob, error) {
+	for {
+		files, err := ioutil.ReadDir(d.dir)
+		if err != nil {
+			return scanJob{}, err
+		}
+		// oldest first
+		sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+			claimed := filepath.Join(d.processing, f.Name())
+			if err := os.Rename(filepath.Join(d.dir, f.Name()), claimed); err != nil {
+				// another worker got there first
+				continue
+			}
+			data, err := ioutil.ReadFile(claimed)
+			if err != nil {
+				return scanJob{}, err
+			}
+			job, err := decodeJob(data)
+			job.handle = claimed
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return scanJob{}, ctx.Err()
+		case <-time.After(d.poll):
+		}
+	}
+}
+
+func (d *dirQueue) Ack(job scanJob) error {
+	return os.Remove(job.handle.(string))
+}
+
+func (d *dirQueue) Close() error { return nil }
+
+// redisQueue pops jobs off a Redis list, keeping them on <key>:processing
+// until they are acked
+type redisQueue struct {
+	client *redis.Client
+	key    string
+}
+
+func (r *redisQueue) Next(ctx context.Context) (scanJob, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return scanJob{}, err
+		}
+		raw, err := r.client.BRPopLPush(r.key, r.key+":processing", time.Second).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return scanJob{}, err
+		}
+		return decodeJob([]byte(raw))
+	}
+}
+
+func (r *redisQueue) Ack(job scanJob) error {
+	return r.client.LRem(r.key+":processing", 1, string(job.raw)).Err()
+}
+
+func (r *redisQueue) Close() error { return r.client.Close() }
+
+// natsQueue receives jobs from a NATS queue group, core NATS has no
+// redelivery so acking is a no-op
+type natsQueue struct {
+	conn *nats.Conn
+	sub  *nats.Subscription
+}
+
+func (n *natsQueue) Next(ctx context.Context) (scanJob, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return scanJob{}, err
+		}
+		msg, err := n.sub.NextMsg(time.Second)
+		if err == nats.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			return scanJob{}, err
+		}
+		return decodeJob(msg.Data)
+	}
+}
+
+func (n *natsQueue) Ack(job scanJob) error { return nil }
+
+func (n *natsQueue) Close() error {
+	n.conn.Close()
+	return nil
+}
+
+// kafkaQueue consumes jobs from a Kafka topic as part of a consumer group,
+// offsets are committed when jobs are acked
+type kafkaQueue struct {
+	reader *kafka.Reader
+}
+
+func (k *kafkaQueue) Next(ctx context.Context) (scanJob, error) {
+	msg, err := k.reader.FetchMessage(ctx)
+	if err != nil {
+		return scanJob{}, err
+	}
+	job, err := decodeJob(msg.Value)
+	job.handle = msg
+	return job, err
+}
+
+func (k *kafkaQueue) Ack(job scanJob) error {
+	return k.reader.CommitMessages(context.Background(), job.handle.(kafka.Message))
+}
+
+func (k *kafkaQueue) Close() error { return k.reader.Close() }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// resultsField is where the plugin's results are in the malice index
+const resultsField = "plugins." + category + "." + name
+
+// elasticReputation looks up signers in the results earlier scans wrote to
+// elasticsearch
+type elasticReputation struct {
+	// base is the elasticsearch's URL and url the malice index' search
+	base   string
+	url    string
+	client *http.Client
+}
+
+// newElasticReputation searches the malice index of the elasticsearch at addr,
+// a host, host:port or URL like --elasitcsearch
+func newElasticReputation(addr string) *elasticReputation {
+	if addr == "" {
+		addr = "elasticsearch"
+	}
+	if !strings.Contains(addr, "://") {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr += ":9200"
+		}
+		addr = "http://" + addr
+	}
+	base := strings.TrimSuffix(addr, "/")
+	return &elasticReputation{base: base, url: base + "/malice/_search", client: http.DefaultClient}
+}
+
+func (e *elasticReputation) SignerReputation(ctx context.Context, fingerprint, exclude string) (apkfile.SignerReputation, error) {
+	var rep apkfile.SignerReputation
+
+	query := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					term(resultsField+".signers.sha256.keyword", fingerprint),
+				},
+				"must_not": []interface{}{
+					term(resultsField+".hashes.sha256.keyword", exclude),
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"verdicts": terms(resultsField+".verdict.verdict.keyword", 10, "none"),
+			"packages": terms(resultsField+".impersonation.package.keyword", 20, nil),
+		},
+	}
+
+	var result struct {
+		Hits struct {
+			// Total is a number before elasticsearch 7 and an object after
+			Total json.RawMessage `json:"total"`
+		} `json:"hits"`
+		Aggregations map[string]struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int    `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"aggregations"`
+	}
+	if found, err := e.search(ctx, query, &result); err != nil || !found {
+		return rep, err
+	}
+
+	if err := json.Unmarshal(result.Hits.Total, &rep.Samples); err != nil {
+		var total struct {
+			Value int `json:"value"`
+		}
+		if err := json.Unmarshal(result.Hits.Total, &total); err != nil {
+			return rep, fmt.Errorf("unexpected hits total %s", result.Hits.Total)
+		}
+		rep.Samples = total.Value
+	}
+	for _, b := range result.Aggregations["verdicts"].Buckets {
+		if rep.Verdicts == nil {
+			rep.Verdicts = make(map[string]int)
+		}
+		rep.Verdicts[b.Key] = b.DocCount
+	}
+	for _, b := range result.Aggregations["packages"].Buckets {
+		rep.Packages = append(rep.Packages, b.Key)
+	}
+	return rep, nil
+}
+
+// maxPackageScans is how many earlier scans of a package are compared against
+const maxPackageScans = 10
+
+func (e *elasticReputation) PackageScans(ctx context.Context, pkg, exclude string) ([]apkfile.PackageScan, error) {
+	field := resultsField + ".update_analysis.current"
+	query := map[string]interface{}{
+		"size":    maxPackageScans,
+		"_source": []string{field},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					term(field+".package.keyword", pkg),
+				},
+				"must_not": []interface{}{
+					term(resultsField+".hashes.sha256.keyword", exclude),
+				},
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{field + ".version_code": "desc"},
+		},
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if found, err := e.search(ctx, query, &result); err != nil || !found {
+		return nil, err
+	}
+
+	var scans []apkfile.PackageScan
+	for _, hit := range result.Hits.Hits {
+		var doc struct {
+			Plugins map[string]map[string]struct {
+				UpdateAnalysis struct {
+					Current apkfile.PackageScan `json:"current"`
+				} `json:"update_analysis"`
+			} `json:"plugins"`
+		}
+		if err := json.Unmarshal(hit.Source, &doc); err != nil {
+			return nil, err
+		}
+		scans = append(scans, doc.Plugins[category][name].UpdateAnalysis.Current)
+	}
+	return scans, nil
+}
+
+// search runs query against the malice index and decodes the response into
+// result, it reports false when nothing was ever written to the index
+func (e *elasticReputation) search(ctx context.Context, query map[string]interface{}, result interface{}) (bool, error) {
+	return e.searchURL(ctx, e.url, query, result)
+}
+
+// searchURL runs query against the search endpoint url, see search
+func (e *elasticReputation) searchURL(ctx context.Context, url string, query map[string]interface{}, result interface{}) (bool, error) {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return false, err
+	}
+	return e.post(ctx, url, "application/json", body, result)
+}
+
+// post sends body to url and decodes the response into result, it reports
+// false when the index isn't there
+func (e *elasticReputation) post(ctx context.Context, url, contentType string, body []byte, result interface{}) (bool, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("elasticsearch request failed: %s", resp.Status)
+	}
+	return true, json.NewDecoder(resp.Body).Decode(result)
+}
+
+func term(field, value string) map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{field: value}}
+}
+
+// terms is a terms aggregation, missing is the bucket of documents without field
+func terms(field string, size int, missing interface{}) map[string]interface{} {
+	agg := map[string]interface{}{"field": field, "size": size}
+	if missing != nil {
+		agg["missing"] = missing
+	}
+	return map[string]interface{}{"terms": agg}
+}
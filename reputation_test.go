@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// TestElasticReputation tests the signer lookup against a fake elasticsearch.
+func TestElasticReputation(t *testing.T) {
+	for _, total := range []string{`3`, `{"value": 3, "relation": "eq"}`} {
+		var query string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/malice/_search" {
+				t.Errorf("unexpected path %s", r.URL.Path)
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			query = string(body)
+			w.Write([]byte(`{"hits": {"total": ` + total + `, "hits": []}, "aggregations": {
+				"verdicts": {"buckets": [{"key": "malicious", "doc_count": 2}, {"key": "none", "doc_count": 1}]},
+				"packages": {"buckets": [{"key": "com.flash.update", "doc_count": 3}]}}}`))
+		}))
+
+		rep, err := newElasticReputation(ts.URL).SignerReputation(context.Background(), "c0ffee", "deadbeef")
+		ts.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := apkfile.SignerReputation{Samples: 3, Verdicts: map[string]int{"malicious": 2, "none": 1}, Packages: []string{"com.flash.update"}}
+		if !reflect.DeepEqual(rep, want) {
+			t.Errorf("expected %#v, got %#v", want, rep)
+		}
+		if !json.Valid([]byte(query)) || !strings.Contains(query, `"plugins.metadata.apkfile.signers.sha256.keyword":"c0ffee"`) ||
+			!strings.Contains(query, `"plugins.metadata.apkfile.hashes.sha256.keyword":"deadbeef"`) {
+			t.Errorf("unexpected query %s", query)
+		}
+	}
+
+	for addr, want := range map[string]string{
+		"":                    "http://elasticsearch:9200/malice/_search",
+		"elastic":             "http://elastic:9200/malice/_search",
+		"elastic:9201":        "http://elastic:9201/malice/_search",
+		"https://es.example/": "https://es.example/malice/_search",
+	} {
+		if got := newElasticReputation(addr).url; got != want {
+			t.Errorf("newElasticReputation(%q) searches %s, want %s", addr, got, want)
+		}
+	}
+}
+
+// TestElasticPackageScans tests the package lookup against a fake elasticsearch.
+func TestElasticPackageScans(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		query = string(body)
+		w.Write([]byte(`{"hits": {"total": 1, "hits": [{"_source": {"plugins": {"metadata": {"apkfile": {"update_analysis": {"current": {
+			"sha256": "c0ffee", "package": "com.bank.mobile", "version_code": 411, "signers": ["5e6f"], "permissions": ["android.permission.INTERNET"]}}}}}}}]}}`))
+	}))
+	defer ts.Close()
+
+	scans, err := newElasticReputation(ts.URL).PackageScans(context.Background(), "com.bank.mobile", "deadbeef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []apkfile.PackageScan{{SHA256: "c0ffee", Package: "com.bank.mobile", VersionCode: 411, Signers: []string{"5e6f"}, Permissions: []string{"android.permission.INTERNET"}}}
+	if !reflect.DeepEqual(scans, want) {
+		t.Errorf("expected %#v, got %#v", want, scans)
+	}
+	if !strings.Contains(query, `"plugins.metadata.apkfile.update_analysis.current.package.keyword":"com.bank.mobile"`) ||
+		!strings.Contains(query, `"plugins.metadata.apkfile.hashes.sha256.keyword":"deadbeef"`) {
+		t.Errorf("unexpected query %s", query)
+	}
+}
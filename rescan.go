@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// rescanConfig configures the rescan daemon
+type rescanConfig struct {
+	// Samples are the directories the scanned samples are kept in, they are
+	// walked recursively
+	Samples []string
+	// Interval is how often the configuration is reloaded to check whether
+	// the analyzers, tools or rules changed
+	Interval time.Duration
+	Timeout  time.Duration
+	// EventsURL receives every change event as a JSON POST, empty only logs them
+	EventsURL string
+	// Once runs a single pass instead of a daemon
+	Once bool
+}
+
+// rescanEvent is emitted when a stored report is replaced by a re-scan
+type rescanEvent struct {
+	ID       string `json:"id"`
+	SHA256   string `json:"sha256"`
+	Path     string `json:"path"`
+	Revision int    `json:"revision"`
+	// Scanner and Previous are the digests of the scanners that produced the
+	// new and the replaced report
+	Scanner  string `json:"scanner"`
+	Previous string `json:"previous,omitempty"`
+	// Changes are how the findings differ, e.g. "verdict clean -> malicious",
+	// "tag +banker" or "section -billing", empty when only the scanner did
+	Changes []string `json:"changes,omitempty"`
+	Time    string   `json:"time"`
+}
+
+// storedReport is the latest report of a sample in elasticsearch
+type storedReport struct {
+	ID       string
+	FileInfo apkfile.FileInfo
+}
+
+// StoredReport returns the report stored for the sample with sha256, merged
+// with its refreshed sections, false when there is none
+func (e *elasticReputation) StoredReport(ctx context.Context, sha256 string) (storedReport, bool, error) {
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				ID     string `json:"_id"`
+				Source struct {
+					Plugins map[string]map[string]apkfile.FileInfo `json:"plugins"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	search := map[string]interface{}{
+		"size":    1,
+		"_source": []string{resultsField},
+		"query":   reportFilter{Hash: sha256}.query(),
+		"sort":    []interface{}{map[string]interface{}{resultsField + ".revision": map[string]interface{}{"order": "desc", "unmapped_type": "long"}}},
+	}
+	if found, err := e.search(ctx, search, &result); err != nil || !found || len(result.Hits.Hits) == 0 {
+		return storedReport{}, false, err
+	}
+	hit := result.Hits.Hits[0]
+	reports, err := e.mergeRefreshed(ctx, []apkfile.FileInfo{hit.Source.Plugins[category][name]})
+	if err != nil {
+		return storedReport{}, false, err
+	}
+	return storedReport{ID: hit.ID, FileInfo: reports[0]}, true, nil
+}
+
+// rescanner replaces the stored reports of the samples the current scanner
+// didn't produce
+type rescanner struct {
+	cfg   rescanConfig
+	store *elasticReputation
+	// scan and write are rc.scanner's scan and writeToDatabase, replaced by tests
+	scan   func(ctx context.Context, path string, hashes apkfile.FileHashes) (apkfile.FileInfo, error)
+	write  func(id string, fileInfo apkfile.FileInfo)
+	client *http.Client
+}
+
+// newRescanner re-scans with the scanner and stores the reports in the
+// elasticsearch of rc
+func newRescanner(cfg rescanConfig, rc *runtimeConfig) *rescanner {
+	return &rescanner{
+		cfg:   cfg,
+		store: newElasticReputation(rc.elastic),
+		scan:  rc.scanner.ScanHashed,
+		write: func(id string, fileInfo apkfile.FileInfo) {
+			writeToDatabase(rc.elastic, id, fileInfo)
+		},
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// pass re-scans every sample whose stored report another scanner than digest
+// produced, samples without a report are skipped. It returns how many it
+// re-scanned and the first error that may have left reports behind
+func (r *rescanner) pass(ctx context.Context, digest string) (int, error) {
+	var rescanned int
+	var failed error
+	seen := make(map[string]bool)
+	for _, dir := range r.cfg.Samples {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// skips e.g. the queue's .processing/ and the feed caches
+			if strings.HasPrefix(info.Name(), ".") && path != dir {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			hashes, err := apkfile.HashFile(path)
+			if err != nil {
+				return err
+			}
+			if seen[hashes.SHA256] {
+				return nil
+			}
+			seen[hashes.SHA256] = true
+
+			done, err := r.rescan(ctx, path, hashes, digest)
+			if done {
+				rescanned++
+			}
+			if err != nil {
+				log.WithError(err).WithField("path", path).Error("re-scan failed")
+				if failed == nil {
+					failed = err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return rescanned, err
+		}
+	}
+	return rescanned, failed
+}
+
+// rescan replaces the stored report of one sample unless digest produced it
+func (r *rescanner) rescan(ctx context.Context, path string, hashes apkfile.FileHashes, digest string) (bool, error) {
+	stored, found, err := r.store.StoredReport(ctx, hashes.SHA256)
+	if err != nil || !found || stored.FileInfo.Scanner == digest {
+		return false, err
+	}
+
+	scanCtx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+	fileInfo, err := r.scan(scanCtx, path, hashes)
+	if err != nil {
+		return false, err
+	}
+	// a partial scan would replace findings with errors
+	if fileInfo.Partial() && !stored.FileInfo.Partial() {
+		return false, fmt.Errorf("partial results, keeping the stored report: %v", fileInfo.Errors)
+	}
+	observeTimings(fileInfo.Timings)
+	fileInfo.Scanner = digest
+	fileInfo.Revision = stored.FileInfo.Revision + 1
+	if cache != nil && !fileInfo.Partial() {
+		cache.Set(cacheKey(digest, hashes.SHA256), fileInfo)
+	}
+	// the submitter's tags belong to the sample, not to the scanner
+	fileInfo.Submission = stored.FileInfo.Submission
+
+	fileInfo.MarkDown = generateMarkDownTable(fileInfo)
+	r.write(stored.ID, fileInfo)
+
+	r.emit(rescanEvent{
+		ID:       stored.ID,
+		SHA256:   hashes.SHA256,
+		Path:     path,
+		Revision: fileInfo.Revision,
+		Scanner:  digest,
+		Previous: stored.FileInfo.Scanner,
+		Changes:  reportChanges(stored.FileInfo, fileInfo),
+		Time:     time.Now().UTC().Format(time.RFC3339),
+	})
+	return true, nil
+}
+
+// emit logs a change event and posts it to the events URL
+func (r *rescanner) emit(event rescanEvent) {
+	entry := log.WithFields(log.Fields{"id": event.ID, "sha256": event.SHA256, "revision": event.Revision})
+	if len(event.Changes) == 0 {
+		entry.Debug("report re-scanned, findings unchanged")
+	} else {
+		entry.Info("report re-scanned: ", strings.Join(event.Changes, ", "))
+	}
+	if r.cfg.EventsURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		entry.WithError(err).Error("failed to encode change event")
+		return
+	}
+	resp, err := r.client.Post(r.cfg.EventsURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		entry.WithError(err).Error("failed to post change event")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		entry.Errorf("posting change event failed: %s", resp.Status)
+	}
+}
+
+// reportChanges lists how the findings of two reports of a sample differ:
+// the verdict, the tags and the sections present
+func reportChanges(before, after apkfile.FileInfo) []string {
+	var changes []string
+	verdict := func(fi apkfile.FileInfo) string {
+		if fi.Verdict == nil {
+			return "none"
+		}
+		return fi.Verdict.Verdict
+	}
+	if verdict(before) != verdict(after) {
+		changes = append(changes, "verdict "+verdict(before)+" -> "+verdict(after))
+	}
+	changes = append(changes, setChanges("tag", before.Tags, after.Tags)...)
+	return append(changes, setChanges("section", sections(before), sections(after))...)
+}
+
+// setChanges lists the elements added to and removed from a set as
+// "kind +element" and "kind -element"
+func setChanges(kind string, before, after []string) []string {
+	var changes []string
+	for _, s := range after {
+		if !containsString(before, s) {
+			changes = append(changes, kind+" +"+s)
+		}
+	}
+	for _, s := range before {
+		if !containsString(after, s) {
+			changes = append(changes, kind+" -"+s)
+		}
+	}
+	return changes
+}
+
+// sections are the names of the report's findings, what it holds apart from
+// the bookkeeping of the scan
+func sections(fi apkfile.FileInfo) []string {
+	fi.MarkDown, fi.Timings, fi.Errors, fi.Warnings, fi.Scanner, fi.Revision, fi.ScannedAt = "", nil, nil, nil, "", 0, nil
+	fi.Verdict, fi.Tags, fi.Submission, fi.Sections = nil, nil, nil, nil
+	data, err := json.Marshal(fi)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	var names []string
+	for name, value := range fields {
+		if !emptyJSON(value) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// emptyJSON reports whether a decoded JSON value only holds zero values,
+// e.g. the magic of a report stored without one
+func emptyJSON(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		for _, e := range v {
+			if !emptyJSON(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// rescanService re-scans the stored samples with every new scanner until it
+// receives SIGINT or SIGTERM. The configuration is reloaded every interval,
+// and on SIGHUP, so changed rule files and feeds start a new pass
+func rescanService(cfg rescanConfig) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Infof("received %s, stopping after the current scan", sig)
+		cancel()
+	}()
+
+	reloadOnSIGHUP()
+
+	log.Infof("re-scanning the samples in %s every %s", strings.Join(cfg.Samples, ", "), cfg.Interval)
+
+	var done string
+	for {
+		rc, release := acquireConfig()
+		digest := rc.scannerDigest()
+		var err error
+		if digest != done {
+			log.WithField("scanner", digest).Info("scanner changed, re-scanning stored reports")
+			var n int
+			n, err = newRescanner(cfg, rc).pass(ctx, digest)
+			switch {
+			case err == nil:
+				done = digest
+				log.WithField("scanner", digest).Infof("re-scanned %d reports", n)
+			case ctx.Err() == nil:
+				// the next pass retries the samples left behind
+				log.WithError(err).Errorf("re-scanned %d reports, some are left", n)
+			}
+		}
+		release()
+
+		if cfg.Once {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cfg.Interval):
+		}
+		if err := reloadConfig(); err != nil {
+			log.WithError(err).Error("reload failed, keeping the current configuration")
+		}
+	}
+}
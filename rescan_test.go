@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// TestRescanPass tests re-scanning the stored reports another scanner produced and emitting their changes.
+func TestRescanPass(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rescan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "sample.apk"), []byte("sample"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a copy being processed by the queue is skipped
+	if err := os.Mkdir(filepath.Join(dir, ".processing"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".processing", "other.apk"), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := `{"scanner": "old", "revision": 1, "verdict": {"verdict": "suspicious"}, "tags": ["dropper"], "ssdeep": "3:abc"}`
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"hits": {"hits": [{"_id": "scan-1", "_source": {"plugins": {"metadata": {"apkfile": ` + stored + `}}}}]}}`))
+	}))
+	defer es.Close()
+	events := make(chan rescanEvent, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event rescanEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Error(err)
+		}
+		events <- event
+	}))
+	defer hook.Close()
+
+	var scanned []string
+	var written []apkfile.FileInfo
+	r := &rescanner{
+		cfg:   rescanConfig{Samples: []string{dir}, Timeout: time.Minute, EventsURL: hook.URL},
+		store: newElasticReputation(es.URL),
+		scan: func(ctx context.Context, path string, hashes apkfile.FileHashes) (apkfile.FileInfo, error) {
+			scanned = append(scanned, filepath.Base(path))
+			return apkfile.FileInfo{
+				Hashes:  hashes,
+				Verdict: &apkfile.Verdict{Verdict: "malicious"},
+				Tags:    []string{"dropper", "banker"},
+				Billing: &apkfile.Billing{TollFraudRisk: true},
+			}, nil
+		},
+		write: func(id string, fileInfo apkfile.FileInfo) {
+			if id != "scan-1" {
+				t.Errorf("expected the stored document to be replaced, got %s", id)
+			}
+			written = append(written, fileInfo)
+		},
+		client: http.DefaultClient,
+	}
+
+	n, err := r.pass(context.Background(), "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || !reflect.DeepEqual(scanned, []string{"sample.apk"}) || len(written) != 1 {
+		t.Fatalf("expected sample.apk to be re-scanned once, got %d %v", n, scanned)
+	}
+	if written[0].Scanner != "new" || written[0].Revision != 2 || written[0].MarkDown == "" {
+		t.Errorf("unexpected stored report %+v", written[0])
+	}
+	event := <-events
+	want := []string{"verdict suspicious -> malicious", "tag +banker", "section +billing", "section +hashes", "section -ssdeep"}
+	if event.ID != "scan-1" || event.Previous != "old" || event.Revision != 2 || !reflect.DeepEqual(event.Changes, want) {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	// the reports of the current scanner are left alone
+	stored = `{"scanner": "new", "revision": 2}`
+	if n, err := r.pass(context.Background(), "new"); err != nil || n != 0 || len(scanned) != 1 {
+		t.Errorf("expected no re-scan, got %d %v", n, err)
+	}
+}
@@ -6,19 +6,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"io/ioutil"
 	"net/http"
 	"os"
-	"strings"
+	"runtime"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
 	"github.com/fatih/structs"
-	"github.com/gorilla/mux"
 	"github.com/maliceio/go-plugin-utils/database/elasticsearch"
 	"github.com/maliceio/go-plugin-utils/utils"
 	"github.com/parnurzeal/gorequest"
-	"github.com/rakyll/magicmime"
 	"github.com/urfave/cli"
 )
 
@@ -27,8 +25,6 @@ var (
 	Version string
 	// BuildTime stores the plugin's build time
 	BuildTime string
-
-	fi FileInfo
 )
 
 const (
@@ -37,189 +33,165 @@ const (
 )
 
 type pluginResults struct {
-	ID       string   `structs:"id"`
-	FileInfo FileInfo `structs:"fileinfo"`
-}
-
-// FileMagic is file magic
-type FileMagic struct {
-	Mime        string `json:"mime" structs:"mime"`
-	Description string `json:"description" structs:"description"`
-}
-
-// FileInfo json object
-type FileInfo struct {
-	Magic    FileMagic         `json:"magic" structs:"magic"`
-	SSDeep   string            `json:"ssdeep" structs:"ssdeep"`
-	TRiD     []string          `json:"trid" structs:"trid"`
-	Exiftool map[string]string `json:"exiftool" structs:"exiftool"`
-	MarkDown string            `json:"markdown,omitempty" structs:"markdown,omitempty"`
-	APKFile  string            `json:"apk_file" structs:"apk_file"`
+	ID       string           `structs:"id"`
+	FileInfo apkfile.FileInfo `structs:"fileinfo"`
 }
 
-// GetFileMimeType returns the mime-type of a file path
-func GetFileMimeType(ctx context.Context, path string) error {
-
-	c := make(chan struct {
-		mimetype string
-		err      error
-	}, 1)
-
-	go func() {
-		utils.Assert(magicmime.Open(magicmime.MAGIC_MIME_TYPE | magicmime.MAGIC_SYMLINK | magicmime.MAGIC_ERROR))
-		defer magicmime.Close()
-
-		mt, err := magicmime.TypeByFile(path)
-		pack := struct {
-			mimetype string
-			err      error
-		}{mt, err}
-		c <- pack
-	}()
-
-	select {
-	case <-ctx.Done():
-		<-c // Wait for mime
-		fmt.Println("Cancel the context")
-		return ctx.Err()
-	case ok := <-c:
-		if ok.err != nil {
-			fi.Magic.Mime = ok.err.Error()
-			return ok.err
-		}
-		fi.Magic.Mime = ok.mimetype
-		return nil
+// newScanner builds the scanner from the global tool flags
+func newScanner(c *cli.Context, opts ...apkfile.Option) (*apkfile.Scanner, error) {
+	backend, err := apkfile.NewBackend(c.GlobalString("sandbox"), c.GlobalString("sandbox-image"))
+	if err != nil {
+		return nil, err
 	}
-}
 
-// GetFileDescription returns the textual libmagic type of a file path
-func GetFileDescription(ctx context.Context, path string) error {
-
-	c := make(chan struct {
-		magicdesc string
-		err       error
-	}, 1)
-
-	go func() {
-		utils.Assert(magicmime.Open(magicmime.MAGIC_SYMLINK | magicmime.MAGIC_ERROR))
-		defer magicmime.Close()
-
-		magicdesc, err := magicmime.TypeByFile(path)
-		pack := struct {
-			magicdesc string
-			err       error
-		}{magicdesc, err}
-		c <- pack
-	}()
-
-	select {
-	case <-ctx.Done():
-		<-c // Wait for mime
-		fmt.Println("Cancel the context")
-		return ctx.Err()
-	case ok := <-c:
-		if ok.err != nil {
-			fi.Magic.Description = ok.err.Error()
-			return ok.err
-		}
-		fi.Magic.Description = ok.magicdesc
-		return nil
+	opts = append([]apkfile.Option{
+		apkfile.WithLimits(apkfile.Limits{
+			CPU:      c.GlobalUint64("tool-cpu"),
+			Memory:   c.GlobalUint64("tool-mem") << 20,
+			FileSize: c.GlobalUint64("tool-fsize") << 20,
+			NProc:    c.GlobalUint64("tool-nproc"),
+		}),
+		apkfile.WithRetryPolicy(apkfile.RetryPolicy{
+			Attempts: c.GlobalInt("tool-retries") + 1,
+			Backoff:  c.GlobalDuration("tool-retry-backoff"),
+		}),
+		apkfile.WithBackend(backend),
+		apkfile.WithAPKBackend(c.GlobalString("apk-backend"), c.GlobalString("androguard-helper")),
+		apkfile.WithMaxEntrySize(c.GlobalInt64("max-analyzed-entry-size") << 20),
+		apkfile.WithStringsLimit(c.GlobalInt("strings-limit")),
+	}, opts...)
+
+	if c.GlobalBool("strings-raw") {
+		opts = append(opts, apkfile.WithRawStrings())
 	}
-}
 
-// ParseExiftoolOutput convert exiftool output into JSON
-func ParseExiftoolOutput(exifout string, err error) map[string]string {
-
-	if err != nil {
-		m := make(map[string]string)
-		m["error"] = err.Error()
-		return m
+	if c.GlobalBool("class-list") {
+		opts = append(opts, apkfile.WithClassList())
 	}
 
-	var ignoreTags = []string{
-		"Directory",
-		"File Name",
-		"File Permissions",
-		"File Modification Date/Time",
+	if path := c.GlobalString("secret-rules"); path != "" {
+		rules, err := apkfile.LoadSecretRules(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, apkfile.WithSecretRules(rules))
 	}
 
-	lines := strings.Split(exifout, "\n")
-
-	log.Debugln("Exiftool lines: ", lines)
-
-	if utils.SliceContainsString("File not found", lines) {
-		return nil
+	if path := c.GlobalString("signer-blocklist"); path != "" {
+		entries, err := apkfile.LoadSignerBlocklist(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, apkfile.WithSignerBlocklist(entries))
 	}
 
-	datas := make(map[string]string, len(lines))
-
-	for _, line := range lines {
-		keyvalue := strings.Split(line, ":")
-		if len(keyvalue) != 2 {
-			continue
+	if feed := newMalwareFeed(c); feed != nil {
+		path, err := feed.load()
+		if err != nil {
+			return nil, err
 		}
-		if !utils.StringInSlice(strings.TrimSpace(keyvalue[0]), ignoreTags) {
-			datas[strings.TrimSpace(utils.CamelCase(keyvalue[0]))] = strings.TrimSpace(keyvalue[1])
+		packages, err := apkfile.LoadMalwareFeed(path)
+		if err != nil {
+			return nil, err
 		}
+		opts = append(opts, apkfile.WithMalwareFeed(packages))
 	}
 
-	return datas
-}
-
-// ParseSsdeepOutput convert ssdeep output into JSON
-func ParseSsdeepOutput(ssdout string, err error) string {
-
-	if err != nil {
-		return err.Error()
+	for flag, option := range map[string]func(apkfile.HashList) apkfile.Option{
+		"hash-allowlist": apkfile.WithHashAllowlist,
+		"hash-denylist":  apkfile.WithHashDenylist,
+	} {
+		if feed := newHashListFeed(c, flag); feed != nil {
+			path, err := feed.load()
+			if err != nil {
+				return nil, err
+			}
+			list, err := apkfile.LoadHashList(path)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, option(list))
+		}
 	}
 
-	// Break output into lines
-	lines := strings.Split(ssdout, "\n")
-
-	log.Debugln("ssdeep lines: ", lines)
-
-	if utils.SliceContainsString("No such file or directory", lines) {
-		return ""
+	if path := c.GlobalString("policy"); path != "" {
+		policy, err := apkfile.LoadPolicy(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, apkfile.WithPolicy(policy))
 	}
 
-	// Break second line into hash and path
-	hashAndPath := strings.Split(lines[1], ",")
-
-	return strings.TrimSpace(hashAndPath[0])
-}
-
-// ParseTRiDOutput convert trid output into JSON
-func ParseTRiDOutput(tridout string, err error) []string {
-
-	if err != nil {
-		return []string{err.Error()}
+	if rules := c.GlobalString("quark-rules"); rules != "" {
+		opts = append(opts, apkfile.WithQuark(apkfile.QuarkConfig{
+			Helper:        c.GlobalString("quark-helper"),
+			Rules:         rules,
+			MinConfidence: c.GlobalInt("quark-confidence"),
+		}))
 	}
 
-	keepLines := []string{}
-
-	lines := strings.Split(tridout, "\n")
+	if c.GlobalBool("decompile") {
+		cfg := apkfile.DecompileConfig{Helper: c.GlobalString("decompile-helper")}
+		if dest := c.GlobalString("artifact-store"); dest != "" {
+			store, err := newArtifactStore(dest)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Store = store
+		}
+		opts = append(opts, apkfile.WithDecompiler(cfg))
+	}
 
-	log.Debugln("TRiD lines: ", lines)
+	if dir := c.GlobalString("save-artifacts"); dir != "" {
+		opts = append(opts, apkfile.WithArtifacts(apkfile.DirStore(dir)))
+	}
 
-	if utils.SliceContainsString("Error: found no file(s) to analyze!", lines) {
-		return nil
+	if c.GlobalBool("cloud-probe") {
+		opts = append(opts, apkfile.WithCloudProbe(apkfile.CloudProbeConfig{
+			Client:    &http.Client{Timeout: 10 * time.Second},
+			Interval:  c.GlobalDuration("cloud-probe-interval"),
+			MaxProbes: c.GlobalInt("cloud-probe-max"),
+		}))
 	}
 
-	lines = lines[6:]
+	if !c.GlobalBool("no-enrichment") {
+		var providers []apkfile.EnrichmentProvider
+		if key := c.GlobalString("vt-api-key"); key != "" {
+			providers = append(providers, apkfile.VirusTotal{APIKey: key, PerMinute: c.GlobalInt("vt-rate")})
+		}
+		if token := c.GlobalString("koodous-token"); token != "" {
+			providers = append(providers, apkfile.Koodous{Token: token})
+		}
+		if c.GlobalBool("play-lookup") {
+			providers = append(providers, apkfile.GooglePlay{})
+		}
+		opts = append(opts, apkfile.WithEnrichment(apkfile.EnrichmentConfig{
+			Providers: providers,
+			Timeout:   c.GlobalDuration("enrichment-timeout"),
+			CacheTTL:  c.GlobalDuration("enrichment-cache-ttl"),
+		}))
+	}
 
-	for _, line := range lines {
-		if len(strings.TrimSpace(line)) != 0 {
-			keepLines = append(keepLines, strings.TrimSpace(line))
+	if path := c.GlobalString("plugins"); path != "" {
+		plugins, err := apkfile.LoadPlugins(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range plugins {
+			opts = append(opts, apkfile.WithPlugin(p))
 		}
 	}
 
-	return keepLines
+	return apkfile.NewScanner(opts...)
 }
 
-func generateMarkDownTable(fi FileInfo) string {
+func generateMarkDownTable(fi apkfile.FileInfo) string {
 	var tplOut bytes.Buffer
 
-	t := template.Must(template.New("fileinfo").Parse(tpl))
+	t := template.Must(template.New("fileinfo").Funcs(template.FuncMap{
+		"T":     reportCatalog.T,
+		"label": reportCatalog.label,
+	}).Parse(tpl))
 
 	err := t.Execute(&tplOut, fi)
 	if err != nil {
@@ -229,81 +201,25 @@ func generateMarkDownTable(fi FileInfo) string {
 	return tplOut.String()
 }
 
-func printStatus(resp gorequest.Response, body string, errs []error) {
-	fmt.Println(body)
-}
-
-func webService() {
-	router := mux.NewRouter().StrictSlash(true)
-	router.HandleFunc("/scan", webAvScan).Methods("POST")
-	log.Info("web service listening on port :3993")
-	log.Fatal(http.ListenAndServe(":3993", router))
+// writeToDatabase upserts the scan results into elasticsearch, and each of
+// their sections into the sections index
+func writeToDatabase(elastic, id string, fileInfo apkfile.FileInfo) {
+	elasticsearch.InitElasticSearch(elastic)
+	elasticsearch.WritePluginResultsToDatabase(elasticsearch.PluginResults{
+		ID:       id,
+		Name:     name,
+		Category: category,
+		Data:     structs.Map(fileInfo),
+	})
+	storeSections(elastic, fileInfo)
 }
 
-func webAvScan(w http.ResponseWriter, r *http.Request) {
-
-	r.ParseMultipartForm(32 << 20)
-	file, header, err := r.FormFile("malware")
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintln(w, "Please supply a valid file to scan.")
-		log.Error(err)
-	}
-	defer file.Close()
-
-	log.Debug("Uploaded fileName: ", header.Filename)
-
-	tmpfile, err := ioutil.TempFile("/malware", "web_")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer os.Remove(tmpfile.Name()) // clean up
-
-	data, err := ioutil.ReadAll(file)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if _, err = tmpfile.Write(data); err != nil {
-		log.Fatal(err)
-	}
-	if err = tmpfile.Close(); err != nil {
-		log.Fatal(err)
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(60)*time.Second)
-	defer cancel()
-
-	// Do FileInfo scan
-	path := tmpfile.Name()
-	GetFileMimeType(ctx, path)
-	GetFileDescription(ctx, path)
-
-	apkJSON, err := utils.RunCommand(ctx, "java", "-jar", "apkfile.jar", path)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	fileInfo := FileInfo{
-		Magic:    fi.Magic,
-		SSDeep:   ParseSsdeepOutput(utils.RunCommand(ctx, "ssdeep", path)),
-		TRiD:     ParseTRiDOutput(utils.RunCommand(ctx, "trid", path)),
-		Exiftool: ParseExiftoolOutput(utils.RunCommand(ctx, "exiftool", path)),
-		APKFile:  apkJSON,
-	}
-
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-
-	if err := json.NewEncoder(w).Encode(fileInfo); err != nil {
-		log.Fatal(err)
-	}
+func printStatus(resp gorequest.Response, body string, errs []error) {
+	fmt.Println(body)
 }
 
 func main() {
 
-	var elastic string
-
 	cli.AppHelpTemplate = utils.AppHelpTemplate
 	app := cli.NewApp()
 
@@ -326,6 +242,16 @@ func main() {
 			Name:  "mime, m",
 			Usage: "output only mimetype",
 		},
+		cli.StringSliceFlag{
+			Name:   "tag",
+			Usage:  "tag the scan with the case or campaign it belongs to, repeatable",
+			EnvVar: "MALICE_TAGS",
+		},
+		cli.StringSliceFlag{
+			Name:   "meta",
+			Usage:  "attach key=value metadata to the scan, repeatable",
+			EnvVar: "MALICE_META",
+		},
 		cli.BoolFlag{
 			Name:   "callback, c",
 			Usage:  "POST results to Malice webhook",
@@ -337,11 +263,300 @@ func main() {
 			EnvVar: "MALICE_PROXY",
 		},
 		cli.StringFlag{
-			Name:        "elasitcsearch",
-			Value:       "",
-			Usage:       "elasitcsearch address for Malice to store results",
-			EnvVar:      "MALICE_ELASTICSEARCH",
-			Destination: &elastic,
+			Name:   "elasitcsearch",
+			Value:  "",
+			Usage:  "elasitcsearch address for Malice to store results",
+			EnvVar: "MALICE_ELASTICSEARCH",
+		},
+		cli.StringFlag{
+			Name:   "locale",
+			Usage:  "locale of the Markdown report, e.g. de or es",
+			EnvVar: "MALICE_LOCALE",
+		},
+		cli.StringFlag{
+			Name:   "messages",
+			Usage:  "directory of <locale>.json message catalogs for the Markdown report",
+			EnvVar: "MALICE_MESSAGES",
+		},
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "JSON config file with tool paths and settings re-read on SIGHUP",
+			EnvVar: "MALICE_CONFIG",
+		},
+		cli.Uint64Flag{
+			Name:   "tool-cpu",
+			Usage:  "CPU time limit for external tools (in seconds, 0 for none)",
+			EnvVar: "MALICE_TOOL_CPU",
+		},
+		cli.Uint64Flag{
+			Name:   "tool-mem",
+			Usage:  "address space limit for external tools (in MB, 0 for none)",
+			EnvVar: "MALICE_TOOL_MEM",
+		},
+		cli.Uint64Flag{
+			Name:   "tool-fsize",
+			Usage:  "largest file external tools may write (in MB, 0 for none)",
+			EnvVar: "MALICE_TOOL_FSIZE",
+		},
+		cli.Uint64Flag{
+			Name:   "tool-nproc",
+			Usage:  "process limit for external tools (0 for none)",
+			EnvVar: "MALICE_TOOL_NPROC",
+		},
+		cli.IntFlag{
+			Name:   "tool-retries",
+			Value:  2,
+			Usage:  "times an analyzer is retried after a transient tool failure",
+			EnvVar: "MALICE_TOOL_RETRIES",
+		},
+		cli.DurationFlag{
+			Name:   "tool-retry-backoff",
+			Value:  500 * time.Millisecond,
+			Usage:  "delay before the first analyzer retry, doubled for every retry after it",
+			EnvVar: "MALICE_TOOL_RETRY_BACKOFF",
+		},
+		cli.Int64Flag{
+			Name:   "max-analyzed-entry-size",
+			Value:  apkfile.DefaultMaxEntrySize >> 20,
+			Usage:  "largest APK entry parsed by analyzers, bigger ones are only hashed (in MB, 0 for none)",
+			EnvVar: "MALICE_MAX_ANALYZED_ENTRY_SIZE",
+		},
+		cli.IntFlag{
+			Name:   "strings-limit",
+			Value:  apkfile.DefaultStringsLimit,
+			Usage:  "number of URLs, IPs, emails, wallets and phone numbers listed of each kind (0 for all)",
+			EnvVar: "MALICE_STRINGS_LIMIT",
+		},
+		cli.BoolFlag{
+			Name:   "strings-raw",
+			Usage:  "dump every extracted string in the report",
+			EnvVar: "MALICE_STRINGS_RAW",
+		},
+		cli.BoolFlag{
+			Name:   "class-list",
+			Usage:  "dump every class name in the report",
+			EnvVar: "MALICE_CLASS_LIST",
+		},
+		cli.StringFlag{
+			Name:   "secret-rules",
+			Usage:  "JSON file of regex/entropy rules replacing the built-in hardcoded secret rules",
+			EnvVar: "MALICE_SECRET_RULES",
+		},
+		cli.StringFlag{
+			Name:   "signer-blocklist",
+			Usage:  "JSON file of known-bad signing certificates added to the built-in test keys",
+			EnvVar: "MALICE_SIGNER_BLOCKLIST",
+		},
+		cli.BoolFlag{
+			Name:   "signer-reputation",
+			Usage:  "look up earlier scans of samples with the same signers in elasticsearch",
+			EnvVar: "MALICE_SIGNER_REPUTATION",
+		},
+		cli.BoolFlag{
+			Name:   "update-analysis",
+			Usage:  "compare APKs with earlier scans of the same package in elasticsearch",
+			EnvVar: "MALICE_UPDATE_ANALYSIS",
+		},
+		cli.StringFlag{
+			Name:   "malware-feed",
+			Usage:  "JSON file or URL of package names tied to known malware families",
+			EnvVar: "MALICE_MALWARE_FEED",
+		},
+		cli.StringFlag{
+			Name:   "malware-feed-cache",
+			Usage:  "where a downloaded malware feed is cached (default: in the temp directory)",
+			EnvVar: "MALICE_MALWARE_FEED_CACHE",
+		},
+		cli.DurationFlag{
+			Name:   "malware-feed-refresh",
+			Value:  6 * time.Hour,
+			Usage:  "how often a downloaded malware feed is refreshed",
+			EnvVar: "MALICE_MALWARE_FEED_REFRESH",
+		},
+		cli.StringFlag{
+			Name:   "hash-allowlist",
+			Usage:  "file or URL of known-good SHA256s whose scans are skipped with a known_good verdict",
+			EnvVar: "MALICE_HASH_ALLOWLIST",
+		},
+		cli.StringFlag{
+			Name:   "hash-denylist",
+			Usage:  "file or URL of known-bad SHA256s that are always reported malicious",
+			EnvVar: "MALICE_HASH_DENYLIST",
+		},
+		cli.DurationFlag{
+			Name:   "hash-list-refresh",
+			Value:  6 * time.Hour,
+			Usage:  "how often downloaded hash lists are refreshed",
+			EnvVar: "MALICE_HASH_LIST_REFRESH",
+		},
+		cli.StringFlag{
+			Name:   "policy",
+			Usage:  "YAML file of CEL rules setting verdicts and tags on top of the built-in ones",
+			EnvVar: "MALICE_POLICY",
+		},
+		cli.StringFlag{
+			Name:   "quark-rules",
+			Usage:  "Quark-Engine rule file or directory to run against APKs (disabled when empty)",
+			EnvVar: "MALICE_QUARK_RULES",
+		},
+		cli.StringFlag{
+			Name:   "quark-helper",
+			Value:  "helpers/quark_report.py",
+			Usage:  "script printing Quark-Engine's JSON report through its Python API",
+			EnvVar: "MALICE_QUARK_HELPER",
+		},
+		cli.IntFlag{
+			Name:   "quark-confidence",
+			Value:  apkfile.DefaultQuarkConfidence,
+			Usage:  "lowest Quark-Engine confidence, in percent, a crime is reported with",
+			EnvVar: "MALICE_QUARK_CONFIDENCE",
+		},
+		cli.BoolFlag{
+			Name:   "decompile",
+			Usage:  "decompile APKs with jadx and report the IOCs in the sources",
+			EnvVar: "MALICE_DECOMPILE",
+		},
+		cli.StringFlag{
+			Name:   "decompile-helper",
+			Value:  "helpers/jadx_archive.sh",
+			Usage:  "script running jadx and printing the sources as a tar archive",
+			EnvVar: "MALICE_DECOMPILE_HELPER",
+		},
+		cli.StringFlag{
+			Name:   "artifact-store",
+			Usage:  "directory or s3://bucket/prefix to store artifacts such as decompiled sources in",
+			EnvVar: "MALICE_ARTIFACT_STORE",
+		},
+		cli.StringFlag{
+			Name:   "save-artifacts",
+			Usage:  "directory to save the manifest, certificates, icon and suspicious entries of every APK in",
+			EnvVar: "MALICE_SAVE_ARTIFACTS",
+		},
+		cli.BoolFlag{
+			Name:   "cloud-probe",
+			Usage:  "check whether the Firebase databases and storage buckets APKs use can be read without credentials",
+			EnvVar: "MALICE_CLOUD_PROBE",
+		},
+		cli.DurationFlag{
+			Name:   "cloud-probe-interval",
+			Value:  apkfile.DefaultCloudProbeInterval,
+			Usage:  "least time between two cloud backend probes",
+			EnvVar: "MALICE_CLOUD_PROBE_INTERVAL",
+		},
+		cli.IntFlag{
+			Name:   "cloud-probe-max",
+			Value:  apkfile.DefaultCloudProbes,
+			Usage:  "most cloud backends probed per scan",
+			EnvVar: "MALICE_CLOUD_PROBE_MAX",
+		},
+		cli.StringFlag{
+			Name:   "vt-api-key",
+			Usage:  "look samples up on VirusTotal with this API key",
+			EnvVar: "MALICE_VT_API_KEY",
+		},
+		cli.IntFlag{
+			Name:   "vt-rate",
+			Value:  4,
+			Usage:  "VirusTotal lookups per minute the API key allows",
+			EnvVar: "MALICE_VT_RATE",
+		},
+		cli.StringFlag{
+			Name:   "koodous-token",
+			Usage:  "look samples up on Koodous with this API token",
+			EnvVar: "MALICE_KOODOUS_TOKEN",
+		},
+		cli.BoolFlag{
+			Name:   "play-lookup",
+			Usage:  "look up whether the package of APKs is listed on Google Play",
+			EnvVar: "MALICE_PLAY_LOOKUP",
+		},
+		cli.DurationFlag{
+			Name:   "enrichment-timeout",
+			Value:  apkfile.DefaultEnrichmentTimeout,
+			Usage:  "how long an external lookup may take",
+			EnvVar: "MALICE_ENRICHMENT_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "enrichment-cache-ttl",
+			Value:  apkfile.DefaultEnrichmentCacheTTL,
+			Usage:  "how long the answers of external lookups are cached",
+			EnvVar: "MALICE_ENRICHMENT_CACHE_TTL",
+		},
+		cli.BoolFlag{
+			Name:   "no-enrichment",
+			Usage:  "never look samples up in external services, whatever else is set",
+			EnvVar: "MALICE_NO_ENRICHMENT",
+		},
+		cli.StringFlag{
+			Name:   "sandbox",
+			Value:  "local",
+			Usage:  "execution backend for external tools (local, bwrap, nsjail or docker)",
+			EnvVar: "MALICE_SANDBOX",
+		},
+		cli.StringFlag{
+			Name:   "apk-backend",
+			Value:  apkfile.APKBackendApkfile,
+			Usage:  "what analyzes APKs for the apk_file section (apkfile or androguard)",
+			EnvVar: "MALICE_APK_BACKEND",
+		},
+		cli.StringFlag{
+			Name:   "androguard-helper",
+			Value:  "helpers/androguard_report.py",
+			Usage:  "script printing androguard's JSON report for the androguard backend",
+			EnvVar: "MALICE_ANDROGUARD_HELPER",
+		},
+		cli.StringFlag{
+			Name:   "sandbox-image",
+			Usage:  "image the docker sandbox runs external tools in",
+			EnvVar: "MALICE_SANDBOX_IMAGE",
+		},
+		cli.StringFlag{
+			Name:   "obb",
+			Usage:  "OBB expansion file shipped with the APK, enumerated and hashed along with it",
+			EnvVar: "MALICE_OBB",
+		},
+		cli.StringFlag{
+			Name:   "plugins",
+			Usage:  "JSON config file declaring external analyzer plugins",
+			EnvVar: "MALICE_PLUGINS",
+		},
+		cli.BoolFlag{
+			Name:   "no-cache",
+			Usage:  "always rescan instead of using cached results",
+			EnvVar: "MALICE_NO_CACHE",
+		},
+		cli.IntFlag{
+			Name:   "cache-size",
+			Value:  1000,
+			Usage:  "number of results kept in the in-memory cache",
+			EnvVar: "MALICE_CACHE_SIZE",
+		},
+		cli.DurationFlag{
+			Name:   "cache-ttl",
+			Value:  24 * time.Hour,
+			Usage:  "how long cached results are used for",
+			EnvVar: "MALICE_CACHE_TTL",
+		},
+		cli.StringFlag{
+			Name:   "cache-redis",
+			Usage:  "redis URL to share cached results between instances",
+			EnvVar: "MALICE_CACHE_REDIS",
+		},
+		cli.StringFlag{
+			Name:   "master",
+			Usage:  "Malice master API the web service and worker register with and send heartbeats to",
+			EnvVar: "MALICE_MASTER",
+		},
+		cli.StringFlag{
+			Name:   "advertise",
+			Usage:  "URL the Malice master reaches the web service at (default: http://<hostname>:3993)",
+			EnvVar: "MALICE_ADVERTISE",
+		},
+		cli.DurationFlag{
+			Name:   "heartbeat",
+			Value:  defaultHeartbeat,
+			Usage:  "how often heartbeats are sent to the Malice master",
+			EnvVar: "MALICE_HEARTBEAT",
 		},
 		cli.IntFlag{
 			Name:   "timeout",
@@ -354,12 +569,298 @@ func main() {
 		{
 			Name:  "web",
 			Usage: "Create a File Info web service",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "apk-worker",
+					Value:  "",
+					Usage:  "directory containing ApkfileWorker.class to keep a resident apkfile JVM",
+					EnvVar: "MALICE_APK_WORKER",
+				},
+				cli.StringFlag{
+					Name:   "queue-db",
+					Value:  "",
+					Usage:  "persistent queue database backing async /jobs scans (disabled when empty)",
+					EnvVar: "MALICE_QUEUE_DB",
+				},
+				cli.IntFlag{
+					Name:   "concurrency",
+					Value:  runtime.NumCPU(),
+					Usage:  "number of async scans to run at once",
+					EnvVar: "MALICE_CONCURRENCY",
+				},
+				cli.IntFlag{
+					Name:   "max-attempts",
+					Value:  5,
+					Usage:  "number of times a failing job is tried before it is marked dead",
+					EnvVar: "MALICE_MAX_ATTEMPTS",
+				},
+				cli.DurationFlag{
+					Name:   "retry-backoff",
+					Value:  10 * time.Second,
+					Usage:  "delay before the first retry of a failed job, doubled on every attempt",
+					EnvVar: "MALICE_RETRY_BACKOFF",
+				},
+				cli.DurationFlag{
+					Name:   "job-retention",
+					Value:  7 * 24 * time.Hour,
+					Usage:  "how long done and dead jobs and their results are kept in the queue database (0 keeps them forever)",
+					EnvVar: "MALICE_JOB_RETENTION",
+				},
+				cli.BoolFlag{
+					Name:   "graphql",
+					Usage:  "serve /graphql to query the reports stored in elasticsearch",
+					EnvVar: "MALICE_GRAPHQL",
+				},
+				cli.StringFlag{
+					Name:   "admin-token",
+					Value:  "",
+					Usage:  "bearer token of the /admin endpoints (disabled when empty)",
+					EnvVar: "MALICE_ADMIN_TOKEN",
+				},
+				cli.StringFlag{
+					Name:   "sample-dir",
+					Value:  "",
+					Usage:  "directory uploads are written to while they are scanned (defaults to the system temp dir)",
+					EnvVar: "MALICE_SAMPLE_DIR",
+				},
+				cli.Int64Flag{
+					Name:   "max-upload-size",
+					Value:  defaultMaxUploadSize,
+					Usage:  "largest resumable upload in bytes",
+					EnvVar: "MALICE_MAX_UPLOAD_SIZE",
+				},
+				cli.DurationFlag{
+					Name:   "upload-ttl",
+					Value:  defaultUploadTTL,
+					Usage:  "how long resumable uploads are kept without being scanned",
+					EnvVar: "MALICE_UPLOAD_TTL",
+				},
+			},
 			Action: func(c *cli.Context) error {
-				webService()
-				return nil
+				// build the scanner, with its resident apkfile JVM, and the cache once for
+				// every scan this process runs, reloads swap the scanner
+				if err := setupConfig(c, apkfile.WithAPKWorker(c.String("apk-worker"))); err != nil {
+					return err
+				}
+				defer closeConfig()
+				for _, feed := range feeds(c) {
+					feed.refreshPeriodically()
+				}
+				capabilities := []string{"scan"}
+				if c.String("queue-db") != "" {
+					capabilities = append(capabilities, "jobs")
+				}
+				if c.GlobalString("save-artifacts") != "" {
+					capabilities = append(capabilities, "artifacts")
+				}
+				if c.Bool("graphql") {
+					capabilities = append(capabilities, "graphql")
+				}
+				return webService(workerConfig{
+					SampleDir:     c.String("sample-dir"),
+					MaxUploadSize: c.Int64("max-upload-size"),
+					UploadTTL:     c.Duration("upload-ttl"),
+					ArtifactDir:   c.GlobalString("save-artifacts"),
+					GraphQL:       c.Bool("graphql"),
+					AdminToken:    c.String("admin-token"),
+					Master:        newMaster(c, "web", webEndpoint(c), capabilities...),
+					Concurrency:   c.Int("concurrency"),
+					Timeout:       time.Duration(c.GlobalInt("timeout")) * time.Second,
+					QueueDB:       c.String("queue-db"),
+					MaxAttempts:   c.Int("max-attempts"),
+					RetryBackoff:  c.Duration("retry-backoff"),
+					JobRetention:  c.Duration("job-retention"),
+				})
+			},
+		},
+		{
+			Name:  "worker",
+			Usage: "Process scan jobs from a queue",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "queue",
+					Value:  defaultJobQueue(),
+					Usage:  "queue to pull jobs from (dir://, redis://, nats:// or kafka://)",
+					EnvVar: "MALICE_QUEUE",
+				},
+				cli.IntFlag{
+					Name:   "concurrency",
+					Value:  runtime.NumCPU(),
+					Usage:  "number of scans to run at once",
+					EnvVar: "MALICE_CONCURRENCY",
+				},
+				cli.StringFlag{
+					Name:   "metrics",
+					Value:  ":9393",
+					Usage:  "address to expose Prometheus metrics on",
+					EnvVar: "MALICE_METRICS",
+				},
+				cli.StringFlag{
+					Name:   "apk-worker",
+					Value:  "",
+					Usage:  "directory containing ApkfileWorker.class to keep a resident apkfile JVM",
+					EnvVar: "MALICE_APK_WORKER",
+				},
+				cli.StringFlag{
+					Name:   "queue-db",
+					Value:  "",
+					Usage:  "persist jobs to this local queue database before scanning them",
+					EnvVar: "MALICE_QUEUE_DB",
+				},
+				cli.IntFlag{
+					Name:   "max-attempts",
+					Value:  5,
+					Usage:  "number of times a failing job is tried before it is marked dead",
+					EnvVar: "MALICE_MAX_ATTEMPTS",
+				},
+				cli.DurationFlag{
+					Name:   "retry-backoff",
+					Value:  10 * time.Second,
+					Usage:  "delay before the first retry of a failed job, doubled on every attempt",
+					EnvVar: "MALICE_RETRY_BACKOFF",
+				},
+				cli.DurationFlag{
+					Name:   "job-retention",
+					Value:  7 * 24 * time.Hour,
+					Usage:  "how long done and dead jobs and their results are kept in the queue database (0 keeps them forever)",
+					EnvVar: "MALICE_JOB_RETENTION",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.GlobalBool("verbose") {
+					log.SetLevel(log.DebugLevel)
+				}
+				if err := setupConfig(c, apkfile.WithAPKWorker(c.String("apk-worker"))); err != nil {
+					return err
+				}
+				defer closeConfig()
+				for _, feed := range feeds(c) {
+					feed.refreshPeriodically()
+				}
+				return workerService(workerConfig{
+					Queue:        c.String("queue"),
+					Master:       newMaster(c, "worker", "", "queue"),
+					Concurrency:  c.Int("concurrency"),
+					MetricsAddr:  c.String("metrics"),
+					Timeout:      time.Duration(c.GlobalInt("timeout")) * time.Second,
+					QueueDB:      c.String("queue-db"),
+					MaxAttempts:  c.Int("max-attempts"),
+					RetryBackoff: c.Duration("retry-backoff"),
+					JobRetention: c.Duration("job-retention"),
+				})
+			},
+		},
+		{
+			Name:      "rescan",
+			Usage:     "Re-scan the stored samples whenever the analyzers, rules or feeds change",
+			ArgsUsage: "DIR...",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:   "interval",
+					Value:  time.Hour,
+					Usage:  "how often to reload the configuration and check whether the scanner changed",
+					EnvVar: "MALICE_RESCAN_INTERVAL",
+				},
+				cli.StringFlag{
+					Name:   "events",
+					Value:  "",
+					Usage:  "URL to POST a change event to for every re-scanned report",
+					EnvVar: "MALICE_RESCAN_EVENTS",
+				},
+				cli.BoolFlag{
+					Name:  "once",
+					Usage: "run a single pass and exit",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if !c.Args().Present() {
+					return fmt.Errorf("Please supply the directories the samples are kept in")
+				}
+				if c.GlobalBool("verbose") {
+					log.SetLevel(log.DebugLevel)
+				}
+				if err := setupConfig(c); err != nil {
+					return err
+				}
+				defer closeConfig()
+				return rescanService(rescanConfig{
+					Samples:   c.Args(),
+					Interval:  c.Duration("interval"),
+					Timeout:   time.Duration(c.GlobalInt("timeout")) * time.Second,
+					EventsURL: c.String("events"),
+					Once:      c.Bool("once"),
+				})
+			},
+		},
+		{
+			Name:      "refresh",
+			Usage:     "Re-run some analyzers against stored samples and merge their sections into the reports",
+			ArgsUsage: "SAMPLE...",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "section",
+					Usage: "analyzer whose section is refreshed, e.g. enrichment, repeatable",
+				},
+			},
+			Action: refresh,
+		},
+		{
+			Name:      "lookup",
+			Usage:     "Print the stored reports of a sample or package",
+			ArgsUsage: "[SHA256|PACKAGE]",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:   "limit",
+					Value:  10,
+					Usage:  "largest number of reports printed",
+					EnvVar: "MALICE_LOOKUP_LIMIT",
+				},
+				cli.StringFlag{
+					Name:  "tag",
+					Usage: "only reports with the tag, of the policy or the submission",
+				},
+				cli.StringSliceFlag{
+					Name:  "meta",
+					Usage: "only reports submitted with the key=value metadata, repeatable",
+				},
+			},
+			Action: lookup,
+		},
+		{
+			Name:  "stats",
+			Usage: "Print scans per day, top signers, dangerous permissions and verdicts of the stored reports",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:   "days",
+					Value:  defaultStatsDays,
+					Usage:  "how many days back, today included, the statistics go",
+					EnvVar: "MALICE_STATS_DAYS",
+				},
+				cli.IntFlag{
+					Name:   "top",
+					Value:  defaultStatsTop,
+					Usage:  "how many signers and permissions are listed",
+					EnvVar: "MALICE_STATS_TOP",
+				},
 			},
+			Action: stats,
+		},
+		{
+			Name:   "tools",
+			Usage:  "Print the versions of the tools, the rules and the analyzers scans use",
+			Action: tools,
+		},
+		{
+			Name:   "selftest",
+			Usage:  "Scan a built-in benign APK and check every analyzer works",
+			Action: selftest,
 		},
 	}
+	app.Before = func(c *cli.Context) error {
+		var err error
+		reportCatalog, err = loadCatalog(c.GlobalString("locale"), c.GlobalString("messages"))
+		return err
+	}
 	app.Action = func(c *cli.Context) error {
 		var err error
 
@@ -381,46 +882,49 @@ func main() {
 				log.SetLevel(log.DebugLevel)
 			}
 
-			if c.Bool("mime") {
-				GetFileMimeType(ctx, path)
-				fmt.Println(fi.Magic.Mime)
-				return nil
+			submission, err := parseSubmission(c.StringSlice("tag"), c.StringSlice("meta"))
+			if err != nil {
+				return err
 			}
 
-			// run libmagic
-			err = GetFileMimeType(ctx, path)
-			if err != nil && ctx.Err() == nil {
-				// try again
-				GetFileMimeType(ctx, path)
+			if err = setupConfig(c); err != nil {
+				return err
 			}
-			err = GetFileDescription(ctx, path)
-			if err != nil && ctx.Err() == nil {
-				// try again
-				GetFileDescription(ctx, path)
+			defer closeConfig()
+			rc, release := acquireConfig()
+			defer release()
+
+			if c.Bool("mime") {
+				mime, err := rc.scanner.MimeType(ctx, path)
+				if err != nil {
+					return err
+				}
+				fmt.Println(mime)
+				return nil
 			}
 
-			apkJSON, err := utils.RunCommand(ctx, "java", "-jar", "apkfile.jar", path)
+			// run all tools concurrently
+			hashes, err := apkfile.HashFile(path)
 			if err != nil {
 				log.Fatal(err)
 			}
-
-			fileInfo := FileInfo{
-				Magic:    fi.Magic,
-				SSDeep:   ParseSsdeepOutput(utils.RunCommand(ctx, "ssdeep", path)),
-				TRiD:     ParseTRiDOutput(utils.RunCommand(ctx, "trid", path)),
-				Exiftool: ParseExiftoolOutput(utils.RunCommand(ctx, "exiftool", path)),
-				APKFile:  apkJSON,
+			var obb *apkfile.ExpansionFile
+			if c.String("obb") != "" {
+				obb = &apkfile.ExpansionFile{Path: c.String("obb")}
+			}
+			fileInfo, err := cachedScan(ctx, rc, path, hashes, obb)
+			if err != nil {
+				return err
+			}
+			for _, e := range fileInfo.Errors {
+				log.WithFields(log.Fields{"analyzer": e.Analyzer, "code": e.Code}).Warn(e.Message)
 			}
+			fileInfo.Scanner = rc.scannerDigest()
+			fileInfo.Submission = submission
 			fileInfo.MarkDown = generateMarkDownTable(fileInfo)
 
 			// upsert into Database
-			elasticsearch.InitElasticSearch(elastic)
-			elasticsearch.WritePluginResultsToDatabase(elasticsearch.PluginResults{
-				ID:       utils.Getopt("MALICE_SCANID", utils.GetSHA256(path)),
-				Name:     name,
-				Category: category,
-				Data:     structs.Map(fileInfo),
-			})
+			writeToDatabase(rc.elastic, utils.Getopt("MALICE_SCANID", fileInfo.Hashes.SHA256), fileInfo)
 
 			if c.Bool("table") {
 				fmt.Println(fileInfo.MarkDown)
@@ -434,7 +938,7 @@ func main() {
 						request = gorequest.New().Proxy(os.Getenv("MALICE_PROXY"))
 					}
 					request.Post(os.Getenv("MALICE_ENDPOINT")).
-						Set("X-Malice-ID", utils.Getopt("MALICE_SCANID", utils.GetSHA256(path))).
+						Set("X-Malice-ID", utils.Getopt("MALICE_SCANID", fileInfo.Hashes.SHA256)).
 						Send(string(fileInfoJSON)).
 						End(printStatus)
 
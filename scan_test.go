@@ -4,76 +4,27 @@ import (
 	"fmt"
 	"io/ioutil"
 	"testing"
-)
-
-// TestParseExiftool tests the ParseExiftoolOutput function.
-func TestParseExiftool(t *testing.T) {
-	b, err := ioutil.ReadFile("test/exiftool.out")
-	if err != nil {
-		fmt.Print(err)
-	}
-
-	results := ParseExiftoolOutput(string(b), nil)
-
-	if err != nil {
-		t.Log(err)
-	}
-
-	if true {
-		t.Log("results: ", results)
-	}
-}
-
-// TestParseTRiD tests the ParseTRiDOutput function.
-func TestParseTRiD(t *testing.T) {
-	b, err := ioutil.ReadFile("test/trid.out") // just pass the file name
-	if err != nil {
-		fmt.Print(err)
-	}
-
-	trid := ParseTRiDOutput(string(b), nil)
 
-	if true {
-		t.Log("trid: ", trid)
-	}
-}
-
-// TestParseTRiDSsdeep tests the ParseSsdeepOutput function.
-func TestParseTRiDSsdeep(t *testing.T) {
-	b, err := ioutil.ReadFile("test/ssdeep.out") // just pass the file name
-	if err != nil {
-		fmt.Print(err)
-	}
-
-	ssdeep := ParseSsdeepOutput(string(b), nil)
-
-	if true {
-		t.Log("ssdeep: ", ssdeep)
-	}
-}
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
 
-// TestGenerateMarkDownTable tests the ParseSsdeepOutput function.
+// TestGenerateMarkDownTable tests the generateMarkDownTable function.
 func TestGenerateMarkDownTable(t *testing.T) {
-	exifOut, err := ioutil.ReadFile("test/exiftool.out")
-	if err != nil {
-		fmt.Print(err)
-	}
-
-	tridOut, err := ioutil.ReadFile("test/trid.out")
+	exifOut, err := ioutil.ReadFile("pkg/apkfile/testdata/exiftool.json")
 	if err != nil {
 		fmt.Print(err)
 	}
 
-	ssdeepOut, err := ioutil.ReadFile("test/ssdeep.out")
+	tridOut, err := ioutil.ReadFile("pkg/apkfile/testdata/trid.out")
 	if err != nil {
 		fmt.Print(err)
 	}
 
-	fileInfo := FileInfo{
+	fileInfo := apkfile.FileInfo{
 		// Magic:    fi.Magic,
-		SSDeep:   ParseSsdeepOutput(string(ssdeepOut), nil),
-		TRiD:     ParseTRiDOutput(string(tridOut), nil),
-		Exiftool: ParseExiftoolOutput(string(exifOut), nil),
+		SSDeep:   "768:15jQ4nVHQaeO379u4XckKVCsknBN9A4hUnDxDiNZ957ZpK0IUUiM95Zdz:15jQ4nVHQaeO9uwckKuBN9A4UnDxcbFi",
+		TRiD:     apkfile.ParseTRiDOutput(string(tridOut)),
+		Exiftool: apkfile.ParseExiftoolOutput(string(exifOut)),
 	}
 	fileInfo.MarkDown = generateMarkDownTable(fileInfo)
 
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/urfave/cli"
+)
+
+// sectionsIndex holds every section of the stored reports as a document of
+// its own, so one section can be refreshed without rewriting the report
+const sectionsIndex = "malice-" + name + "-sections"
+
+// maxSectionDocs caps the refreshed sections merged into the reports of one
+// lookup
+const maxSectionDocs = 10000
+
+// sectionDoc is one analyzer's section of a sample's report, its ID is the
+// sample's SHA256 and the section name so a sample has one of each
+type sectionDoc struct {
+	SHA256  string `json:"sha256"`
+	Section string `json:"section"`
+	apkfile.SectionStamp
+	// Refreshed is set when the section was produced apart from the report,
+	// only those are merged into it
+	Refreshed bool `json:"refreshed,omitempty"`
+	// Data holds the section under its name, keeping the fields of every
+	// section apart in the index mapping
+	Data map[string]json.RawMessage `json:"data"`
+}
+
+// newSectionDocs detaches the sections of the analyzers that ran without
+// errors from fileInfo
+func newSectionDocs(fileInfo apkfile.FileInfo, stamp apkfile.SectionStamp, refreshed bool) ([]sectionDoc, error) {
+	data, err := json.Marshal(fileInfo)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var analyzers map[string]json.RawMessage
+	if a, ok := fields["analyzers"]; ok {
+		if err := json.Unmarshal(a, &analyzers); err != nil {
+			return nil, err
+		}
+	}
+
+	var docs []sectionDoc
+	for section := range fileInfo.Timings {
+		if _, failed := fileInfo.Errors.Get(section); failed {
+			continue
+		}
+		value, ok := fields[section]
+		if !reportFields[section] {
+			value, ok = analyzers[section]
+		}
+		if !ok {
+			// the section is empty, storing it clears the one it refreshes
+			value = json.RawMessage("null")
+		}
+		docs = append(docs, sectionDoc{
+			SHA256:       fileInfo.Hashes.SHA256,
+			Section:      section,
+			SectionStamp: stamp,
+			Refreshed:    refreshed,
+			Data:         map[string]json.RawMessage{section: value},
+		})
+	}
+	return docs, nil
+}
+
+// reportFields are the JSON names of the FileInfo fields, the sections of
+// the built-in analyzers are named after theirs
+var reportFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(apkfile.FileInfo{})
+	for i := 0; i < t.NumField(); i++ {
+		fields[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	return fields
+}()
+
+// mergeSections overlays the sections of docs refreshed after fileInfo was
+// scanned on it and lists them in Sections
+func mergeSections(fileInfo apkfile.FileInfo, docs []sectionDoc) (apkfile.FileInfo, error) {
+	var newer []sectionDoc
+	for _, doc := range docs {
+		if doc.SHA256 != fileInfo.Hashes.SHA256 || !doc.Refreshed {
+			continue
+		}
+		if fileInfo.ScannedAt != nil && !doc.ScannedAt.After(*fileInfo.ScannedAt) {
+			// a re-scan replaced the report since
+			continue
+		}
+		newer = append(newer, doc)
+	}
+	if len(newer) == 0 {
+		return fileInfo, nil
+	}
+
+	data, err := json.Marshal(fileInfo)
+	if err != nil {
+		return fileInfo, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fileInfo, err
+	}
+	analyzers := make(map[string]json.RawMessage)
+	if a, ok := fields["analyzers"]; ok {
+		if err := json.Unmarshal(a, &analyzers); err != nil {
+			return fileInfo, err
+		}
+	}
+	for _, doc := range newer {
+		if reportFields[doc.Section] {
+			fields[doc.Section] = doc.Data[doc.Section]
+		} else {
+			analyzers[doc.Section] = doc.Data[doc.Section]
+		}
+	}
+	delete(fields, "analyzers")
+	if len(analyzers) > 0 {
+		if fields["analyzers"], err = json.Marshal(analyzers); err != nil {
+			return fileInfo, err
+		}
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return fileInfo, err
+	}
+
+	var merged apkfile.FileInfo
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return fileInfo, err
+	}
+	merged.Sections = make(map[string]apkfile.SectionStamp)
+	for _, doc := range newer {
+		// the section failed in the scan but not when it was refreshed, and
+		// the scan's warnings are about the section it replaces
+		merged.Errors = merged.Errors.Without(doc.Section)
+		merged.Warnings = merged.Warnings.Without(doc.Section)
+		merged.Sections[doc.Section] = doc.SectionStamp
+	}
+	if merged.MarkDown != "" {
+		merged.MarkDown = generateMarkDownTable(merged)
+	}
+	return merged, nil
+}
+
+// StoreSections writes docs to the sections index, replacing the sections
+// stored for their samples before
+func (e *elasticReputation) StoreSections(ctx context.Context, docs []sectionDoc) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, doc := range docs {
+		action := map[string]interface{}{
+			"index": map[string]string{"_index": sectionsIndex, "_id": doc.SHA256 + "." + doc.Section},
+		}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if _, err := e.post(ctx, e.base+"/_bulk", "application/x-ndjson", body.Bytes(), &result); err != nil {
+		return err
+	}
+	if result.Errors {
+		return fmt.Errorf("elasticsearch failed to store some of the %d sections", len(docs))
+	}
+	return nil
+}
+
+// RefreshedSections returns the sections of the samples with the SHA256s
+// that were refreshed apart from their reports
+func (e *elasticReputation) RefreshedSections(ctx context.Context, sha256s []string) ([]sectionDoc, error) {
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source sectionDoc `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	query := map[string]interface{}{
+		"size": maxSectionDocs,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"terms": map[string]interface{}{"sha256.keyword": sha256s}},
+					map[string]interface{}{"term": map[string]interface{}{"refreshed": true}},
+				},
+			},
+		},
+	}
+	if found, err := e.searchURL(ctx, e.base+"/"+sectionsIndex+"/_search", query, &result); err != nil || !found {
+		return nil, err
+	}
+	var docs []sectionDoc
+	for _, hit := range result.Hits.Hits {
+		docs = append(docs, hit.Source)
+	}
+	return docs, nil
+}
+
+// mergeRefreshed merges the refreshed sections into the stored reports
+func (e *elasticReputation) mergeRefreshed(ctx context.Context, reports []apkfile.FileInfo) ([]apkfile.FileInfo, error) {
+	if len(reports) == 0 {
+		return reports, nil
+	}
+	var sha256s []string
+	for _, r := range reports {
+		sha256s = append(sha256s, r.Hashes.SHA256)
+	}
+	docs, err := e.RefreshedSections(ctx, sha256s)
+	if err != nil || len(docs) == 0 {
+		return reports, err
+	}
+	for i := range reports {
+		if reports[i], err = mergeSections(reports[i], docs); err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+// storeSections writes the sections of a report fileinfo stored next to it.
+// They are only read once refreshed, so failing to store them is logged and
+// the report kept
+func storeSections(elastic string, fileInfo apkfile.FileInfo) {
+	stamp := apkfile.SectionStamp{Version: Version, Scanner: fileInfo.Scanner}
+	if fileInfo.ScannedAt != nil {
+		stamp.ScannedAt = *fileInfo.ScannedAt
+	}
+	docs, err := newSectionDocs(fileInfo, stamp, false)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = newElasticReputation(elastic).StoreSections(ctx, docs)
+	}
+	if err != nil {
+		log.WithError(err).Debug("failed to store the sections of ", fileInfo.Hashes.SHA256)
+	}
+}
+
+// refresh re-runs the analyzers of the --section flags against the samples
+// in the arguments and stores their sections apart from the reports, which
+// are merged with them whenever they are read
+func refresh(c *cli.Context) error {
+	if !c.Args().Present() {
+		return fmt.Errorf("Please supply the samples to refresh")
+	}
+	if len(c.StringSlice("section")) == 0 {
+		return fmt.Errorf("Please supply the sections to refresh with --section")
+	}
+	if err := setupConfig(c); err != nil {
+		return err
+	}
+	defer closeConfig()
+	rc, release := acquireConfig()
+	defer release()
+
+	store := newElasticReputation(rc.elastic)
+	for _, path := range c.Args() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.GlobalInt("timeout"))*time.Second)
+		err := refreshSample(ctx, rc, store, path, c.StringSlice("section"))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// refreshSample refreshes the sections of one sample and prints its merged
+// report as JSON
+func refreshSample(ctx context.Context, rc *runtimeConfig, store *elasticReputation, path string, sections []string) error {
+	hashes, err := apkfile.HashFile(path)
+	if err != nil {
+		return err
+	}
+	stored, found, err := store.StoredReport(ctx, hashes.SHA256)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no stored report of %s, scan it first", hashes.SHA256)
+	}
+
+	fileInfo, err := rc.scanner.ScanSections(ctx, path, hashes, sections)
+	if err != nil {
+		return err
+	}
+	for _, e := range fileInfo.Errors {
+		log.WithFields(log.Fields{"analyzer": e.Analyzer, "code": e.Code}).Warn(e.Message)
+	}
+	stamp := apkfile.SectionStamp{ScannedAt: time.Now().UTC(), Version: Version, Scanner: rc.scannerDigest()}
+	docs, err := newSectionDocs(fileInfo, stamp, true)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("none of the sections could be refreshed")
+	}
+	if err := store.StoreSections(ctx, docs); err != nil {
+		return err
+	}
+
+	merged, err := mergeSections(stored.FileInfo, docs)
+	if err != nil {
+		return err
+	}
+	merged.MarkDown = ""
+	out, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
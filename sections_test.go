@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// TestNewSectionDocs tests detaching the sections of the analyzers that ran without errors.
+func TestNewSectionDocs(t *testing.T) {
+	fileInfo := apkfile.FileInfo{
+		Hashes:     apkfile.FileHashes{SHA256: "c0ffee"},
+		Enrichment: &apkfile.Enrichments{Unavailable: map[string]string{"koodous": "rate limited"}},
+		Analyzers:  map[string]interface{}{"yara": []string{"Joker"}},
+		Errors:     apkfile.Diagnostics{{Analyzer: "trid", Code: apkfile.DiagnosticTimeout}},
+		Timings: map[string]apkfile.Timing{
+			"enrichment": {}, "yara": {}, "trid": {}, "quark": {},
+		},
+	}
+	docs, err := newSectionDocs(fileInfo, apkfile.SectionStamp{Scanner: "new"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, doc := range docs {
+		if doc.SHA256 != "c0ffee" || doc.Scanner != "new" || !doc.Refreshed {
+			t.Errorf("unexpected section %+v", doc)
+		}
+		got[doc.Section] = string(doc.Data[doc.Section])
+	}
+	want := map[string]string{
+		"enrichment": `{"unavailable":{"koodous":"rate limited"}}`,
+		"yara":       `["Joker"]`,
+		// quark found nothing, the section it refreshes is cleared
+		"quark": "null",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// TestMergeRefreshedSections tests merging the sections refreshed after the scan into the stored reports.
+func TestMergeRefreshedSections(t *testing.T) {
+	var bulk string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_bulk":
+			body, _ := ioutil.ReadAll(r.Body)
+			bulk = string(body)
+			w.Write([]byte(`{"errors": false}`))
+		case "/malice/_search":
+			w.Write([]byte(`{"hits": {"hits": [{"_source": {"plugins": {"metadata": {"apkfile": {
+				"hashes": {"sha256": "c0ffee"},
+				"scanned_at": "2026-10-01T12:00:00Z",
+				"quark": {"total_score": 12},
+				"analyzers": {"yara": ["Joker"]},
+				"errors": {"enrichment": "timeout"}}}}}}]}}`))
+		case "/" + sectionsIndex + "/_search":
+			w.Write([]byte(`{"hits": {"hits": [
+				{"_source": {"sha256": "c0ffee", "section": "enrichment", "scanned_at": "2026-10-16T08:00:00Z", "scanner": "new", "refreshed": true,
+					"data": {"enrichment": {"results": [{"provider": "virustotal", "found": true, "detected": true}]}}}},
+				{"_source": {"sha256": "c0ffee", "section": "yara", "scanned_at": "2026-10-16T08:00:00Z", "scanner": "new", "refreshed": true,
+					"data": {"yara": ["Joker", "Harly"]}}},
+				{"_source": {"sha256": "c0ffee", "section": "quark", "scanned_at": "2026-09-01T08:00:00Z", "scanner": "old", "refreshed": true,
+					"data": {"quark": null}}}
+			]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer es.Close()
+	e := newElasticReputation(es.URL)
+
+	if err := e.StoreSections(context.Background(), []sectionDoc{{SHA256: "c0ffee", Section: "enrichment"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"index":{"_id":"c0ffee.enrichment","_index":"` + sectionsIndex + `"}}`; !strings.HasPrefix(bulk, want+"\n") {
+		t.Errorf("expected the section to be indexed by sample and name, got %s", bulk)
+	}
+
+	reports, err := e.FindReports(context.Background(), reportFilter{Hash: "c0ffee", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expected one report, got %d", len(reports))
+	}
+	fi := reports[0]
+	if fi.Enrichment == nil || len(fi.Enrichment.Results) != 1 || !fi.Enrichment.Results[0].Detected {
+		t.Errorf("expected the refreshed enrichment, got %+v", fi.Enrichment)
+	}
+	if !reflect.DeepEqual(fi.Analyzers["yara"], []interface{}{"Joker", "Harly"}) {
+		t.Errorf("expected the refreshed yara matches, got %v", fi.Analyzers)
+	}
+	if fi.Quark == nil || fi.Quark.TotalScore != 12 {
+		t.Errorf("expected a section refreshed before the scan to be ignored, got %+v", fi.Quark)
+	}
+	if fi.Errors != nil {
+		t.Errorf("expected the refreshed section's error to be cleared, got %v", fi.Errors)
+	}
+	want := map[string]apkfile.SectionStamp{
+		"enrichment": {ScannedAt: time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC), Scanner: "new"},
+		"yara":       {ScannedAt: time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC), Scanner: "new"},
+	}
+	if !reflect.DeepEqual(fi.Sections, want) {
+		t.Errorf("expected %v, got %v", want, fi.Sections)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// selftest scans the self-test APK and fails unless every analyzer reports
+// what it should
+func selftest(c *cli.Context) error {
+	if err := setupConfig(c); err != nil {
+		return err
+	}
+	defer closeConfig()
+	rc, release := acquireConfig()
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.GlobalInt("timeout"))*time.Second)
+	defer cancel()
+	results, err := rc.scanner.SelfTest(ctx)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range results {
+		if r.Passed {
+			fmt.Printf("ok   %s\n", r.Analyzer)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s: %s\n", r.Analyzer, r.Error)
+	}
+	if failed > 0 {
+		return fmt.Errorf("self-test failed, %d of %d checks", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const (
+	// defaultStatsDays is how many days back the statistics go
+	defaultStatsDays = 30
+	// defaultStatsTop is how many signers and permissions are listed
+	defaultStatsTop = 10
+	// maxStatsDays caps the days of the scans per day
+	maxStatsDays = 366
+)
+
+// scanStats sums up the reports stored in elasticsearch over the last days
+type scanStats struct {
+	Days int `json:"days"`
+	// Scans counts the reports of the period, re-scans count again
+	Scans          int               `json:"scans"`
+	PerDay         []dayCount        `json:"per_day"`
+	Verdicts       map[string]int    `json:"verdicts"`
+	TopSigners     []signerCount     `json:"top_signers"`
+	TopPermissions []permissionCount `json:"top_permissions"`
+}
+
+type dayCount struct {
+	Date  string `json:"date"`
+	Scans int    `json:"scans"`
+}
+
+type signerCount struct {
+	SHA256  string `json:"sha256"`
+	Subject string `json:"subject,omitempty"`
+	Samples int    `json:"samples"`
+}
+
+// permissionCount is a dangerous permission and how many samples declare or
+// request it
+type permissionCount struct {
+	Name    string `json:"name"`
+	Samples int    `json:"samples"`
+}
+
+type statsBucket struct {
+	Key         interface{} `json:"key"`
+	KeyAsString string      `json:"key_as_string"`
+	DocCount    int         `json:"doc_count"`
+	Subjects    struct {
+		Buckets []statsBucket `json:"buckets"`
+	} `json:"subjects"`
+}
+
+// Stats aggregates the reports scanned in the last days, the signers and
+// permissions are the top ones
+func (e *elasticReputation) Stats(ctx context.Context, days, top int) (*scanStats, error) {
+	signers := terms(resultsField+".signers.sha256.keyword", top, nil)
+	signers["aggs"] = map[string]interface{}{
+		"subjects": terms(resultsField+".signers.subject.keyword", 1, nil),
+	}
+	query := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{
+				resultsField + ".scanned_at": map[string]interface{}{"gte": fmt.Sprintf("now-%dd/d", days-1)},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"per_day": map[string]interface{}{
+				"date_histogram": map[string]interface{}{
+					"field":             resultsField + ".scanned_at",
+					"calendar_interval": "day",
+					"format":            "yyyy-MM-dd",
+				},
+			},
+			"verdicts": terms(resultsField+".verdict.verdict.keyword", 10, "none"),
+			"signers":  signers,
+			// a permission is either requested or dormant, adding up the two
+			// counts every sample declaring or requesting it once
+			"requested": terms(resultsField+".runtime_permissions.requested.name.keyword", 2*top, nil),
+			"dormant":   terms(resultsField+".runtime_permissions.dormant.keyword", 2*top, nil),
+		},
+	}
+
+	var result struct {
+		Aggregations map[string]struct {
+			Buckets []statsBucket `json:"buckets"`
+		} `json:"aggregations"`
+	}
+	stats := &scanStats{
+		Days:           days,
+		PerDay:         []dayCount{},
+		Verdicts:       map[string]int{},
+		TopSigners:     []signerCount{},
+		TopPermissions: []permissionCount{},
+	}
+	if found, err := e.search(ctx, query, &result); err != nil || !found {
+		return stats, err
+	}
+
+	for _, b := range result.Aggregations["per_day"].Buckets {
+		stats.PerDay = append(stats.PerDay, dayCount{Date: b.KeyAsString, Scans: b.DocCount})
+		stats.Scans += b.DocCount
+	}
+	for _, b := range result.Aggregations["verdicts"].Buckets {
+		stats.Verdicts[fmt.Sprint(b.Key)] = b.DocCount
+	}
+	for _, b := range result.Aggregations["signers"].Buckets {
+		s := signerCount{SHA256: fmt.Sprint(b.Key), Samples: b.DocCount}
+		if len(b.Subjects.Buckets) > 0 {
+			s.Subject = fmt.Sprint(b.Subjects.Buckets[0].Key)
+		}
+		stats.TopSigners = append(stats.TopSigners, s)
+	}
+
+	permissions := make(map[string]int)
+	for _, agg := range []string{"requested", "dormant"} {
+		for _, b := range result.Aggregations[agg].Buckets {
+			permissions[fmt.Sprint(b.Key)] += b.DocCount
+		}
+	}
+	for name, samples := range permissions {
+		stats.TopPermissions = append(stats.TopPermissions, permissionCount{name, samples})
+	}
+	sort.Slice(stats.TopPermissions, func(i, j int) bool {
+		a, b := stats.TopPermissions[i], stats.TopPermissions[j]
+		if a.Samples != b.Samples {
+			return a.Samples > b.Samples
+		}
+		return a.Name < b.Name
+	})
+	if len(stats.TopPermissions) > top {
+		stats.TopPermissions = stats.TopPermissions[:top]
+	}
+	return stats, nil
+}
+
+// statsParams checks the period and the number of top entries asked for
+func statsParams(days, top int) error {
+	if days < 1 || days > maxStatsDays {
+		return fmt.Errorf("days must be between 1 and %d", maxStatsDays)
+	}
+	if top < 1 || top > 100 {
+		return fmt.Errorf("top must be between 1 and 100")
+	}
+	return nil
+}
+
+// webStats serves the statistics of the stored reports, ?days= and ?top=
+// override the defaults
+func webStats(w http.ResponseWriter, r *http.Request) {
+	days, top := defaultStatsDays, defaultStatsTop
+	var err error
+	if v := r.URL.Query().Get("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil {
+			days = 0
+		}
+	}
+	if v := r.URL.Query().Get("top"); v != "" {
+		if top, err = strconv.Atoi(v); err != nil {
+			top = 0
+		}
+	}
+	if err := statsParams(days, top); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	rc, release := acquireConfig()
+	elastic := rc.elastic
+	release()
+	s, err := newElasticReputation(elastic).Stats(r.Context(), days, top)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		log.WithError(err).Error("stats failed")
+		fmt.Fprintln(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(s)
+}
+
+// stats prints the statistics of the stored reports as JSON
+func stats(c *cli.Context) error {
+	if err := statsParams(c.Int("days"), c.Int("top")); err != nil {
+		return err
+	}
+
+	file, err := readConfigFile(c.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+	elastic := c.GlobalString("elasitcsearch")
+	if file.Elasticsearch != "" {
+		elastic = file.Elasticsearch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.GlobalInt("timeout"))*time.Second)
+	defer cancel()
+	s, err := newElasticReputation(elastic).Stats(ctx, c.Int("days"), c.Int("top"))
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestStats tests aggregating the stored reports into statistics.
+func TestStats(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		query = string(body)
+		w.Write([]byte(`{"aggregations": {
+			"per_day": {"buckets": [{"key_as_string": "2026-10-16", "key": 1792108800000, "doc_count": 3}, {"key_as_string": "2026-10-17", "key": 1792195200000, "doc_count": 2}]},
+			"verdicts": {"buckets": [{"key": "malicious", "doc_count": 2}, {"key": "none", "doc_count": 3}]},
+			"signers": {"buckets": [{"key": "c0ffee", "doc_count": 4, "subjects": {"buckets": [{"key": "CN=Android Debug", "doc_count": 4}]}}]},
+			"requested": {"buckets": [{"key": "android.permission.READ_SMS", "doc_count": 2}, {"key": "android.permission.CAMERA", "doc_count": 1}]},
+			"dormant": {"buckets": [{"key": "android.permission.READ_SMS", "doc_count": 1}, {"key": "android.permission.RECORD_AUDIO", "doc_count": 2}]}
+		}}`))
+	}))
+	defer ts.Close()
+
+	s, err := newElasticReputation(ts.URL).Stats(context.Background(), 7, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &scanStats{
+		Days:           7,
+		Scans:          5,
+		PerDay:         []dayCount{{"2026-10-16", 3}, {"2026-10-17", 2}},
+		Verdicts:       map[string]int{"malicious": 2, "none": 3},
+		TopSigners:     []signerCount{{SHA256: "c0ffee", Subject: "CN=Android Debug", Samples: 4}},
+		TopPermissions: []permissionCount{{"android.permission.READ_SMS", 3}, {"android.permission.RECORD_AUDIO", 2}},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("expected %+v, got %+v", want, s)
+	}
+	if want := `"gte":"now-6d/d"`; !strings.Contains(query, want) {
+		t.Errorf("expected %s in %s", want, query)
+	}
+}
+
+// TestWebStats tests the parameters of the stats endpoint.
+func TestWebStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+	current = &runtimeConfig{elastic: ts.URL}
+	defer func() { current = nil }()
+
+	for target, code := range map[string]int{
+		"/v1/stats":          http.StatusOK,
+		"/v1/stats?days=7":   http.StatusOK,
+		"/v1/stats?days=0":   http.StatusBadRequest,
+		"/v1/stats?top=many": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		webStats(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != code {
+			t.Errorf("%s: expected %d, got %d", target, code, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	webStats(w, httptest.NewRequest("GET", "/v1/stats", nil))
+	if body := w.Body.String(); !strings.Contains(body, `"scans":0`) || !strings.Contains(body, `"per_day":[]`) {
+		t.Errorf("expected empty statistics before anything was stored, got %s", body)
+	}
+}
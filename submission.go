@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// apiKey is a key the web service's submitters send as X-API-Key, its tags
+// and metadata are attached to everything submitted with it
+type apiKey struct {
+	// Name is recorded as the submitter of the scans
+	Name     string            `json:"name"`
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// metadataKeyRegexp is what metadata keys may be, they are elasticsearch
+// field names
+var metadataKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// maxTagLength caps the tags and metadata values submitters attach
+const maxTagLength = 256
+
+// parseSubmission builds the submission of tags and key=value metadata, nil
+// when both are empty
+func parseSubmission(tags, meta []string) (*apkfile.Submission, error) {
+	s := &apkfile.Submission{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %.32q... is longer than %d characters", tag, maxTagLength)
+		}
+		if tag != "" && !containsString(s.Tags, tag) {
+			s.Tags = append(s.Tags, tag)
+		}
+	}
+	for _, m := range meta {
+		i := strings.Index(m, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("metadata %q isn't key=value", m)
+		}
+		key, value := strings.TrimSpace(m[:i]), strings.TrimSpace(m[i+1:])
+		if !metadataKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("metadata key %q must be letters, digits, _ and -", key)
+		}
+		if len(value) > maxTagLength {
+			return nil, fmt.Errorf("metadata %s is longer than %d characters", key, maxTagLength)
+		}
+		if s.Metadata == nil {
+			s.Metadata = make(map[string]string)
+		}
+		s.Metadata[key] = value
+	}
+	if len(s.Tags) == 0 && len(s.Metadata) == 0 {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// withDefaults adds the tags and the metadata of key that s doesn't set, and
+// records the key as the submitter
+func withDefaults(s *apkfile.Submission, key *apiKey) *apkfile.Submission {
+	if key == nil {
+		return s
+	}
+	merged := &apkfile.Submission{Submitter: key.Name}
+	if s != nil {
+		merged.Tags = append(merged.Tags, s.Tags...)
+		merged.Metadata = s.Metadata
+	}
+	for _, tag := range key.Tags {
+		if !containsString(merged.Tags, tag) {
+			merged.Tags = append(merged.Tags, tag)
+		}
+	}
+	for k, v := range key.Metadata {
+		if _, ok := merged.Metadata[k]; ok {
+			continue
+		}
+		if merged.Metadata == nil {
+			merged.Metadata = make(map[string]string)
+		}
+		merged.Metadata[k] = v
+	}
+	return merged
+}
+
+// findAPIKey returns the configured key matching key, comparing in constant
+// time so keys can't be guessed from how long a request takes
+func findAPIKey(keys map[string]apiKey, key string) (*apiKey, bool) {
+	var found *apiKey
+	for k, v := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			v := v
+			found = &v
+		}
+	}
+	return found, found != nil
+}
+
+// webSubmission is the submission of a web request, the "tag" and "meta"
+// form fields and the defaults of its X-API-Key. Requests without a key get
+// no defaults, ones with an unknown key are refused
+func webSubmission(w http.ResponseWriter, r *http.Request) (*apkfile.Submission, bool) {
+	r.ParseMultipartForm(32 << 20)
+	s, err := parseSubmission(r.Form["tag"], r.Form["meta"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, err)
+		return nil, false
+	}
+
+	header := r.Header.Get("X-API-Key")
+	if header == "" {
+		return s, true
+	}
+	rc, release := acquireConfig()
+	key, ok := findAPIKey(rc.apiKeys, header)
+	release()
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "Unknown API key.")
+		return nil, false
+	}
+	return withDefaults(s, key), true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// TestParseSubmission tests parsing the tags and metadata of a submission.
+func TestParseSubmission(t *testing.T) {
+	s, err := parseSubmission([]string{"case-4711", " op-x ", "case-4711", ""}, []string{"case=4711", "analyst = jd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &apkfile.Submission{Tags: []string{"case-4711", "op-x"}, Metadata: map[string]string{"case": "4711", "analyst": "jd"}}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("unexpected submission %#v", s)
+	}
+
+	if s, err := parseSubmission(nil, nil); s != nil || err != nil {
+		t.Errorf("expected no submission, got %#v %v", s, err)
+	}
+	for _, meta := range []string{"case", "case.id=1", "=1"} {
+		if _, err := parseSubmission(nil, []string{meta}); err == nil {
+			t.Errorf("expected %q to be refused", meta)
+		}
+	}
+}
+
+// TestWebSubmission tests the form fields and the API key defaults of web submissions.
+func TestWebSubmission(t *testing.T) {
+	current = &runtimeConfig{apiKeys: map[string]apiKey{
+		"s3cret": {Name: "soc-emea", Tags: []string{"emea"}, Metadata: map[string]string{"team": "soc", "case": "default"}},
+	}}
+	defer func() { current = nil }()
+
+	submit := func(key string, form url.Values) (*apkfile.Submission, int) {
+		r := httptest.NewRequest("POST", "/v1/scan", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		s, _ := webSubmission(w, r)
+		return s, w.Code
+	}
+
+	s, code := submit("s3cret", url.Values{"tag": {"case-4711"}, "meta": {"case=4711"}})
+	want := &apkfile.Submission{
+		Submitter: "soc-emea",
+		Tags:      []string{"case-4711", "emea"},
+		Metadata:  map[string]string{"case": "4711", "team": "soc"},
+	}
+	if code != http.StatusOK || !reflect.DeepEqual(s, want) {
+		t.Errorf("unexpected submission %#v", s)
+	}
+
+	if s, code := submit("", url.Values{"tag": {"case-4711"}}); code != http.StatusOK || s.Submitter != "" || len(s.Tags) != 1 {
+		t.Errorf("expected the form's tags only, got %#v", s)
+	}
+	if _, code := submit("guess", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected an unknown key to be refused, got %d", code)
+	}
+	if _, code := submit("", url.Values{"meta": {"no value"}}); code != http.StatusBadRequest {
+		t.Errorf("expected malformed metadata to be refused, got %d", code)
+	}
+}
+
+// TestSubmissionFilter tests looking up reports by submission tags and metadata.
+func TestSubmissionFilter(t *testing.T) {
+	ts, query := fakeElastic(`{"hits": {"hits": [{"_source": {"plugins": {"metadata": {"apkfile": {"submission": {"tags": ["case-4711"]}}}}}}]}}`)
+	defer ts.Close()
+
+	reports, err := newElasticReputation(ts.URL).FindReports(context.Background(), reportFilter{
+		Tag:      "case-4711",
+		Metadata: map[string]string{"analyst": "jd"},
+		Limit:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Submission == nil {
+		t.Fatalf("unexpected reports %#v", reports)
+	}
+	for _, want := range []string{
+		`"plugins.metadata.apkfile.tags.keyword":"case-4711"`,
+		`"plugins.metadata.apkfile.submission.tags.keyword":"case-4711"`,
+		`"plugins.metadata.apkfile.submission.metadata.analyst.keyword":"jd"`,
+	} {
+		if !strings.Contains(*query, want) {
+			t.Errorf("expected %s in %s", want, *query)
+		}
+	}
+}
@@ -1,10 +1,40 @@
 package main
 
-const tpl = `{{ if .Magic}}#### Magic
-| Field       | Value                  |
+const tpl = `{{ with .Verdict}}#### {{ T "Verdict" }}: **{{ label .Verdict }}**
+{{ range .Reasons -}}
+ - {{ . }}
+{{ end }}
+{{ end -}}
+{{ if .Tags }}#### {{ T "Tags" }}: {{ range $i, $t := .Tags }}{{ if $i }}, {{ end }}{{ $t }}{{ end }}
+
+{{ end -}}
+{{ with .Submission }}#### {{ T "Submission" }}
+| {{ T "Field" }}       | {{ T "Value" }}                |
+|-------------|----------------------|
+{{- with .Submitter }}
+| {{ T "Submitter" }}   | {{ . }} |
+{{- end }}
+{{- if .Tags }}
+| {{ T "Tags" }}        | {{ range $i, $t := .Tags }}{{ if $i }}, {{ end }}{{ $t }}{{ end }} |
+{{- end }}
+{{- range $key, $value := .Metadata }}
+| {{ $key }} | {{ $value }} |
+{{- end }}
+
+{{ end -}}
+{{ if .Magic}}#### {{ T "Magic" }}
+| {{ T "Field" }}       | {{ T "Value" }}                  |
 |-------------|------------------------|
-| Mime        | {{.Magic.Mime}}        |
-| Description | {{.Magic.Description}} |
+| {{ T "Mime" }}        | {{.Magic.Mime}}        |
+| {{ T "Description" }} | {{.Magic.Description}} |
+{{ end -}}
+{{- if .Hashes.SHA256}}
+#### {{ T "Hashes" }}
+| {{ T "Field" }}  | {{ T "Value" }}                 |
+|--------|-----------------------|
+| MD5    | {{.Hashes.MD5}}    |
+| SHA1   | {{.Hashes.SHA1}}   |
+| SHA256 | {{.Hashes.SHA256}} |
 {{ end -}}
 {{- if .SSDeep}}
 #### SSDeep
@@ -13,15 +43,428 @@ const tpl = `{{ if .Magic}}#### Magic
 {{- if .TRiD}}
 #### TRiD
 {{ range .TRiD -}}
- - {{ . }}
+ - {{ printf "%.1f" .Probability }}% {{ if .Extension }}(.{{ .Extension }}) {{ end }}{{ .Description }}
 {{end}}
 {{- end }}
 {{- if .Exiftool}}
 #### Exiftool
-| Field       | Value                |
+| {{ T "Field" }}       | {{ T "Value" }}                |
 |-------------|----------------------|
 {{- range $key, $value := .Exiftool }}
 | {{ $key }}  | {{ $value }}        |
 {{- end }}
 {{- end }}
+{{- with .Timestamps}}
+{{- if .Anomalies}}
+#### {{ T "Timestamp Anomalies" }}
+{{- range .Anomalies }}
+ - {{ . }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if .SuspiciousEntries}}
+#### {{ T "Suspicious Entries" }}
+| {{ T "Entry" }}       | {{ T "Rule" }}                 | {{ T "Description" }}          |
+|-------------|----------------------|----------------------|
+{{- range .SuspiciousEntries }}
+| {{ printf "%q" .Name }} | {{ .Rule }} | {{ .Description }} |
+{{- end }}
+{{- end }}
+{{- with .Expansion}}
+#### {{ T "Expansion File" }}
+| {{ T "Name" }}        | {{ T "Size" }}                 | SHA256               | {{ T "Package" }}              | {{ T "Linked" }}               |
+|-------------|----------------------|----------------------|----------------------|----------------------|
+| {{ .Name }} | {{ .Size }} | {{ .Hashes.SHA256 }} | {{ .Package }} | {{ .Linked }} |
+{{- if .Code}}
+
+{{ T "Code" }}: {{ range $i, $c := .Code }}{{ if $i }}, {{ end }}{{ $c }}{{ end }}
+{{- end }}
+{{- end }}
+{{- if .Vulnerabilities}}
+#### {{ T "Vulnerabilities" }}
+| {{ T "Name" }}        | {{ T "Description" }}          | {{ T "Locations" }}            |
+|-------------|----------------------|----------------------|
+{{- range .Vulnerabilities }}
+| {{ .Name }} | {{ .Description }} | {{ range $i, $l := .Locations }}{{ if $i }}, {{ end }}{{ $l }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- if .Stego}}
+#### {{ T "Steganography" }}
+| {{ T "Image" }}       | {{ T "Finding" }}              | {{ T "Offset" }}               | {{ T "Length" }}               |
+|-------------|----------------------|----------------------|----------------------|
+{{- range .Stego }}
+{{- $path := .Path }}
+{{- range .Findings }}
+| {{ $path }} | {{ .Description }} | {{ .Offset }} | {{ .Length }} |
+{{- end }}
+{{- end }}
+{{- end }}
+{{- with .Strings}}
+#### {{ T "Strings" }}
+{{ range .URLs -}}
+ - URL: ` + "`" + `{{ . }}` + "`" + `
+{{ end -}}
+{{ range .IPs -}}
+ - IP: ` + "`" + `{{ . }}` + "`" + `
+{{ end -}}
+{{ range .Emails -}}
+ - {{ T "Email" }}: ` + "`" + `{{ . }}` + "`" + `
+{{ end -}}
+{{ range .Bitcoin -}}
+ - {{ T "Bitcoin" }}: ` + "`" + `{{ . }}` + "`" + `
+{{ end -}}
+{{ range .Monero -}}
+ - {{ T "Monero" }}: ` + "`" + `{{ . }}` + "`" + `
+{{ end -}}
+{{ range .Phones -}}
+ - {{ T "Phone" }}: ` + "`" + `{{ . }}` + "`" + `
+{{ end -}}
+{{ range .Decrypted -}}
+ - {{ T "Decrypted" }}: ` + "`" + `{{ .Value }}` + "`" + ` ({{ .Scheme }}, {{ .Decryptor }})
+{{ end -}}
+{{- end }}
+{{- if .Secrets}}
+#### {{ T "Secrets" }}
+| {{ T "Rule" }}        | {{ T "Secret" }}               | {{ T "Location" }}             |
+|-------------|----------------------|----------------------|
+{{- range .Secrets }}
+| {{ .Rule }} | ` + "`" + `{{ .Secret }}` + "`" + ` | {{ .Location }} |
+{{- end }}
+{{- end }}
+{{- with .CloudBackends}}
+#### {{ T "Cloud Backends" }}
+{{- if .Endpoints}}
+| {{ T "Kind" }}        | URL                  | {{ T "Exposed" }}              |
+|-------------|----------------------|----------------------|
+{{- range .Endpoints }}
+| {{ .Kind }} | ` + "`" + `{{ .URL }}` + "`" + ` | {{ if .Probe }}{{ .Exposed }} ({{ .Probe }}){{ else }}{{ T "not probed" }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- if .Projects}}
+
+{{ T "Projects" }}: {{ range $i, $p := .Projects }}{{ if $i }}, {{ end }}{{ $p }}{{ end }}
+{{- end }}
+{{- end }}
+{{- if .Crypto}}
+#### {{ T "Crypto Findings" }}
+| {{ T "Rule" }}        | {{ T "Location" }}             | {{ T "Evidence" }}             |
+|-------------|----------------------|----------------------|
+{{- range .Crypto }}
+| {{ .Rule }} | {{ .Location }} | {{ .Evidence }} |
+{{- end }}
+{{- end }}
+{{- if .Signers}}
+#### {{ T "Signers" }}
+| {{ T "Subject" }}     | SHA256               | {{ T "Schemes" }}              | {{ T "Issues" }}               | {{ T "Blocklisted" }}          |
+|-------------|----------------------|----------------------|----------------------|----------------------|
+{{- range .Signers }}
+| {{ .Subject }} | {{ .SHA256 }} | {{ range $i, $s := .Schemes }}{{ if $i }}, {{ end }}{{ $s }}{{ end }} | {{ range $i, $s := .Issues }}{{ if $i }}, {{ end }}{{ $s }}{{ end }} | {{ with .Blocklisted }}**{{ .Name }}**{{ end }} |
+{{- end }}
+{{- end }}
+{{- with .CrossCheck}}
+{{- if .Discrepancies}}
+#### {{ T "Parser Discrepancies" }}
+| {{ T "Tool" }}        | {{ T "Field" }}                | {{ T "Ours" }}                 | {{ T "Theirs" }}               |
+|-------------|----------------------|----------------------|----------------------|
+{{- range .Discrepancies }}
+| {{ .Tool }} | {{ .Field }} | {{ .Ours }} | {{ .Theirs }} |
+{{- end }}
+{{- end }}
+{{- if .SignatureErrors}}
+#### {{ T "Signature Errors" }}
+{{- range .SignatureErrors }}
+ - {{ . }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if .Artifacts}}
+#### {{ T "Artifacts" }}
+| {{ T "Name" }}        | {{ T "Size" }}                 | {{ T "Description" }}          |
+|-------------|----------------------|----------------------|
+{{- range .Artifacts }}
+| {{ .Name }} | {{ .Size }} | {{ .Description }} |
+{{- end }}
+{{- end }}
+{{- if .SignerReputation}}
+#### {{ T "Signer Reputation" }}
+| SHA256      | {{ T "Samples" }}              | {{ T "Verdicts" }}             | {{ T "Packages" }}             |
+|-------------|----------------------|----------------------|----------------------|
+{{- range .SignerReputation }}
+| {{ .SHA256 }} | {{ .Samples }} | {{ range $v, $n := .Verdicts }}{{ $v }}: {{ $n }} {{ end }} | {{ range $i, $p := .Packages }}{{ if $i }}, {{ end }}{{ $p }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- with .UpdateAnalysis}}{{ with .Previous }}
+#### {{ T "Update Analysis" }}
+| {{ T "Field" }}               | {{ T "Previous" }}             | {{ T "Current" }}              |
+|---------------------|----------------------|----------------------|
+| SHA256              | {{ .SHA256 }} | {{ $.UpdateAnalysis.Current.SHA256 }} |
+| {{ T "Version Code" }}        | {{ .VersionCode }} | {{ $.UpdateAnalysis.Current.VersionCode }}{{ if $.UpdateAnalysis.Downgrade }} ({{ T "downgrade" }}){{ end }} |
+| {{ T "Signers" }}             | {{ range $i, $s := .Signers }}{{ if $i }}, {{ end }}{{ $s }}{{ end }} | {{ range $i, $s := $.UpdateAnalysis.Current.Signers }}{{ if $i }}, {{ end }}{{ $s }}{{ end }}{{ if $.UpdateAnalysis.SignerChanged }} ({{ T "changed" }}){{ end }} |
+{{- with $.UpdateAnalysis.AddedPermissions }}
+| {{ T "Added Permissions" }}   | | {{ range $i, $p := . }}{{ if $i }}, {{ end }}{{ $p }}{{ end }} |
+{{- end }}
+{{- with $.UpdateAnalysis.RemovedPermissions }}
+| {{ T "Removed Permissions" }} | {{ range $i, $p := . }}{{ if $i }}, {{ end }}{{ $p }}{{ end }} | |
+{{- end }}
+{{- end }}{{- end }}
+{{- if .MalwarePackages}}
+#### {{ T "Malware Packages" }}
+| {{ T "Match" }}       | {{ T "Package" }}              | {{ T "Version Code" }}         | {{ T "Family" }}               |
+|-------------|----------------------|----------------------|----------------------|
+{{- range .MalwarePackages }}
+| {{ .Match }} | {{ .Package }} | {{ .VersionCode }} | {{ .Family }} |
+{{- end }}
+{{- end }}
+{{- with .Enrichment}}
+#### {{ T "Enrichment" }}
+{{- if .Results}}
+| {{ T "Provider" }}    | {{ T "Found" }}                | {{ T "Detections" }}           | {{ T "Label" }}                |
+|-------------|----------------------|----------------------|----------------------|
+{{- range .Results }}
+| [{{ .Provider }}]({{ .Link }}) | {{ .Found }} | {{ if .Engines }}{{ .Detections }}/{{ .Engines }}{{ else if .Detected }}**{{ T "detected" }}**{{ end }} | {{ .Label }} |
+{{- end }}
+{{- end }}
+{{- range $name, $reason := .Unavailable }}
+ - {{ T "Unavailable" }}: {{ $name }} ({{ $reason }})
+{{- end }}
+{{- end }}
+{{- with .Quark}}
+#### Quark-Engine ({{ label .ThreatLevel }}, {{ T "score" }} {{ .TotalScore }})
+| {{ T "Crime" }}       | {{ T "Confidence" }}           | {{ T "Weight" }}               | {{ T "Labels" }}               |
+|-------------|----------------------|----------------------|----------------------|
+{{- range .Crimes }}
+| {{ .Crime }} | {{ .Confidence }}% | {{ .Weight }} | {{ range $i, $l := .Labels }}{{ if $i }}, {{ end }}{{ $l }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- with .Androguard}}
+#### Androguard
+{{ .CallGraph.Methods }} {{ T "methods" }}, {{ .CallGraph.Calls }} {{ T "calls" }}, {{ .CallGraph.External }} {{ T "external methods" }}
+
+| API         | {{ T "Callers" }}              |
+|-------------|----------------------|
+{{- range .APICalls }}
+| {{ .API }} | {{ .CallerCount }} |
+{{- end }}
+{{- end }}
+{{- with .Decompiled}}
+#### {{ T "Decompiled Sources" }}
+| {{ T "Field" }}       | {{ T "Value" }}                |
+|-------------|----------------------|
+| {{ T "Files" }}       | {{ .Files }}         |
+| {{ T "Artifact" }}    | {{ .Artifact }}      |
+{{- with .Strings }}
+| {{ T "URLs" }}        | {{ range $i, $u := .URLs }}{{ if $i }}, {{ end }}{{ $u }}{{ end }} |
+| {{ T "IPs" }}         | {{ range $i, $u := .IPs }}{{ if $i }}, {{ end }}{{ $u }}{{ end }} |
+| {{ T "Emails" }}      | {{ range $i, $u := .Emails }}{{ if $i }}, {{ end }}{{ $u }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- with .Toolchain}}
+#### {{ T "Toolchain" }}
+| {{ T "Field" }}       | {{ T "Value" }}                |
+|-------------|----------------------|
+| {{ T "Language" }}    | {{ .Language }}      |
+| {{ T "Compiler" }}    | {{ .Compiler }}      |
+| {{ T "Frameworks" }}  | {{ range $i, $f := .Frameworks }}{{ if $i }}, {{ end }}{{ $f }}{{ end }} |
+| {{ T "Rebuilt" }}     | {{ if .Rebuilt }}**{{ T "yes" }}**{{ else }}{{ T "no" }}{{ end }} |
+{{- end }}
+{{- with .Opcodes}}
+#### {{ T "Opcodes" }}
+| {{ T "Dex" }}         | {{ T "Methods" }}              | {{ T "Instructions" }}         | {{ T "Invoke Density" }}       | {{ T "Const-String Ratio" }}   |
+|-------------|----------------------|----------------------|----------------------|----------------------|
+{{- range .Dex }}
+| {{ .Name }} | {{ .Methods }} | {{ .Instructions }} | {{ .InvokeDensity }} | {{ .ConstStringRatio }} |
+{{- end }}
+{{- end }}
+{{- with .Packages}}
+#### {{ T "Packages" }} ({{ .Classes }} {{ T "classes" }})
+| {{ T "Package" }}     | {{ T "Classes" }}              |
+|-------------|----------------------|
+{{- range .Packages }}
+| {{ if .App }}**{{ .Name }}**{{ else }}{{ .Name }}{{ end }} | {{ .Classes }} |
+{{- end }}
+{{- end }}
+{{- with .APIUsage}}
+#### {{ T "API Usage" }}
+| API             | {{ T "Calls" }}                | {{ T "Methods" }}              |
+|-----------------|----------------------|----------------------|
+| {{ T "Reflection" }}      | {{ .Reflection.Calls }}{{ if .HeavyReflection }} (**{{ T "heavy" }}**){{ end }} | {{ .Reflection.Methods }} |
+| Cipher          | {{ .Cipher.Calls }} | {{ .Cipher.Methods }} |
+| Base64          | {{ .Base64.Calls }} | {{ .Base64.Methods }} |
+| Runtime.exec    | {{ .RuntimeExec.Calls }} | {{ .RuntimeExec.Methods }} |
+| ProcessBuilder  | {{ .ProcessBuilder.Calls }} | {{ .ProcessBuilder.Methods }} |
+{{- end }}
+{{- with .NativeLibs}}
+{{- if .Libraries}}
+#### {{ T "Native Libraries" }}
+| {{ T "Library" }}     | {{ T "JNI Exports" }}          | RegisterNatives      | {{ T "Packer" }}               | {{ T "Anti-Debug" }} | NX | RELRO | {{ T "Canary" }} | PIE | {{ T "Stripped" }} |
+|-------------|----------------------|----------------------|----------------------|------------|----|-------|--------|-----|----------|
+{{- range .Libraries }}
+| {{ .Path }} | {{ len .JNIExports }} | {{ .RegisterNatives }} | {{ if .Packer }}{{ .Packer }}{{ else if .Packed }}{{ T "unknown" }}{{ end }} | {{ if .AntiDebug }}{{ len .AntiDebug }}{{ end }} | {{ with .Hardening }}{{ .NX }} | {{ .RELRO }} | {{ .Canary }} | {{ .PIE }} | {{ .Stripped }}{{ else }} | | | |{{ end }} |
+{{- end }}
+{{- end }}
+{{- end }}
+{{- with .Impersonation}}
+{{- if .Findings}}
+#### {{ T "Impersonation" }}
+| {{ T "Rule" }}        | {{ T "Description" }}          |
+|-------------|----------------------|
+{{- range .Findings }}
+| {{ .Rule }} | {{ .Description }} |
+{{- end }}
+{{- end }}
+{{- end }}
+{{- with .Locales}}
+#### {{ T "Locales" }}
+| {{ T "Field" }}       | {{ T "Value" }}                |
+|-------------|----------------------|
+{{- if .Label }}
+| {{ T "Label" }}       | {{ .Label }} |
+{{- end }}
+{{- if .Script }}
+| {{ T "Script" }}      | {{ .Script }}{{ if .Language }} ({{ .Language }}){{ end }} |
+{{- end }}
+{{- if .Locales }}
+| {{ T "Locales" }}     | {{ range $i, $l := .Locales }}{{ if $i }}, {{ end }}{{ $l }}{{ end }} |
+{{- end }}
+{{- range .RegionalSDKs }}
+| {{ .Region }} SDK | {{ .Name }} ({{ .Kind }}) |
+{{- end }}
+{{- end }}
+{{- with .Intents}}
+{{- if .Indicators}}
+#### {{ T "Intent Filters" }}
+| {{ T "Indicator" }}   | {{ T "Description" }}          | {{ T "Components" }}           |
+|-------------|----------------------|----------------------|
+{{- range .Indicators }}
+| {{ .Name }} | {{ .Description }} | {{ range $i, $c := .Components }}{{ if $i }}, {{ end }}{{ $c }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- end }}
+{{- with .TaskHijacking}}
+{{- if .Indicators}}
+#### {{ T "Task Hijacking" }}
+| {{ T "Indicator" }}   | {{ T "Description" }}          | {{ T "Activities" }}           |
+|-------------|----------------------|----------------------|
+{{- range .Indicators }}
+| {{ .Name }} | {{ .Description }} | {{ range $i, $a := .Activities }}{{ if $i }}, {{ end }}{{ $a }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if .Attestation}}
+#### {{ T "Attestation" }}
+| API         | {{ T "Description" }}          | {{ T "Calls" }}                |
+|-------------|----------------------|----------------------|
+{{- range .Attestation }}
+| {{ .Name }} | {{ .Description }} | {{ range $i, $c := .Calls }}{{ if $i }}, {{ end }}{{ $c }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- with .WebView}}
+#### WebView
+{{- if .Settings}}
+| {{ T "Setting" }}     | {{ T "Description" }}          | {{ T "Location" }}             |
+|-------------|----------------------|----------------------|
+{{- range .Settings }}
+| {{ .Name }} | {{ .Description }} | {{ .Location }} |
+{{- end }}
+{{- end }}
+{{- if .Interfaces}}
+
+{{ T "JavaScript interfaces" }}:
+{{- range .Interfaces }}
+ - {{ if .Name }}` + "`" + `{{ .Name }}` + "`" + ` {{ end }}{{ T "at" }} {{ .Location }}
+{{- end }}
+{{- end }}
+{{- if .FileURLs}}
+
+{{ T "File URLs" }}: {{ range $i, $u := .FileURLs }}{{ if $i }}, {{ end }}` + "`" + `{{ $u }}` + "`" + `{{ end }}
+{{- end }}
+{{- if .Assets}}
+
+{{ T "Bundled pages and scripts" }}: {{ range $i, $a := .Assets }}{{ if $i }}, {{ end }}{{ $a }}{{ end }}
+{{- end }}
+{{- end }}
+{{- with .AntiAnalysis}}
+#### {{ T "Anti-Analysis" }}
+| {{ T "Check" }}       | {{ T "Indicator" }}            | {{ T "Location" }}             |
+|-------------|----------------------|----------------------|
+{{- range .Emulator }}
+| {{ T "emulator" }} | {{ .Indicator }} | {{ .Location }} |
+{{- end }}
+{{- range .Root }}
+| {{ T "root" }} | {{ .Indicator }} | {{ .Location }} |
+{{- end }}
+{{- range .Instrumentation }}
+| {{ T "instrumentation" }} | {{ .Indicator }} | {{ .Location }} |
+{{- end }}
+{{- end }}
+{{- if .Behaviors}}
+#### {{ T "Behaviors" }}
+| {{ T "Behavior" }}    | {{ T "Description" }}          | {{ T "Evidence" }}             |
+|-------------|----------------------|----------------------|
+{{- range .Behaviors }}
+| {{ .Name }} | {{ .Description }} | {{ range $i, $e := .Evidence }}{{ if $i }}, {{ end }}{{ $e }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- with .Billing}}
+#### {{ T "Billing" }}
+| SDK         | {{ T "Kind" }}                 | {{ T "Package" }}              |
+|-------------|----------------------|----------------------|
+{{- range .SDKs }}
+| {{ .Name }} | {{ label .Kind }} | {{ .Package }} |
+{{- end }}
+{{- if .TollFraudRisk }}
+
+{{ T "Toll fraud risk" }}: {{ T "embeds payment flows and requests" }} {{ range $i, $p := .SMSPermissions }}{{ if $i }}, {{ end }}{{ $p }}{{ end }}
+{{- end }}
+{{- end }}
+{{- if .Permissions}}
+#### {{ T "Custom Permissions" }}
+| {{ T "Permission" }}  | {{ T "Protection Level" }}     | {{ T "Weakly Guarded" }}       |
+|-------------|----------------------|----------------------|
+{{- range .Permissions }}
+| {{ .Name }} | {{ .ProtectionLevel }} | {{ range $i, $c := .Weak }}{{ if $i }}, {{ end }}{{ $c }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- with .RuntimePerms}}
+#### {{ T "Runtime Permissions" }}
+{{- if .Requested}}
+| {{ T "Permission" }}  | {{ T "Declared" }}             | {{ T "Requested In" }}         |
+|-------------|----------------------|----------------------|
+{{- range .Requested }}
+| {{ .Name }} | {{ .Declared }} | {{ range $i, $l := .Locations }}{{ if $i }}, {{ end }}{{ $l }}{{ end }} |
+{{- end }}
+{{- end }}
+{{- if .Dormant}}
+
+{{ T "Declared but not requested" }}: {{ range $i, $p := .Dormant }}{{ if $i }}, {{ end }}{{ $p }}{{ end }}
+{{- end }}
+{{- if .Unresolved}}
+
+{{ T "Requests that aren't constants" }}: {{ range $i, $l := .Unresolved }}{{ if $i }}, {{ end }}{{ $l }}{{ end }}
+{{- end }}
+{{- end }}
+{{- if .DeepLinks}}
+#### {{ T "Deep Links" }}
+| URI         | {{ T "Component" }}            | {{ T "Suspicious" }}           |
+|-------------|----------------------|----------------------|
+{{- range .DeepLinks }}
+| ` + "`" + `{{ .URI }}` + "`" + ` | {{ .Component }} | {{ .Suspicious }} |
+{{- end }}
+{{- end }}
+{{- if .Errors}}
+#### {{ T "Errors" }}
+| {{ T "Analyzer" }}    | {{ T "Error" }}                |
+|-------------|----------------------|
+{{- range .Errors }}
+| {{ .Analyzer }}  | {{ .Message }}        |
+{{- end }}
+{{- end }}
+{{- if .Warnings}}
+#### {{ T "Warnings" }}
+| {{ T "Analyzer" }}    | {{ T "Warning" }}              |
+|-------------|----------------------|
+{{- range .Warnings }}
+| {{ .Analyzer }}  | {{ .Message }}        |
+{{- end }}
+{{- end }}
 `
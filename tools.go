@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/urfave/cli"
+)
+
+// pluginInfo is what GET /admin/info and fileinfo tools report, to reproduce
+// results across a fleet
+type pluginInfo struct {
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	Version   string `json:"version"`
+	BuildTime string `json:"build_time"`
+	apkfile.ScannerInfo
+}
+
+// newPluginInfo describes the plugin and what scanner runs
+func newPluginInfo(ctx context.Context, scanner *apkfile.Scanner) pluginInfo {
+	return pluginInfo{
+		Name:        name,
+		Category:    category,
+		Version:     Version,
+		BuildTime:   BuildTime,
+		ScannerInfo: scanner.Info(ctx),
+	}
+}
+
+// digest identifies what produces the reports, it changes with the plugin
+// version, the tools, the analyzers and the rules but not with rebuilds
+func (p pluginInfo) digest() string {
+	p.BuildTime = ""
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// tools prints the plugin's tool versions, rules and analyzers as JSON
+func tools(c *cli.Context) error {
+	if err := setupConfig(c); err != nil {
+		return err
+	}
+	defer closeConfig()
+	rc, release := acquireConfig()
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.GlobalInt("timeout"))*time.Second)
+	defer cancel()
+	out, err := json.MarshalIndent(newPluginInfo(ctx, rc.scanner), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
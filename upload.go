@@ -0,0 +1,401 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/gorilla/mux"
+)
+
+// tusVersion is the version of the tus resumable upload protocol served
+const tusVersion = "1.0.0"
+
+const (
+	// defaultMaxUploadSize caps resumable uploads, game APKs with their
+	// assets run into gigabytes
+	defaultMaxUploadSize = 8 << 30
+	// defaultUploadTTL is how long an upload is kept without being scanned
+	defaultUploadTTL = 24 * time.Hour
+)
+
+var (
+	// uploadDir holds the resumable uploads, a directory of each, empty
+	// when they are disabled
+	uploadDir string
+	// maxUploadSize caps the length of resumable uploads
+	maxUploadSize int64 = defaultMaxUploadSize
+	// uploadLocks serializes the requests to the same upload, tus clients
+	// retrying a chunk may race the request they gave up on
+	uploadLocks = struct {
+		sync.Mutex
+		m map[string]*sync.Mutex
+	}{m: make(map[string]*sync.Mutex)}
+)
+
+// uploadInfo is the state of a resumable upload, kept next to its data so
+// uploads resume after a restart
+type uploadInfo struct {
+	Length int64 `json:"length"`
+	// SHA256 is the digest the client announced, the assembled file must
+	// match it
+	SHA256   string    `json:"sha256,omitempty"`
+	Filename string    `json:"filename,omitempty"`
+	Created  time.Time `json:"created"`
+	// Hashes are set once every byte was received and validated
+	Hashes *apkfile.FileHashes `json:"hashes,omitempty"`
+}
+
+// lockUpload locks the upload id, call the returned func to unlock it
+func lockUpload(id string) func() {
+	uploadLocks.Lock()
+	mu, ok := uploadLocks.m[id]
+	if !ok {
+		mu = &sync.Mutex{}
+		uploadLocks.m[id] = mu
+	}
+	uploadLocks.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// removeUpload deletes the upload id and forgets its lock, the caller must
+// hold it. Requests waiting for the lock find the upload gone
+func removeUpload(id string) error {
+	err := os.RemoveAll(filepath.Join(uploadDir, id))
+	forgetUpload(id)
+	return err
+}
+
+// forgetUpload drops the lock of an upload that doesn't exist, the caller
+// must hold it
+func forgetUpload(id string) {
+	uploadLocks.Lock()
+	delete(uploadLocks.m, id)
+	uploadLocks.Unlock()
+}
+
+// validUploadID matches the IDs webCreateUpload hands out
+var validUploadID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func uploadPath(id, name string) string {
+	return filepath.Join(uploadDir, id, name)
+}
+
+func readUploadInfo(id string) (*uploadInfo, error) {
+	data, err := ioutil.ReadFile(uploadPath(id, "info.json"))
+	if err != nil {
+		return nil, err
+	}
+	var info uploadInfo
+	return &info, json.Unmarshal(data, &info)
+}
+
+func writeUploadInfo(id string, info *uploadInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	tmp := uploadPath(id, ".info.json")
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, uploadPath(id, "info.json"))
+}
+
+// uploadOffset is how many bytes of the upload were received
+func uploadOffset(id string) (int64, error) {
+	fi, err := os.Stat(uploadPath(id, "data"))
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header, comma separated
+// keys and Base64 values
+func parseUploadMetadata(header string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			meta[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("metadata %s isn't Base64", fields[0])
+			}
+			meta[fields[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("malformed metadata %q", pair)
+		}
+	}
+	return meta, nil
+}
+
+// tusHeaders sets the headers every tus response carries
+func tusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// webUploadOptions tells tus clients what the service supports
+func webUploadOptions(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,termination")
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxUploadSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webCreateUpload starts a resumable upload of Upload-Length bytes, the
+// "sha256" metadata is the digest the assembled file is checked against
+func webCreateUpload(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "Please supply the Upload-Length.")
+		return
+	}
+	if length > maxUploadSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprintf(w, "Uploads are at most %d bytes.\n", maxUploadSize)
+		return
+	}
+	meta, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, err)
+		return
+	}
+	info := &uploadInfo{Length: length, SHA256: strings.ToLower(meta["sha256"]), Filename: meta["filename"], Created: time.Now().UTC()}
+	if _, err := hex.DecodeString(info.SHA256); err != nil || len(info.SHA256) != 0 && len(info.SHA256) != 64 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "The sha256 metadata must be a hex SHA256.")
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	key := hex.EncodeToString(id)
+	defer lockUpload(key)()
+	err = os.Mkdir(filepath.Join(uploadDir, key), 0700)
+	if err == nil {
+		var f *os.File
+		if f, err = createPrivate(uploadPath(key, "data")); err == nil {
+			f.Close()
+			err = writeUploadInfo(key, info)
+		}
+	}
+	if err != nil {
+		removeUpload(key)
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+key)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// webUploadOffset tells the client where to resume the upload
+func webUploadOffset(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	id := mux.Vars(r)["id"]
+	defer lockUpload(id)()
+
+	info, err := readUploadInfo(id)
+	if err != nil {
+		forgetUpload(id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	offset, err := uploadOffset(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// webUploadChunk appends the body to the upload at Upload-Offset, the last
+// chunk has the upload validated and hashed
+func webUploadChunk(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	id := mux.Vars(r)["id"]
+	defer lockUpload(id)()
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	info, err := readUploadInfo(id)
+	if err != nil {
+		forgetUpload(id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	offset, err := uploadOffset(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	if claimed, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64); err != nil || claimed != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, "The upload is at offset %d.\n", offset)
+		return
+	}
+
+	f, err := os.OpenFile(uploadPath(id, "data"), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	// whatever arrived before the link dropped is kept, the client resumes
+	// after it
+	n, err := io.Copy(f, io.LimitReader(r.Body, info.Length-offset+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if offset+n > info.Length {
+		os.Truncate(uploadPath(id, "data"), offset)
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "The chunk goes past the Upload-Length.")
+		return
+	}
+	offset += n
+	if err != nil {
+		log.WithError(err).Debugf("upload %s interrupted at offset %d", id, offset)
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if offset == info.Length {
+		if err := completeUpload(id, info); err != nil {
+			// the client can't fix a corrupt upload by resuming it
+			removeUpload(id)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintln(w, err)
+			return
+		}
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeUpload hashes the assembled upload and checks it against the
+// SHA256 the client announced
+func completeUpload(id string, info *uploadInfo) error {
+	hashes, err := apkfile.HashFile(uploadPath(id, "data"))
+	if err != nil {
+		return err
+	}
+	if info.SHA256 != "" && hashes.SHA256 != info.SHA256 {
+		return fmt.Errorf("the upload's SHA256 is %s, not %s", hashes.SHA256, info.SHA256)
+	}
+	info.Hashes = &hashes
+	return writeUploadInfo(id, info)
+}
+
+// webDeleteUpload abandons an upload
+func webDeleteUpload(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	id := mux.Vars(r)["id"]
+	defer lockUpload(id)()
+
+	if _, err := readUploadInfo(id); err != nil {
+		forgetUpload(id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := removeUpload(id); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// takeUpload moves the completed upload id into the scan directory dir, the
+// upload is gone once it is scanned
+func takeUpload(w http.ResponseWriter, id, dir string) (string, apkfile.FileHashes, bool) {
+	defer lockUpload(id)()
+
+	info, err := readUploadInfo(id)
+	if err != nil {
+		forgetUpload(id)
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "No such upload.")
+		return "", apkfile.FileHashes{}, false
+	}
+	if info.Hashes == nil {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintln(w, "The upload isn't complete.")
+		return "", apkfile.FileHashes{}, false
+	}
+
+	path := filepath.Join(dir, "sample")
+	if err := os.Rename(uploadPath(id, "data"), path); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return "", apkfile.FileHashes{}, false
+	}
+	removeUpload(id)
+	log.Debug("Uploaded fileName: ", info.Filename)
+	return path, *info.Hashes, true
+}
+
+// expireUploads removes the uploads older than ttl every hour, finished or not
+func expireUploads(ttl time.Duration) {
+	for range time.Tick(time.Hour) {
+		removeExpiredUploads(time.Now().Add(-ttl))
+	}
+}
+
+// removeExpiredUploads removes the uploads created before deadline
+func removeExpiredUploads(deadline time.Time) {
+	dirs, err := ioutil.ReadDir(uploadDir)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, d := range dirs {
+		id := d.Name()
+		unlock := lockUpload(id)
+		if info, err := readUploadInfo(id); err != nil || info.Created.Before(deadline) {
+			log.Debugf("removing expired upload %s", id)
+			removeUpload(id)
+		}
+		unlock()
+	}
+}
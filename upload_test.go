@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResumableUpload tests uploading a file in chunks, resuming after an
+// interrupted chunk and moving the completed upload into a scan directory.
+func TestResumableUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	uploadDir = filepath.Join(dir, "uploads")
+	defer func() { uploadDir = "" }()
+	if err := os.Mkdir(uploadDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter()
+
+	data := strings.Repeat("PK\x03\x04 large game assets ", 1000)
+	sum := sha256.Sum256([]byte(data))
+	do := func(method, target string, headers map[string]string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Tus-Resumable", tusVersion)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	create := func(sha string) string {
+		w := do("POST", "/v1/uploads", map[string]string{
+			"Upload-Length":   strconv.Itoa(len(data)),
+			"Upload-Metadata": "filename Z2FtZS5hcGs=,sha256 " + base64.StdEncoding.EncodeToString([]byte(sha)),
+		}, "")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected the upload to be created, got %d %s", w.Code, w.Body)
+		}
+		return w.Header().Get("Location")
+	}
+	patch := func(location string, offset int, chunk string) *httptest.ResponseRecorder {
+		return do("PATCH", location, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": strconv.Itoa(offset),
+		}, chunk)
+	}
+
+	location := create(hex.EncodeToString(sum[:]))
+	if w := patch(location, 0, data[:10000]); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "10000" {
+		t.Fatalf("unexpected response to the first chunk %d %v", w.Code, w.Header())
+	}
+	if w := patch(location, 5000, data[5000:]); w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "10000" {
+		t.Errorf("expected a chunk at the wrong offset to conflict, got %d %v", w.Code, w.Header())
+	}
+	if w := do("HEAD", location, nil, ""); w.Header().Get("Upload-Offset") != "10000" || w.Header().Get("Upload-Length") != strconv.Itoa(len(data)) {
+		t.Errorf("unexpected offset %v", w.Header())
+	}
+
+	id := filepath.Base(location)
+	scanDir, err := ioutil.TempDir(dir, "scan_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := takeUpload(httptest.NewRecorder(), id, scanDir); ok {
+		t.Error("expected an incomplete upload to be refused")
+	}
+	if w := patch(location, 10000, data[10000:]+"trailing"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a chunk past the length to be refused, got %d", w.Code)
+	}
+	if w := patch(location, 10000, data[10000:]); w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected response to the last chunk %d %s", w.Code, w.Body)
+	}
+
+	path, hashes, ok := takeUpload(httptest.NewRecorder(), id, scanDir)
+	if !ok {
+		t.Fatal("expected the complete upload to be taken")
+	}
+	if got, _ := ioutil.ReadFile(path); string(got) != data || hashes.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected upload %s with %s", path, hashes.SHA256)
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, id)); !os.IsNotExist(err) {
+		t.Error("expected the upload to be removed once taken")
+	}
+
+	location = create(strings.Repeat("0", 64))
+	if w := patch(location, 0, data); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected a mismatching SHA256 to be refused, got %d", w.Code)
+	}
+	if w := do("HEAD", location, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the corrupt upload to be removed, got %d", w.Code)
+	}
+}
+
+// TestUploadLocks tests that only removed uploads lose their lock and that upload IDs are checked.
+func TestUploadLocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	uploadDir = dir
+	defer func() { uploadDir = "" }()
+
+	kept, expired := strings.Repeat("a", 32), strings.Repeat("b", 32)
+	for id, created := range map[string]time.Time{kept: time.Now(), expired: time.Now().Add(-48 * time.Hour)} {
+		if err := os.Mkdir(filepath.Join(dir, id), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeUploadInfo(id, &uploadInfo{Length: 1, Created: created}); err != nil {
+			t.Fatal(err)
+		}
+		lockUpload(id)()
+	}
+	lock := uploadLocks.m[kept]
+
+	removeExpiredUploads(time.Now().Add(-defaultUploadTTL))
+	if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+		t.Errorf("expected the recent upload to be kept, got %v", err)
+	}
+	if uploadLocks.m[kept] != lock {
+		t.Error("expected the kept upload to keep its lock")
+	}
+	if _, err := os.Stat(filepath.Join(dir, expired)); !os.IsNotExist(err) {
+		t.Errorf("expected the expired upload to be removed, got %v", err)
+	}
+	if _, ok := uploadLocks.m[expired]; ok {
+		t.Error("expected the lock of the removed upload to be forgotten")
+	}
+
+	r := httptest.NewRequest("POST", "/v1/scan", strings.NewReader("upload=../"+kept))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if _, _, ok := saveUpload(w, r, dir); ok || w.Code != http.StatusBadRequest {
+		t.Errorf("expected a path as upload ID to be refused, got %d", w.Code)
+	}
+	if _, ok := uploadLocks.m["../"+kept]; ok {
+		t.Error("expected no lock for an invalid upload ID")
+	}
+}
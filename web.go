@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/gorilla/mux"
+)
+
+// jobs backs the async /jobs endpoints, nil when they are disabled
+var jobs *boltQueue
+
+// sampleDir is where uploads are written while they are scanned
+var sampleDir string
+
+// artifactDir is where scans save artifacts, their endpoint is disabled when empty
+var artifactDir string
+
+// adminToken is the bearer token of the /admin endpoints, they are disabled
+// when empty
+var adminToken string
+
+func webService(cfg workerConfig) error {
+	sampleDir = cfg.SampleDir
+	artifactDir = cfg.ArtifactDir
+	adminToken = cfg.AdminToken
+	if sampleDir == "" {
+		sampleDir = os.TempDir()
+	}
+	if err := checkWritable(sampleDir); err != nil {
+		return fmt.Errorf("sample directory %s is not writable: %v", sampleDir, err)
+	}
+
+	// next to the scan directories, so completed uploads are moved into them
+	uploadDir = filepath.Join(sampleDir, "uploads")
+	if err := os.MkdirAll(uploadDir, 0700); err != nil {
+		return err
+	}
+	if cfg.MaxUploadSize > 0 {
+		maxUploadSize = cfg.MaxUploadSize
+	}
+	if cfg.UploadTTL > 0 {
+		go expireUploads(cfg.UploadTTL)
+	}
+
+	if cfg.GraphQL {
+		var err error
+		if graphqlHandler, err = newGraphQLHandler(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.QueueDB != "" {
+		var err error
+		if jobs, err = openBoltQueue(cfg.QueueDB, cfg.MaxAttempts, cfg.RetryBackoff, cfg.JobRetention); err != nil {
+			return err
+		}
+		defer jobs.Close()
+
+		go runJobs(context.Background(), jobs, cfg)
+	}
+
+	reloadOnSIGHUP()
+
+	if cfg.Master != nil {
+		go cfg.Master.run(context.Background())
+	}
+
+	log.Info("web service listening on port :3993")
+	return http.ListenAndServe(":3993", newRouter())
+}
+
+// legacySunset is when the unversioned routes of earlier releases go away
+var legacySunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+
+// newRouter serves the API under /v1, and under the unversioned paths Malice
+// deployments already use until legacySunset. Schema-breaking changes get a
+// /v2 subrouter with its own handlers, leaving /v1 as it is
+func newRouter() *mux.Router {
+	router := mux.NewRouter().StrictSlash(true)
+	routesV1(router.PathPrefix("/v1").Subrouter())
+
+	legacy := router.NewRoute().Subrouter()
+	legacy.Use(deprecated("/v1"))
+	routesV1(legacy)
+	return router
+}
+
+// routesV1 registers the version 1 API on r
+func routesV1(r *mux.Router) {
+	r.HandleFunc("/scan", webAvScan).Methods("POST")
+	if adminToken != "" {
+		admin := r.PathPrefix("/admin").Subrouter()
+		admin.Use(requireAdminToken)
+		admin.HandleFunc("/reload", webReload).Methods("POST")
+		admin.HandleFunc("/info", webInfo).Methods("GET")
+	}
+	r.HandleFunc("/stats", webStats).Methods("GET")
+	if uploadDir != "" {
+		r.HandleFunc("/uploads", webUploadOptions).Methods("OPTIONS")
+		r.HandleFunc("/uploads", webCreateUpload).Methods("POST")
+		r.HandleFunc("/uploads/{id:[0-9a-f]{32}}", webUploadOffset).Methods("HEAD")
+		r.HandleFunc("/uploads/{id:[0-9a-f]{32}}", webUploadChunk).Methods("PATCH")
+		r.HandleFunc("/uploads/{id:[0-9a-f]{32}}", webDeleteUpload).Methods("DELETE")
+	}
+	if artifactDir != "" {
+		r.HandleFunc("/scan/{sha256:[0-9a-f]{64}}/artifacts/{name}", webGetArtifact).Methods("GET")
+	}
+	if graphqlHandler != nil {
+		r.Handle("/graphql", graphqlHandler).Methods("POST")
+	}
+	if jobs != nil {
+		r.HandleFunc("/jobs", webSubmitJob).Methods("POST")
+		r.HandleFunc("/jobs/{id}", webGetJob).Methods("GET")
+	}
+}
+
+// requireAdminToken refuses the requests without adminToken as their bearer
+// token
+func requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, "Please supply the admin token.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deprecated marks the responses of routes that moved under prefix, with the
+// successor's path and when the old one stops working
+func deprecated(prefix string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Sunset", legacySunset.Format(http.TimeFormat))
+			w.Header().Set("Link", "<"+prefix+r.URL.Path+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newScanDir creates the directory of one scan's uploads in sampleDir, only
+// readable by the service. Removing it removes everything the scan wrote
+func newScanDir(w http.ResponseWriter) (string, bool) {
+	// TempDir creates it with mode 0700 under a name no other scan gets
+	dir, err := ioutil.TempDir(sampleDir, "scan_")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return "", false
+	}
+	return dir, true
+}
+
+// createPrivate creates a file only the service can read, failing when it
+// exists
+func createPrivate(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+}
+
+// saveUpload streams the "malware" form file into the scan directory dir,
+// hashing it on the way, or moves the completed resumable upload the
+// "upload" form field names there
+func saveUpload(w http.ResponseWriter, r *http.Request, dir string) (string, apkfile.FileHashes, bool) {
+
+	r.ParseMultipartForm(32 << 20)
+	if id := r.FormValue("upload"); id != "" && uploadDir != "" {
+		if !validUploadID.MatchString(id) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "Please supply a valid upload ID.")
+			return "", apkfile.FileHashes{}, false
+		}
+		return takeUpload(w, id, dir)
+	}
+	file, header, err := r.FormFile("malware")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "Please supply a valid file to scan.")
+		log.Error(err)
+		return "", apkfile.FileHashes{}, false
+	}
+	defer file.Close()
+
+	log.Debug("Uploaded fileName: ", header.Filename)
+
+	tmpfile, err := createPrivate(filepath.Join(dir, "sample"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return "", apkfile.FileHashes{}, false
+	}
+
+	// hash the upload while streaming it to disk
+	h := apkfile.NewMultiHash()
+	_, err = io.Copy(tmpfile, io.TeeReader(file, h))
+	if cerr := tmpfile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return "", apkfile.FileHashes{}, false
+	}
+
+	return tmpfile.Name(), h.Sum(), true
+}
+
+// saveExpansion writes the optional "obb" form file, an expansion file shipped
+// with the APK, into the scan directory dir. It returns nil when there is none
+func saveExpansion(w http.ResponseWriter, r *http.Request, dir string) (*apkfile.ExpansionFile, bool) {
+	file, header, err := r.FormFile("obb")
+	if err == http.ErrMissingFile {
+		return nil, true
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "Please supply a valid expansion file.")
+		log.Error(err)
+		return nil, false
+	}
+	defer file.Close()
+
+	tmpfile, err := createPrivate(filepath.Join(dir, "expansion.obb"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return nil, false
+	}
+	_, err = io.Copy(tmpfile, file)
+	if cerr := tmpfile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return nil, false
+	}
+
+	// the name says which package and version the expansion file is for
+	return &apkfile.ExpansionFile{Path: tmpfile.Name(), Name: filepath.Base(header.Filename)}, true
+}
+
+// checkWritable makes sure uploads can be written to dir
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".write_test_")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func webAvScan(w http.ResponseWriter, r *http.Request) {
+
+	submission, ok := webSubmission(w, r)
+	if !ok {
+		return
+	}
+	dir, ok := newScanDir(w)
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dir) // clean up
+	path, hashes, ok := saveUpload(w, r, dir)
+	if !ok {
+		return
+	}
+	obb, ok := saveExpansion(w, r, dir)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(60)*time.Second)
+	defer cancel()
+
+	rc, release := acquireConfig()
+	defer release()
+
+	// Do FileInfo scan
+	fileInfo, err := cachedScan(ctx, rc, path, hashes, obb)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	fileInfo.Submission = submission
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(fileInfo); err != nil {
+		log.Error(err)
+	}
+}
+
+// webSubmitJob queues an uploaded file for an async scan
+func webSubmitJob(w http.ResponseWriter, r *http.Request) {
+
+	var priority int
+	if p := r.FormValue("priority"); p != "" {
+		var err error
+		if priority, err = strconv.Atoi(p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "The priority must be an integer.")
+			return
+		}
+	}
+	submission, ok := webSubmission(w, r)
+	if !ok {
+		return
+	}
+
+	dir, ok := newScanDir(w)
+	if !ok {
+		return
+	}
+	path, hashes, ok := saveUpload(w, r, dir)
+	if !ok {
+		os.RemoveAll(dir)
+		return
+	}
+	obb, ok := saveExpansion(w, r, dir)
+	if !ok {
+		os.RemoveAll(dir)
+		return
+	}
+	job := scanJob{ID: hashes.SHA256, Path: path, Dir: dir, Cleanup: true, Priority: priority, Submission: submission}
+	if obb != nil {
+		job.Expansion, job.ExpansionName = obb.Path, obb.Name
+	}
+
+	id, err := jobs.Enqueue(job)
+	if err != nil {
+		os.RemoveAll(dir)
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	// relative to the API version the job was submitted through
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+id)
+	w.WriteHeader(http.StatusAccepted)
+
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "sha256": hashes.SHA256})
+}
+
+// webGetJob returns the state, and once done the results, of an async scan
+func webGetJob(w http.ResponseWriter, r *http.Request) {
+
+	rec, err := jobs.Get(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "No such job.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(rec)
+}
+
+// webGetArtifact returns an artifact a scan saved
+func webGetArtifact(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	// the store's temporary files start with a dot
+	if name := vars["name"]; name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "No such artifact.")
+		return
+	}
+	f, err := os.Open(filepath.Join(artifactDir, vars["sha256"], vars["name"]))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "No such artifact.")
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "No such artifact.")
+		return
+	}
+
+	// artifacts are malware, never let a browser render them
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+vars["name"]+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, vars["name"], fi.ModTime(), f)
+}
+
+// webInfo returns the versions of the tools, the rules and the analyzers
+// scans use
+func webInfo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	rc, release := acquireConfig()
+	defer release()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(newPluginInfo(ctx, rc.scanner))
+}
+
+// webReload reloads the configuration like SIGHUP does
+func webReload(w http.ResponseWriter, r *http.Request) {
+	if err := reloadConfig(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err)
+		log.WithError(err).Error("reload failed, keeping the current configuration")
+		return
+	}
+	log.Info("configuration reloaded")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+)
+
+// TestCheckWritable tests the checkWritable function.
+func TestCheckWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "samples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := checkWritable(dir); err != nil {
+		t.Errorf("%s should be writable: %v", dir, err)
+	}
+	if err := checkWritable(filepath.Join(dir, "missing")); err == nil {
+		t.Error("a missing directory should not be writable")
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("checkWritable should clean up after itself, found %d files", len(files))
+	}
+}
+
+// TestRouterVersions tests that the unversioned routes are deprecated aliases of /v1.
+func TestRouterVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if jobs, err = openBoltQueue(filepath.Join(dir, "jobs.db"), 1, time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		jobs.Close()
+		jobs = nil
+	}()
+	router := newRouter()
+
+	for path, successor := range map[string]string{"/v1/jobs/7": "", "/jobs/7": "</v1/jobs/7>; rel=\"successor-version\""} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound || w.Body.String() != "No such job.\n" {
+			t.Errorf("GET %s: unexpected response %d %q", path, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Link"); got != successor {
+			t.Errorf("GET %s: expected Link %q, got %q", path, successor, got)
+		}
+		if sunset := w.Header().Get("Sunset"); (sunset != "") != (successor != "") {
+			t.Errorf("GET %s: unexpected Sunset %q", path, sunset)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v2/jobs/7", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("Link") != "" {
+		t.Errorf("expected no /v2 yet, got %d", w.Code)
+	}
+}
+
+// TestWebGetArtifact tests serving saved artifacts.
+func TestWebGetArtifact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sha256 := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	os.MkdirAll(filepath.Join(dir, sha256), 0755)
+	ioutil.WriteFile(filepath.Join(dir, sha256, "AndroidManifest.xml"), []byte("<manifest/>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, sha256, ".icon.png123"), []byte("partial"), 0644)
+
+	artifactDir = dir
+	defer func() { artifactDir = "" }()
+	router := newRouter()
+
+	for path, want := range map[string]int{
+		"/v1/scan/" + sha256 + "/artifacts/AndroidManifest.xml": http.StatusOK,
+		"/scan/" + sha256 + "/artifacts/AndroidManifest.xml":    http.StatusOK,
+		"/v1/scan/" + sha256 + "/artifacts/missing.pem":         http.StatusNotFound,
+		"/v1/scan/" + sha256 + "/artifacts/.icon.png123":        http.StatusNotFound,
+		"/v1/scan/not-a-sha256/artifacts/AndroidManifest.xml":   http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("GET %s: expected %d, got %d", path, want, w.Code)
+		}
+		if want == http.StatusOK && (w.Body.String() != "<manifest/>" || w.Header().Get("Content-Type") != "application/octet-stream") {
+			t.Errorf("GET %s: unexpected %s response %q", path, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+// TestWebInfo tests reporting the plugin and tool versions to holders of the admin token.
+func TestWebInfo(t *testing.T) {
+	rebuild = func() (*runtimeConfig, error) {
+		s, err := apkfile.NewScanner()
+		if err != nil {
+			return nil, err
+		}
+		return &runtimeConfig{scanner: s}, nil
+	}
+	if err := reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	defer closeConfig()
+
+	adminToken = "s3cret"
+	defer func() { adminToken = "" }()
+	router := newRouter()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/admin/reload", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a reload without the admin token to be refused, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/v1/admin/info", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	router.ServeHTTP(w, r)
+	var info pluginInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("%d %q: %v", w.Code, w.Body.String(), err)
+	}
+	if info.Name != name || info.Category != category || info.Tools["apkfile.jar"].Path == "" {
+		t.Errorf("unexpected info %#v", info)
+	}
+}
+
+// TestWebSubmitJobScanDir tests that uploads go into a private directory per scan, removed with the job.
+func TestWebSubmitJobScanDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "samples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sampleDir = dir
+	defer func() { sampleDir = "" }()
+	if jobs, err = openBoltQueue(filepath.Join(dir, "jobs.db"), 1, time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		jobs.Close()
+		jobs = nil
+	}()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for field, name := range map[string]string{"malware": "sample.apk", "obb": "main.1.com.example.obb"} {
+		fw, err := mw.CreateFormFile(field, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(field))
+	}
+	mw.Close()
+	req := httptest.NewRequest("POST", "/v1/jobs", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	webSubmitJob(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	job, err := jobs.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(job.Dir)
+	if err != nil || filepath.Dir(job.Dir) != dir || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected a 0700 scan directory in %s, got %s %v", dir, job.Dir, info)
+	}
+	for _, path := range []string{job.Path, job.Expansion} {
+		info, err := os.Stat(path)
+		if err != nil || filepath.Dir(path) != job.Dir || info.Mode().Perm() != 0600 {
+			t.Errorf("expected %s to be a 0600 file in the scan directory, got %v %v", path, info, err)
+		}
+	}
+	if job.ExpansionName != "main.1.com.example.obb" {
+		t.Errorf("unexpected expansion name %s", job.ExpansionName)
+	}
+
+	if err := jobs.Ack(job); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(job.Dir); !os.IsNotExist(err) {
+		t.Errorf("expected the scan directory to be removed, got %v", err)
+	}
+}
+
+// TestWebAdminDisabled tests that the admin endpoints aren't served without an admin token.
+func TestWebAdminDisabled(t *testing.T) {
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, httptest.NewRequest("POST", "/v1/admin/reload", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected no admin endpoints, got %d", w.Code)
+	}
+}
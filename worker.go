@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/atlantis0/apk-file-malice/pkg/apkfile"
+	"github.com/maliceio/go-plugin-utils/utils"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// workerConfig configures the queue worker daemon
+type workerConfig struct {
+	Queue       string
+	Concurrency int
+	MetricsAddr string
+	Timeout     time.Duration
+	// QueueDB is the local bolt queue jobs are persisted to before being
+	// processed, empty processes jobs straight from Queue
+	QueueDB      string
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	// JobRetention is how long finished jobs are kept in QueueDB
+	JobRetention time.Duration
+	// SampleDir is where the web service writes uploads, empty uses os.TempDir
+	SampleDir string
+	// MaxUploadSize caps the web service's resumable uploads
+	MaxUploadSize int64
+	// UploadTTL is how long resumable uploads are kept without being scanned
+	UploadTTL time.Duration
+	// ArtifactDir is where scans save artifacts, the web service serves them
+	ArtifactDir string
+	// GraphQL enables the web service's /graphql endpoint over stored reports
+	GraphQL bool
+	// AdminToken is the bearer token of the web service's /admin endpoints,
+	// empty disables them
+	AdminToken string
+	// Master keeps the instance registered with the Malice master, nil when
+	// it doesn't register
+	Master *masterClient
+}
+
+// workerService pulls scan jobs off the configured queue and scans them with a
+// bounded pool of goroutines until it receives SIGINT or SIGTERM, SIGHUP
+// reloads the configuration
+func workerService(cfg workerConfig) error {
+	q, err := openJobQueue(cfg.Queue)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Infof("received %s, finishing in-flight scans", sig)
+		cancel()
+	}()
+
+	reloadOnSIGHUP()
+
+	if cfg.Master != nil {
+		go cfg.Master.run(ctx)
+	}
+
+	if cfg.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		go func() {
+			log.Info("metrics listening on ", cfg.MetricsAddr)
+			log.Error(http.ListenAndServe(cfg.MetricsAddr, mux))
+		}()
+	}
+
+	log.Infof("worker processing %s with %d goroutines", cfg.Queue, cfg.Concurrency)
+
+	if cfg.QueueDB == "" {
+		runJobs(ctx, q, cfg)
+		return nil
+	}
+
+	local, err := openBoltQueue(cfg.QueueDB, cfg.MaxAttempts, cfg.RetryBackoff, cfg.JobRetention)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	go feedJobs(ctx, q, local)
+	runJobs(ctx, local, cfg)
+
+	return nil
+}
+
+// feedJobs moves jobs from upstream into the local bolt queue, upstream jobs
+// are only acked once they are persisted locally
+func feedJobs(ctx context.Context, upstream jobQueue, local *boltQueue) {
+	for {
+		job, err := upstream.Next(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("failed to read scan job")
+			if job.raw != nil {
+				// a malformed job will never succeed, drop it
+				upstream.Ack(job)
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		if _, err := local.Enqueue(job); err != nil {
+			log.WithError(err).Error("failed to persist scan job")
+			time.Sleep(time.Second)
+			continue
+		}
+		if err := upstream.Ack(job); err != nil {
+			log.WithError(err).Error("failed to ack scan job")
+		}
+	}
+}
+
+// runJobs processes jobs from q with cfg.Concurrency goroutines until ctx is done
+func runJobs(ctx context.Context, q jobQueue, cfg workerConfig) {
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := q.Next(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.WithError(err).Error("failed to read scan job")
+					if job.raw != nil {
+						// a malformed job will never succeed, drop it
+						q.Ack(job)
+					}
+					time.Sleep(time.Second)
+					continue
+				}
+
+				fileInfo, err := processJob(cfg, job)
+				if err != nil {
+					if rq, ok := q.(retryQueue); ok {
+						err = rq.Fail(job, err)
+					} else {
+						err = q.Ack(job)
+					}
+				} else if rq, ok := q.(resultQueue); ok {
+					err = rq.Complete(job, fileInfo)
+				} else {
+					err = q.Ack(job)
+				}
+				if err != nil {
+					log.WithError(err).Error("failed to ack scan job")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// processJob scans a single job and stores its results
+func processJob(cfg workerConfig, job scanJob) (apkfile.FileInfo, error) {
+	// in-flight scans are allowed to finish when the worker is shutting down
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	scansInFlight.Inc()
+	defer scansInFlight.Dec()
+	start := time.Now()
+
+	hashes, err := apkfile.HashFile(job.Path)
+	if err != nil {
+		scansTotal.WithLabelValues("error").Inc()
+		return apkfile.FileInfo{}, err
+	}
+	rc, release := acquireConfig()
+	defer release()
+
+	var obb *apkfile.ExpansionFile
+	if job.Expansion != "" {
+		obb = &apkfile.ExpansionFile{Path: job.Expansion, Name: job.ExpansionName}
+	}
+	fileInfo, err := cachedScan(ctx, rc, job.Path, hashes, obb)
+	scanDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		scansTotal.WithLabelValues("error").Inc()
+		log.WithError(err).WithField("path", job.Path).Error("scan failed")
+		return fileInfo, err
+	}
+	if fileInfo.Partial() {
+		scansTotal.WithLabelValues("partial").Inc()
+	} else {
+		scansTotal.WithLabelValues("ok").Inc()
+	}
+
+	id := job.ID
+	if id == "" {
+		id = utils.Getopt("MALICE_SCANID", fileInfo.Hashes.SHA256)
+	}
+	fileInfo.Scanner = rc.scannerDigest()
+	fileInfo.Submission = job.Submission
+	fileInfo.MarkDown = generateMarkDownTable(fileInfo)
+	writeToDatabase(rc.elastic, id, fileInfo)
+	fileInfo.MarkDown = ""
+
+	log.WithField("path", job.Path).Debug("scan stored with id ", id)
+
+	return fileInfo, nil
+}
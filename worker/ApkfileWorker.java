@@ -0,0 +1,47 @@
+import java.io.BufferedReader;
+import java.io.ByteArrayOutputStream;
+import java.io.InputStreamReader;
+import java.io.PrintStream;
+import java.lang.reflect.Method;
+
+/**
+ * ApkfileWorker keeps a JVM resident so apkfile.jar does not pay JVM start up
+ * for every scan. It reads one APK path per line on stdin and answers each with
+ * a header line "OK <length>" or "ERR <length>" followed by exactly <length>
+ * bytes of apkfile JSON (or the error message) on stdout.
+ */
+public class ApkfileWorker {
+    public static void main(String[] args) throws Exception {
+        Method apkfileMain = Class.forName("org.cf.apkfile.Main").getMethod("main", String[].class);
+
+        PrintStream out = System.out;
+        BufferedReader in = new BufferedReader(new InputStreamReader(System.in, "UTF-8"));
+
+        out.print("READY\n");
+        out.flush();
+
+        String path;
+        while ((path = in.readLine()) != null) {
+            ByteArrayOutputStream buf = new ByteArrayOutputStream();
+            String status = "OK";
+
+            System.setOut(new PrintStream(buf, true, "UTF-8"));
+            try {
+                apkfileMain.invoke(null, (Object) new String[] { path });
+            } catch (Throwable t) {
+                Throwable cause = t.getCause() != null ? t.getCause() : t;
+                status = "ERR";
+                buf.reset();
+                buf.write(cause.toString().getBytes("UTF-8"));
+            } finally {
+                System.out.flush();
+                System.setOut(out);
+            }
+
+            byte[] body = buf.toByteArray();
+            out.print(status + " " + body.length + "\n");
+            out.write(body);
+            out.flush();
+        }
+    }
+}